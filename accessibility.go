@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// announcement is the kind of scan mode message, which sets its banner colors
+// in large-print mode
+type announcement int
+
+const (
+	announceInfo announcement = iota
+	announceSuccess
+	announceWarning
+	announceError
+)
+
+// bannerWidth is the width of large-print banners in characters
+const bannerWidth = 64
+
+// announce prints a scan mode message in the configured accessibility mode.
+// standard is the normal console text; plain is a complete sentence without
+// symbols or brackets, used for screen readers and large-print banners.
+// Nothing is printed with JSON logs, whose events stand in for the messages.
+func (options scanOptions) announce(kind announcement, standard, plain string) {
+	if options.jsonLogs() {
+		return
+	}
+	switch options.Accessibility {
+	case "plain":
+		fmt.Println(plain)
+	case "large":
+		printBanner(kind, plain)
+	default:
+		fmt.Println(standard)
+	}
+}
+
+// printBanner prints text in a high-contrast block, letter-spaced and in
+// capitals so it can be read from a distance
+func printBanner(kind announcement, text string) {
+	colors := map[announcement]string{
+		announceInfo:    "\033[1;97;40m", // bold bright white on black
+		announceSuccess: "\033[1;30;102m",
+		announceWarning: "\033[1;30;103m",
+		announceError:   "\033[1;97;41m",
+	}
+
+	var lines []string
+	for _, line := range wrapWords(strings.ToUpper(text), bannerWidth/2-2) {
+		lines = append(lines, spaceLetters(line))
+	}
+
+	blank := strings.Repeat(" ", bannerWidth)
+	fmt.Println()
+	fmt.Println(colors[kind] + blank + "\033[0m")
+	for _, line := range lines {
+		padding := max(bannerWidth-displayWidth(line), 0)
+		left := padding / 2
+		fmt.Println(colors[kind] + strings.Repeat(" ", left) + line + strings.Repeat(" ", padding-left) + "\033[0m")
+	}
+	fmt.Println(colors[kind] + blank + "\033[0m")
+	fmt.Println()
+}
+
+// wrapWords splits text into lines of at most width characters, breaking on
+// spaces where possible
+func wrapWords(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for len([]rune(word)) > width {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			lines = append(lines, string([]rune(word)[:width]))
+			word = string([]rune(word)[width:])
+		}
+		if line == "" {
+			line = word
+		} else if len([]rune(line))+1+len([]rune(word)) <= width {
+			line += " " + word
+		} else {
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// spokenText rewrites symbols that screen readers announce awkwardly.
+// Exclamation marks are left alone, as readers pause on them as on a full
+// stop, and turning "Welcome!." into ".." would be read out as dots.
+func spokenText(text string) string {
+	return strings.ReplaceAll(text, "#", "number ")
+}
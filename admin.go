@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxPhotoSize is the largest member photo the admin page accepts
+const maxPhotoSize = 5 << 20
+
+// photoTypes are the image types accepted as member photos, with the
+// extension each is saved under
+var photoTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// adminManagedColumns are the roster columns the admin page sets through its
+// own controls rather than the member form
+var adminManagedColumns = []string{"id", "family", "caregivers", "active", "photo"}
+
+// rosterAdmin is the server's roster administration page at /admin, where
+// staff add, edit and deactivate members, link families and caregivers and
+// upload photos without editing the roster file on the station. Photos are
+// saved in a photos directory next to the roster, named by ID, with their
+// path in the roster's photo column.
+type rosterAdmin struct {
+	rosterFile string
+	readOnly   bool
+	mu         sync.Mutex // one roster change at a time
+}
+
+// register adds the admin pages to the server. They need an admin API token,
+// entered in the browser as the password when it asks, and are off until one
+// is configured, since without tokens anyone on the network could edit the
+// roster.
+func (a *rosterAdmin) register(mux *http.ServeMux, cfg config) {
+	guard := func(handler http.HandlerFunc) http.HandlerFunc {
+		return cfg.requireToken(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				if a.readOnly {
+					http.Error(w, "the server is read-only", http.StatusForbidden)
+					return
+				}
+				if !sameOrigin(r) {
+					http.Error(w, "cross-site request refused", http.StatusForbidden)
+					return
+				}
+			}
+			handler(w, r)
+		})
+	}
+	mux.HandleFunc("/admin", guard(a.handlePage))
+	mux.HandleFunc("/admin/member", guard(a.handleMember))
+	mux.HandleFunc("/admin/active", guard(a.handleActive))
+	mux.HandleFunc("/admin/link", guard(a.handleLink))
+	mux.HandleFunc("/admin/photo", guard(a.handlePhoto))
+}
+
+// sameOrigin reports whether a form post came from a page on this server, so
+// another site can't make an admin's browser post to it. Requests without an
+// Origin or Referer, from scripts rather than browsers, are let through.
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+	u, err := url.Parse(source)
+	return err == nil && u.Host == r.Host
+}
+
+// table reads the roster for editing, starting an empty one when there is no
+// roster file yet
+func (a *rosterAdmin) table() (*rosterTable, error) {
+	table, err := readRosterTable(a.rosterFile)
+	if os.IsNotExist(err) {
+		return &rosterTable{header: []string{"id", "name"}}, nil
+	}
+	return table, err
+}
+
+// change applies edit to the roster and saves it, then sends the browser back
+// to the page with edit's message or error
+func (a *rosterAdmin) change(w http.ResponseWriter, r *http.Request, edit func(*rosterTable) (string, error)) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	table, err := a.table()
+	message := ""
+	if err == nil {
+		message, err = edit(table)
+	}
+	if err == nil {
+		err = table.write(a.rosterFile)
+	}
+	if err != nil {
+		message = "Error: " + err.Error()
+	} else {
+		fmt.Println("Roster admin:", message)
+	}
+	http.Redirect(w, r, "/admin?msg="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+// adminMember is one row of the admin page's member table
+type adminMember struct {
+	ID, Name, Type     string
+	Family, Caregivers string
+	Active, HasPhoto   bool
+}
+
+// adminField is one input of the member form
+type adminField struct {
+	Column, Value string
+}
+
+// adminPage is the data for the admin page template
+type adminPage struct {
+	Message  string
+	Query    string
+	Members  []adminMember
+	Editing  string
+	Fields   []adminField
+	ReadOnly bool
+}
+
+// handlePage shows the roster, filtered by the q parameter, with the member
+// form filled in for the member in the edit parameter
+func (a *rosterAdmin) handlePage(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	table, err := a.table()
+	a.mu.Unlock()
+	if err != nil {
+		http.Error(w, "error reading roster: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page := adminPage{Message: r.URL.Query().Get("msg"), Query: r.URL.Query().Get("q"), ReadOnly: a.readOnly}
+	query := strings.ToLower(page.Query)
+	for _, row := range table.rows {
+		member := adminMember{
+			ID:         table.get(row, "id"),
+			Name:       table.get(row, "name"),
+			Type:       table.get(row, "type"),
+			Family:     table.get(row, "family"),
+			Caregivers: strings.ReplaceAll(table.get(row, "caregivers"), ";", ", "),
+			Active:     rosterActive(rosterEntry{Fields: map[string]string{"active": table.get(row, "active")}}),
+			HasPhoto:   table.get(row, "photo") != "",
+		}
+		if member.ID == "" || (query != "" && !strings.Contains(strings.ToLower(member.Name), query) && !strings.Contains(member.ID, query)) {
+			continue
+		}
+		page.Members = append(page.Members, member)
+	}
+	sort.Slice(page.Members, func(i, j int) bool {
+		if page.Members[i].Name != page.Members[j].Name {
+			return page.Members[i].Name < page.Members[j].Name
+		}
+		return page.Members[i].ID < page.Members[j].ID
+	})
+
+	var editing []string
+	if id := r.URL.Query().Get("edit"); id != "" {
+		if editing = table.row(id); editing != nil {
+			page.Editing = id
+		}
+	}
+	for _, column := range table.header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if column == "" || contains(adminManagedColumns, column) {
+			continue
+		}
+		field := adminField{Column: column}
+		if editing != nil {
+			field.Value = table.get(editing, column)
+		}
+		page.Fields = append(page.Fields, field)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	adminTemplate.Execute(w, page)
+}
+
+// handleMember adds a member, or saves the form's fields for an existing one
+// when editing
+func (a *rosterAdmin) handleMember(w http.ResponseWriter, r *http.Request) {
+	a.change(w, r, func(table *rosterTable) (string, error) {
+		id := strings.TrimSpace(r.FormValue("id"))
+		editing := r.FormValue("editing") != ""
+		if !barcodePattern.MatchString(id) {
+			return "", fmt.Errorf("ID %q is not a numeric badge ID", id)
+		}
+		exists := table.row(id) != nil
+		if editing && !exists {
+			return "", fmt.Errorf("ID %s is not on the roster", id)
+		}
+		if !editing && exists {
+			return "", fmt.Errorf("ID %s is already on the roster", id)
+		}
+		if !exists {
+			row := make([]string, len(table.header))
+			row[table.column("id")] = id
+			table.rows = append(table.rows, row)
+		}
+		for _, column := range table.header {
+			column = strings.ToLower(strings.TrimSpace(column))
+			if values, ok := r.PostForm["col."+column]; ok && !contains(adminManagedColumns, column) {
+				table.set(id, column, strings.TrimSpace(values[0]))
+			}
+		}
+		if editing {
+			return "Saved " + id + ".", nil
+		}
+		return "Added " + id + ".", nil
+	})
+}
+
+// handleActive deactivates or reactivates a member. Deactivated members stay
+// on the roster, so their history keeps its names, but can't check in.
+func (a *rosterAdmin) handleActive(w http.ResponseWriter, r *http.Request) {
+	a.change(w, r, func(table *rosterTable) (string, error) {
+		id := r.FormValue("id")
+		if table.row(id) == nil {
+			return "", fmt.Errorf("ID %s is not on the roster", id)
+		}
+		if r.FormValue("active") == "true" {
+			table.set(id, "active", "")
+			return "Reactivated " + id + ".", nil
+		}
+		table.set(id, "active", "false")
+		return "Deactivated " + id + ".", nil
+	})
+}
+
+// handleLink links or unlinks families and caregivers as -link and -unlink
+// do
+func (a *rosterAdmin) handleLink(w http.ResponseWriter, r *http.Request) {
+	a.change(w, r, func(table *rosterTable) (string, error) {
+		ids := splitIDs(r.FormValue("ids"))
+		if r.FormValue("action") == "unlink" {
+			return table.unlink(r.FormValue("relation"), ids)
+		}
+		return table.link(r.FormValue("relation"), ids)
+	})
+}
+
+// handlePhoto serves a member's photo, or with a POST saves an uploaded one
+func (a *rosterAdmin) handlePhoto(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		a.mu.Lock()
+		table, err := a.table()
+		a.mu.Unlock()
+		if err != nil {
+			http.Error(w, "error reading roster", http.StatusInternalServerError)
+			return
+		}
+		row := table.row(r.URL.Query().Get("id"))
+		if row == nil || table.get(row, "photo") == "" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join(filepath.Dir(a.rosterFile), filepath.Clean(table.get(row, "photo"))))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPhotoSize+1<<20)
+	a.change(w, r, func(table *rosterTable) (string, error) {
+		id := r.FormValue("id")
+		if table.row(id) == nil || !barcodePattern.MatchString(id) {
+			return "", fmt.Errorf("ID %s is not on the roster", id)
+		}
+		upload, _, err := r.FormFile("photo")
+		if err != nil {
+			return "", fmt.Errorf("no photo was uploaded")
+		}
+		defer upload.Close()
+		data, err := io.ReadAll(io.LimitReader(upload, maxPhotoSize+1))
+		if err != nil {
+			return "", err
+		}
+		if len(data) > maxPhotoSize {
+			return "", fmt.Errorf("photos must be under %d MB", maxPhotoSize>>20)
+		}
+		ext, ok := photoTypes[http.DetectContentType(data)]
+		if !ok {
+			return "", fmt.Errorf("photos must be JPEG, PNG, GIF or WebP images")
+		}
+
+		dir := filepath.Join(filepath.Dir(a.rosterFile), "photos")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+		name := filepath.Join(dir, id+ext)
+		if err := writeFileAtomic(name, data, 0644); err != nil {
+			return "", err
+		}
+		// A photo of another type replaces the old one
+		for _, other := range photoTypes {
+			if other != ext {
+				os.Remove(filepath.Join(dir, id+other))
+			}
+		}
+		table.set(id, "photo", filepath.ToSlash(filepath.Join("photos", id+ext)))
+		return "Saved the photo for " + id + ".", nil
+	})
+}
+
+// adminTemplate renders the roster administration page
+var adminTemplate = template.Must(template.ParseFS(assets, "assets/admin.html"))
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMinCount is the smallest count an aggregate export shows as it is;
+// smaller ones are written as "<5"
+const defaultMinCount = 5
+
+// aggregateDimensions are what an aggregate export can count check-ins by,
+// besides field.<name> for a roster column
+var aggregateDimensions = []string{"date", "week", "month", "weekday", "hour", "type"}
+
+// identifyingFields are roster columns that name or reach one person, so
+// counting by them would give away each person's attendance
+var identifyingFields = []string{"id", "name", "name_latin", "email", "phone", "badges", "replaced_by", "caregivers", "family"}
+
+// parseAggregate parses a comma-separated list of aggregate dimensions, such
+// as "month,type"
+func parseAggregate(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var dimensions []string
+	for _, dimension := range strings.Split(list, ",") {
+		dimension = strings.ToLower(strings.TrimSpace(dimension))
+		field, isField := strings.CutPrefix(dimension, "field.")
+		if !contains(aggregateDimensions, dimension) && (!isField || field == "") {
+			return nil, fmt.Errorf("unknown aggregate %q (available: date, week, month, weekday, hour, type, field.<roster column>)", dimension)
+		}
+		if isField && contains(identifyingFields, field) {
+			return nil, fmt.Errorf("aggregate %q would identify people; count by a group column instead", dimension)
+		}
+		dimensions = append(dimensions, dimension)
+	}
+	return dimensions, nil
+}
+
+// aggregateRows counts the check-ins among records, and the people making
+// them, for each combination of the dimensions, for sharing usage without
+// anyone's attendance. A cell with fewer than minCount people has its people
+// written as "<minCount" and its check-ins as "suppressed", so no cell shows
+// how often a few people came; there are no totals, which would give away the
+// suppressed cells. Combinations without check-ins are left out.
+func aggregateRows(records [][]string, dimensions []string, roster map[string]rosterEntry, minCount int, location *time.Location) [][]string {
+	type cell struct {
+		values  []string
+		order   string
+		checkIn int
+		people  map[string]bool
+	}
+	holders := badgeHolders(roster)
+	cells := make(map[string]*cell)
+	for _, record := range records {
+		t, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+		if err != nil || recordDirection(record) != "in" {
+			continue
+		}
+		t = t.In(location)
+		values := make([]string, len(dimensions))
+		var order []string
+		for i, dimension := range dimensions {
+			sortKey := ""
+			switch dimension {
+			case "date":
+				values[i] = t.Format("2006-01-02")
+			case "week":
+				year, week := t.ISOWeek()
+				values[i] = fmt.Sprintf("%d-W%02d", year, week)
+			case "month":
+				values[i] = t.Format("2006-01")
+			case "weekday":
+				// Monday first, as ISO weeks are
+				values[i], sortKey = t.Weekday().String(), strconv.Itoa((int(t.Weekday())+6)%7)
+			case "hour":
+				values[i] = t.Format("15") + ":00"
+			case "type":
+				values[i] = recordType(record)
+			default:
+				values[i] = roster[holder(holders, record[1])].Fields[strings.TrimPrefix(dimension, "field.")]
+			}
+			if sortKey == "" {
+				sortKey = values[i]
+			}
+			order = append(order, sortKey)
+		}
+		key := strings.Join(values, "\x00")
+		c := cells[key]
+		if c == nil {
+			c = &cell{values: values, order: strings.Join(order, "\x00"), people: make(map[string]bool)}
+			cells[key] = c
+		}
+		c.checkIn++
+		c.people[holder(holders, record[1])] = true
+	}
+
+	var sorted []*cell
+	for _, c := range cells {
+		sorted = append(sorted, c)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].order < sorted[j].order })
+	rows := [][]string{append(append([]string{}, dimensions...), "check_ins", "people")}
+	for _, c := range sorted {
+		checkIns, people := strconv.Itoa(c.checkIn), strconv.Itoa(len(c.people))
+		if len(c.people) < minCount {
+			checkIns, people = "suppressed", "<"+strconv.Itoa(minCount)
+		}
+		rows = append(rows, append(append([]string{}, c.values...), checkIns, people))
+	}
+	return rows
+}
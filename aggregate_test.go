@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAggregateSuppressesSinglePersonCells(t *testing.T) {
+	var records [][]string
+	// One person checking in every day of a month is 20 check-ins but one person
+	for day := 1; day <= 20; day++ {
+		records = append(records, []string{time.Date(2026, 3, day, 9, 0, 0, 0, time.UTC).Format("2006-01-02T15:04:05-07:00"), "1001", "", "", "in", "staff"})
+	}
+	for i := 0; i < 6; i++ {
+		records = append(records, []string{"2026-03-02T10:00:00+00:00", string(rune('a' + i)), "", "", "in", "member"})
+	}
+	rows := aggregateRows(records, []string{"month", "type"}, nil, 5, time.UTC)
+	want := [][]string{
+		{"month", "type", "check_ins", "people"},
+		{"2026-03", "member", "6", "6"},
+		{"2026-03", "staff", "suppressed", "<5"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %v, want %v", rows, want)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if rows[i][j] != want[i][j] {
+				t.Errorf("row %d: got %v, want %v", i, rows[i], want[i])
+				break
+			}
+		}
+	}
+}
+
+func TestParseAggregateRejectsIdentifyingFields(t *testing.T) {
+	for _, list := range []string{"field.id", "month,field.name", "field.Email"} {
+		if _, err := parseAggregate(list); err == nil {
+			t.Errorf("%q: no error", list)
+		}
+	}
+	if _, err := parseAggregate("month,field.group"); err != nil {
+		t.Errorf("field.group: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// includeArchives is set by -include-archives to have the modes that read
+// the records start with the archived ones
+var includeArchives bool
+
+// archiveFile returns the compressed file holding the archived records from
+// t's month, e.g. scans.archive-2024-09.csv.gz for scans.csv
+func archiveFile(t time.Time) string {
+	ext := filepath.Ext(dataFile)
+	return strings.TrimSuffix(dataFile, ext) + ".archive-" + t.Format("2006-01") + ext + ".gz"
+}
+
+// archiveFiles returns the archive files, oldest month first
+func archiveFiles() ([]string, error) {
+	ext := filepath.Ext(dataFile)
+	return filepath.Glob(strings.TrimSuffix(dataFile, ext) + ".archive-[0-9][0-9][0-9][0-9]-[0-9][0-9]" + ext + ".gz")
+}
+
+// archiveRecords moves the records from before cutoff out of the data files
+// into a compressed archive file per month and returns how many were moved.
+// Archiving a month again adds another gzip member to its file, which reads
+// back as one stream. The archives are written before the data files are
+// rewritten, so a failure never loses records.
+func archiveRecords(cutoff time.Time) (int, error) {
+	records, sources, err := readDataFile()
+	if err != nil {
+		return 0, err
+	}
+
+	var kept [][]string
+	var keptSources []string
+	months := make(map[string][][]string)
+	for i, record := range records {
+		recordTime, err := time.ParseInLocation("2006-01-02T15:04:05-07:00", record[0], time.Local)
+		if len(record) < 2 || err != nil || !recordTime.Before(cutoff) {
+			kept = append(kept, record)
+			keptSources = append(keptSources, sources[i])
+			continue
+		}
+		name := archiveFile(recordTime.In(time.Local))
+		months[name] = append(months[name], record)
+	}
+	if len(months) == 0 {
+		return 0, nil
+	}
+
+	var names []string
+	for name := range months {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	archived := 0
+	for _, name := range names {
+		if err := appendArchive(name, months[name]); err != nil {
+			return 0, fmt.Errorf("writing %s: %w", name, err)
+		}
+		archived += len(months[name])
+	}
+
+	if err := rewriteDataFile(kept, keptSources); err != nil {
+		return 0, fmt.Errorf("records were archived but the data file was not rewritten, so they are now in both: %w", err)
+	}
+	return archived, nil
+}
+
+// appendArchive adds records to an archive file as a new gzip member
+func appendArchive(name string, records [][]string) error {
+	if err := journalFile(name); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	compressed := gzip.NewWriter(file)
+	writer := newDataWriter(compressed)
+	writer.WriteAll(records)
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := compressed.Close(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// runArchiveMode archives the records from before the given date
+// (YYYY-MM-DD or a relative keyword such as last-90-days, whose first day is
+// the cutoff). checksummed is set when records carry a checksum.
+func runArchiveMode(before string, checksummed bool) {
+	cutoff, err := archiveCutoff(before, time.Now())
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	archived, err := archiveRecords(cutoff)
+	if err != nil {
+		fmt.Println("Error archiving records:", err)
+		return
+	}
+	if archived == 0 {
+		fmt.Printf("No records from before %s to archive.\n", cutoff.Format("2006-01-02"))
+		return
+	}
+	fmt.Printf("Archived %d records from before %s. Use -include-archives to read them.\n", archived, cutoff.Format("2006-01-02"))
+	if checksummed {
+		fmt.Println("Note: Run -verify with -include-archives, since the checksum chain starts in the archives.")
+	}
+}
+
+// archiveCutoff resolves an archive date to the start of that day
+func archiveCutoff(before string, now time.Time) (time.Time, error) {
+	if start, _, ok := relativeRange(before, now); ok {
+		before = start
+	}
+	cutoff, err := time.ParseInLocation("2006-01-02", before, time.Local)
+	if err != nil {
+		return cutoff, fmt.Errorf("invalid archive date %q, expected YYYY-MM-DD or a keyword such as last-90-days", before)
+	}
+	return cutoff, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultArrivalWindow is how long the arrival rate is averaged over when the
+// config doesn't say
+const defaultArrivalWindow = 5 * time.Minute
+
+// arrivalRateConfig is the config file's "arrival_rate" section: the
+// check-ins a minute at a station that mean the line is backing up, so
+// supervisors can open a second lane before the lobby fills
+type arrivalRateConfig struct {
+	PerMinute float64  `json:"per_minute"` // alert when check-ins arrive faster than this; 0 disables the alerts
+	Window    duration `json:"window"`     // the rate is averaged over this long; default 5m
+	Sound     string   `json:"sound"`      // played with sound_command when the rate goes over
+	Webhook   string   `json:"webhook"`    // Slack-compatible incoming webhook URL
+}
+
+// window returns how long the rate is averaged over
+func (settings arrivalRateConfig) window() time.Duration {
+	if settings.Window > 0 {
+		return time.Duration(settings.Window)
+	}
+	return defaultArrivalWindow
+}
+
+// high reports whether a rate is over the alert threshold
+func (settings arrivalRateConfig) high(rate float64) bool {
+	return settings.PerMinute > 0 && rate > settings.PerMinute
+}
+
+// arrivalCounter keeps the times of the latest scans to work out the rate
+// they arrive at over a window
+type arrivalCounter struct {
+	window time.Duration
+	times  []time.Time
+}
+
+// add counts a scan at t
+func (c *arrivalCounter) add(t time.Time) {
+	c.times = append(c.times, t)
+}
+
+// rate returns the scans a minute over the window before now, dropping the
+// scans that have left it
+func (c *arrivalCounter) rate(now time.Time) float64 {
+	for len(c.times) > 0 && now.Sub(c.times[0]) > c.window {
+		c.times = c.times[1:]
+	}
+	return float64(len(c.times)) / c.window.Minutes()
+}
+
+// arrivalMonitor tracks whether check-ins are arriving faster than the
+// threshold between scans
+type arrivalMonitor struct {
+	settings arrivalRateConfig
+	arrivals arrivalCounter
+	high     bool
+	peak     float64
+}
+
+// newArrivalMonitor returns a monitor for the settings
+func newArrivalMonitor(settings arrivalRateConfig) *arrivalMonitor {
+	return &arrivalMonitor{settings: settings, arrivals: arrivalCounter{window: settings.window()}}
+}
+
+// update counts a check-in. Going over the threshold shows a banner, plays
+// the alert sound and posts to the webhook; the banner is shown again on
+// every check-in while the rate stays high, and the first check-in after it
+// drops back posts that the line has eased with the peak rate. Dry runs only
+// show the warning.
+func (m *arrivalMonitor) update(options scanOptions, now time.Time) {
+	if m.settings.PerMinute <= 0 {
+		return
+	}
+	m.arrivals.add(now)
+	rate := m.arrivals.rate(now)
+	minutes := int(m.settings.window().Minutes())
+
+	if m.settings.high(rate) {
+		m.peak = max(m.peak, rate)
+		text := fmt.Sprintf("Arrivals are backing up: %.1f check-ins a minute over the last %d minutes, the alert is at %.1f. Open another check-in lane",
+			rate, minutes, m.settings.PerMinute)
+		if options.Station != "" {
+			text = options.Station + ": " + text
+		}
+		if options.Accessibility == "plain" {
+			fmt.Println(text + ".")
+		} else {
+			printBanner(announceWarning, text)
+		}
+		if m.high {
+			return
+		}
+		m.high = true
+		playSound(options.SoundCommand, m.settings.Sound)
+		if !options.DryRun {
+			m.notify(text + ".")
+		}
+		return
+	}
+
+	if m.high {
+		m.high = false
+		if !options.DryRun {
+			text := fmt.Sprintf("Arrivals have eased: %.1f check-ins a minute over the last %d minutes. The peak was %.1f.", rate, minutes, m.peak)
+			if options.Station != "" {
+				text = options.Station + ": " + text
+			}
+			m.notify(text)
+		}
+		m.peak = 0
+	}
+}
+
+// notify posts text to the arrival rate webhook through the delivery queue
+func (m *arrivalMonitor) notify(text string) {
+	if m.settings.Webhook == "" {
+		return
+	}
+	body, _ := json.Marshal(map[string]string{"text": text})
+	req, err := http.NewRequest("POST", m.settings.Webhook, bytes.NewReader(body))
+	if err != nil {
+		fmt.Println("Error posting arrival rate alert:", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	queueRequest("arrival rate webhook", req)
+}
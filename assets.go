@@ -0,0 +1,69 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// assets holds the web pages, report templates and built-in sounds, so a
+// station runs from the binary alone with nothing to copy next to it
+//
+//go:embed assets
+var assets embed.FS
+
+// builtinSound returns the embedded path of a built-in sound, e.g.
+// success.wav, duplicate.wav or alert.wav, or "" when name isn't one
+func builtinSound(name string) string {
+	embedded := path.Join("assets/sounds", name)
+	if name == "" || path.Base(name) != name {
+		return ""
+	}
+	if _, err := fs.Stat(assets, embedded); err != nil {
+		return ""
+	}
+	return embedded
+}
+
+// soundPath returns the file to play for a theme or alert sound: the file
+// itself when it exists, and for a built-in sound's name without one a copy
+// extracted to the temporary directory, as sound commands need a file
+func soundPath(name string) string {
+	if _, err := os.Stat(name); err == nil {
+		return name
+	}
+	embedded := builtinSound(name)
+	if embedded == "" {
+		return name
+	}
+	extracted := filepath.Join(os.TempDir(), "checkin-sounds", name)
+	if _, err := os.Stat(extracted); err == nil {
+		return extracted
+	}
+	data, err := assets.ReadFile(embedded)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(extracted), 0755)
+	}
+	if err == nil {
+		err = writeFileAtomic(extracted, data, 0644)
+	}
+	if err != nil {
+		return name
+	}
+	return extracted
+}
+
+// serveSound serves a theme sound file, or the built-in sound of that name
+// when there is no such file
+func serveSound(w http.ResponseWriter, r *http.Request, name string) {
+	if _, err := os.Stat(name); err != nil {
+		if embedded := builtinSound(name); embedded != "" {
+			http.ServeFileFS(w, r, assets, embedded)
+			return
+		}
+	}
+	http.ServeFile(w, r, name)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// runAttendanceMode saves the roster's attendance from first to last
+// (YYYY-MM-DD, inclusive) as a matrix with a row per roster member, a column
+// per date and present or absent in each cell, the sheet teachers otherwise
+// fill in by hand. Each row ends with the number of days present. Closure
+// days are marked closed for everyone. The sheet is saved as a CSV in dir and
+// shown in short form, P for present and - for closed. A reissued badge's
+// check-ins count for its holder's current badge.
+func runAttendanceMode(roster map[string]rosterEntry, closures []closureConfig, first, last, dir string) {
+	if len(roster) == 0 {
+		fmt.Println("Error: -attendance needs a -roster to list people by.")
+		return
+	}
+	start, err := time.ParseInLocation("2006-01-02", first, time.Local)
+	if err != nil {
+		fmt.Println("Error parsing start date:", err)
+		return
+	}
+	end, err := time.ParseInLocation("2006-01-02", last, time.Local)
+	if err != nil {
+		fmt.Println("Error parsing end date:", err)
+		return
+	}
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+
+	var dates []string
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		dates = append(dates, day.Format("2006-01-02"))
+	}
+	rows := attendanceSheet(records, roster, badgeHolders(roster), closures, dates)
+
+	fmt.Printf("Attendance %s to %s (%d days)\n\n", first, last, len(dates))
+	for _, row := range rows[1:] {
+		short := make([]byte, len(dates))
+		for i, cell := range row[2 : 2+len(dates)] {
+			short[i] = attendanceMarks[cell]
+		}
+		fmt.Printf("  %-12s %-28s %s %s\n", row[0], row[1], short, row[len(row)-1])
+	}
+
+	filename := "attendance_" + first + "_" + last + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving attendance sheet:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving attendance sheet:", err)
+		return
+	}
+	fmt.Println("\nSaved to", filename)
+}
+
+// attendanceMarks are the short form of the attendance sheet's cells
+var attendanceMarks = map[string]byte{"present": 'P', "absent": '.', "closed": '-'}
+
+// attendanceSheet returns the attendance matrix of the people on the dates
+// (YYYY-MM-DD) in the records: a header row, then a row per person sorted by
+// name. Scans of a reissued badge count for the badge its holder has now,
+// which is the only row the person gets.
+func attendanceSheet(records [][]string, people map[string]rosterEntry, holders map[string]string, closures []closureConfig, dates []string) [][]string {
+	rows := [][]string{append(append([]string{"id", "name"}, dates...), "days_present")}
+	if len(dates) == 0 {
+		return rows
+	}
+	first, last := dates[0], dates[len(dates)-1]
+	present := make(map[string]bool) // by "id date"
+	for _, record := range records {
+		date := record[0][:10]
+		if recordDirection(record) == "in" && date >= first && date <= last {
+			present[holder(holders, record[1])+" "+date] = true
+		}
+	}
+
+	ids := make([]string, 0, len(people))
+	for id := range people {
+		if _, reissued := holders[id]; !reissued {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if people[ids[i]].Name != people[ids[j]].Name {
+			return people[ids[i]].Name < people[ids[j]].Name
+		}
+		return ids[i] < ids[j]
+	})
+
+	for _, id := range ids {
+		row := []string{id, people[id].Name}
+		days := 0
+		for _, date := range dates {
+			if _, closed := closureOn(closures, date); closed && !present[id+" "+date] {
+				row = append(row, "closed")
+			} else if present[id+" "+date] {
+				row = append(row, "present")
+				days++
+			} else {
+				row = append(row, "absent")
+			}
+		}
+		rows = append(rows, append(row, strconv.Itoa(days)))
+	}
+	return rows
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// badgeConfig is the config file's "badges" section. Badge history lives in
+// the roster: issued is the date (YYYY-MM-DD) a badge was handed out,
+// badge_status is lost or expired once it is out of use, and replaced_by and
+// replaces link a reissued badge to the one before it, so the person's old
+// scans still count as theirs.
+type badgeConfig struct {
+	ValidDays int `json:"valid_days"` // badges issued longer ago are refused as expired; 0 never expires them
+}
+
+// badgeReasons are why a badge is taken out of use
+var badgeReasons = []string{"lost", "expired"}
+
+// expires returns the date (YYYY-MM-DD) a badge issued on issued stops being
+// valid, or "" when badges don't expire or the issue date is unknown
+func (settings badgeConfig) expires(issued string) string {
+	day, err := time.ParseInLocation("2006-01-02", issued, time.Local)
+	if settings.ValidDays <= 0 || err != nil {
+		return ""
+	}
+	return day.AddDate(0, 0, settings.ValidDays).Format("2006-01-02")
+}
+
+// badgeProblem returns why a roster member's badge may not check in at t: it
+// was reported lost or expired, or is older than valid_days. It returns ""
+// for a badge in use.
+func (settings badgeConfig) badgeProblem(entry rosterEntry, t time.Time) string {
+	if status := entry.Fields["badge_status"]; status != "" {
+		if replacement := entry.Fields["replaced_by"]; replacement != "" {
+			return fmt.Sprintf("badge reported %s and replaced by %s", status, replacement)
+		}
+		return "badge reported " + status
+	}
+	if expires := settings.expires(entry.Fields["issued"]); expires != "" && t.Format("2006-01-02") >= expires {
+		return "badge expired on " + expires
+	}
+	return ""
+}
+
+// badgeHolders maps each reissued badge on the roster to the badge its holder
+// carries now, following replaced_by through every reissue. Reports count a
+// person's scans under their current badge with it.
+func badgeHolders(roster map[string]rosterEntry) map[string]string {
+	holders := make(map[string]string)
+	for id := range roster {
+		current := id
+		seen := map[string]bool{id: true}
+		for next := roster[current].Fields["replaced_by"]; next != "" && !seen[next]; next = roster[current].Fields["replaced_by"] {
+			seen[next] = true
+			current = next
+		}
+		if current != id {
+			holders[id] = current
+		}
+	}
+	return holders
+}
+
+// holder returns the badge currently carried by whoever scanned id
+func holder(holders map[string]string, id string) string {
+	if current, ok := holders[id]; ok {
+		return current
+	}
+	return id
+}
+
+// runRetireBadgeMode marks a badge lost or expired and deactivates it, so scan
+// mode refuses it with the reason
+func runRetireBadgeMode(rosterFile, id, reason string) {
+	table, err := readRosterTable(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+	if err := table.retire(id, reason, ""); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if err := table.write(rosterFile); err != nil {
+		fmt.Println("Error writing roster:", err)
+		return
+	}
+	fmt.Printf("Marked badge %s as %s; scans of it are refused. Give its holder a new badge with -reissue=%s,<new id>.\n", id, reason, id)
+}
+
+// runReissueMode gives the holder of a lost or expired badge a new one: the
+// new ID is added to the roster with the old badge's details, issued today
+// and linked to it, and the old badge is marked with the reason and
+// deactivated. Earlier scans of the old badge still count for the person.
+func runReissueMode(rosterFile string, ids []string, reason string, now time.Time) {
+	if len(ids) != 2 {
+		fmt.Println("Error: -reissue takes the old badge ID and the new one, e.g. -reissue=1001,1042.")
+		return
+	}
+	oldID, newID := ids[0], ids[1]
+	table, err := readRosterTable(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+	if table.row(newID) != nil {
+		fmt.Printf("Error: ID %s is already on the roster.\n", newID)
+		return
+	}
+	old := table.row(oldID)
+	if err := table.retire(oldID, reason, newID); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	row := append([]string(nil), old...)
+	for len(row) < len(table.header) {
+		row = append(row, "")
+	}
+	row[table.column("id")] = newID
+	table.rows = append(table.rows, row)
+	table.set(newID, "issued", now.Format("2006-01-02"))
+	table.set(newID, "replaces", oldID)
+	for _, column := range []string{"badge_status", "replaced_by", "active"} {
+		if table.column(column) >= 0 {
+			table.set(newID, column, "")
+		}
+	}
+
+	if err := table.write(rosterFile); err != nil {
+		fmt.Println("Error writing roster:", err)
+		return
+	}
+	name := table.get(old, "name")
+	if name == "" {
+		name = "its holder"
+	}
+	fmt.Printf("Reissued badge %s (%s) as %s; the old badge is marked %s and refused, and its scans count under %s.\n", oldID, name, newID, reason, newID)
+}
+
+// retire marks the ID's badge with the reason, and the badge replacing it if
+// any, and deactivates it
+func (t *rosterTable) retire(id, reason, replacement string) error {
+	if !contains(badgeReasons, reason) {
+		return fmt.Errorf("badge reason must be %s, not %q", strings.Join(badgeReasons, " or "), reason)
+	}
+	row := t.row(id)
+	if row == nil {
+		return fmt.Errorf("ID %s is not on the roster", id)
+	}
+	if replacement != "" && t.get(row, "replaced_by") != "" {
+		return fmt.Errorf("badge %s was already replaced by %s", id, t.get(row, "replaced_by"))
+	}
+	t.set(id, "badge_status", reason)
+	t.set(id, "active", "false")
+	if replacement != "" {
+		t.set(id, "replaced_by", replacement)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runBundleMode saves the packet put together after an event as one zip in
+// dir, named after the event and dates: the event's records from first to
+// last (YYYY-MM-DD, inclusive) as stored, a summary sheet, the no-shows with
+// their contact fields and the sign-in matrix of everyone expected. Expected
+// people are the event's registrations when it has a list, and otherwise
+// everyone on the roster. With tags, only the records with at least one of
+// them are the event's.
+func runBundleMode(event string, expected, roster map[string]rosterEntry, cfg config, tagFilter []string, first, last, dir string) {
+	start, err := time.ParseInLocation("2006-01-02", first, time.Local)
+	if err != nil {
+		fmt.Println("Error parsing start date:", err)
+		return
+	}
+	end, err := time.ParseInLocation("2006-01-02", last, time.Local)
+	if err != nil {
+		fmt.Println("Error parsing end date:", err)
+		return
+	}
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+	tags, err := loadTags()
+	if err != nil {
+		fmt.Println("Error reading tags:", err)
+		return
+	}
+	var eventRecords [][]string
+	for _, record := range records {
+		if date := record[0][:10]; date >= first && date <= last && (len(tagFilter) == 0 || hasAnyTag(tags, record, tagFilter)) {
+			eventRecords = append(eventRecords, record)
+		}
+	}
+
+	var dates []string
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		dates = append(dates, day.Format("2006-01-02"))
+	}
+	sheet := attendanceSheet(eventRecords, expected, badgeHolders(roster), cfg.Closures, dates)
+	missing := noShows(eventRecords, expected, roster, cfg.ContactFields, first, last)
+	summary := eventSummary(event, eventRecords, first, last, len(sheet)-1, len(missing)-1)
+
+	// The sheets are written to a scratch folder and zipped under their
+	// own names, so the packet opens the same on every machine
+	scratch, err := os.MkdirTemp("", "checkin-bundle")
+	if err != nil {
+		fmt.Println("Error saving bundle:", err)
+		return
+	}
+	defer os.RemoveAll(scratch)
+	var files []string
+	for _, part := range []struct {
+		name string
+		rows [][]string
+	}{
+		{"records.csv", eventRecords},
+		{"summary.csv", summary},
+		{"noshows.csv", missing},
+		{"attendance.csv", sheet},
+	} {
+		name := filepath.Join(scratch, part.name)
+		if err := writeCSVExport(name, part.rows, false); err != nil {
+			fmt.Println("Error saving bundle:", err)
+			return
+		}
+		files = append(files, name)
+	}
+
+	filename := bundleName(event) + "_" + first
+	if last != first {
+		filename += "_" + last
+	}
+	filename += ".zip"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving bundle:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := zipFiles(filename, files); err != nil {
+		fmt.Println("Error saving bundle:", err)
+		return
+	}
+
+	for _, row := range summary[1:] {
+		fmt.Printf("  %-24s %s\n", row[0], row[1])
+	}
+	fmt.Printf("\nSaved %s: records.csv (%d records), summary.csv, noshows.csv (%d) and attendance.csv (%d people).\n",
+		filename, len(eventRecords), len(missing)-1, len(sheet)-1)
+}
+
+// eventSummary returns an event's summary sheet as metric,value rows: the
+// event and its dates, how many of the expected people came, the check-ins
+// by record type, the check-outs, the people seen, and the first and last
+// scans
+func eventSummary(event string, records [][]string, first, last string, expected, missing int) [][]string {
+	rows := [][]string{{"metric", "value"}, {"event", event}, {"first_date", first}, {"last_date", last}}
+	attended := expected - missing
+	rows = append(rows, []string{"expected", strconv.Itoa(expected)}, []string{"attended", strconv.Itoa(attended)},
+		[]string{"no_shows", strconv.Itoa(missing)})
+	if expected > 0 {
+		rows = append(rows, []string{"attendance_percent", strconv.Itoa(attended * 100 / expected)})
+	}
+
+	checkIns, checkOuts := make(map[string]int), 0
+	people := make(map[string]bool)
+	firstScan, lastScan := "", ""
+	for _, record := range records {
+		people[record[1]] = true
+		if firstScan == "" || record[0] < firstScan {
+			firstScan = record[0]
+		}
+		if record[0] > lastScan {
+			lastScan = record[0]
+		}
+		if recordDirection(record) == "out" {
+			checkOuts++
+			continue
+		}
+		checkIns[recordType(record)]++
+	}
+	total := 0
+	var types []string
+	for t, n := range checkIns {
+		types = append(types, t)
+		total += n
+	}
+	sort.Strings(types)
+	rows = append(rows, []string{"check_ins", strconv.Itoa(total)})
+	for _, t := range types {
+		rows = append(rows, []string{"check_ins." + t, strconv.Itoa(checkIns[t])})
+	}
+	rows = append(rows, []string{"check_outs", strconv.Itoa(checkOuts)}, []string{"people", strconv.Itoa(len(people))})
+	if firstScan != "" {
+		rows = append(rows, []string{"first_scan", firstScan}, []string{"last_scan", lastScan})
+	}
+	return rows
+}
+
+// bundleName returns an event's name made safe for a file name
+func bundleName(event string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' || r == ':' {
+			return '-'
+		}
+		return r
+	}, event)
+}
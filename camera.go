@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCameraCommand grabs one frame from the first V4L2 webcam. The
+	// photo's path is appended.
+	defaultCameraCommand = "ffmpeg -loglevel error -y -f v4l2 -i /dev/video0 -frames:v 1"
+	// cameraTimeout is how long a capture may take before it is given up
+	cameraTimeout = 10 * time.Second
+	// cameraPruneEvery is how often expired photos are looked for
+	cameraPruneEvery = time.Hour
+)
+
+// cameraConfig is the config file's "camera" section, for the webcam photo
+// -camera takes at each check-in
+type cameraConfig struct {
+	Command   string   `json:"command"`    // run with the photo's path appended; default grabs a frame with ffmpeg
+	Types     []string `json:"types"`      // record types to photograph, e.g. ["visitor"]; empty for all
+	Dir       string   `json:"dir"`        // where photos are kept; default next to the data file, e.g. scans.photos
+	RetainFor duration `json:"retain_for"` // photos older than this are deleted, e.g. "720h"; default kept
+}
+
+// camera takes check-in photos, each saved as <scan ID>.jpg so it can be
+// found from the record. Captures run in the background so a slow webcam
+// doesn't hold up the line.
+type camera struct {
+	settings  cameraConfig
+	running   sync.WaitGroup
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// newCamera returns the camera for scan mode, deleting expired photos
+func newCamera(settings cameraConfig) *camera {
+	if settings.Command == "" {
+		settings.Command = defaultCameraCommand
+	}
+	if settings.Dir == "" {
+		settings.Dir = strings.TrimSuffix(dataFile, filepath.Ext(dataFile)) + ".photos"
+	}
+	c := &camera{settings: settings}
+	c.prune(time.Now())
+	return c
+}
+
+// capture photographs a recorded check-in when its type is one to
+// photograph, reporting failures to report
+func (c *camera) capture(record []string, now time.Time, report func(error)) {
+	scanID := recordScanID(record)
+	if scanID == "" || recordDirection(record) != "in" || (len(c.settings.Types) > 0 && !contains(c.settings.Types, recordType(record))) {
+		return
+	}
+	args := append(strings.Fields(c.settings.Command), filepath.Join(c.settings.Dir, scanID+".jpg"))
+	c.running.Add(1)
+	go func() {
+		defer c.running.Done()
+		c.prune(now)
+		if err := os.MkdirAll(c.settings.Dir, 0700); err != nil {
+			report(err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), cameraTimeout)
+		defer cancel()
+		if output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput(); err != nil {
+			report(fmt.Errorf("%s: %v: %s", args[0], err, strings.TrimSpace(string(output))))
+		}
+	}()
+}
+
+// prune deletes the photos past the retention period, at most hourly
+func (c *camera) prune(now time.Time) {
+	if c.settings.RetainFor <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.lastPrune) < cameraPruneEvery {
+		return
+	}
+	c.lastPrune = now
+	names, _ := filepath.Glob(filepath.Join(c.settings.Dir, "*.jpg"))
+	for _, name := range names {
+		if info, err := os.Stat(name); err == nil && now.Sub(info.ModTime()) > time.Duration(c.settings.RetainFor) {
+			os.Remove(name)
+		}
+	}
+}
+
+// wait blocks until the captures in progress have finished
+func (c *camera) wait() {
+	c.running.Wait()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// capacityConfig is the occupancy ceiling scan mode alerts on, from the config
+// file's "capacity" section
+type capacityConfig struct {
+	Max     int    `json:"max"`     // 0 disables capacity alerts
+	Sound   string `json:"sound"`   // played with sound_command when the ceiling is exceeded
+	Webhook string `json:"webhook"` // Slack-compatible incoming webhook URL
+	Log     string `json:"log"`     // CSV of over-capacity periods, default capacity.csv
+
+	// Waitlist puts check-ins on an ordered waitlist once max people are
+	// inside, instead of letting the building go over capacity
+	Waitlist bool `json:"waitlist"`
+}
+
+// capacityMonitor tracks whether the building is over capacity between scans
+type capacityMonitor struct {
+	settings capacityConfig
+	over     bool
+	peak     int
+}
+
+// newCapacityMonitor returns a monitor for the settings, picking up an
+// over-capacity period left open in the log by an earlier scan session
+func newCapacityMonitor(settings capacityConfig) *capacityMonitor {
+	m := &capacityMonitor{settings: settings}
+	data, err := os.ReadFile(m.logFile())
+	if err != nil {
+		return m
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	rows, _ := reader.ReadAll()
+	if len(rows) > 0 && len(rows[len(rows)-1]) > 2 && rows[len(rows)-1][1] == "over" {
+		m.over = true
+		m.peak, _ = strconv.Atoi(rows[len(rows)-1][2])
+	}
+	return m
+}
+
+// logFile returns the capacity log path
+func (m *capacityMonitor) logFile() string {
+	if m.settings.Log == "" {
+		return "capacity.csv"
+	}
+	return m.settings.Log
+}
+
+// update checks the occupancy after a scan. Going over the ceiling shows a
+// banner, plays the alert sound, posts to the webhook and logs the start of
+// the period; dropping back to the ceiling logs its end with the peak. Dry
+// runs only show the warning.
+func (m *capacityMonitor) update(options scanOptions, occupancy int, now time.Time) {
+	if m.settings.Max <= 0 {
+		return
+	}
+
+	if occupancy > m.settings.Max {
+		if occupancy > m.peak {
+			m.peak = occupancy
+		}
+		text := fmt.Sprintf("Over capacity: %d people inside, the limit is %d", occupancy, m.settings.Max)
+		if options.Accessibility == "plain" {
+			fmt.Println(text + ".")
+		} else {
+			printBanner(announceError, text)
+		}
+		if m.over {
+			return
+		}
+		m.over = true
+		playSound(options.SoundCommand, m.settings.Sound)
+		if !options.DryRun {
+			m.record(now, "over", occupancy)
+			m.notify(text + ".")
+		}
+		return
+	}
+
+	if m.over {
+		m.over = false
+		if !options.DryRun {
+			m.record(now, "under", m.peak)
+			m.notify(fmt.Sprintf("Back under capacity: %d people inside, the limit is %d. The peak was %d.", occupancy, m.settings.Max, m.peak))
+		}
+		m.peak = 0
+	}
+}
+
+// record appends the start ("over", with the occupancy) or end ("under", with
+// the peak occupancy) of an over-capacity period to the capacity log
+func (m *capacityMonitor) record(now time.Time, event string, occupancy int) {
+	file, err := os.OpenFile(m.logFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Println("Error writing capacity log:", err)
+		return
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{now.Format("2006-01-02T15:04:05-07:00"), event, strconv.Itoa(occupancy), strconv.Itoa(m.settings.Max)})
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		fmt.Println("Error writing capacity log:", err)
+	}
+}
+
+// notify posts text to the capacity webhook through the delivery queue, so a
+// slow or unreachable webhook never holds up the scan line or loses the alert
+func (m *capacityMonitor) notify(text string) {
+	if m.settings.Webhook == "" {
+		return
+	}
+	body, _ := json.Marshal(map[string]string{"text": text})
+	req, err := http.NewRequest("POST", m.settings.Webhook, bytes.NewReader(body))
+	if err != nil {
+		fmt.Println("Error posting capacity alert:", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	queueRequest("capacity webhook", req)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCheckMode validates every line of the data file and prints a report of
+// the problems found with their line numbers. It exits with status 1 when any
+// problem is found so it can be used from cron.
+func runCheckMode() {
+	file, err := openDataFiles()
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	problems := checkRecords(file)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+
+	if len(problems) > 0 {
+		fmt.Printf("%d problems found in %s.\n", len(problems), dataName())
+		os.Exit(1)
+	}
+	fmt.Printf("No problems found in %s.\n", dataName())
+}
+
+// checkRecords reads the records line by line and returns a description of
+// each problem, prefixed with its line number
+func checkRecords(r io.Reader) []string {
+	var problems []string
+	report := func(line int, format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+	}
+
+	reader := newDataReader(r)
+
+	seenRows := make(map[string]int)
+	seenScanIDs := make(map[string]int)
+	lastCount := make(map[string]int)
+	var lastTime time.Time
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			report(parseErr.StartLine, "malformed CSV: %v", parseErr.Err)
+			continue
+		} else if err != nil {
+			report(0, "reading CSV: %v", err)
+			break
+		}
+		line, _ := reader.FieldPos(0)
+
+		if len(record) < 3 {
+			report(line, "expected 3 fields, found %d", len(record))
+			continue
+		}
+
+		key := strings.Join(record, ",")
+		if first, ok := seenRows[key]; ok {
+			report(line, "duplicate of line %d", first)
+		} else {
+			seenRows[key] = line
+		}
+		// Exact duplicates are already reported above
+		if scanID := recordScanID(record); scanID != "" {
+			if first, ok := seenScanIDs[scanID]; ok && seenRows[key] != first {
+				report(line, "scan ID %s is already used on line %d", scanID, first)
+			} else if !ok {
+				seenScanIDs[scanID] = line
+			}
+		}
+
+		if !barcodePattern.MatchString(record[1]) {
+			report(line, "ID %q does not match the barcode pattern", record[1])
+		}
+
+		recordTime, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+		if err != nil {
+			report(line, "invalid timestamp %q", record[0])
+			continue
+		}
+		if recordTime.Before(lastTime) {
+			report(line, "timestamp %s is earlier than the previous record", record[0])
+		}
+		lastTime = recordTime
+
+		// Check-outs have no daily count to check
+		if len(record) > 4 && record[4] != "" && record[4] != "in" && record[4] != "out" {
+			report(line, "direction %q must be in or out", record[4])
+			continue
+		}
+		if recordDirection(record) == "out" {
+			continue
+		}
+
+		count, err := strconv.Atoi(record[2])
+		if err != nil {
+			report(line, "invalid daily count %q", record[2])
+			continue
+		}
+		// Each record type is counted separately
+		if len(record) > 5 && record[5] != "" && !contains(recordTypes, record[5]) {
+			report(line, "unknown record type %q", record[5])
+		}
+		date := record[0][:10]
+		countKey := date + " " + recordType(record)
+		if count != lastCount[countKey]+1 {
+			report(line, "daily count %d does not follow %d for %s", count, lastCount[countKey], countKey)
+		}
+		lastCount[countKey] = count
+	}
+
+	return problems
+}
@@ -1,21 +1,153 @@
 package main
 
 import (
-	"encoding/csv"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
-	"strconv"
+	"runtime"
+	"strings"
 	"time"
 )
 
+// dataFile is the CSV file scan mode records to and the other modes read from.
+// A profile can point it elsewhere.
+var dataFile = "scans.csv"
+
+// defaultDedupeWindow is how long scan mode ignores repeat scans of an ID
+const defaultDedupeWindow = 2 * time.Hour
+
+// barcodePattern matches a valid barcode ID
+var barcodePattern = regexp.MustCompile(`^\d+$`)
+
 func main() {
 	// Define command-line flags for the two modes
 	scanMode := flag.Bool("scan", false, "Start barcode scanning mode")
 	exportMode := flag.Bool("export", false, "Export records within a date or date range (format: YYYY-MM-DD)")
 	startDate := flag.String("start", "", "Start date for export (required if using export mode)")
 	endDate := flag.String("end", "", "End date for export (optional, for a date range)")
+	week := flag.String("week", "", "Export an ISO week instead of a start date (format: YYYY-Www)")
+	month := flag.String("month", "", "Export a calendar month instead of a start date (format: YYYY-MM)")
+	format := flag.String("format", "csv", "Comma-separated export file formats: csv, parquet")
+	compress := flag.String("compress", "", "Compress exports with gzip, or bundle them into a zip")
+	filenameTemplate := flag.String("filename", "", "Export filename template, e.g. {{.Start}}_{{.End}}_{{.Count}}.csv")
+	outputDir := flag.String("dir", "", "Directory to write exports to")
+	sinceLastExport := flag.Bool("since-last-export", false, "Export only records newer than the last incremental export")
+	stateFile := flag.String("state-file", "export_state.json", "File remembering the last exported timestamp")
+	appendTo := flag.String("append-to", "", "Append exported records to this rolling CSV file")
+	encrypt := flag.Bool("encrypt", false, "Bundle exports into an AES-encrypted zip using export_password from the config")
+	sign := flag.Bool("sign", false, "Write a detached signature for each export file")
+	emailTo := flag.String("email-to", "", "Comma-separated addresses to email the export to")
+	upload := flag.String("upload", "", "Comma-separated destinations to upload the export to: sftp, drive, share")
+	split := flag.String("split", "", "With -export, write a file for each day of the range: day")
+	aggregateList := flag.String("aggregate", "", "With -export, write only check-in counts by these dimensions, e.g. month,type")
+	minCount := flag.Int("min-count", defaultMinCount, "Aggregate export rows with fewer people than this have their counts suppressed")
+	exportSort := flag.String("sort", "", "With -export, order the records by timestamp, id or name instead of as stored")
+	exportDesc := flag.Bool("desc", false, "With -export, sort in descending order (newest first unless -sort says otherwise)")
+	preview := flag.Bool("preview", false, "With -export, show the records the filters match without writing a file")
+	push := flag.Bool("push", false, "Send the exported records to the instance in the config file's push section")
+	timeFormat := flag.String("time-format", "rfc3339", "CSV export timestamps: rfc3339, local (no offset), split (date and time columns) or unix")
+	delimiterName := flag.String("delimiter", "", "Field delimiter of export files and -ingest and -merge input: comma, tab or semicolon")
+	excelList := flag.String("excel", "", "Comma-separated CSV export options for Excel: bom, crlf, text (IDs as text) or all")
+	columnList := flag.String("columns", "", "Comma-separated export columns: timestamp, id, count, name, direction, type, note, tags, scan_id and derived columns")
+	watchMode := flag.Bool("watch", false, "Show live counts and recent entries from the data file")
+	serveMode := flag.Bool("serve", false, "Run the HTTP server with the attendee welcome display")
+	addr := flag.String("addr", ":8080", "Address the HTTP server listens on")
+	daemonMode := flag.Bool("daemon", false, "Run the scheduled jobs from the config file")
+	waitlistMode := flag.Bool("waitlist", false, "Show who is on today's waitlist, in order")
+	admitNext := flag.Bool("admit-next", false, "Check in the first person on the waitlist")
+	missingMode := flag.Bool("missing", false, "List the -event's registered attendees who haven't checked in")
+	afterHours := flag.Bool("after-hours", false, "List the scans outside the operating hours -start to -end (default yesterday)")
+	earlyDeparturesMode := flag.Bool("early-departures", false, "List who checked out before the session end -start to -end (default yesterday)")
+	noShowMode := flag.Bool("no-shows", false, "List who was expected but didn't check in -start to -end (default yesterday)")
+	comparePeriods := flag.String("compare", "", "Two comma-separated periods; list IDs that checked in during one but not the other")
+	retention := flag.String("retention", "", "Show a cohort retention matrix by first check-in week or month")
+	heatmapMode := flag.Bool("heatmap", false, "Show check-ins per day as a calendar heatmap and save it as HTML")
+	replayMode := flag.Bool("replay", false, "Re-process the records from -start to -end through the current rules and report how the counts differ")
+	rosterOnly := flag.Bool("roster-only", false, "With -replay, refuse IDs that aren't on the roster")
+	statsMode := flag.Bool("stats", false, "Show check-in totals, averages per open day and attendance streaks from -start to -end")
+	timesheetMode := flag.Bool("timesheet", false, "Report the hours staff on the time clock worked in each pay period")
+	attendanceMode := flag.Bool("attendance", false, "Save a roster-by-date attendance sheet for -start to -end (default this week)")
+	redactSample := flag.Bool("redact-sample", false, "Save the records from -start to -end (default today) with pseudonymized IDs and no names, for bug reports")
+	bundleMode := flag.Bool("bundle", false, "Save an -event's records, summary, no-shows and sign-in matrix from -start to -end (default today) as one zip")
+	repeatsMode := flag.Bool("repeats", false, "List the scans refused as duplicates per ID per day from -start to -end (default today)")
+	pausesMode := flag.Bool("pauses", false, "List the scan mode pauses and their reasons from -start to -end (default today)")
+	pickupsMode := flag.Bool("pickups", false, "List the children collected and refused pickups from -start to -end (default today)")
+	stationsMode := flag.Bool("stations", false, "List the scan stations sending this server heartbeats and which are down")
+	trashMode := flag.Bool("trash", false, "List the rows -dedupe -remove and -compact removed that can still be restored")
+	restoreIDs := flag.String("restore", "", "Comma-separated trash batch or row IDs to put back in the data file (see -trash)")
+	initMode := flag.Bool("init", false, "Set up a new site interactively: config file, roster template and a scanner test")
+	showVersion := flag.Bool("version", false, "Print this build's version and platform")
+	updateMode := flag.Bool("update", false, "Replace this binary with the latest release from the config file's update section")
+	screeningMode := flag.Bool("screening", false, "List the screening answers given from -start to -end (default today)")
+	undoAdmin := flag.Bool("undo-admin", false, "Revert the last maintenance command, or the -entry given, from the journal")
+	journalEntryID := flag.Int("entry", 0, "Journal entry for -undo-admin (see -journal)")
+	listJournal := flag.Bool("journal", false, "List the journaled maintenance commands")
+	occupancyMode := flag.Bool("occupancy", false, "Show who is in the building now")
+	evacuateMode := flag.Bool("evacuate", false, "Print and save a headcount of everyone still checked in")
+	checkMode := flag.Bool("check", false, "Validate the data file and report problems")
+	verifyMode := flag.Bool("verify", false, "Verify the record checksums in the data file")
+	renumberSpec := flag.String("renumber", "", "Renumber the daily counts for a date, range or all days in timestamp order")
+	verifyCounts := flag.Bool("verify-counts", false, "Recompute the daily counts from the timestamps and report mismatches")
+	dedupeMode := flag.Bool("dedupe", false, "Find duplicate records across the data file")
+	dedupeWindow := flag.Duration("window", 10*time.Second, "Scans of the same ID closer than this are duplicates (dedupe mode)")
+	ingestFile := flag.String("ingest", "", "Add the timestamp,id scans in this file from an offline scanner")
+	importOuts := flag.String("import-outs", "", "Add the timestamp,id check-outs in this file from an exit scanner, pairing each with that day's check-in")
+	mergeFiles := flag.String("merge", "", "Comma-separated data files from other stations to merge in, skipping records already present; file@offset corrects a station's clock")
+	compactMode := flag.Bool("compact", false, "Rewrite the data file without unreadable lines and duplicates, renumbering daily counts")
+	removeDuplicates := flag.Bool("remove", false, "Remove duplicates and recompute daily counts (dedupe mode)")
+	issuePass := flag.String("issue-pass", "", "Issue a temporary guest ID for this name, valid -start to -end (default today)")
+	linkIDs := flag.String("link", "", "Comma-separated roster IDs to link as a family, or caregiver first then the people they care for")
+	unlinkIDs := flag.String("unlink", "", "Comma-separated roster IDs to unlink")
+	lookupMode := flag.Bool("lookup", false, "Run a help desk station where attendees find themselves by name or email to reprint a lost badge")
+	openDay := flag.Bool("open-day", false, "Record the start of the day's session on -start (default today) and run the start-of-day checklist")
+	closeDay := flag.Bool("close-day", false, "Close the day's session on -start (default today): print its summary and run its export and backup")
+	signWaiver := flag.String("sign-waiver", "", "Comma-separated IDs to record as having signed a waiver on -start (default today)")
+	missingWaivers := flag.Bool("missing-waivers", false, "List roster members without a valid signed waiver")
+	retireBadge := flag.String("retire-badge", "", "Mark a roster ID's badge as lost or expired (see -badge-reason) and refuse its scans")
+	reissueIDs := flag.String("reissue", "", "Old and new badge IDs, e.g. 1001,1042: give the old badge's holder the new one, linked to it")
+	badgeReason := flag.String("badge-reason", "lost", "Why the badge is out of use for -retire-badge and -reissue: lost or expired")
+	listLinks := flag.Bool("links", false, "List families and caregivers from the roster")
+	syncRosterMode := flag.Bool("sync-roster", false, "Fetch the roster from the config file's roster_source now")
+	ldapLookup := flag.String("ldap-lookup", "", "Look an ID up in the config file's ldap directory")
+	resolveID := flag.String("resolve", "", "Look an ID up through the config file's resolvers, as scan mode does")
+	syncCRMMode := flag.Bool("sync-crm", false, "Post the visits not yet synced to the config file's crm as activities")
+	queueCommand := flag.String("queue", "", "Show the outbound delivery queue (status) or send everything in it now (flush)")
+	relation := flag.String("relation", "family", "Relation for -link and -unlink: family or caregiver")
+	annotateLine := flag.Int("annotate", 0, "Line number of a record (from -search) to attach -note to")
+	note := flag.String("note", "", "Note to attach with -annotate")
+	tagList := flag.String("tag", "", "Comma-separated tags for scan mode or -annotate, or to filter exports by")
+	searchText := flag.String("search", "", "Search records and roster for a name, ID fragment or text")
+	rosterFile := flag.String("roster", "roster.csv", "Roster CSV with id and name columns")
+	testModeFlag := flag.Bool("test-mode", false, "Redirect all reads and writes to a practice copy of the data file")
+	sourceList := flag.String("source", "", "Comma-separated sources to export records from, e.g. mobile,import")
+	typeList := flag.String("type", "", "Record type for scan mode, or comma-separated types to export: member, visitor, staff, contractor")
+	direction := flag.String("direction", "in", "Scan mode records check-ins (in) or check-outs (out)")
+	timeClock := flag.Bool("time-clock", false, "In scan mode, staff punch in and out in turn whatever the station's direction")
+	dryRun := flag.Bool("dry-run", false, "Scan mode checks and displays scans without recording them")
+	cameraMode := flag.Bool("camera", false, "Scan mode takes a webcam photo at each check-in")
+	metricsLog := flag.String("metrics-log", "", "CSV file scan mode appends per-scan timings to")
+	logFile := flag.String("log-file", "", "Also write all output to this file, rotated by size and age")
+	supervise := flag.Bool("supervise", false, "Scan mode restarts itself after a crash or I/O error")
+	hidDevice := flag.String("hid-device", "", "Scan mode reads the scanner from this Linux evdev device, e.g. /dev/input/event3")
+	stdinMode := flag.Bool("stdin", false, "Scan mode reads IDs piped to it without prompting and prints a JSON result per line")
+	outputFormat := flag.String("output", "text", "Output of -stats, -search, -verify and -queue: text, or json for scripts")
+	logFormat := flag.String("log-format", "text", "Scan mode output: text, or json for one event per scan or error")
+	station := flag.String("station", defaultStation(), "Station name in JSON log events")
+	accessibility := flag.String("accessibility", "", "Scan mode output for accessibility: large or plain")
+	event := flag.String("event", "", "Event from the config file whose greeting, colors and sounds to use")
+	fileFlag := flag.String("file", dataFile, "CSV data file")
+	archiveBefore := flag.String("archive", "", "Move records from before this date (YYYY-MM-DD or e.g. last-365-days) into compressed archives")
+	includeArchivesFlag := flag.Bool("include-archives", false, "Also read archived records in export, search, check and verify")
+	historyList := flag.String("history", "", "Comma-separated read-only data files or folders of them from earlier years to read before the live records")
+	localeName := flag.String("locale", "", "Language and date and number formats of the printed reports and heatmap: en-US, fr-CA or fr-FR (overrides the config file)")
+	readOnly := flag.Bool("readonly", false, "Refuse any command that writes to the data files, for reports run next to a live station")
+	partition := flag.String("partition", "", "Set to monthly to keep records in one file per month, e.g. scans-2025-03.csv")
+	timeZone := flag.String("tz", "", "Time zone for timestamps and date ranges, e.g. America/Chicago")
+	scanDedupeWindow := flag.Duration("dedupe-window", defaultDedupeWindow, "Scan mode ignores repeat scans of an ID within this window")
+	profileName := flag.String("profile", "", "Named profile from the config file to use")
+	configFile := flag.String("config", "checkin.json", "JSON config file")
 	helpFlag := flag.Bool("help", false, "Display this help message")
 
 	flag.Parse()
@@ -25,18 +157,919 @@ func main() {
 		displayHelp()
 		return
 	}
+	if *showVersion {
+		fmt.Printf("checkin %s (%s/%s)\n", version, runtime.GOOS, runtime.GOARCH)
+		return
+	}
+
+	if err := applyEnvironment(); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	// The wizard writes the config file, so it runs before one is loaded
+	if *initMode {
+		if *readOnly {
+			fmt.Println("Error: -init writes the config and roster files, so it cannot be used with -readonly.")
+			return
+		}
+		runInitMode(*configFile, *rosterFile)
+		return
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Println("Error loading config:", err)
+		return
+	}
+	if *logFile != "" {
+		stopLogging, err := teeOutput(*logFile, cfg.LogRotation)
+		if err != nil {
+			fmt.Println("Error opening log file:", err)
+			return
+		}
+		defer stopLogging()
+	}
+	startTracing(cfg.Tracing)
+	defer stopTracing()
+
+	// Apply the profile's settings unless the matching flag or environment
+	// variable was given
+	profile, err := cfg.profile(*profileName)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	if setFlags["file"] {
+		dataFile = *fileFlag
+	} else if profile.DataFile != "" {
+		dataFile = profile.DataFile
+	}
+	if profile.Partition != "" && !setFlags["partition"] {
+		*partition = profile.Partition
+	}
+	switch *partition {
+	case "":
+	case "monthly":
+		partitioned = true
+	default:
+		fmt.Println("Error: Partition must be monthly.")
+		return
+	}
+	includeArchives = *includeArchivesFlag
+	historySources = cfg.History
+	if len(profile.History) > 0 {
+		historySources = profile.History
+	}
+	if *historyList != "" {
+		historySources = splitIDs(*historyList)
+	}
+	if profile.Locale != "" {
+		cfg.Locale = profile.Locale
+	}
+	if *localeName != "" {
+		cfg.Locale = *localeName
+	}
+	if err := checkLocale(cfg.Locale); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if dataDelimiter, err = parseDelimiter(cfg.DataDelimiter); err != nil {
+		fmt.Println("Error in config file: data_delimiter:", err)
+		return
+	}
+	// The delimiter of the files -export writes and -ingest and -merge read;
+	// zero leaves each with its default
+	var delimiter rune
+	if *delimiterName != "" {
+		if delimiter, err = parseDelimiter(*delimiterName); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+	}
+	if *testModeFlag {
+		testMode = true
+		dataFile = practiceFile(dataFile)
+	}
+	if profile.Roster != "" && !setFlags["roster"] {
+		*rosterFile = profile.Roster
+	}
+	if profile.Event != "" && !setFlags["event"] {
+		*event = profile.Event
+	}
+	if len(profile.Goals) > 0 {
+		cfg.Goals = profile.Goals
+	}
+	if *profileName != "" && !setFlags["state-file"] {
+		*stateFile = "export_state_" + *profileName + ".json"
+	}
+	scanWindow := *scanDedupeWindow
+	if profile.DedupeWindow > 0 && !setFlags["dedupe-window"] {
+		scanWindow = time.Duration(profile.DedupeWindow)
+	}
+	dedupe, err := newDedupeRules(cfg, profile, *event, scanWindow)
+	if err != nil {
+		fmt.Println("Error in config file:", err)
+		return
+	}
+	if err := cfg.Hours.validate(); err != nil {
+		fmt.Println("Error in config file:", err)
+		return
+	}
+
+	if *timeZone != "" {
+		location, err := time.LoadLocation(*timeZone)
+		if err != nil {
+			fmt.Println("Error loading time zone:", err)
+			return
+		}
+		time.Local = location
+	}
+
+	integrityKey, err := loadIntegrityKey(cfg.IntegrityKeyFile)
+	if err != nil {
+		fmt.Println("Error loading integrity key:", err)
+		return
+	}
+	tags, err := parseTags(*tagList)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if *outputFormat != "text" && *outputFormat != "json" {
+		fmt.Println("Error: Output must be text or json.")
+		return
+	}
+	asJSON := *outputFormat == "json"
+	if asJSON && !*statsMode && *searchText == "" && !*verifyMode && *queueCommand == "" {
+		fmt.Println("Error: -output=json works with " + jsonOutputModes + ".")
+		return
+	}
+
+	// Scanning needs an operator, while exports, reports listing people by
+	// name and anything that changes the data file need an admin
+	needed, action := roleViewer, "this command"
+	switch {
+	case *scanMode:
+		needed, action = roleOperator, "scan mode"
+	case *issuePass != "":
+		needed, action = roleOperator, "issuing day passes"
+	case *signWaiver != "":
+		needed, action = roleOperator, "recording waivers"
+	case *lookupMode:
+		needed, action = roleOperator, "reprinting badges"
+	case *openDay, *closeDay:
+		needed, action = roleOperator, "opening and closing the day"
+	case *admitNext:
+		needed, action = roleOperator, "admitting from the waitlist"
+	case *evacuateMode:
+		needed, action = roleOperator, "the evacuation headcount"
+	case *heatmapMode:
+		needed, action = roleOperator, "the check-in heatmap"
+	case *exportMode, *comparePeriods != "", *bundleMode, *redactSample:
+		needed, action = roleAdmin, "export mode"
+	case *timesheetMode:
+		needed, action = roleAdmin, "the payroll timesheet"
+	case *attendanceMode, *noShowMode, *retention != "":
+		needed, action = roleAdmin, "reports naming attendees"
+	case *updateMode:
+		needed, action = roleAdmin, "updating the program"
+	case *daemonMode:
+		needed, action = roleAdmin, "running scheduled jobs"
+	case *compactMode:
+		needed, action = roleAdmin, "compacting records"
+	case *ingestFile != "":
+		needed, action = roleAdmin, "ingesting scans"
+	case *importOuts != "":
+		needed, action = roleAdmin, "importing check-outs"
+	case *mergeFiles != "":
+		needed, action = roleAdmin, "merging records"
+	case *dedupeMode && *removeDuplicates:
+		needed, action = roleAdmin, "removing records"
+	case *archiveBefore != "":
+		needed, action = roleAdmin, "archiving records"
+	case *restoreIDs != "":
+		needed, action = roleAdmin, "restoring records"
+	case *renumberSpec != "":
+		needed, action = roleAdmin, "renumbering records"
+	case *annotateLine != 0:
+		needed, action = roleAdmin, "annotating records"
+	case *linkIDs != "" || *unlinkIDs != "":
+		needed, action = roleAdmin, "editing roster links"
+	case *retireBadge != "" || *reissueIDs != "":
+		needed, action = roleAdmin, "reissuing badges"
+	case *syncRosterMode:
+		needed, action = roleAdmin, "syncing the roster"
+	case *syncCRMMode:
+		needed, action = roleAdmin, "syncing visits to the CRM"
+	case *queueCommand == "flush":
+		needed, action = roleAdmin, "flushing the delivery queue"
+	case *undoAdmin:
+		needed, action = roleAdmin, "undoing maintenance commands"
+	}
+	if err := cfg.authorize(needed, action); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	// Read-only mode only runs commands that open the data files for reading,
+	// so reports never change the files a scan station is writing to
+	if *readOnly {
+		switch {
+		case *scanMode, *daemonMode, *compactMode, *ingestFile != "", *importOuts != "", *mergeFiles != "", *dedupeMode && *removeDuplicates, *archiveBefore != "", *restoreIDs != "",
+			*renumberSpec != "", *annotateLine != 0, *linkIDs != "", *unlinkIDs != "", *retireBadge != "", *reissueIDs != "", *syncRosterMode, *syncCRMMode, *queueCommand == "flush", *issuePass != "", *signWaiver != "", *lookupMode, *openDay, *closeDay, *admitNext, *undoAdmin, *updateMode:
+			fmt.Println("Error: -readonly only allows commands that read the records, such as -export, -search and -serve.")
+			return
+		case *exportMode && *sinceLastExport && !*preview:
+			fmt.Println("Error: -since-last-export saves its progress to the state file, so it cannot be used with -readonly.")
+			return
+		}
+	}
+
+	// Maintenance commands save the files they change to the journal first,
+	// so -undo-admin can put them back
+	switch {
+	case *compactMode, *ingestFile != "", *importOuts != "", *mergeFiles != "", *dedupeMode && *removeDuplicates, *archiveBefore != "", *restoreIDs != "",
+		*renumberSpec != "", *annotateLine != 0, *linkIDs != "", *unlinkIDs != "", *retireBadge != "", *reissueIDs != "", *syncRosterMode:
+		if err := startJournal(action); err != nil {
+			fmt.Println("Error reading journal:", err)
+			return
+		}
+		defer finishJournal()
+	}
+
+	// Webhooks, SMS and failed export emails and uploads go out through the
+	// delivery queue, which the long-running modes keep sending from
+	outbox.cfg = cfg
+	if *scanMode || *serveMode || *daemonMode || *lookupMode {
+		outbox.start()
+	}
+	if cfg.Update.CheckAtStartup && (*scanMode || *serveMode || *daemonMode) {
+		go checkForUpdate(cfg.Update)
+	}
+	hooks.settings = cfg.Hooks
+	defer hooks.wait()
 
 	// Determine which mode to run
 	if *scanMode {
-		runScanMode()
+		roster, err := loadRoster(*rosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		theme, err := cfg.eventTheme(*event)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		var registrations map[string]rosterEntry
+		if theme.Registrations != "" {
+			if registrations, err = loadRoster(theme.Registrations); err != nil {
+				fmt.Println("Error loading registrations:", err)
+				return
+			}
+		}
+		scanTypes, err := parseRecordTypes(*typeList)
+		if err != nil || len(scanTypes) > 1 {
+			fmt.Println("Error: Scan mode takes a single record type: member, visitor, staff or contractor.")
+			return
+		}
+		scanType := ""
+		if len(scanTypes) == 1 {
+			scanType = scanTypes[0]
+		}
+		if *direction != "in" && *direction != "out" {
+			fmt.Println("Error: Direction must be in or out.")
+			return
+		}
+		// Piped input has no one watching the screen or listening
+		soundCommand := cfg.SoundCommand
+		if *stdinMode {
+			*logFormat = "json"
+			soundCommand = ""
+		}
+		if *logFormat != "text" && *logFormat != "json" {
+			fmt.Println("Error: Log format must be text or json.")
+			return
+		}
+		if *accessibility != "" && *accessibility != "large" && *accessibility != "plain" {
+			fmt.Println("Error: Accessibility mode must be large or plain.")
+			return
+		}
+		options := scanOptions{
+			Roster:        roster,
+			RosterFile:    *rosterFile,
+			Resolvers:     newResolverChain(cfg.Resolvers, cfg.LDAP),
+			Theme:         theme,
+			SoundCommand:  soundCommand,
+			Accessibility: *accessibility,
+			Dedupe:        dedupe,
+			Hours:         cfg.Hours,
+			DryRun:        *dryRun,
+			MetricsLog:    *metricsLog,
+			IntegrityKey:  integrityKey,
+			Direction:     *direction,
+			Capacity:      cfg.Capacity,
+			ArrivalRate:   cfg.ArrivalRate,
+			Pause:         cfg.Pause,
+			Storage:       cfg.Storage,
+			WatchList:     cfg.WatchList,
+			GuardianSMS:   cfg.GuardianSMS,
+			Registrations: registrations,
+			RecordType:    scanType,
+			TypePrefixes:  cfg.TypePrefixes,
+			Passes:        cfg.Passes,
+			Badges:        cfg.Badges,
+			Waivers:       cfg.Waivers,
+			Screening:     cfg.Screening,
+			Pickup:        cfg.Pickup,
+			Tags:          tags,
+			Milestones:    cfg.milestones(),
+			SpotCheck:     cfg.SpotCheck,
+			Closures:      cfg.Closures,
+			Scanner:       cfg.Scanner,
+			HIDDevice:     *hidDevice,
+			NTPServer:     cfg.NTPServer,
+			Stdin:         *stdinMode,
+			LogFormat:     *logFormat,
+			Station:       *station,
+			Event:         *event,
+		}
+		if *timeClock {
+			options.TimeClock = &cfg.TimeClock
+		}
+		if cfg.Kiosk.LockAfterHours {
+			options.Kiosk = &kioskLock{settings: cfg.Kiosk, hours: cfg.Hours, closures: cfg.Closures}
+		}
+		if *cameraMode {
+			options.Camera = newCamera(cfg.Camera)
+		}
+		options.Door = newDoorRelay(cfg.Door)
+		options.Heartbeat = startHeartbeat(cfg.Heartbeat, cfg.ArrivalRate, *station, *direction, func(err error) {
+			options.logError("Error sending heartbeat", err)
+		})
+		defer options.Heartbeat.close()
+		if cfg.RosterSource.URL != "" {
+			startRosterSync(cfg.RosterSource, *rosterFile, func(err error) {
+				options.logError("Error syncing roster", err)
+			})
+		}
+		if *supervise {
+			superviseScanMode(options)
+		} else {
+			runScanMode(options)
+		}
 	} else if *exportMode {
-		if *startDate == "" {
+		*startDate, *endDate, err = resolveExportRange(*startDate, *endDate, *week, *month, time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if *sinceLastExport && (*startDate != "" || *endDate != "") {
+			fmt.Println("Error: -since-last-export cannot be combined with a date range.")
+			return
+		}
+		if *startDate == "" && !*sinceLastExport {
 			fmt.Println("Error: Start date is required for export mode.")
 			return
 		}
-		runExportMode(*startDate, *endDate)
+		excel, err := parseExcelOptions(*excelList)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		columns, err := parseExportColumns(*columnList)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		types, err := parseRecordTypes(*typeList)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		sources, err := parseRecordSources(*sourceList)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		aggregate, err := parseAggregate(*aggregateList)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		var recipients, destinations []string
+		if *emailTo != "" {
+			recipients = strings.Split(*emailTo, ",")
+		}
+		if *upload != "" {
+			destinations = strings.Split(*upload, ",")
+		}
+		options := exportOptions{
+			Formats:    strings.Split(*format, ","),
+			Compress:   *compress,
+			Encrypt:    *encrypt,
+			Columns:    columns,
+			TimeFormat: *timeFormat,
+			Excel:      excel,
+			Delimiter:  delimiter,
+			Types:      types,
+			Tags:       tags,
+			Sources:    sources,
+			RosterFile: *rosterFile,
+			Filename:   *filenameTemplate,
+			Dir:        *outputDir,
+			Split:      *split,
+			Preview:    *preview,
+			Sort:       *exportSort,
+			Desc:       *exportDesc,
+			Aggregate:  aggregate,
+			MinCount:   *minCount,
+
+			SinceLastExport: *sinceLastExport,
+			StateFile:       *stateFile,
+			AppendTo:        *appendTo,
+			Sign:            *sign,
+
+			EmailTo: recipients,
+			Upload:  destinations,
+			Push:    *push,
+			Config:  cfg,
+		}
+		if err := options.validate(); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		runExportMode(*startDate, *endDate, options)
+	} else if *watchMode {
+		runWatchMode(*rosterFile, cfg.Capacity.Max, cfg.Capacity.Waitlist, cfg.Goals, cfg.ArrivalRate)
+	} else if *serveMode {
+		theme, err := cfg.eventTheme(*event)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		runServeMode(*addr, *rosterFile, *metricsLog, theme, cfg, mobileAPI{
+			RosterFile:   *rosterFile,
+			Dedupe:       dedupe,
+			Hours:        cfg.Hours,
+			TypePrefixes: cfg.TypePrefixes,
+			Passes:       cfg.Passes,
+			Badges:       cfg.Badges,
+			Waivers:      cfg.Waivers,
+			GuardianSMS:  cfg.GuardianSMS,
+			IntegrityKey: integrityKey,
+			ReadOnly:     *readOnly,
+		})
+	} else if *daemonMode {
+		runDaemonMode(cfg, *rosterFile)
+	} else if *missingMode {
+		theme, err := cfg.eventTheme(*event)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if theme.Registrations == "" {
+			fmt.Println("Error: -missing needs an -event with a registrations file in the config file.")
+			return
+		}
+		registrations, err := loadRoster(theme.Registrations)
+		if err != nil {
+			fmt.Println("Error loading registrations:", err)
+			return
+		}
+		first, last, err := resolveExportRange(*startDate, *endDate, "", "", time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if first == "" {
+			first, _, _ = relativeRange("today", time.Now())
+		}
+		runMissingMode(registrations, first, last)
+	} else if *comparePeriods != "" {
+		runCompareMode(*comparePeriods, *rosterFile, *outputDir)
+	} else if *retention != "" {
+		if *retention != "week" && *retention != "month" {
+			fmt.Println("Error: -retention must be week or month.")
+			return
+		}
+		first, last, err := resolveExportRange(*startDate, *endDate, *week, *month, time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if last == "" && *startDate != "" {
+			last = first
+		}
+		runRetentionMode(retentionPeriod(*retention), cfg, first, last, *outputDir)
+	} else if *heatmapMode {
+		first, last, err := resolveExportRange(*startDate, *endDate, *week, *month, time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		now := time.Now()
+		if first == "" {
+			first = time.Date(now.Year(), now.Month()-2, 1, 0, 0, 0, 0, time.Local).Format("2006-01-02")
+		}
+		if last == "" {
+			last = now.Format("2006-01-02")
+			if *startDate != "" && *endDate == "" && *week == "" && *month == "" && first > last {
+				last = first
+			}
+		}
+		runHeatmapMode(first, last, *outputDir, cfg.locale())
+	} else if *replayMode {
+		first, last, err := resolveExportRange(*startDate, *endDate, *week, *month, time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if last == "" && *startDate != "" {
+			last = first
+		}
+		roster, err := loadRoster(*rosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		runReplayMode(replayRules{Scanner: cfg.Scanner, Roster: roster, RosterOnly: *rosterOnly, Hours: cfg.Hours, Dedupe: dedupe}, first, last, *outputDir)
+	} else if *statsMode {
+		first, last, err := resolveExportRange(*startDate, *endDate, *week, *month, time.Now())
+		if err != nil {
+			printError(asJSON, "Error:", err)
+			return
+		}
+		if first == "" {
+			first, last, _ = relativeRange("last-28-days", time.Now())
+		}
+		if last == "" {
+			last = first
+		}
+		roster, err := loadRoster(*rosterFile)
+		if err != nil {
+			printError(asJSON, "Error loading roster:", err)
+			return
+		}
+		runStatsMode(cfg, roster, first, last, *outputDir, asJSON)
+	} else if *timesheetMode {
+		first, last, err := resolveExportRange(*startDate, *endDate, *week, *month, time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if last == "" {
+			last = first
+		}
+		roster, err := loadRoster(*rosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		runTimesheetMode(cfg.TimeClock, roster, first, last, *outputDir)
+	} else if *repeatsMode {
+		roster, err := loadRoster(*rosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		first, last, err := resolveExportRange(*startDate, *endDate, *week, *month, time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if first == "" {
+			first, last, _ = relativeRange("today", time.Now())
+		}
+		if last == "" {
+			last = first
+		}
+		runRepeatsMode(roster, first, last, *outputDir)
+	} else if *pausesMode {
+		first, last, err := resolveExportRange(*startDate, *endDate, *week, *month, time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if first == "" {
+			first, last, _ = relativeRange("today", time.Now())
+		}
+		if last == "" {
+			last = first
+		}
+		runPausesMode(first, last, *outputDir)
+	} else if *pickupsMode {
+		roster, err := loadRoster(*rosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		first, last, err := resolveExportRange(*startDate, *endDate, *week, *month, time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if first == "" {
+			first, last, _ = relativeRange("today", time.Now())
+		}
+		if last == "" {
+			last = first
+		}
+		runPickupsMode(roster, first, last, *outputDir)
+	} else if *stationsMode {
+		runStationsMode()
+	} else if *updateMode {
+		runUpdateMode(cfg.Update)
+	} else if *screeningMode {
+		roster, err := loadRoster(*rosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		first, last, err := resolveExportRange(*startDate, *endDate, *week, *month, time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if first == "" {
+			first, last, _ = relativeRange("today", time.Now())
+		}
+		if last == "" {
+			last = first
+		}
+		runScreeningMode(cfg.Screening, roster, first, last, *outputDir)
+	} else if *attendanceMode {
+		roster, err := loadRoster(*rosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		first, last, err := resolveExportRange(*startDate, *endDate, *week, *month, time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if first == "" {
+			first, last, _ = relativeRange("this-week", time.Now())
+		}
+		if last == "" {
+			last = first
+		}
+		runAttendanceMode(roster, cfg.Closures, first, last, *outputDir)
+	} else if *redactSample {
+		first, last, err := resolveExportRange(*startDate, *endDate, *week, *month, time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if first == "" {
+			first, last, _ = relativeRange("today", time.Now())
+		}
+		if last == "" {
+			last = first
+		}
+		roster, err := loadRoster(*rosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		runRedactSampleMode(roster, cfg.TypePrefixes, first, last, *outputDir)
+	} else if *bundleMode {
+		if *event == "" {
+			fmt.Println("Error: -bundle needs the -event to bundle, as named in the config file.")
+			return
+		}
+		theme, err := cfg.eventTheme(*event)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		roster, err := loadRoster(*rosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		expected := roster
+		if theme.Registrations != "" {
+			if expected, err = loadRoster(theme.Registrations); err != nil {
+				fmt.Println("Error loading registrations:", err)
+				return
+			}
+		}
+		first, last, err := resolveExportRange(*startDate, *endDate, *week, *month, time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if first == "" {
+			first, _, _ = relativeRange("today", time.Now())
+		}
+		if last == "" {
+			last = first
+		}
+		runBundleMode(*event, expected, roster, cfg, tags, first, last, *outputDir)
+	} else if *noShowMode {
+		roster, err := loadRoster(*rosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		theme, err := cfg.eventTheme(*event)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		expected := roster
+		if theme.Registrations != "" {
+			if expected, err = loadRoster(theme.Registrations); err != nil {
+				fmt.Println("Error loading registrations:", err)
+				return
+			}
+		}
+		first, last, err := resolveExportRange(*startDate, *endDate, "", "", time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if first == "" {
+			first, _, _ = relativeRange("yesterday", time.Now())
+		}
+		if last == "" {
+			last = first
+		}
+		runNoShowMode(expected, roster, cfg.ContactFields, first, last, *outputDir)
+	} else if *afterHours {
+		roster, err := loadRoster(*rosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		first, last, err := resolveExportRange(*startDate, *endDate, "", "", time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if first == "" {
+			first, _, _ = relativeRange("yesterday", time.Now())
+		}
+		if last == "" {
+			last = first
+		}
+		runAfterHoursMode(cfg.Hours, roster, first, last, *outputDir)
+	} else if *earlyDeparturesMode {
+		roster, err := loadRoster(*rosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		first, last, err := resolveExportRange(*startDate, *endDate, "", "", time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if first == "" {
+			first, _, _ = relativeRange("yesterday", time.Now())
+		}
+		if last == "" {
+			last = first
+		}
+		runEarlyDeparturesMode(cfg.SessionEnd, roster, first, last, *outputDir)
+	} else if *undoAdmin {
+		runUndoAdminMode(*journalEntryID, cfg)
+	} else if *listJournal {
+		runJournalMode()
+	} else if *waitlistMode {
+		runWaitlistMode(*rosterFile)
+	} else if *admitNext {
+		runAdmitNextMode(*rosterFile, cfg, integrityKey)
+	} else if *occupancyMode {
+		runOccupancyMode(*rosterFile)
+	} else if *evacuateMode {
+		runEvacuateMode(*rosterFile, *outputDir)
+	} else if *checkMode {
+		runCheckMode()
+	} else if *renumberSpec != "" {
+		runRenumberMode(*renumberSpec, cfg)
+	} else if *verifyCounts {
+		runVerifyCountsMode()
+	} else if *verifyMode {
+		runVerifyMode(integrityKey, asJSON)
+	} else if *ingestFile != "" {
+		runIngestMode(*ingestFile, *rosterFile, dedupe, cfg.TypePrefixes, cfg.Scanner, delimiter)
+	} else if *importOuts != "" {
+		runImportOutsMode(*importOuts, *rosterFile, cfg.Scanner, delimiter, *outputDir)
+	} else if *mergeFiles != "" {
+		sources, err := parseMergeSources(*mergeFiles)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		runMergeMode(sources, delimiter)
+	} else if *compactMode {
+		runCompactMode(*dedupeWindow, cfg)
+	} else if *dedupeMode {
+		runDedupeMode(*dedupeWindow, *removeDuplicates, cfg)
+	} else if *trashMode {
+		runTrashMode(cfg)
+	} else if *restoreIDs != "" {
+		runRestoreMode(*restoreIDs, cfg)
+	} else if *issuePass != "" {
+		first, last, err := resolveExportRange(*startDate, *endDate, "", "", time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if first == "" {
+			first, _, _ = relativeRange("today", time.Now())
+		}
+		runIssuePassMode(cfg.Passes, *issuePass, first, last, *rosterFile)
+	} else if *lookupMode {
+		theme, err := cfg.eventTheme(*event)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		peopleFile := *rosterFile
+		if theme.Registrations != "" {
+			peopleFile = theme.Registrations
+		}
+		people, err := loadRoster(peopleFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		runLookupMode(people, peopleFile, *event, cfg.Lookup, cfg.BadgePrinter, mobileAPI{
+			RosterFile:   *rosterFile,
+			Dedupe:       dedupe,
+			Hours:        cfg.Hours,
+			TypePrefixes: cfg.TypePrefixes,
+			Passes:       cfg.Passes,
+			Badges:       cfg.Badges,
+			Waivers:      cfg.Waivers,
+			GuardianSMS:  cfg.GuardianSMS,
+			IntegrityKey: integrityKey,
+		}, *station)
+	} else if *signWaiver != "" {
+		first, _, err := resolveExportRange(*startDate, "", "", "", time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if first == "" {
+			first, _, _ = relativeRange("today", time.Now())
+		}
+		runSignWaiverMode(cfg.Waivers, splitIDs(*signWaiver), first)
+	} else if *openDay || *closeDay {
+		date, _, err := resolveExportRange(*startDate, "", "", "", time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if date == "" {
+			date, _, _ = relativeRange("today", time.Now())
+		}
+		if *openDay {
+			runOpenDayMode(cfg, date, *station)
+		} else {
+			runCloseDayMode(cfg, *rosterFile, date, *station, *outputDir)
+		}
+	} else if *missingWaivers {
+		runMissingWaiversMode(cfg.Waivers, *rosterFile, cfg.TypePrefixes, *outputDir)
+	} else if *archiveBefore != "" {
+		runArchiveMode(*archiveBefore, integrityKey != nil)
+	} else if *annotateLine != 0 {
+		runAnnotateMode(*annotateLine, *note, tags)
+	} else if *linkIDs != "" {
+		runLinkMode(*rosterFile, *relation, splitIDs(*linkIDs))
+	} else if *unlinkIDs != "" {
+		runUnlinkMode(*rosterFile, *relation, splitIDs(*unlinkIDs))
+	} else if *retireBadge != "" {
+		runRetireBadgeMode(*rosterFile, *retireBadge, *badgeReason)
+	} else if *reissueIDs != "" {
+		runReissueMode(*rosterFile, splitIDs(*reissueIDs), *badgeReason, time.Now())
+	} else if *listLinks {
+		runListLinksMode(*rosterFile)
+	} else if *syncRosterMode {
+		runSyncRosterMode(cfg.RosterSource, *rosterFile)
+	} else if *ldapLookup != "" {
+		runLDAPLookupMode(cfg.LDAP, *ldapLookup)
+	} else if *resolveID != "" {
+		roster, err := loadRoster(*rosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		runResolveMode(newResolverChain(cfg.Resolvers, cfg.LDAP), roster, *resolveID)
+	} else if *syncCRMMode {
+		runSyncCRMMode(cfg.CRM, *rosterFile)
+	} else if *queueCommand != "" {
+		runQueueMode(*queueCommand, asJSON)
+	} else if *searchText != "" {
+		runSearchMode(*searchText, *rosterFile, asJSON)
 	} else {
-		fmt.Println("Error: Please specify either -scan or -export.")
+		fmt.Println("Error: Please specify either -init, -scan, -export, -watch, -serve, -daemon, -missing, -no-shows, -after-hours, -early-departures, -compare, -retention, -heatmap, -replay, -stats, -timesheet, -attendance, -bundle, -redact-sample, -screening, -repeats, -pauses, -pickups, -stations, -journal, -undo-admin, -waitlist, -admit-next, -occupancy, -evacuate, -check, -verify, -verify-counts, -renumber, -dedupe, -compact, -trash, -restore, -ingest, -import-outs, -merge, -issue-pass, -lookup, -open-day, -close-day, -sign-waiver, -missing-waivers, -link, -unlink, -links, -retire-badge, -reissue, -sync-roster, -ldap-lookup, -resolve, -sync-crm, -queue, -annotate, -archive, -search or -update.")
 	}
 }
 
@@ -44,229 +1077,1216 @@ func main() {
 func displayHelp() {
 	fmt.Println("Barcode Scanner Program")
 	fmt.Println("Usage:")
-	fmt.Println("  -scan                  : Start barcode scanning mode.")
+	fmt.Println("  -init                  : Set up a new site step by step: the folder for its files, a config file with")
+	fmt.Println("                           its opening hours and what its scanner adds to badge numbers (found by scanning")
+	fmt.Println("                           a badge twice), a roster template and a test scan to the practice file.")
+	fmt.Println("  -scan                  : Start barcode scanning mode. With the config file's arrival_rate section")
+	fmt.Println("                           (per_minute, window, sound, webhook) it warns on screen and posts to the webhook")
+	fmt.Println("                           when check-ins arrive faster than per_minute, so another lane can be opened.")
+	fmt.Println("                           Type 'pause <reason> [note]' at the prompt to refuse scans, e.g. over lunch,")
+	fmt.Println("                           and 'resume' to take them again; the reason is one of the pause section's")
+	fmt.Println("                           reasons (default lunch, break, incident, cleaning) and message is shown meanwhile.")
+	fmt.Println("                           Type x2 (or x1.5, ...) before a badge to make its check-in count as that many")
+	fmt.Println("                           attendance credits, e.g. for a double-length session.")
 	fmt.Println("  -export                : Export records within a date or date range.")
 	fmt.Println("  -start=<YYYY-MM-DD>    : Specify the start date for export (required if using export mode).")
+	fmt.Println("                           Also accepts today, yesterday, this-week, last-week, this-month,")
+	fmt.Println("                           last-month and last-N-days (the N days ending today).")
 	fmt.Println("  -end=<YYYY-MM-DD>      : Specify the end date for export (optional, for a date range).")
+	fmt.Println("  -week=<YYYY-Www>       : Export an ISO week instead of specifying -start and -end.")
+	fmt.Println("  -month=<YYYY-MM>       : Export a calendar month instead of specifying -start and -end.")
+	fmt.Println("  -format=<csv|parquet>  : Export file format (default csv). List several to write each, e.g. csv,parquet.")
+	fmt.Println("  -compress=<gzip|zip>   : Gzip each export file, or bundle all formats into one zip.")
+	fmt.Println("  -filename=<template>   : Export filename template using {{.Start}}, {{.End}}, {{.Count}} and {{.Format}}.")
+	fmt.Println("  -dir=<directory>       : Directory to write the export to (created if missing).")
+	fmt.Println("  -since-last-export     : Export only records newer than the previous -since-last-export run.")
+	fmt.Println("  -state-file=<file>     : Where the last exported timestamp is kept (default export_state.json).")
+	fmt.Println("  -append-to=<file>      : Append exported records to this rolling CSV file.")
+	fmt.Println("  -split=day             : Write a file for each day of the range with records, each named as a")
+	fmt.Println("                           single day's export would be, e.g. for filing one day per document.")
+	fmt.Println("  -aggregate=<list>      : Export only the check-ins and people counted by these, for sharing usage")
+	fmt.Println("                           publicly: date, week, month, weekday, hour, type or field.<roster column>,")
+	fmt.Println("                           except columns naming people such as field.id and field.name. A row with")
+	fmt.Println("                           fewer people than -min-count (default 5) has its counts suppressed, and")
+	fmt.Println("                           there are no totals, which would give them away.")
+	fmt.Println("  -sort=<order>          : Export the records sorted by timestamp, id or name (the roster name), instead")
+	fmt.Println("                           of in the data file's order, which after -merge and -ingest needn't be")
+	fmt.Println("                           chronological. Ties go by timestamp. -desc sorts in descending order, and on")
+	fmt.Println("                           its own exports newest first.")
+	fmt.Println("  -preview               : Show how many records the range and filters match, the first and last")
+	fmt.Println("                           timestamps and the count for each day, without writing, sending or")
+	fmt.Println("                           uploading anything or moving -since-last-export on.")
+	fmt.Println("  -encrypt               : Bundle the export into an AES-256 encrypted zip (export_password in the config).")
+	fmt.Println("  -sign                  : Write a detached FILE.sig for each export with signing_key_file from the config.")
+	fmt.Println("  -email-to=<addresses>  : Email the export files to these comma-separated addresses.")
+	fmt.Println("  -upload=<destinations> : Upload the export files to destinations set in the config file: sftp, drive.")
+	fmt.Println("                           share copies them to a network folder, such as a UNC path on Windows or a")
+	fmt.Println("                           mounted SMB share, reads each back to check it landed whole and tries")
+	fmt.Println("                           again up to attempts times (default 3). The folder must already exist.")
+	fmt.Println("  -push                  : Also send the exported records to another checkin instance, such as the central")
+	fmt.Println("                           office's, set by push url and token (an admin API token there) in the config.")
+	fmt.Println("                           Records it already has are skipped, so pushing a day again is safe.")
+	fmt.Println("  -columns=<list>        : Export only these columns, in order: timestamp, id, count, name, direction, type, note, tags,")
+	fmt.Println("                           scan_id, credits (a check-in's attendance credits), source (see -source), and the")
+	fmt.Println("                           derived columns")
+	fmt.Println("                           day_of_week, week_number (ISO), hour_bucket, is_weekend and")
+	fmt.Println("                           days_since_previous_visit, and answer.<question> for the answer to a")
+	fmt.Println("                           screening question. name_latin is the roster's name_latin column")
+	fmt.Println("                           (a transliteration for systems without Unicode) or the name without accents.")
+	fmt.Println("  -source=<sources>      : Export only records that arrived through these comma-separated intake paths:")
+	fmt.Println("                           prompt (scan mode's prompt), scanner (-hid-device), mobile (the companion")
+	fmt.Println("                           app), kiosk, lookup, push (from another instance), waitlist (-admit), import")
+	fmt.Println("                           (-ingest and -import-outs) or merge. Each record's source is kept in the")
+	fmt.Println("                           origins file next to the data file; older records have none.")
+	fmt.Println("  -delimiter=<name>      : Separate export fields with comma (default), tab or semicolon. -ingest and")
+	fmt.Println("                           -merge read their files with it too. The data file's own delimiter is")
+	fmt.Println("                           data_delimiter in the config file.")
+	fmt.Println("  -excel=<options>       : Make CSV exports open cleanly in Excel: bom (UTF-8 byte order mark), crlf")
+	fmt.Println("                           (Windows line endings), text (IDs as text to keep leading zeros) or all.")
+	fmt.Println("                           Use bom when names have non-Latin letters, such as Arabic or Chinese.")
+	fmt.Println("  -time-format=<format>  : Write CSV export timestamps as rfc3339 (default, as stored), local (local")
+	fmt.Println("                           time without the offset), split (date and time columns) or unix (seconds).")
+	fmt.Println("  -watch                 : Show a live count, arrival rate and recent entries as the data file grows,")
+	fmt.Println("                           and the progress towards the config's attendance goals. The rate is flagged")
+	fmt.Println("                           when it is over the arrival_rate alert.")
+	fmt.Println("  -serve                 : Run the HTTP server. The attendee welcome display is at /display.")
+	fmt.Println("                           With an operator token, the companion app syncs the roster from")
+	fmt.Println("                           /api/roster (with an ETag), registers at /api/devices and uploads batches")
+	fmt.Println("                           of offline scans, each with its own UUID, to /api/scans; scans from an")
+	fmt.Println("                           earlier month go in that month's partition. A duplicate's result says when")
+	fmt.Println("                           the scan it repeats was and when the ID is eligible again (last_scan,")
+	fmt.Println("                           eligible_at).")
+	fmt.Println("                           Other instances' -push sends records to /api/records with an admin token.")
+	fmt.Println("                           A GET of /api/records, also with an admin token, lists them a page at a")
+	fmt.Println("                           time: start and end (dates or keywords), id (comma-separated), event,")
+	fmt.Println("                           station, source, direction and type filter; sort=timestamp|id|name and")
+	fmt.Println("                           order=asc|desc order; limit (default 100, at most 1000) sizes the page, and")
+	fmt.Println("                           the next_cursor it returns is passed as cursor for the next. Stations,")
+	fmt.Println("                           events and sources are known for records made since they were noted in")
+	fmt.Println("                           the origins file.")
+	fmt.Println("                           Scan stations whose config heartbeat url points here post heartbeats to")
+	fmt.Println("                           /api/heartbeats; /stations shows which are alive and /api/stations lists them.")
+	fmt.Println("                           /goals returns the progress towards the config's attendance goals as JSON.")
+	fmt.Println("                           /kiosk is a check-in page for a tablet at the door. With waivers enforced it")
+	fmt.Println("                           asks people without one to sign the waivers text_file, typed or drawn, and")
+	fmt.Println("                           adds new visitors to the roster. With the config's kiosk lock_after_hours set,")
+	fmt.Println("                           it and scan mode lock outside the operating hours and on closures until the")
+	fmt.Println("                           admin_pin is entered, which unlocks them for unlock_for (default 30m).")
+	fmt.Println("                           /healthz reports the server is up, and /readyz checks the data file can be")
+	fmt.Println("                           written, disk space, the configured backends and the clock (503 on failure).")
+	fmt.Println("                           With an admin API token, /admin adds, edits and deactivates roster members,")
+	fmt.Println("                           links families and caregivers and uploads photos (the token is the password).")
+	fmt.Println("                           Until the config file sets api_tokens, only the display, /healthz and the")
+	fmt.Println("                           viewer endpoints are served; the rest answer 403.")
+	fmt.Println("  -addr=<host:port>      : Address the HTTP server listens on (default :8080).")
+	fmt.Println("  -daemon                : Run the export and backup jobs scheduled in the config file, and keep the")
+	fmt.Println("                           roster synced from the roster_source if one is set. At midnight it runs")
+	fmt.Println("                           the config's on_day_close hooks, which scan mode also runs on the first scan")
+	fmt.Println("                           of a new day; on_scan, on_duplicate and on_export hooks get each event as JSON.")
+	fmt.Println("                           A job of type stats emails the -stats report from start to end (default the")
+	fmt.Println("                           last 28 days) to its email_to, with the report's CSV attached.")
+	fmt.Println("  -missing               : List who registered for the -event but hasn't checked in today, or -start")
+	fmt.Println("                           to -end. Set the event's \"registrations\" CSV in the config file; scan")
+	fmt.Println("                           mode then shows how many registered attendees have arrived.")
+	fmt.Println("  -no-shows              : List who was on the roster, or registered for the -event, but didn't check")
+	fmt.Println("                           in -start to -end (default yesterday), with the roster's contact_fields")
+	fmt.Println("                           from the config file (default email and phone). Saved as a CSV in -dir.")
+	fmt.Println("  -after-hours           : List the scans -start to -end (default yesterday) outside the weekly")
+	fmt.Println("                           \"hours\" in the config file, and save them as a CSV in -dir. Scan mode")
+	fmt.Println("                           flags such scans, or refuses them when the hours set \"reject\".")
+	fmt.Println("  -early-departures      : List who checked out -start to -end (default yesterday) before the config's")
+	fmt.Println("                           session_end (HH:MM) and didn't come back, with their arrival and departure")
+	fmt.Println("                           times and minutes early, and save them as a CSV in -dir.")
+	fmt.Println("  -compare=<a>,<b>       : List the IDs that checked in during period a but not b, and b but not a,")
+	fmt.Println("                           and save them as a CSV in -dir. Each period is a date, a week (YYYY-Www),")
+	fmt.Println("                           a month (YYYY-MM), a keyword such as yesterday, or start:end dates.")
+	fmt.Println("  -retention=<period>    : Group first-time attendees by the week or month of their first check-in and")
+	fmt.Println("                           show the share of each cohort back in each later period, saved as a CSV")
+	fmt.Println("                           in -dir. -start/-end, -week or -month limit which cohorts are shown. An")
+	fmt.Println("                           average row ends it; periods the config's closures cover are shown as closed")
+	fmt.Println("                           and left out of the average.")
+	fmt.Println("  -heatmap               : Show check-ins per day as a colored calendar grid from -start (default the")
+	fmt.Println("                           1st two months ago) to -end (default today), or for a -week or -month,")
+	fmt.Println("                           and save it as an HTML page with an SVG calendar in -dir.")
+	fmt.Println("  -replay                : Re-process the records from -start to -end (default the whole file) through the")
+	fmt.Println("                           current badge ID formats, operating hours and dedupe policies, and report")
+	fmt.Println("                           per day how many would have been recorded and why the rest would not. Try a")
+	fmt.Println("                           change first with -dedupe-window or a draft -config. Saves the report in -dir.")
+	fmt.Println("  -roster-only           : With -replay, also refuse IDs that aren't on the roster.")
+	fmt.Println("  -stats                 : Show check-ins from -start to -end (default the last 28 days), or of a -week")
+	fmt.Println("                           or -month: the total, the average per open day and per weekday, the busiest")
+	fmt.Println("                           day, the progress towards the config's attendance goals (e.g. \"312 of 400")
+	fmt.Println("                           weekly goal\") and the longest attendance streaks. Days in the config's")
+	fmt.Println("                           closures, and weekdays without operating hours, are left out of the averages")
+	fmt.Println("                           and don't break streaks. Scan mode warns when started on a closure day.")
+	fmt.Println("                           Saved in -dir.")
+	fmt.Println("  -timesheet             : Report the hours each person on the time clock worked per pay period, for")
+	fmt.Println("                           payroll: the last pay period that ended, or those covering -start to -end, a")
+	fmt.Println("                           -week or a -month. The config's time_clock sets the pay_period (weekly,")
+	fmt.Println("                           biweekly with a period_start, semimonthly or monthly) and round_minutes with")
+	fmt.Println("                           rounding (nearest, up or down) for each punch. Punches with no match within")
+	fmt.Println("                           max_shift (default 16h) are listed to fix. Saved as a CSV in -dir.")
+	fmt.Println("  -attendance            : Save an attendance sheet with a row per roster member, a column per date")
+	fmt.Println("                           -start to -end (default this week), or of a -week or -month, and present")
+	fmt.Println("                           or absent in each cell, or closed on the config's closures, as a CSV in -dir.")
+	fmt.Println("  -bundle                : Save the packet for an -event from -start to -end (default today), or of a")
+	fmt.Println("                           -week or -month, as one zip in -dir: records.csv with its records as stored,")
+	fmt.Println("                           summary.csv, noshows.csv and the attendance.csv sign-in matrix of its")
+	fmt.Println("                           registrations (or the roster). With -tag, only records with one of the tags.")
+	fmt.Println("  -redact-sample         : Save the records from -start to -end (default today), or of a -week or -month,")
+	fmt.Println("                           for a bug report without who attended: a sample_<dates> folder in -dir with")
+	fmt.Println("                           scans.csv, its tags, credits and origins, and roster.csv. IDs are replaced by")
+	fmt.Println("                           pseudonyms of the same shape, the same in every file, from a key used only")
+	fmt.Println("                           for that sample. Names, notes, screening answers and checksums are left out.")
+	fmt.Println("  -screening             : List the answers to the config file's screening questions from -start to -end")
+	fmt.Println("                           (default today), with yes and no counts and unexpected answers, as a CSV in -dir.")
+	fmt.Println("                           Scan mode asks each question on the first scan of the day, or every scan,")
+	fmt.Println("                           and flags or refuses scans not given the expected answer.")
+	fmt.Println("  -repeats               : List the scans refused as duplicates from -start to -end (default today), per")
+	fmt.Println("                           ID per day, with how many came within 10s of the recorded scan (likely a")
+	fmt.Println("                           scanner double read) and at which stations. IDs presented again later or at")
+	fmt.Println("                           several stations are flagged, as a badge may be shared. Saved as a CSV in -dir.")
+	fmt.Println("                           Scan mode and mobile uploads log each refused repeat to the repeats file.")
+	fmt.Println("  -pauses                : List the pauses scan stations logged from -start to -end (default today), with")
+	fmt.Println("                           their reason, note and minutes, and the minutes per reason, as a CSV in -dir,")
+	fmt.Println("                           to explain gaps in the records.")
+	fmt.Println("  -pickups               : List who collected each child from -start to -end (default today) and the")
+	fmt.Println("                           refused attempts, as a CSV in -dir. With the config file's pickup section")
+	fmt.Println("                           enabled, -direction=out asks who is collecting a child and only checks them out")
+	fmt.Println("                           for a caregiver (see -link) or a name in the roster's pickup column.")
+	fmt.Println("  -stations              : List the scan stations that have sent this server heartbeats: when each was")
+	fmt.Println("                           last heard from and last recorded a scan, today's scans, its scans a minute")
+	fmt.Println("                           (\"high\" over its arrival_rate alert), errors and free disk.")
+	fmt.Println("                           Stations silent for three heartbeat intervals are flagged as down.")
+	fmt.Println("  -journal               : List the maintenance commands (-dedupe -remove, -compact, -restore, -ingest, -merge,")
+	fmt.Println("                           -archive, -annotate, -link, -unlink, -retire-badge, -reissue, -sync-roster)")
+	fmt.Println("                           with the files each changed, newest first.")
+	fmt.Println("  -undo-admin            : Put back the files the last maintenance command changed, or those of")
+	fmt.Println("                           -entry=<n>. Undos are journaled too, so undoing one redoes the command.")
+	fmt.Println("  -waitlist              : Show today's waitlist in order. With \"waitlist\": true in the config's capacity")
+	fmt.Println("                           section, scan mode waitlists check-ins once capacity.max people are inside.")
+	fmt.Println("  -admit-next            : Check in the first person on the waitlist and post it to the capacity webhook.")
+	fmt.Println("                           -watch and the server's /waitlist endpoint show who is being admitted.")
+	fmt.Println("  -occupancy             : Show how many people are in the building and who, from today's IN/OUT scans.")
+	fmt.Println("  -evacuate              : Print a headcount of everyone not checked out and save it as a CSV (in -dir).")
+	fmt.Println("  -check                 : Validate the data file and report problems by line number.")
+	fmt.Println("  -verify                : Verify the chained record checksums (integrity_key_file in the config).")
+	fmt.Println("  -verify-counts         : Report check-ins whose daily count doesn't match their order in the day,")
+	fmt.Println("                           and days whose counts have gaps or repeats.")
+	fmt.Println("  -renumber=<date|all>   : Renumber the daily counts of a date, week, month or range, or of every")
+	fmt.Println("                           day, in timestamp order, e.g. after editing the file by hand.")
+	fmt.Println("  -dedupe                : Report exact and near-duplicate records in the data file.")
+	fmt.Println("  -window=<duration>     : Same-ID scans closer than this are duplicates (default 10s).")
+	fmt.Println("  -remove                : With -dedupe, remove duplicates and recompute daily counts after confirmation.")
+	fmt.Println("                           The removed records go to the trash.")
+	fmt.Println("  -ingest=<file>         : Add the check-ins in a timestamp,id file from an offline scanner with their")
+	fmt.Println("                           original times, skipping repeats within -dedupe-window and renumbering daily counts.")
+	fmt.Println("  -import-outs=<file>    : Add the check-outs in a timestamp,id file, e.g. from an exit door scanner")
+	fmt.Println("                           running a capture tool, pairing each with the ID's check-in before it that day")
+	fmt.Println("                           so visits get their length. Check-outs with no check-in that day, or after")
+	fmt.Println("                           the ID already checked out, are skipped. The visits are saved as a CSV in -dir.")
+	fmt.Println("  -merge=<files>         : Merge other stations' data files, or exports made without -columns, into")
+	fmt.Println("                           this one in timestamp order. Records are matched by their scan ID, so")
+	fmt.Println("                           merging the same file again adds nothing. Clock problems at the other")
+	fmt.Println("                           stations are reported; fix one with an offset, e.g. laptop2.csv@-4m30s.")
+	fmt.Println("  -compact               : Drop unreadable lines and duplicates (using -window), renumber daily counts")
+	fmt.Println("                           and rewrite the data file after confirmation, keeping a .bak backup. The dropped")
+	fmt.Println("                           lines and records go to the trash.")
+	fmt.Println("  -trash                 : List the rows in the trash by batch, newest first. Rows are kept for the config")
+	fmt.Println("                           file's trash_days (default 30), then dropped.")
+	fmt.Println("  -restore=<ids>         : Put trashed rows back, by batch or row ID from -trash, renumbering daily counts.")
+	fmt.Println("  -issue-pass=<name>     : Issue a guest ID valid from -start to -end (default today only) that scan mode")
+	fmt.Println("                           accepts as a visitor until it expires.")
+	fmt.Println("  -lookup                : Run a help desk station for attendees who lost their badge. They search by name")
+	fmt.Println("                           or email in the -event's registrations (or the roster), give the email on file")
+	fmt.Println("                           (the config file's lookup verify_field) or show staff a photo ID, and get a new")
+	fmt.Println("                           badge from the badge_printer command and a check-in. Reprints are logged.")
+	fmt.Println("  -open-day              : Start the day's session on -start (default today) and run the start-of-day")
+	fmt.Println("                           checklist: the clock, the badge printer, disk space and the data file. Exits")
+	fmt.Println("                           with status 1 when a check fails.")
+	fmt.Println("  -close-day             : Close the day's session in one step: print the day's summary, with new and")
+	fmt.Println("                           returning visitors, and save it in -dir, run the export and backup from the")
+	fmt.Println("                           config file's day section (by default a CSV in -dir and a copy in backups) and")
+	fmt.Println("                           fire the day_close hooks. Opens and closes are logged next to the data file.")
+	fmt.Println("  -sign-waiver=<ids>     : Record that the IDs signed a waiver on -start (default today). Scan mode also")
+	fmt.Println("                           accepts a date or yes in the roster's waiver column. The config file's waivers")
+	fmt.Println("                           section makes scan mode warn about (enforce: warn) or refuse (enforce: block)")
+	fmt.Println("                           check-ins without a valid waiver, optionally only for some record types.")
+	fmt.Println("  -missing-waivers       : List active roster members who need a waiver and have no valid one, saved in -dir.")
+	fmt.Println("  -link=<ids>            : Link roster IDs as one family, or with -relation=caregiver make the first ID")
+	fmt.Println("                           a caregiver of the rest. Stored in the roster's family and caregivers columns.")
+	fmt.Println("  -unlink=<ids>          : Take IDs out of their family, or with -relation=caregiver remove the first ID")
+	fmt.Println("                           as a caregiver of the rest (or of everyone).")
+	fmt.Println("  -links                 : List families and caregivers.")
+	fmt.Println("  -relation=<relation>   : family (default) or caregiver, for -link and -unlink.")
+	fmt.Println("  -retire-badge=<id>     : Mark a badge lost (or -badge-reason=expired) in the roster's badge_status")
+	fmt.Println("                           column and deactivate it; scan mode refuses it with the reason.")
+	fmt.Println("  -reissue=<old>,<new>   : Retire the old badge and add the new ID to the roster with the same details,")
+	fmt.Println("                           issued today. The roster's replaced_by and replaces columns link the two, so")
+	fmt.Println("                           -stats, -attendance, -no-shows and visit milestones count the old badge's")
+	fmt.Println("                           scans for the person. With the config's badges valid_days, badges issued")
+	fmt.Println("                           longer ago than that are refused as expired.")
+	fmt.Println("  -badge-reason=<reason> : lost (default) or expired, for -retire-badge and -reissue.")
+	fmt.Println("  -sync-roster           : Replace the roster with the members from the config file's roster_source, a")
+	fmt.Println("                           REST endpoint sent the source's headers. Scan mode and -daemon also sync it")
+	fmt.Println("                           every interval (default 15m); columns the source lacks are kept.")
+	fmt.Println("  -ldap-lookup=<id>      : Look an ID up in the config file's ldap directory and show its name, groups")
+	fmt.Println("                           and record type. Scan mode looks up IDs missing from the roster there, with")
+	fmt.Println("                           the system ldapsearch client.")
+	fmt.Println("  -resolve=<id>          : Look an ID up through the config file's resolvers chain as scan mode does,")
+	fmt.Println("                           and say which step knew it. The chain is tried in order, each step with its")
+	fmt.Println("                           own timeout and cache: roster, ldap, rest (a url with {id}) and a closing")
+	fmt.Println("                           unknown step that records unknown IDs, with a name and record_type, or")
+	fmt.Println("                           rejects them. Without one, scan mode tries the roster and then ldap.")
+	fmt.Println("  -sync-crm              : Post the check-ins not yet synced to the config file's crm endpoint, in")
+	fmt.Println("                           batches retried with backoff, as visit activities on the contact in the")
+	fmt.Println("                           roster's crm_id column (or by email). Synced visits are logged next to the")
+	fmt.Println("                           data file; a \"crm\" job in -daemon syncs on a schedule.")
+	fmt.Println("  -queue=<status|flush>  : Show the outbound deliveries waiting to be retried, or try them all now.")
+	fmt.Println("                           Capacity, arrival rate and watch list webhooks and SMS and guardian texts are")
+	fmt.Println("                           queued next to the data file and sent in the background, as are export emails")
+	fmt.Println("                           and uploads that failed; scan mode, -serve and -daemon retry them with a")
+	fmt.Println("                           growing delay, up to hourly.")
+	fmt.Println("  -annotate=<line>       : Attach -note=<text> and/or -tag=<tags> to the record on that line (as shown by -search).")
+	fmt.Println("                           Notes and tags are kept in .notes.csv and .tags.csv files next to the data file.")
+	fmt.Println("  -tag=<tags>            : Comma-separated tags such as field-trip. Scan mode tags every scan of the session,")
+	fmt.Println("                           and export mode exports only records with at least one of the tags. Scan mode")
+	fmt.Println("                           also tags an ID's first check-in ever first_visit and greets the newcomer, and")
+	fmt.Println("                           celebrates milestone visits (the config file's milestones, default 10, 50 and")
+	fmt.Println("                           100 days with a check-in), tagged e.g. milestone_50 and listed by -close-day.")
+	fmt.Println("                           Check-ins picked at random by the config's spot_check percent are tagged")
+	fmt.Println("                           spot_check.")
+	fmt.Println("  -search=<text>         : Search records and roster by name, ID fragment or text.")
+	fmt.Println("  -output=json           : Print the result of -stats, -search, -verify or -queue as one JSON document")
+	fmt.Println("                           for scripts and monitoring, instead of text that can change between versions.")
+	fmt.Println("                           Errors are printed as {\"error\": \"...\"}, and exit statuses are unchanged.")
+	fmt.Println("  -update                : Replace this binary with the latest release for the platform from the config")
+	fmt.Println("                           file's update url, once SHA256SUMS.sig checks out with public_key_file,")
+	fmt.Println("                           SHA256SUMS's version line names the release and the download matches its")
+	fmt.Println("                           checksum. The old binary is kept as <binary>.previous.")
+	fmt.Println("                           With check_at_startup, scan mode, -serve and -daemon say when one is out.")
+	fmt.Println("  -version               : Print this build's version and platform. Releases are single binaries with")
+	fmt.Println("                           the web pages and sounds built in, made by release.sh.")
+	fmt.Println("  -roster=<file>         : Roster CSV with id and name columns (default roster.csv). Optional type and")
+	fmt.Println("                           family columns set record types and link family members for group check-in.")
+	fmt.Println("                           Scan mode, -serve and -lookup reload it, and the -event's registrations, within")
+	fmt.Println("                           seconds of a change and log who was added or removed; a copy that can't be")
+	fmt.Println("                           read or is empty leaves the loaded roster in place.")
+	fmt.Println("  -type=<type>           : Scan mode records this type instead of deriving it from the roster or ID prefix.")
+	fmt.Println("                           Export mode exports only these comma-separated types.")
+	fmt.Println("                           Types are member, visitor, staff and contractor, each with its own daily count.")
+	fmt.Println("  -direction=<in|out>    : Scan mode records check-ins (default) or check-outs, e.g. at an exit door.")
+	fmt.Println("  -time-clock            : Scan mode also serves as the staff time clock: each scan of a staff ID (or")
+	fmt.Println("                           the time_clock types in the config) punches in, or out when its last punch")
+	fmt.Println("                           was in. A scan within repeat_window (default 2m) of a punch is ignored.")
+	fmt.Println("  -test-mode             : Use a practice data file (e.g. scans.practice.csv) and label the output.")
+	fmt.Println("  -dry-run               : Scan mode validates and dedupes scans but writes nothing.")
+	fmt.Println("  -camera                : Scan mode takes a webcam photo at each check-in, saved by scan ID next to")
+	fmt.Println("                           the data file (e.g. scans.photos). The config file's camera section sets the")
+	fmt.Println("                           capture command, the record types to photograph and how long photos are kept.")
+	fmt.Println("  -metrics-log=<file>    : Log per-scan dedupe, write and total times; -serve exposes them at /metrics.")
+	fmt.Println("  -accessibility=<mode>  : Scan mode output: large (high-contrast banners) or plain (screen readers).")
+	fmt.Println("  -log-file=<file>       : Also write all output, timestamped, to this file. It is rotated to .1, .2 and so on")
+	fmt.Println("                           by the log_rotation config settings (default 10 MB or a day, keeping 7).")
+	fmt.Println("  -supervise             : With -scan, restart scan mode after a crash or a read or write error,")
+	fmt.Println("                           logging each incident to the data file's .incidents sidecar.")
+	fmt.Println("  -hid-device=<path>     : With -scan, read the scanner directly from its evdev device (e.g.")
+	fmt.Println("                           /dev/input/by-id/usb-...-event-kbd), grabbing it so scans are captured")
+	fmt.Println("                           even when the terminal loses focus. Needs read access, e.g. the input group.")
+	fmt.Println("  -stdin                 : With -scan, read IDs piped in (cat ids.txt | ./checkin -scan -stdin) without")
+	fmt.Println("                           prompts or sounds, printing one JSON result per line as -log-format=json does.")
+	fmt.Println("  -log-format=json       : Scan mode prints one JSON event per scan or error instead of console text,")
+	fmt.Println("                           with the time, -station (default the host name), outcome and latency.")
+	fmt.Println("  -event=<name>          : Use the greeting, prompt, messages, colors and sounds of an event from the config")
+	fmt.Println("                           file. The config file's theme section sets them for every event. Sounds are")
+	fmt.Println("                           files, or the built-in success.wav, duplicate.wav and alert.wav. An event's")
+	fmt.Println("                           credits setting makes each check-in count as that many attendance credits, which")
+	fmt.Println("                           -stats and exports sum separately from the check-ins (see the credits column).")
+	fmt.Println("  -file=<file>           : CSV data file (default scans.csv).")
+	fmt.Println("  -archive=<date>        : Move records from before the date into gzipped monthly archives")
+	fmt.Println("                           (scans.archive-2024-09.csv.gz). Relative keywords such as last-365-days work.")
+	fmt.Println("  -include-archives      : Also read archived records in export, search, check and verify.")
+	fmt.Println("  -history=<paths>       : Also read these comma-separated data files, or folders of .csv and .csv.gz")
+	fmt.Println("                           files, from earlier years before the live records, for multi-year exports and")
+	fmt.Println("                           reports. They are only read, so a read-only mount works; the config file's and")
+	fmt.Println("                           profiles' history lists set them too.")
+	fmt.Println("  -locale=<locale>       : Write the printed -stats and -close-day reports and the -heatmap page in this")
+	fmt.Println("                           language with its date and number formats: en-US, fr-CA or fr-FR, e.g. \"14")
+	fmt.Println("                           octobre 2026\" and \"12,5\". The default is English with ISO dates; the config")
+	fmt.Println("                           file's and profiles' locale set it too. Saved CSV files keep their metric keys.")
+	fmt.Println("  -readonly              : Refuse any command that writes to the data, roster or state files, so reports")
+	fmt.Println("                           can run against a shared data directory while a station is scanning.")
+	fmt.Println("  -partition=monthly     : Record to one file per month (scans-2025-03.csv) and read them all as one.")
+	fmt.Println("                           Records already in the data file are still read first.")
+	fmt.Println("  -tz=<zone>             : Time zone for timestamps and date ranges, e.g. America/Chicago.")
+	fmt.Println("  -dedupe-window=<dur>   : Scan mode skips repeat scans of an ID within this window (default 2h).")
+	fmt.Println("  -profile=<name>        : Use a named profile's data file, partitioning, roster, dedupe window and event.")
+	fmt.Println("  -config=<file>         : JSON config file (default checkin.json).")
 	fmt.Println("  -help                  : Display this help message.")
 	fmt.Println()
+	fmt.Println("Settings can also come from environment variables, which flags override:")
+	fmt.Print(" ")
+	for _, name := range envFlags {
+		fmt.Print(" ", envName(name))
+	}
+	fmt.Println()
+	fmt.Println()
 	fmt.Println("Examples:")
+	fmt.Println("  ./checkin -init")
 	fmt.Println("  ./checkin -scan")
+	fmt.Println("  ./checkin -scan -event=holiday-party")
+	fmt.Println("  ./checkin -scan -accessibility=large")
+	fmt.Println("  ./checkin -scan -profile=gym")
+	fmt.Println("  ./checkin -scan -dry-run")
+	fmt.Println("  ./checkin -scan -direction=out")
+	fmt.Println("  ./checkin -scan -type=visitor")
+	fmt.Println("  ./checkin -scan -test-mode")
 	fmt.Println("  ./checkin -export -start=2024-10-25")
 	fmt.Println("  ./checkin -export -start=2024-10-24 -end=2024-10-26")
+	fmt.Println("  ./checkin -export -start=2024-10-24 -end=2024-10-26 -format=parquet")
+	fmt.Println("  ./checkin -export -start=last-7-days")
+	fmt.Println("  ./checkin -export -start=2024-10-25 -columns=timestamp,name,id")
+	fmt.Println("  ./checkin -export -start=last-month -type=visitor,contractor")
+	fmt.Println("  ./checkin -export -start=last-month -type=visitor -preview")
+	fmt.Println("  ./checkin -export -start=last-month -aggregate=weekday,hour -min-count=10")
+	fmt.Println("  ./checkin -export -since-last-export -append-to=deltas.csv")
+	fmt.Println("  ./checkin -export -start=last-week -dir=reports -filename={{.Start}}_{{.End}}_{{.Count}}.csv")
+	fmt.Println("  ./checkin -export -start=2024-10-01 -end=2024-10-31 -format=csv,parquet -compress=zip")
+	fmt.Println("  ./checkin -export -start=last-week -email-to=director@example.org")
+	fmt.Println("  ./checkin -export -start=yesterday -upload=sftp")
+	fmt.Println("  ./checkin -export -start=last-month -sign")
+	fmt.Println("  ./checkin -export -start=last-week -encrypt -email-to=director@example.org")
+	fmt.Println("  ./checkin -export -week=2025-W14")
+	fmt.Println("  ./checkin -export -month=2025-03")
+	fmt.Println("  ./checkin -bundle -event=holiday-party -start=2025-12-13 -dir=packets")
+	fmt.Println("  ./checkin -watch")
+	fmt.Println("  ./checkin -serve -addr=:8080")
+	fmt.Println("  ./checkin -scan -metrics-log=metrics.csv")
+	fmt.Println("  ./checkin -daemon -config=checkin.json")
+	fmt.Println("  ./checkin -occupancy")
+	fmt.Println("  ./checkin -evacuate")
+	fmt.Println("  ./checkin -check")
+	fmt.Println("  ./checkin -verify")
+	fmt.Println("  ./checkin -dedupe -window=30s -remove")
+	fmt.Println("  ./checkin -issue-pass=\"Dana Smith\"")
+	fmt.Println("  ./checkin -issue-pass=\"Dana Smith\" -start=2025-06-02 -end=2025-06-06")
+	fmt.Println("  ./checkin -link=10,11,12")
+	fmt.Println("  ./checkin -link=30,11,12 -relation=caregiver")
+	fmt.Println("  ./checkin -links")
+	fmt.Println("  ./checkin -reissue=1001,1042 -badge-reason=lost")
+	fmt.Println("  ./checkin -annotate=42 -note=\"left early due to illness\"")
+	fmt.Println("  ./checkin -scan -tag=field-trip")
+	fmt.Println("  ./checkin -export -start=this-month -tag=makeup-session")
+	fmt.Println("  ./checkin -archive=last-365-days")
+	fmt.Println("  ./checkin -export -start=2024-01-01 -end=2024-12-31 -include-archives")
+	fmt.Println("  ./checkin -stats -start=2022-01-01 -end=2025-12-31 -history=/mnt/records/previous-years")
+	fmt.Println("  ./checkin -heatmap -month=2026-10 -locale=fr-CA")
+	fmt.Println("  ./checkin -search=marco")
 	fmt.Println("  ./checkin -help")
 }
 
-// runScanMode handles the barcode scanning and saving data to the CSV
-func runScanMode() {
-	file, err := os.OpenFile("scans.csv", os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+// scanOptions holds the scan mode settings
+type scanOptions struct {
+	Roster       map[string]rosterEntry
+	RosterFile   string         // reloaded when it changes, e.g. synced from the roster source
+	Resolvers    *resolverChain // looks scanned IDs up in the roster, directory or REST sources, in order
+	Theme        eventTheme
+	SoundCommand string
+
+	Accessibility string // large or plain; empty for the standard output
+
+	Dedupe dedupeRules // which repeat scans of an ID are skipped, by record type
+	Hours  hoursConfig // operating hours; scans outside them are flagged or refused
+	DryRun bool        // check and display scans without writing them
+
+	MetricsLog string // file per-scan timings are appended to; empty disables them
+
+	IntegrityKey []byte // HMAC key for the checksum column; nil records without one
+
+	Direction   string            // in or out; out records check-outs, e.g. at an exit door
+	Capacity    capacityConfig    // occupancy ceiling to alert on
+	ArrivalRate arrivalRateConfig // check-ins a minute to alert on
+	Pause       pauseConfig       // reason codes and message for the pause command
+	Storage     storageConfig     // free space and data file size to warn about
+	WatchList   watchListConfig   // IDs whose arrival notifies staff
+
+	GuardianSMS guardianSMSConfig // texts guardians who opted in when their child checks in or out
+
+	Registrations map[string]rosterEntry // the event's expected attendees; nil without a list
+
+	RecordType   string            // type given for every scan at this station; empty derives it per ID
+	TypePrefixes map[string]string // record type by ID prefix
+
+	Passes  passesConfig // day passes, accepted as visitors while valid
+	Badges  badgeConfig  // lost, replaced and expired badges are refused
+	Waivers waiverConfig // check-ins without a signed waiver are flagged or refused
+	Tags    []string     // added to every record written this session
+
+	Milestones []int           // visit counts celebrated at check-in
+	SpotCheck  spotCheckConfig // share of check-ins selected for secondary screening
+
+	Screening []screeningQuestion // yes/no questions asked before recording a scan
+	Pickup    pickupConfig        // check-outs of children need an authorized adult
+
+	Scanner scannerConfig // prefixes, suffixes and identifiers to strip from reads
+	Camera  *camera       // photographs check-ins; nil without -camera
+	Door    *doorRelay    // unlocked after each recorded scan; nil without one
+
+	Closures []closureConfig // days the facility is closed, warned about at startup
+	Kiosk    *kioskLock      // locks scanning after hours until the admin PIN is typed; nil without lock_after_hours
+
+	Heartbeat *heartbeat // reports recorded scans and errors to the central server; nil without one
+
+	TimeClock *timeClockConfig // staff punch in and out in turn; nil without -time-clock
+
+	HIDDevice string // evdev device to read the scanner from instead of standard input
+	NTPServer string // server the clock is checked against at startup
+	Stdin     bool   // IDs are piped in, so blank lines are skipped
+	LogFormat string // text, or json for one JSON event per scan or error
+	Station   string // station name in JSON events and the origins file
+	Event     string // the -event scanned for, noted in the origins file
+
+	Supervised bool // return on write and read errors so the supervisor can restart
+}
+
+// runScanMode handles the barcode scanning and saving data to the CSV. It
+// returns nil when the operator exits or the input ends, and otherwise the
+// error that stopped it.
+func runScanMode(options scanOptions) error {
+	fileName := currentDataFile()
+	file, err := openScanFile(fileName, options.DryRun)
 	if err != nil {
-		fmt.Println("Error opening/creating file:", err)
-		return
+		options.logError("Error opening/creating file", err)
+		return err
 	}
-	defer file.Close()
+	defer func() { file.Close() }()
 
-	writer := csv.NewWriter(file)
-	fmt.Println("Barcode scanner ready. Type 'exit' to quit.")
+	// With monthly partitions, the previous month's file is still read so
+	// repeat scans just after midnight on the 1st are caught
+	var previous *os.File
+	if partitioned {
+		year, month, _ := time.Now().Date()
+		previous, _ = os.Open(partitionFile(time.Date(year, month, 0, 0, 0, 0, 0, time.Local)))
+	}
+	defer func() {
+		if previous != nil {
+			previous.Close()
+		}
+	}()
 
-	// Regular expression to match numeric IDs
-	numRegex := regexp.MustCompile(`^\d+$`)
+	writer := newDataWriter(file)
+	if testMode {
+		options.announce(announceWarning, "TEST MODE: scans are recorded to the practice file "+fileName+".",
+			"Test mode. Scans go to a practice file, not the real records.")
+	}
+	if options.DryRun {
+		options.announce(announceWarning, "DRY RUN: scans are checked but nothing is written to "+fileName+".",
+			"Practice mode. Scans are checked but not recorded.")
+	}
+	// A board that lost its clock would otherwise record a whole day of
+	// scans in 1970
+	if check := checkClock(time.Now(), options.NTPServer); !check.OK {
+		options.announce(announceWarning, "CLOCK PROBLEM: the time "+check.Detail+". Scans will be recorded with the wrong time until it is fixed.",
+			"Warning. This station's clock is wrong. Please tell a staff member.")
+	}
+	if closure, closed := closureOn(options.Closures, time.Now().Format("2006-01-02")); closed {
+		options.announce(announceWarning, "CLOSED TODAY: "+time.Now().Format("2006-01-02")+" is "+describeClosure(closure)+" in the closures calendar. Scans are still recorded.",
+			"Warning. The facility is closed today. Please check with a staff member before scanning.")
+	}
+	options.announce(announceInfo, "Barcode scanner ready. Type '"+options.Theme.Exit+"' to quit.",
+		"Scanner ready. Scan your badge, or type "+options.Theme.Exit+" to quit.")
 
-	// Initialize the daily count and load the count for today if it exists
-	currentDate := time.Now().Format("2006-01-02")
-	dailyCount := getDailyCount(file, currentDate)
+	// Scans accepted during a dry run, so repeats are still caught
+	var dryRunRecords [][]string
+	capacity := newCapacityMonitor(options.Capacity)
+	arrivals := newArrivalMonitor(options.ArrivalRate)
+	storage := newStorageMonitor(options.Storage)
+	defer storage.wait()
+	watchList := newWatchNotifier(options.WatchList)
+	defer outbox.wait()
+	if options.Camera != nil {
+		defer options.Camera.wait()
+	}
+	if options.Door != nil {
+		defer options.Door.close()
+	}
 
-	for {
-		fmt.Print("Barcode ID: ")
-		var barcodeID string
-		fmt.Scanln(&barcodeID)
+	// Today's counts for each record type and each ID's latest scan, from
+	// the checkpoint and whatever was appended to the file after it
+	state := loadScanState(file, fileName, time.Now())
+	history, err := loadVisitHistory()
+	if err != nil {
+		options.logError("Error reading visit history, first visits and milestones won't be announced", err)
+	}
+	history.followBadges(badgeHolders(options.Roster))
+	defer func() {
+		if options.DryRun {
+			return
+		}
+		if err := state.checkpoint(time.Now(), true); err != nil {
+			options.logError("Error saving checkpoint", err)
+		}
+	}()
 
-		if barcodeID == "exit" {
-			fmt.Println("Exiting scan mode.")
-			break
+	// recentlyScanned returns the time of the scan of an ID in the direction
+	// recent enough to skip this one under its type's dedupe policy, if any.
+	// Scans other programs appended, such as mobile uploads, are read first.
+	recentlyScanned := func(barcodeID, direction string, policy dedupePolicy) (time.Time, bool) {
+		state.update(file, time.Now())
+		if t, ok := state.seen(barcodeID, direction, policy, time.Now()); ok {
+			return t, true
+		}
+		if previous != nil {
+			if t, ok := checkRecentDuplicate(previous, barcodeID, direction, policy); ok {
+				return t, true
+			}
 		}
+		return hasRecentScan(dryRunRecords, barcodeID, direction, policy, time.Now())
+	}
 
-		// Ignore non-numeric IDs
-		if !numRegex.MatchString(barcodeID) {
-			fmt.Println("Invalid input. Please enter a numeric barcode ID.")
-			continue
+	// The write or read error that stops a supervised scan mode
+	var fatal error
+
+	// The scanner reads, also read for screening answers and family choices
+	var reads <-chan scanRead
+	readAnswer := func() (string, error) { return nextRead(reads) }
+
+	// Work after each recorded scan that the next one doesn't wait for
+	followUps := startScanFollowUps(options.logError)
+	defer followUps.wait()
+
+	// The attendance credits the x<credits> modifier gives the next check-in
+	var nextCredits float64
+
+	// checkIn records one scan of an ID in the station's direction, or for a
+	// time clock punch in the direction after the ID's last punch, unless it
+	// repeats a recent scan, and reports whether it was recorded
+	checkIn := func(barcodeID string, started time.Time) bool {
+		// Move on to the new month's partition, keeping the old one for
+		// dedupe checks
+		if name := currentDataFile(); name != fileName {
+			next, err := openScanFile(name, options.DryRun)
+			if err != nil {
+				options.logError("Error opening/creating file", err)
+				fatal = err
+				return false
+			}
+			if previous != nil {
+				previous.Close()
+			}
+			previous, file, fileName = file, next, name
+			writer = newDataWriter(file)
+			state = loadScanState(file, fileName, time.Now())
 		}
 
-		// Check if this barcode ID has been scanned within the last 2 hours
-		if checkRecentDuplicate(file, barcodeID) {
-			fmt.Println("Duplicate entry within 2 hours detected. Skipping entry.")
-			continue
+		// The first scan after midnight closes the day before
+		if day := state.Date; day < started.Format("2006-01-02") && !options.DryRun {
+			hooks.closeDay(day)
 		}
 
-		// Update the daily count and check if a new day has started
-		now := time.Now()
-		if now.Format("2006-01-02") != currentDate {
-			// Reset daily count and update the current date
-			currentDate = now.Format("2006-01-02")
-			dailyCount = 0
+		// Check if this barcode ID has been scanned within the dedupe window
+		dedupeStarted := time.Now()
+		scanType := options.scanType(barcodeID)
+		policy := options.Dedupe.forType(scanType)
+		// A time clock punch goes in the direction after the ID's last punch,
+		// and only a repeat of that punch within the repeat window is a
+		// duplicate. This scan's copy of the options keeps the direction for
+		// the rest of it and the work after it.
+		options := options
+		punch := options.TimeClock != nil && options.TimeClock.punches(scanType)
+		var duplicate bool
+		var earlier time.Time // the scan this one repeats
+		if punch {
+			state.update(file, time.Now())
+			options.Direction, duplicate = state.nextPunch(barcodeID, *options.TimeClock, time.Now())
+			policy = dedupePolicy{Window: options.TimeClock.repeatWindow()}
+			earlier, _ = time.Parse("2006-01-02T15:04:05-07:00", state.LastSeen[barcodeID+" "+options.Direction])
+		} else {
+			earlier, duplicate = recentlyScanned(barcodeID, options.Direction, policy)
+		}
+		metrics := scanMetrics{Time: started, ID: barcodeID, Dedupe: time.Since(dedupeStarted)}
+		if duplicate {
+			data := greetingData{Name: rosterName(options.Roster, barcodeID), ID: barcodeID, Direction: options.Direction}
+			if !policy.Daily {
+				data.Window = humanDuration(policy.Window)
+			}
+			plain := "Already checked " + options.Direction + " within the last " + data.Window + ". Not recorded again."
+			if policy.Daily {
+				plain = "Already checked " + options.Direction + " today. Not recorded again."
+			}
+			// Saying when the ID may scan again settles arguments at the
+			// door over whether the scan went through
+			if !earlier.IsZero() {
+				data.Ago, data.Eligible = policy.repeatTimes(earlier, started)
+				plain = "Already checked " + options.Direction + " " + data.Ago + " ago. Eligible again " + data.Eligible + ". Not recorded again."
+			}
+			options.announce(announceWarning, renderGreeting(options.Theme.Duplicate, data), plain)
+			playSound(options.SoundCommand, options.Theme.DuplicateSound)
+			metrics.Outcome = "duplicate"
+			options.logMetrics(file, metrics)
+			options.logScan("duplicate", barcodeID, nil, started)
+			if !options.DryRun {
+				hooks.fire(hookEvent{Event: "duplicate", Station: options.Station, ID: barcodeID, Name: rosterName(options.Roster, barcodeID),
+					Direction: options.Direction, Type: scanType})
+				previous := state.LastSeen[barcodeID+" "+options.Direction]
+				followUps.add(func() {
+					if err := logRepeat(started, barcodeID, options.Direction, scanType, options.Station, previous); err != nil {
+						options.logError("Error writing repeats file", err)
+					}
+				})
+			}
+			return false
+		}
+		if !options.Hours.open(started) {
+			if options.Hours.Reject {
+				options.announce(announceError, "Outside operating hours. Not recorded.",
+					"The building is closed. This scan was not recorded. Please see a staff member.")
+				playSound(options.SoundCommand, options.Theme.DuplicateSound)
+				metrics.Outcome = "after_hours"
+				options.logMetrics(file, metrics)
+				options.logScan("after_hours", barcodeID, nil, started)
+				return false
+			}
+			options.announce(announceWarning, "Scan outside operating hours. It is recorded and will be listed by -after-hours.",
+				"The building is closed right now. Your scan was recorded for staff to review.")
+		}
+		if options.joinWaitlist(file, dryRunRecords, barcodeID, started) {
+			metrics.Outcome = "waitlisted"
+			options.logMetrics(file, metrics)
+			options.logScan("waitlisted", barcodeID, nil, started)
+			return false
+		}
+		_, scannedToday := recentlyScanned(barcodeID, options.Direction, dedupePolicy{Daily: true})
+		answers, passed := options.screen(readAnswer, barcodeID, scanType, !scannedToday)
+		if !passed {
+			metrics.Outcome = "screened_out"
+			options.logMetrics(file, metrics)
+			options.logScan("screened_out", barcodeID, nil, started)
+			return false
+		}
+		if _, collected := options.confirmPickup(readAnswer, barcodeID, scanType, started); !collected {
+			metrics.Outcome = "pickup_refused"
+			options.logMetrics(file, metrics)
+			options.logScan("pickup_refused", barcodeID, nil, started)
+			return false
 		}
-		dailyCount++
 
-		// Generate a timestamp in local time zone
+		// Catch up on the daily counts, which start again on a new day
+		now := time.Now()
+		state.update(file, now)
+		// Generate a timestamp in local time zone. Check-outs leave the daily
+		// count empty since it numbers arrivals.
 		timestamp := now.Format("2006-01-02T15:04:05-07:00")
-		record := []string{timestamp, barcodeID, fmt.Sprintf("%d", dailyCount)}
+		scan := Record{Timestamp: now, BadgeID: barcodeID, Direction: options.Direction, Type: scanType, ScanID: newScanID()}
+		var record, shown []string
+		var message, spoken string
+		firstVisit, visits := false, 0
+		if options.Direction == "out" {
+			record = scan.Fields()
+			shown = []string{timestamp, barcodeID}
+			message = "Goodbye!"
+			if name := rosterName(options.Roster, barcodeID); name != "" {
+				message = "Goodbye, " + name + "!"
+			}
+			spoken = "Checked out. " + spokenText(message)
+		} else {
+			state.Counts[scanType]++
+			scan.Seq = state.Counts[scanType]
+			record = scan.Fields()
+			shown = append([]string{}, record[:3]...)
+			greeting := greetingData{Name: rosterName(options.Roster, barcodeID), Count: record[2]}
+			message = renderGreeting(options.Theme.Greeting, greeting) + " " + renderGreeting(options.Theme.Detail, greeting)
+			if firstVisit = isFirstVisit(history, state, barcodeID); firstVisit {
+				message = renderGreeting(options.Theme.FirstVisit, greeting) + " " + message
+			}
+			if visits = milestone(history, state, options.Milestones, barcodeID, timestamp[:10]); visits > 0 {
+				message += "\n" + renderGreeting(options.Theme.Milestone, greetingData{Name: greeting.Name, Count: fmt.Sprintf("%d", visits)})
+			}
+			spoken = "Checked in. " + spokenText(message) + "."
+		}
+		// Check-ins worth other than one attendance credit, by the event or
+		// the modifier, say so and are noted in the credits file
+		credits := 1.0
+		if options.Direction == "in" && !punch {
+			if options.Theme.Credits > 0 {
+				credits = options.Theme.Credits
+			}
+			if nextCredits > 0 {
+				credits = nextCredits
+			}
+		}
+		if credits != 1 {
+			message += fmt.Sprintf(" (%s credits)", formatCredits(credits))
+		}
+		if punch {
+			message = fmt.Sprintf("Clocked %s at %s. %s", options.Direction, now.Format("15:04"), message)
+			spoken = fmt.Sprintf("Clocked %s. %s", options.Direction, spoken)
+		}
+		if scanType != "member" {
+			shown = append(shown, scanType)
+		}
+		spotCheck := options.Direction == "in" && options.SpotCheck.selects(scanType)
+
+		if options.DryRun {
+			dryRunRecords = append(dryRunRecords, record)
+			options.announce(announceSuccess, fmt.Sprintf("Dry run, would record: %v\n%s", shown, message),
+				"Practice scan, not recorded. "+spoken)
+			playSound(options.SoundCommand, options.Theme.SuccessSound)
+			if spotCheck {
+				options.announceSpotCheck(barcodeID)
+			}
+			capacity.update(options, options.announceOccupancy(file, dryRunRecords), now)
+			if options.Direction == "in" {
+				arrivals.update(options, now)
+				watchList.arrived(options, barcodeID, now)
+				options.announceRegistrations(file, dryRunRecords, barcodeID)
+			}
+			options.logScan("dry_run", barcodeID, record, started)
+			return true
+		}
+
+		writeStarted := time.Now()
+		if options.IntegrityKey != nil {
+			previous, err := lastChecksum()
+			if err != nil {
+				options.logError("Error reading last checksum", err)
+				return false
+			}
+			if len(record) == 3 {
+				record = append(record, "")
+			}
+			record[3] = recordChecksum(options.IntegrityKey, previous, record)
+		}
 		if err := writer.Write(record); err != nil {
-			fmt.Println("Error writing to CSV:", err)
-			continue
+			options.logError("Error writing to CSV", err)
+			options.warnDiskFull(err)
+			fatal = err
+			return false
 		}
 
 		writer.Flush()
+		metrics.Write = time.Since(writeStarted)
 		if err := writer.Error(); err != nil {
-			fmt.Println("Error flushing to CSV:", err)
-		} else {
-			fmt.Println("Recorded:", record)
+			options.logError("Error flushing to CSV", err)
+			options.warnDiskFull(err)
+			fatal = err
+			return false
+		}
+		tags := options.Tags
+		if firstVisit {
+			tags = append(append([]string{}, tags...), firstVisitTag)
+		}
+		if visits > 0 {
+			tags = append(append([]string{}, tags...), milestoneTag(visits))
+		}
+		if spotCheck {
+			tags = append(append([]string{}, tags...), spotCheckTag)
 		}
+		followUps.add(func() {
+			if len(tags) > 0 {
+				if err := appendSidecar("tags", record, tags); err != nil {
+					options.logError("Error writing tags file", err)
+				}
+			}
+			if len(answers) > 0 {
+				if err := appendSidecar("screening", record, answers); err != nil {
+					options.logError("Error writing screening file", err)
+				}
+			}
+			if credits != 1 {
+				if err := appendSidecar("credits", record, []string{formatCredits(credits)}); err != nil {
+					options.logError("Error writing credits file", err)
+				}
+			}
+			if err := logOrigin(record, options.Station, options.Event, options.source()); err != nil {
+				options.logError("Error writing origins file", err)
+			}
+		})
+		if !options.DryRun {
+			options.Heartbeat.scanned(now)
+			state.update(file, now)
+			if err := state.checkpoint(now, false); err != nil {
+				options.logError("Error saving checkpoint", err)
+			}
+		}
+		metrics.Outcome = "recorded"
+		options.logMetrics(file, metrics)
+		recorded := renderGreeting(options.Theme.Success, greetingData{Name: rosterName(options.Roster, barcodeID), Count: record[2], ID: barcodeID,
+			Direction: options.Direction, Record: fmt.Sprint(shown)})
+		options.announce(announceSuccess, recorded+"\n"+message, spoken)
+		playSound(options.SoundCommand, options.Theme.SuccessSound)
+		if spotCheck {
+			options.announceSpotCheck(barcodeID)
+		}
+		if options.Door != nil && (!options.Door.settings.StaffedHoursOnly || options.Hours.open(now)) {
+			followUps.add(func() {
+				options.Door.unlock(func(err error) {
+					options.logError("Error unlocking door", err)
+				})
+			})
+		}
+		capacity.update(options, options.announceOccupancy(file, nil), now)
+		if options.Direction == "in" {
+			arrivals.update(options, now)
+			watchList.arrived(options, barcodeID, now)
+		}
+		entry := options.Roster[barcodeID]
+		followUps.add(func() {
+			options.GuardianSMS.notify(entry, recordType(record), options.Direction, now, options.Station, func(err error) {
+				options.logError("Error texting guardian", err)
+			})
+		})
+		options.leaveWaitlist(barcodeID, now)
+		if options.Direction == "in" {
+			options.announceRegistrations(file, nil, barcodeID)
+		}
+		options.logScan("recorded", barcodeID, record, started)
+		if options.Camera != nil {
+			options.Camera.capture(record, now, func(err error) {
+				options.logError("Error taking check-in photo", err)
+			})
+		}
+		event := hookEvent{Event: "scan", Time: timestamp, Station: options.Station, ID: barcodeID, Name: entry.Name,
+			Direction: options.Direction, Type: recordType(record), Count: record[2], Record: record}
+		followUps.add(func() { hooks.fire(event) })
+		return true
 	}
-}
 
-// getDailyCount reads the CSV and returns the current daily count for the specified date
-func getDailyCount(file *os.File, currentDate string) int {
-	// Go back to the beginning of the file to read all records
-	if _, err := file.Seek(0, 0); err != nil {
-		fmt.Println("Error seeking to beginning of file:", err)
-		return 0
+	// The last read and when it arrived, for debouncing
+	var lastRead string
+	var lastReadAt time.Time
+
+	// The roster and the event's registrations are watched, and reloadRoster
+	// picks up the latest of each before a scan is handled. The watchers log
+	// through a copy of the options, as they report from their own goroutine.
+	logger := options
+	// watch starts watching a roster file, logging what each reload changed
+	watch := func(path string, people map[string]rosterEntry, what string) *rosterWatcher {
+		return watchRoster(path, people, func(change string, err error) {
+			if err != nil {
+				logger.logError("Error reloading "+what, err)
+				return
+			}
+			logger.logNotice("roster", change)
+		})
+	}
+	roster := watch(options.RosterFile, options.Roster, "roster")
+	defer roster.stop()
+	var registrations *rosterWatcher
+	if options.Theme.Registrations != "" {
+		registrations = watch(options.Theme.Registrations, options.Registrations, "registrations")
+		defer registrations.stop()
+	}
+	reloadRoster := func() {
+		if people, changed := roster.current(); changed {
+			options.Roster = people
+		}
+		if registrations == nil {
+			return
+		}
+		if people, changed := registrations.current(); changed {
+			options.Registrations = people
+		}
 	}
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	source, err := scanInput(options.HIDDevice)
 	if err != nil {
-		fmt.Println("Error reading CSV:", err)
-		return 0
+		options.logError("Error opening scanner device", err)
+		return err
 	}
+	defer source.Close()
+	reads = scanReads(source, options.HIDDevice)
 
-	// Find the maximum count for today
-	maxCount := 0
-	for _, record := range records {
-		recordDate := record[0][:10] // Extract only the date portion (YYYY-MM-DD)
-		if recordDate == currentDate && len(record) > 2 {
-			count, err := strconv.Atoi(record[2])
-			if err == nil && count > maxCount {
-				maxCount = count
-			}
+	// The pause in progress, logged when scans resume or scan mode exits
+	var pause *scanPause
+	defer func() {
+		if pause != nil {
+			options.endPause(pause, time.Now())
 		}
-	}
+	}()
+	for {
+		if fatal != nil && options.Supervised {
+			return fatal
+		}
+		storage.check(options, time.Now())
+		if !options.jsonLogs() {
+			fmt.Print(options.Theme.Prompt)
+		}
+		line, err := nextRead(reads)
+		barcodeID := strings.TrimSpace(line)
+		started := time.Now()
 
-	return maxCount
-}
+		if err != nil && err != io.EOF {
+			options.logError("Error reading scanner", err)
+			if options.Supervised {
+				return err
+			}
+		}
+		if strings.EqualFold(barcodeID, options.Theme.Exit) || (err != nil && barcodeID == "") {
+			options.announce(announceInfo, "Exiting scan mode.", "Scanner stopped.")
+			break
+		}
+		if barcodeID == "" && options.Stdin {
+			continue
+		}
+		// A station left running overnight is locked after hours, and every
+		// read is taken as the admin PIN until staff unlock it
+		if options.Kiosk != nil && options.Kiosk.locked(started) {
+			if problem, ok := options.Kiosk.unlock(barcodeID, started); !ok {
+				if barcodeID == "" {
+					problem = "Type the admin PIN to unlock."
+				}
+				options.announce(announceError, "LOCKED: "+options.Kiosk.message()+" "+problem,
+					options.Kiosk.message())
+				options.logScan("locked", "", nil, started)
+				continue
+			}
+			options.announce(announceInfo, "Unlocked. Scan badges as usual.", "Scanner unlocked.")
+			continue
+		}
+		// Staff pause the station with a reason code, e.g. for lunch, and
+		// scans are refused until they resume it
+		if command, reason, note, ok := parsePauseCommand(barcodeID); ok {
+			switch {
+			case command == "resume" && pause == nil:
+				fmt.Println("Scan mode isn't paused.")
+			case command == "resume":
+				options.endPause(pause, started)
+				pause = nil
+			case pause != nil:
+				fmt.Printf("Already paused for %s since %s. Type 'resume' first.\n", pause.Reason, pause.Started.Format("15:04"))
+			default:
+				pause = options.startPause(reason, note, started)
+			}
+			continue
+		}
+		if pause != nil {
+			options.refusePaused(barcodeID, started)
+			continue
+		}
+		// An operator's x2 before a badge makes its check-in count double
+		if credits, ok := parseCreditsModifier(barcodeID); ok {
+			nextCredits = credits
+			fmt.Printf("The next check-in counts as %s credits.\n", formatCredits(credits))
+			continue
+		}
 
-// checkRecentDuplicate checks if the barcode has been recorded within the last 2 hours
-func checkRecentDuplicate(file *os.File, barcodeID string) bool {
-	// Go back to the beginning of the file to read all records
-	if _, err := file.Seek(0, 0); err != nil {
-		fmt.Println("Error seeking to beginning of file:", err)
-		return false
-	}
+		// Remove what the scanner adds around the badge number, then ignore
+		// non-numeric IDs
+		barcodeID, symbology := options.Scanner.normalize(barcodeID)
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		fmt.Println("Error reading CSV:", err)
-		return false
-	}
+		// Ignore the extra reads a scanner fires for one presentation of a
+		// badge, measured from the latest so a burst is ignored as a whole
+		bounced := barcodeID == lastRead && started.Sub(lastReadAt) < time.Duration(options.Scanner.Debounce)
+		lastRead, lastReadAt = barcodeID, started
+		if bounced {
+			options.logScan("debounced", barcodeID, nil, started)
+			continue
+		}
+		if !barcodePattern.MatchString(barcodeID) {
+			options.announce(announceError, "Invalid input. Please enter a numeric barcode ID.",
+				"Badge not recognized. Please scan again.")
+			options.logScan("invalid", barcodeID, nil, started)
+			continue
+		}
+		// A read cut short by a badge pulled away too soon is still numeric,
+		// so the configured formats catch it
+		if err := options.Scanner.check(barcodeID, symbology); err != nil {
+			options.announce(announceError, "Partial read: "+err.Error()+". Please scan again.",
+				"Badge not read fully. Please scan again.")
+			options.logScan("partial", barcodeID, nil, started)
+			continue
+		}
 
-	// Get the current time and the cutoff time for duplicates (2 hours ago)
-	now := time.Now()
-	twoHoursAgo := now.Add(-2 * time.Hour)
+		reloadRoster()
+		entry, source, errs := options.Resolvers.resolve(barcodeID, options.Roster, started)
+		for _, err := range errs {
+			options.logError("Error looking up ID", err)
+		}
+		if source == "unknown" && options.Resolvers.rejectsUnknown() {
+			options.announce(announceError, fmt.Sprintf("ID %s is not recognized. Not recorded.", barcodeID),
+				"Badge not recognized. Please see the front desk.")
+			playSound(options.SoundCommand, options.Theme.DuplicateSound)
+			options.logScan("unknown", barcodeID, nil, started)
+			continue
+		}
+		if source != "roster" && (source != "unknown" || entry.Name != "" || entry.Fields["type"] != "") {
+			options.Roster[barcodeID] = entry
+		}
 
-	// Check each record to see if there is a recent duplicate
-	for _, record := range records {
-		recordTime, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+		// Day passes are only accepted while valid. The passes file is read on
+		// every scan so passes issued at the front desk work right away.
+		passes, err := loadPasses(options.Passes.path())
 		if err != nil {
-			fmt.Println("Error parsing timestamp:", err)
+			options.logError("Error reading passes", err)
+		}
+		if pass, ok := passes[barcodeID]; ok {
+			if !pass.validOn(started) {
+				options.announce(announceError, fmt.Sprintf("Day pass %s for %s is valid %s to %s only. Not recorded.", pass.ID, pass.Name, pass.First, pass.Last),
+					"This guest pass has expired or is not valid today. Please see the front desk.")
+				playSound(options.SoundCommand, options.Theme.DuplicateSound)
+				options.logScan("rejected", barcodeID, nil, started)
+				continue
+			}
+			options.Roster[barcodeID] = rosterEntry{ID: pass.ID, Name: pass.Name, Fields: map[string]string{"type": "visitor"}}
+		}
+		if entry, ok := options.Roster[barcodeID]; ok && options.Badges.badgeProblem(entry, started) != "" {
+			options.announce(announceError, fmt.Sprintf("Badge %s (%s): %s. Not recorded.", barcodeID, entry.Name, options.Badges.badgeProblem(entry, started)),
+				"This badge is no longer valid. Please see the front desk for a new one.")
+			playSound(options.SoundCommand, options.Theme.DuplicateSound)
+			options.logScan("rejected", barcodeID, nil, started)
+			continue
+		}
+		if entry, ok := options.Roster[barcodeID]; ok && !rosterActive(entry) {
+			options.announce(announceError, fmt.Sprintf("Badge %s (%s) is deactivated. Not recorded.", barcodeID, entry.Name),
+				"This badge is not active. Please see the front desk.")
+			playSound(options.SoundCommand, options.Theme.DuplicateSound)
+			options.logScan("inactive", barcodeID, nil, started)
+			continue
+		}
+		if !options.checkWaiver(barcodeID, started) {
 			continue
 		}
 
-		if record[1] == barcodeID && recordTime.After(twoHoursAgo) {
-			return true
+		recorded := checkIn(barcodeID, started)
+		nextCredits = 0
+		if !recorded {
+			continue
+		}
+
+		// Offer to record the rest of the family along with this badge,
+		// leaving out anyone already scanned
+		var family []string
+		for _, id := range familyMembers(options.Roster, barcodeID) {
+			if _, scanned := recentlyScanned(id, options.Direction, options.Dedupe.forType(options.scanType(id))); !scanned {
+				family = append(family, id)
+			}
+		}
+		for _, id := range options.confirmFamily(readAnswer, family) {
+			checkIn(id, time.Now())
 		}
 	}
+	return nil
+}
 
-	return false
+// openScanFile opens a data file for scan mode to append to. A dry run only
+// reads the existing records for dedupe checks and counts, and never creates
+// or writes the file.
+func openScanFile(name string, dryRun bool) (*os.File, error) {
+	if !dryRun {
+		return os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	}
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return os.Open(os.DevNull)
+	}
+	return file, err
 }
 
-// runExportMode handles reading and exporting records from a date or date range
-func runExportMode(startDate, endDate string) {
-	file, err := os.Open("scanned_barcodes.csv")
-	if err != nil {
-		fmt.Println("Error opening file:", err)
-		return
+// announceOccupancy announces and returns how many people are in the building
+// after a scan, counting the data file and any unrecorded dry run scans
+func (options scanOptions) announceOccupancy(file *os.File, extra [][]string) int {
+	if _, err := file.Seek(0, 0); err != nil {
+		fmt.Println("Error seeking to beginning of file:", err)
+		return 0
 	}
-	defer file.Close()
+	records, _, _ := readRecords(file)
+	present := presentIDs(append(records, extra...), time.Now())
+	options.announce(announceInfo, fmt.Sprintf("In the building: %d", len(present)),
+		fmt.Sprintf("%d in the building.", len(present)))
+	return len(present)
+}
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+// checkWaiver warns about or, with enforce set to block, refuses a check-in by
+// someone without a valid waiver, returning false when refused. The waivers
+// file is read on every check-in so waivers signed at the front desk count
+// right away.
+func (options scanOptions) checkWaiver(barcodeID string, now time.Time) bool {
+	settings := options.Waivers
+	if settings.Enforce == "" || options.Direction != "in" || !settings.required(options.scanType(barcodeID)) {
+		return true
+	}
+	waivers, err := loadWaivers(settings.path())
 	if err != nil {
-		fmt.Println("Error reading CSV:", err)
-		return
+		options.logError("Error reading waivers file", err)
+	}
+	entry := options.Roster[barcodeID]
+	problem := settings.waiverProblem(barcodeID, entry, waivers, now)
+	if problem == "" {
+		return true
+	}
+	name := entry.Name
+	if name == "" {
+		name = "unknown"
+	}
+	if settings.Enforce == "block" {
+		options.announce(announceError, fmt.Sprintf("WAIVER: %s (%s) has %s. Not recorded.", barcodeID, name, problem),
+			"A signed waiver is needed before you can enter. Please see the front desk.")
+		playSound(options.SoundCommand, options.Theme.DuplicateSound)
+		options.logScan("no_waiver", barcodeID, nil, now)
+		return false
 	}
+	options.announce(announceWarning, fmt.Sprintf("WAIVER: %s (%s) has %s.", barcodeID, name, problem),
+		"Please see the front desk about your waiver.")
+	return true
+}
 
-	// Parse the start date in local time
-	location := time.Now().Location()
-	start, err := time.ParseInLocation("2006-01-02", startDate, location)
-	if err != nil {
-		fmt.Println("Error parsing start date:", err)
+// scanType returns the record type a scan of the ID is recorded as
+func (options scanOptions) scanType(barcodeID string) string {
+	if options.RecordType != "" {
+		return options.RecordType
+	}
+	return deriveType(barcodeID, options.Roster, options.TypePrefixes)
+}
+
+// logMetrics finishes a scan's timings and appends them to the metrics log, if
+// one is set. Dry runs write nothing, including metrics.
+func (options scanOptions) logMetrics(file *os.File, metrics scanMetrics) {
+	if options.MetricsLog == "" || options.DryRun {
 		return
 	}
+	metrics.Total = time.Since(metrics.Time)
+	if info, err := file.Stat(); err == nil {
+		metrics.FileBytes = info.Size()
+	}
+	if err := appendMetrics(options.MetricsLog, metrics); err != nil {
+		fmt.Println("Error writing metrics log:", err)
+	}
+}
 
-	// Set the end date for a single day or a range
-	var end time.Time
-	if endDate == "" {
-		end = start.Add(24 * time.Hour).Add(-time.Second) // end of the start day
-	} else {
-		end, err = time.ParseInLocation("2006-01-02", endDate, location)
-		if err != nil {
-			fmt.Println("Error parsing end date:", err)
-			return
-		}
-		end = end.Add(24 * time.Hour).Add(-time.Second) // end of the end day
+// checkRecentDuplicate returns the time the barcode was recorded in the same
+// direction when it was recent enough to make a scan now a duplicate under
+// the policy
+func checkRecentDuplicate(file *os.File, barcodeID, direction string, policy dedupePolicy) (time.Time, bool) {
+	// Go back to the beginning of the file to read all records
+	if _, err := file.Seek(0, 0); err != nil {
+		fmt.Println("Error seeking to beginning of file:", err)
+		return time.Time{}, false
 	}
 
-	// Filter records by date range in local time
-	var filteredRecords [][]string
+	// Malformed lines were reported when scan mode started
+	records, _, _ := readRecords(file)
+
+	return hasRecentScan(records, barcodeID, direction, policy, time.Now())
+}
+
+// hasRecentScan checks each record to see if the barcode was scanned in the
+// direction in a way that makes a scan at now a repeat under the policy,
+// returning the latest such scan's time
+func hasRecentScan(records [][]string, barcodeID, direction string, policy dedupePolicy, now time.Time) (time.Time, bool) {
+	var latest time.Time
+	found := false
 	for _, record := range records {
-		recordTime, err := time.ParseInLocation("2006-01-02T15:04:05-07:00", record[0], location)
+		recordTime, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
 		if err != nil {
 			fmt.Println("Error parsing timestamp:", err)
 			continue
 		}
 
-		if (recordTime.Equal(start) || recordTime.After(start)) && recordTime.Before(end) {
-			filteredRecords = append(filteredRecords, record)
+		if record[1] == barcodeID && recordDirection(record) == direction && policy.repeats(recordTime, now) && (!found || recordTime.After(latest)) {
+			latest, found = recordTime, true
 		}
 	}
 
-	// Handle case where no records are found
-	if len(filteredRecords) == 0 {
-		fmt.Println("No records found for the specified date range.")
-		return
-	}
-
-	// Create a dynamic filename with the date range and record count
-	var filename string
-	if endDate == "" {
-		filename = fmt.Sprintf("export_%s_%d_records.csv", startDate, len(filteredRecords))
-	} else {
-		filename = fmt.Sprintf("export_%s_to_%s_%d_records.csv", startDate, endDate, len(filteredRecords))
-	}
-
-	// Export filtered records to the dynamically named file
-	exportFile, err := os.Create(filename)
-	if err != nil {
-		fmt.Println("Error creating export file:", err)
-		return
-	}
-	defer exportFile.Close()
-
-	writer := csv.NewWriter(exportFile)
-	if err := writer.WriteAll(filteredRecords); err != nil {
-		fmt.Println("Error writing to export file:", err)
-	} else {
-		fmt.Printf("Exported %d records to %s\n", len(filteredRecords), filename)
-	}
-	writer.Flush()
+	return latest, found
 }
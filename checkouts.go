@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// importedVisit is a check-in paired with an imported check-out
+type importedVisit struct {
+	ID      string
+	In, Out time.Time
+}
+
+// runImportOutsMode adds the check-outs in a file of "timestamp,id" lines,
+// such as one from an exit door scanner running a plain capture tool, to the
+// data file, giving the visits they close a length after the fact. Each
+// check-out is paired with the ID's latest check-in before it on the same
+// day; one with no check-in that day, or after the ID already checked out,
+// is skipped, which also drops an exit scanner's double reads. The new
+// records take the type of the check-in they close and are merged in
+// timestamp order. The paired visits are saved with their minutes as a CSV
+// in dir.
+func runImportOutsMode(path, rosterFile string, scanner scannerConfig, comma rune, dir string) {
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+	ids, times, err := readOfflineScans(path, scanner, comma)
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	records, sources, err := readDataFile()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error reading CSV:", err)
+		fmt.Println("Importing check-outs rewrites the whole file, so fix the malformed lines first (see -check).")
+		return
+	}
+
+	// Every scan of each ID by local day, recorded or imported, in time order
+	type scan struct {
+		at   time.Time
+		out  bool
+		kind string
+	}
+	days := make(map[string][]scan)
+	for _, fields := range records {
+		if record, err := parseRecord(fields); err == nil {
+			key := record.BadgeID + " " + record.Timestamp.In(time.Local).Format("2006-01-02")
+			days[key] = append(days[key], scan{record.Timestamp, record.Direction == "out", record.Type})
+		}
+	}
+	for key := range days {
+		sort.SliceStable(days[key], func(i, j int) bool { return days[key][i].at.Before(days[key][j].at) })
+	}
+	order := make([]int, len(ids))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return times[order[a]].Before(times[order[b]]) })
+
+	var added [][]string
+	var addedTimes []time.Time
+	var visits []importedVisit
+	noCheckIn, checkedOut := 0, 0
+	for _, i := range order {
+		key := ids[i] + " " + times[i].In(time.Local).Format("2006-01-02")
+		// The scan just before this check-out says what it closes
+		var before *scan
+		for j := range days[key] {
+			if !days[key][j].at.Before(times[i]) {
+				break
+			}
+			before = &days[key][j]
+		}
+		switch {
+		case before == nil:
+			noCheckIn++
+			continue
+		case before.out:
+			checkedOut++
+			continue
+		}
+		visits = append(visits, importedVisit{ID: ids[i], In: before.at, Out: times[i]})
+		record := Record{Timestamp: times[i], BadgeID: ids[i], Direction: "out", Type: before.kind, ScanID: newScanID()}
+		added = append(added, record.Fields())
+		addedTimes = append(addedTimes, times[i])
+		days[key] = append(days[key], scan{times[i], true, before.kind})
+		sort.SliceStable(days[key], func(a, b int) bool { return days[key][a].at.Before(days[key][b].at) })
+	}
+	skipped := fmt.Sprintf("%d without a check-in earlier that day, %d after the ID already checked out", noCheckIn, checkedOut)
+	if len(added) == 0 {
+		fmt.Printf("No check-outs to import from %s (skipped %s).\n", path, skipped)
+		return
+	}
+
+	merged, mergedSources := mergeRecords(records, sources, added, addedTimes)
+	if err := rewriteDataFile(merged, mergedSources); err != nil {
+		fmt.Println("Error rewriting data file:", err)
+		return
+	}
+	if err := logOrigins(added, "import"); err != nil {
+		fmt.Println("Error writing origins file:", err)
+	}
+	var total time.Duration
+	for _, visit := range visits {
+		total += visit.Out.Sub(visit.In)
+	}
+	average := (total / time.Duration(len(visits))).Round(time.Minute)
+	fmt.Printf("Imported %d check-outs from %s into %s, an average stay of %dh%02dm (skipped %s).\n",
+		len(added), path, dataName(), int(average.Hours()), int(average.Minutes())%60, skipped)
+	for _, record := range merged {
+		if len(record) > 3 && record[3] != "" {
+			fmt.Println("Warning: Record checksums no longer match the rewritten file, so -verify will report it.")
+			break
+		}
+	}
+
+	rows := [][]string{{"date", "id", "name", "checked_in", "checked_out", "minutes"}}
+	for _, visit := range visits {
+		rows = append(rows, []string{visit.In.In(time.Local).Format("2006-01-02"), visit.ID, rosterName(roster, visit.ID),
+			visit.In.In(time.Local).Format("15:04:05"), visit.Out.In(time.Local).Format("15:04:05"), strconv.Itoa(int(visit.Out.Sub(visit.In).Minutes()))})
+	}
+	first, last := rows[1][0], rows[len(rows)-1][0]
+	filename := "visits_" + first + "_" + last + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving visit lengths:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving visit lengths:", err)
+		return
+	}
+	fmt.Println("Saved the visit lengths to", filename)
+}
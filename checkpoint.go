@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// checkpointInterval is how often scan mode saves its state, at most
+const checkpointInterval = time.Minute
+
+// scanState is what scan mode knows about the data file: today's daily counts
+// and each ID's latest scan. It is kept up to date by reading only what was
+// appended since the last read, and checkpointed so a restart after a crash
+// or power cut picks up from there instead of reading the whole file again.
+type scanState struct {
+	DataFile string            `json:"data_file"`
+	Date     string            `json:"date"`      // the day Counts are for
+	Offset   int64             `json:"offset"`    // bytes of the data file read so far
+	Tail     string            `json:"tail"`      // the last line read, to tell whether the file was rewritten since
+	Counts   map[string]int    `json:"counts"`    // today's highest daily count by record type
+	LastSeen map[string]string `json:"last_seen"` // latest scan timestamp by "id direction"
+
+	saved time.Time
+}
+
+// checkpointFile returns the file next to the data file scan mode saves its
+// state to, e.g. scans.checkpoint.json for scans.csv
+func checkpointFile() string {
+	return strings.TrimSuffix(dataFile, filepath.Ext(dataFile)) + ".checkpoint.json"
+}
+
+// loadScanState returns scan mode's state for the open data file, starting
+// from the checkpoint when it belongs to the same file and reading whatever
+// was appended after it
+func loadScanState(file *os.File, name string, now time.Time) *scanState {
+	var state scanState
+	if data, err := os.ReadFile(checkpointFile()); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	if state.DataFile != name {
+		state = scanState{DataFile: name}
+	}
+	state.update(file, now)
+	return &state
+}
+
+// update reads the records appended to the data file since the last read. A
+// file that shrank or no longer ends the way it did was rewritten, by
+// -dedupe -remove for example, and is read again from the start.
+func (s *scanState) update(file *os.File, now time.Time) {
+	if s.Offset > 0 {
+		tail := make([]byte, len(s.Tail))
+		if _, err := file.ReadAt(tail, s.Offset-int64(len(tail))); err != nil || string(tail) != s.Tail {
+			*s = scanState{DataFile: s.DataFile}
+		}
+	}
+	if s.LastSeen == nil {
+		s.LastSeen = make(map[string]string)
+	}
+	if today := now.Format("2006-01-02"); s.Counts == nil || s.Date != today {
+		s.Date, s.Counts = today, make(map[string]int)
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(file, s.Offset, 1<<62))
+	if err != nil {
+		return
+	}
+	// A line still being written is read next time
+	end := bytes.LastIndexByte(data, '\n') + 1
+	if end == 0 {
+		return
+	}
+	records, _, bad := readRecords(bytes.NewReader(data[:end]))
+	if s.Offset == 0 {
+		reportBadRows(bad)
+	}
+	for _, record := range records {
+		// Uploads from the mobile API can arrive out of order
+		key := record[1] + " " + recordDirection(record)
+		if latest, ok := s.LastSeen[key]; !ok || recordAfter(record[0], latest) {
+			s.LastSeen[key] = record[0]
+		}
+		if record[0][:10] == s.Date && len(record) > 2 {
+			if count, err := strconv.Atoi(record[2]); err == nil && count > s.Counts[recordType(record)] {
+				s.Counts[recordType(record)] = count
+			}
+		}
+	}
+	start := bytes.LastIndexByte(data[:end-1], '\n') + 1
+	s.Offset += int64(end)
+	s.Tail = string(data[start:end])
+}
+
+// recordAfter reports whether timestamp a is later than b
+func recordAfter(a, b string) bool {
+	ta, errA := time.Parse("2006-01-02T15:04:05-07:00", a)
+	tb, errB := time.Parse("2006-01-02T15:04:05-07:00", b)
+	return errA == nil && (errB != nil || ta.After(tb))
+}
+
+// seen returns the ID's latest scan in the direction when it makes a scan
+// at now a repeat under the policy
+func (s *scanState) seen(barcodeID, direction string, policy dedupePolicy, now time.Time) (time.Time, bool) {
+	latest, ok := s.LastSeen[barcodeID+" "+direction]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("2006-01-02T15:04:05-07:00", latest)
+	return t, err == nil && policy.repeats(t, now)
+}
+
+// checkpoint saves the state if it hasn't been saved for a while, or
+// whenever force is set, replacing the old checkpoint in one rename so a
+// power cut never leaves half of one
+func (s *scanState) checkpoint(now time.Time, force bool) error {
+	if !force && now.Sub(s.saved) < checkpointInterval {
+		return nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	name := checkpointFile()
+	if err := os.WriteFile(name+".tmp", data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	s.saved = now
+	return nil
+}
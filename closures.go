@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// closureConfig is one entry of the config file's "closures" calendar: a day,
+// or a run of days, the facility is closed, such as a holiday or a snow day.
+// Reports leave closures out of their averages and streaks, and scan mode
+// warns when a station is started on one.
+type closureConfig struct {
+	Date    string `json:"date"`    // YYYY-MM-DD
+	Through string `json:"through"` // last day of a closure of several days; empty for one day
+	Reason  string `json:"reason"`  // e.g. "Thanksgiving"
+}
+
+// checkClosures validates the closures calendar
+func checkClosures(closures []closureConfig) error {
+	for _, closure := range closures {
+		if _, err := time.Parse("2006-01-02", closure.Date); err != nil {
+			return fmt.Errorf("closures: date must be YYYY-MM-DD, not %q", closure.Date)
+		}
+		if closure.Through == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", closure.Through); err != nil {
+			return fmt.Errorf("closures: through must be YYYY-MM-DD, not %q", closure.Through)
+		}
+		if closure.Through < closure.Date {
+			return fmt.Errorf("closures: %s ends before it starts", closure.Date)
+		}
+	}
+	return nil
+}
+
+// closureOn returns the closure covering a date (YYYY-MM-DD), reporting
+// false when the facility isn't closed that day
+func closureOn(closures []closureConfig, date string) (closureConfig, bool) {
+	for _, closure := range closures {
+		last := closure.Through
+		if last == "" {
+			last = closure.Date
+		}
+		if date >= closure.Date && date <= last {
+			return closure, true
+		}
+	}
+	return closureConfig{}, false
+}
+
+// openOn reports whether the facility is open on a date (YYYY-MM-DD): it
+// isn't a closure and, when weekly operating hours are set, the weekday has
+// hours
+func (cfg config) openOn(date string) bool {
+	if _, closed := closureOn(cfg.Closures, date); closed {
+		return false
+	}
+	if len(cfg.Hours.Weekly) == 0 {
+		return true
+	}
+	day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	return err == nil && cfg.Hours.Weekly[hoursDays[day.Weekday()]] != ""
+}
+
+// describeClosure describes a closure for warnings, e.g. "a closure day
+// (Thanksgiving)"
+func describeClosure(closure closureConfig) string {
+	if closure.Reason == "" {
+		return "a closure day"
+	}
+	return "a closure day (" + closure.Reason + ")"
+}
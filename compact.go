@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// runCompactMode rewrites the data files without their unreadable lines and
+// duplicate records, renumbering the daily counts. Unlike -dedupe it doesn't
+// stop at malformed lines, so it is the cleanup after many repairs. Each file
+// is backed up to a .bak file before it is rewritten.
+func runCompactMode(window time.Duration, cfg config) {
+	names, err := dataFiles()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	var records [][]string
+	var sources, places []string
+	var trashed []trashedRow
+	var before int64
+	unreadable := 0
+	for _, name := range names {
+		contents, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Println("Error opening file:", err)
+			return
+		}
+		before += int64(len(contents))
+		fileRecords, fileLines, bad := readRecords(bytes.NewReader(contents))
+
+		// Unreadable lines go to the trash as their text
+		lines := strings.Split(string(contents), "\n")
+		for _, row := range bad {
+			fmt.Printf("%s line %d: %s\n", name, row.Line, row.Reason)
+			if row.Line > 0 && row.Line <= len(lines) {
+				trashed = append(trashed, trashedRow{Reason: row.Reason, Source: name, Line: true, Fields: []string{strings.TrimRight(lines[row.Line-1], "\r")}})
+			}
+		}
+		unreadable += len(bad)
+		for i, record := range fileRecords {
+			records = append(records, record)
+			sources = append(sources, name)
+			places = append(places, fmt.Sprintf("%s:%d", name, fileLines[i]))
+		}
+	}
+
+	duplicates := findDuplicates(records, places, window)
+	var kept [][]string
+	var keptSources []string
+	for i, record := range records {
+		if reason, ok := duplicates[i]; ok {
+			fmt.Printf("%s: %s (%s)\n", places[i], strings.Join(record, ","), reason)
+			trashed = append(trashed, trashedRow{Reason: reason, Source: sources[i], Fields: record})
+			continue
+		}
+		kept = append(kept, record)
+		keptSources = append(keptSources, sources[i])
+	}
+
+	renumbered := make([][]string, len(kept))
+	for i, record := range kept {
+		renumbered[i] = append([]string{}, record...)
+	}
+	renumberDailyCounts(renumbered)
+	changed := 0
+	for i := range kept {
+		if strings.Join(kept[i], ",") != strings.Join(renumbered[i], ",") {
+			changed++
+		}
+	}
+
+	if unreadable == 0 && len(duplicates) == 0 && changed == 0 {
+		fmt.Println("Nothing to compact.")
+		return
+	}
+	fmt.Printf("Found %d unreadable lines and %d duplicate records to drop, and %d daily counts to renumber.\n",
+		unreadable, len(duplicates), changed)
+	if !confirmDestructive(cfg, "rewrite", unreadable+len(duplicates)+changed, len(records)+unreadable) {
+		return
+	}
+
+	batch := ""
+	if len(trashed) > 0 {
+		if batch, err = moveToTrash(cfg, "compact", trashed); err != nil {
+			fmt.Println("Error moving the dropped rows to the trash, nothing was changed:", err)
+			return
+		}
+	}
+	if err := rewriteDataFile(renumbered, keptSources); err != nil {
+		fmt.Println("Error rewriting data file:", err)
+		if batch != "" {
+			discardTrashBatch(batch)
+		}
+		return
+	}
+
+	var after int64
+	for _, name := range names {
+		if info, err := os.Stat(name); err == nil {
+			after += info.Size()
+		}
+	}
+	backups := "backup saved to " + dataFile + ".bak"
+	if partitioned {
+		backups = "backups saved as .bak files"
+	}
+	fmt.Printf("Compacted %s from %d to %d bytes (%s).\n", dataName(), before, after, backups)
+	if batch != "" {
+		trashNotice(cfg, batch, len(trashed))
+	}
+	for _, record := range renumbered {
+		if len(record) > 3 && record[3] != "" {
+			fmt.Println("Warning: Record checksums no longer match the rewritten file, so -verify will report it.")
+			break
+		}
+	}
+}
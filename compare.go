@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runCompareMode lists the IDs that checked in during one period but not
+// the other, in both directions, e.g. who came Monday but not Tuesday. Each
+// period is anything parseRange accepts. The lists are also saved as one CSV
+// in dir with the period each ID attended and the one it missed.
+func runCompareMode(periods, rosterFile, dir string) {
+	specs := strings.Split(periods, ",")
+	if len(specs) != 2 {
+		fmt.Println("Error: -compare takes two periods separated by a comma, e.g. -compare=2025-03-03,2025-03-04.")
+		return
+	}
+	var firsts, lasts, labels [2]string
+	for i, spec := range specs {
+		first, last, err := parseRange(strings.TrimSpace(spec), time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		firsts[i], lasts[i], labels[i] = first, last, first
+		if last != first {
+			labels[i] = first + "_to_" + last
+		}
+	}
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+	arrived := [2]map[string]bool{
+		arrivedIDs(records, firsts[0], lasts[0]),
+		arrivedIDs(records, firsts[1], lasts[1]),
+	}
+
+	rows := [][]string{{"id", "name", "attended", "missed"}}
+	for i := range arrived {
+		other := 1 - i
+		var only []string
+		for id := range arrived[i] {
+			if !arrived[other][id] {
+				only = append(only, id)
+			}
+		}
+		sort.Strings(only)
+
+		fmt.Printf("In %s but not %s: %d\n", strings.ReplaceAll(labels[i], "_", " "), strings.ReplaceAll(labels[other], "_", " "), len(only))
+		for _, id := range only {
+			fmt.Printf("  %-12s %s\n", id, rosterName(roster, id))
+			rows = append(rows, []string{id, rosterName(roster, id), labels[i], labels[other]})
+		}
+		fmt.Println()
+	}
+
+	filename := "compare_" + labels[0] + "_vs_" + labels[1] + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving comparison:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving comparison:", err)
+		return
+	}
+	fmt.Println("Saved to", filename)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// compressExports compresses the written export files and returns the names
+// of the compressed files. gzip compresses each file on its own while zip
+// bundles every file into one archive named after the first. The
+// uncompressed files are removed.
+func compressExports(files []string, method string) ([]string, error) {
+	switch method {
+	case "gzip":
+		var compressed []string
+		for _, file := range files {
+			if err := gzipFile(file, file+".gz"); err != nil {
+				return nil, err
+			}
+			os.Remove(file)
+			compressed = append(compressed, file+".gz")
+		}
+		return compressed, nil
+	case "zip":
+		archive := strings.TrimSuffix(files[0], filepath.Ext(files[0])) + ".zip"
+		if err := zipFiles(archive, files); err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			os.Remove(file)
+		}
+		return []string{archive}, nil
+	}
+	return nil, fmt.Errorf("unknown compression %q", method)
+}
+
+// gzipFile writes a gzip-compressed copy of src to dst
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	gz.Name = filepath.Base(src)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// zipFiles writes a zip archive to dst holding each of the files under its
+// base name
+func zipFiles(dst string, files []string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	archive := zip.NewWriter(out)
+
+	for _, file := range files {
+		if err := addZipFile(archive, file); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// addZipFile adds one file to the archive, keeping its modification time
+func addZipFile(archive *zip.Writer, file string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Method = zip.Deflate
+
+	w, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, in)
+	return err
+}
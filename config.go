@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// config holds settings read from the JSON config file. Settings that only
+// matter to a single run are command-line flags instead.
+type config struct {
+	SMTP  smtpConfig  `json:"smtp"`
+	SFTP  sftpConfig  `json:"sftp"`
+	Drive driveConfig `json:"drive"`
+	Share shareConfig `json:"share"` // network folder for -upload=share
+	Push  pushConfig  `json:"push"`  // another instance -push sends exported records to
+	Jobs  []jobConfig `json:"jobs"`  // run by -daemon
+
+	Theme        eventTheme            `json:"theme"`         // prompt, messages, colors and sounds for every event
+	Events       map[string]eventTheme `json:"events"`        // selected with -event
+	SoundCommand string                `json:"sound_command"` // plays theme sounds at the scan station, e.g. "aplay -q"
+
+	Profiles map[string]profileConfig `json:"profiles"` // selected with -profile
+
+	IntegrityKeyFile string `json:"integrity_key_file"` // HMAC key; when set, scan mode adds a chained checksum column
+	SigningKeyFile   string `json:"signing_key_file"`   // PKCS #8 PEM Ed25519 or RSA key for -sign
+	ExportPassword   string `json:"export_password"`    // password for -encrypt archives
+
+	// Roles (viewer, operator or admin) by API token for the server. Roles by
+	// login name for commands are in the users policy file; Users is only
+	// read to refuse commands from configs that still list them here.
+	Users     map[string]string `json:"users"`
+	APITokens map[string]string `json:"api_tokens"`
+
+	// SHA-256 hex digest of a second admin's code, required along with the
+	// typed confirmation before records are deleted or rewritten
+	ApprovalCodeSHA256 string `json:"approval_code_sha256"`
+
+	TrashDays int `json:"trash_days"` // days rows removed by -dedupe -remove and -compact stay restorable; default 30
+
+	Capacity capacityConfig `json:"capacity"` // occupancy ceiling for scan mode alerts
+
+	ArrivalRate arrivalRateConfig `json:"arrival_rate"` // check-ins a minute scan mode alerts on, to open another lane
+
+	Pause pauseConfig `json:"pause"` // reason codes and message for scan mode's pause command
+
+	Storage storageConfig `json:"storage"` // free space and data file size scan mode warns about
+
+	Heartbeat heartbeatConfig `json:"heartbeat"` // central server scan mode reports the station's status to
+
+	Update updateConfig `json:"update"` // release server -update installs new versions from
+
+	WatchList watchListConfig `json:"watch_list"` // IDs whose check-in notifies staff
+
+	GuardianSMS guardianSMSConfig `json:"guardian_sms"` // texts to opted-in guardians on check-in and check-out
+
+	ContactFields []string `json:"contact_fields"` // roster columns in the no-show report; default email and phone
+
+	TypePrefixes map[string]string `json:"type_prefixes"` // record type by ID prefix, e.g. "9": "visitor"
+
+	Passes passesConfig `json:"passes"` // temporary guest IDs issued with -issue-pass
+
+	Tracing tracingConfig `json:"tracing"` // OpenTelemetry collector for server and integration spans
+
+	LogRotation logRotationConfig `json:"log_rotation"` // limits for the -log-file activity log
+
+	Scanner scannerConfig `json:"scanner"` // what to strip from raw scanner reads
+
+	Camera cameraConfig `json:"camera"` // check-in photos taken with -camera
+	Door   doorConfig   `json:"door"`   // relay unlocking a door after each recorded scan
+
+	Waivers waiverConfig `json:"waivers"` // signed waivers scan mode checks for
+	Kiosk   kioskConfig  `json:"kiosk"`   // after-hours lock of scan mode and the server's /kiosk page
+
+	Screening []screeningQuestion `json:"screening"` // yes/no questions scan mode asks before recording
+
+	Pickup pickupConfig `json:"pickup"` // authorized adults for checking children out
+
+	Lookup       lookupConfig       `json:"lookup"`        // how -lookup checks who someone is
+	BadgePrinter badgePrinterConfig `json:"badge_printer"` // prints badges reprinted by -lookup
+	Badges       badgeConfig        `json:"badges"`        // how long badges stay valid after the roster's issued date
+
+	DedupePolicy   string                      `json:"dedupe_policy"`   // "window" skips repeats within the dedupe window, "daily" for the rest of the day, "none" never
+	DedupePolicies map[string]dedupeRuleConfig `json:"dedupe_policies"` // overrides by record type, e.g. "staff": {"policy": "none"}
+
+	Hours    hoursConfig     `json:"hours"`    // weekly operating hours; scans outside them are flagged or refused
+	Closures []closureConfig `json:"closures"` // holidays and other days the facility is closed
+
+	SessionEnd string `json:"session_end"` // HH:MM; check-outs before it are listed by -early-departures
+
+	Day dayConfig `json:"day"` // the export and backup -close-day runs
+
+	Milestones []int `json:"milestones"` // visit counts celebrated at check-in; default 10, 50 and 100
+
+	Goals []goalConfig `json:"goals"` // attendance targets per day, week or month shown by -stats, -watch and /goals
+
+	SpotCheck spotCheckConfig `json:"spot_check"` // check-ins selected at random for a bag or ID check
+
+	TimeClock timeClockConfig `json:"time_clock"` // staff punches with -time-clock and pay periods for -timesheet
+
+	DataDelimiter string `json:"data_delimiter"` // the data file's field delimiter: comma (default), tab or semicolon
+
+	History []string `json:"history"` // earlier years' data files, or folders of them, read before the live records (see -history)
+
+	Locale string `json:"locale"` // language and date and number formats of the printed reports and heatmap: en-US, fr-CA or fr-FR; English with ISO dates by default
+
+	NTPServer string `json:"ntp_server"` // checked against the clock at startup, e.g. "pool.ntp.org"
+
+	RosterSource rosterSourceConfig `json:"roster_source"` // REST endpoint scan mode and -daemon keep the roster synced from
+
+	LDAP ldapConfig `json:"ldap"` // directory scan mode looks up IDs missing from the roster in
+
+	Resolvers []resolverConfig `json:"resolvers"` // where scan mode looks scanned IDs up, in order; default the roster, then ldap
+
+	CRM crmConfig `json:"crm"` // REST endpoint -sync-crm and crm jobs post visits to
+
+	Hooks hooksConfig `json:"hooks"` // commands run on scans, duplicates, day close and exports
+}
+
+// profileConfig is one program sharing the machine, with its own records.
+// Empty settings keep the defaults.
+type profileConfig struct {
+	DataFile     string   `json:"data_file"`
+	Roster       string   `json:"roster"`
+	DedupeWindow duration `json:"dedupe_window"`
+	DedupePolicy string   `json:"dedupe_policy"`
+	Event        string   `json:"event"`
+	Partition    string   `json:"partition"` // "monthly" splits the data file by month
+	History      []string `json:"history"`   // the program's earlier years' data files or folders, replacing the config file's
+	Locale       string   `json:"locale"`    // the program's report locale, replacing the config file's
+
+	Goals []goalConfig `json:"goals"` // the program's attendance targets, replacing the config file's
+}
+
+// duration is a time.Duration written in config files as a string such as
+// "2h" or "90s"
+type duration time.Duration
+
+// UnmarshalJSON parses a duration string
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string such as \"2h\": %w", err)
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// profile returns the named profile. An empty name returns an empty profile.
+func (cfg config) profile(name string) (profileConfig, error) {
+	if name == "" {
+		return profileConfig{}, nil
+	}
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		return profile, fmt.Errorf("profile %q is not defined in the config file", name)
+	}
+	return profile, nil
+}
+
+// smtpConfig is the mail server used to send exports
+type smtpConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"` // defaults to 587; 465 uses implicit TLS
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+}
+
+// sftpConfig is the server exports are uploaded to with -upload=sftp.
+// Authentication uses the key file or the user's ssh agent.
+type sftpConfig struct {
+	Host           string `json:"host"`
+	Port           int    `json:"port"` // defaults to 22
+	User           string `json:"user"`
+	KeyFile        string `json:"key_file"`
+	KnownHostsFile string `json:"known_hosts_file"`
+	RemoteDir      string `json:"remote_dir"`
+}
+
+// driveConfig is the Google Drive folder exports are uploaded to with
+// -upload=drive, using a service account key
+type driveConfig struct {
+	CredentialsFile string `json:"credentials_file"`
+	FolderID        string `json:"folder_id"`
+}
+
+// loadConfig reads the config file at path. A missing file is not an error and
+// yields the default config.
+func loadConfig(path string) (config, error) {
+	var cfg config
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	} else if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for prefix, t := range cfg.TypePrefixes {
+		if !contains(recordTypes, t) {
+			return cfg, fmt.Errorf("parsing %s: type prefix %q has unknown record type %q", path, prefix, t)
+		}
+	}
+	if w := cfg.Waivers.Enforce; w != "" && w != "warn" && w != "block" {
+		return cfg, fmt.Errorf("parsing %s: waivers enforce must be warn or block, not %q", path, w)
+	}
+	for _, t := range cfg.Waivers.Types {
+		if !contains(recordTypes, t) {
+			return cfg, fmt.Errorf("parsing %s: waivers has unknown record type %q", path, t)
+		}
+	}
+	for _, t := range cfg.Pickup.Types {
+		if !contains(recordTypes, t) {
+			return cfg, fmt.Errorf("parsing %s: pickup has unknown record type %q", path, t)
+		}
+	}
+	for _, t := range cfg.GuardianSMS.Types {
+		if !contains(recordTypes, t) {
+			return cfg, fmt.Errorf("parsing %s: guardian_sms has unknown record type %q", path, t)
+		}
+	}
+	for _, t := range cfg.Camera.Types {
+		if !contains(recordTypes, t) {
+			return cfg, fmt.Errorf("parsing %s: camera has unknown record type %q", path, t)
+		}
+	}
+	if err := checkClosures(cfg.Closures); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := checkTimeClock(cfg.TimeClock); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := checkGoals(cfg.Goals); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := checkLocale(cfg.Locale); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := checkResolvers(cfg.Resolvers, cfg.LDAP); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := checkPause(cfg.Pause); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := checkKiosk(cfg.Kiosk, cfg.Hours); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := checkSessionEnd(cfg.SessionEnd); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for name, profile := range cfg.Profiles {
+		if err := checkGoals(profile.Goals); err != nil {
+			return cfg, fmt.Errorf("parsing %s: profile %s: %w", path, name, err)
+		}
+		if err := checkLocale(profile.Locale); err != nil {
+			return cfg, fmt.Errorf("parsing %s: profile %s: %w", path, name, err)
+		}
+	}
+	if err := checkSpotCheck(cfg.SpotCheck); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := checkMilestones(cfg.Milestones); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := checkScreening(cfg.Screening); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := cfg.Scanner.compile(); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return cfg, nil
+}
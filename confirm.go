@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// confirmDestructive previews a change that deletes or rewrites records and
+// asks the operator to type a confirmation phrase naming the number of
+// affected rows. When the config file sets an approval code hash, a second
+// admin's code is also required. It returns false unless both checks pass.
+func confirmDestructive(cfg config, verb string, affected, total int) bool {
+	fmt.Printf("This will %s %d of %d records in %s.\n", verb, affected, total, dataName())
+
+	input := bufio.NewReader(os.Stdin)
+	phrase := fmt.Sprintf("%s %d", verb, affected)
+	fmt.Printf("Type %q to continue: ", phrase)
+	answer, _ := input.ReadString('\n')
+	if strings.TrimSpace(answer) != phrase {
+		fmt.Println("Not confirmed, nothing was changed.")
+		return false
+	}
+
+	if cfg.ApprovalCodeSHA256 == "" {
+		return true
+	}
+	fmt.Print("Admin approval code: ")
+	code, _ := input.ReadString('\n')
+	sum := sha256.Sum256([]byte(strings.TrimSpace(code)))
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(cfg.ApprovalCodeSHA256))) != 1 {
+		fmt.Println("Approval code is incorrect, nothing was changed.")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runVerifyCountsMode recomputes each day's check-in numbering from the
+// timestamps, as renumbering would, and reports the days whose stored daily
+// counts have gaps or duplicates and every check-in whose count differs. It
+// exits with status 1 when any problem is found so it can be used from cron.
+func runVerifyCountsMode() {
+	records, sources, err := readDataFile()
+	if err != nil {
+		fmt.Println("Error reading CSV:", err)
+		os.Exit(1)
+	}
+
+	expected := make([][]string, len(records))
+	for i, record := range records {
+		expected[i] = append([]string(nil), record...)
+	}
+	renumberDailyCounts(expected)
+
+	// The stored counts of each day and record type, to find gaps and
+	// duplicates
+	stored := make(map[string][]int)
+	var keys []string
+	mismatches := 0
+	for i, record := range records {
+		if len(record) < 3 || recordDirection(record) == "out" || len(record[0]) < 10 {
+			continue
+		}
+		key := record[0][:10] + " " + recordType(record)
+		if stored[key] == nil {
+			keys = append(keys, key)
+		}
+		count, err := strconv.Atoi(record[2])
+		if err != nil {
+			count = 0
+		}
+		stored[key] = append(stored[key], count)
+		if record[2] != expected[i][2] {
+			fmt.Printf("%s: %s %s has daily count %q, expected %s\n", sources[i], record[0], record[1], record[2], expected[i][2])
+			mismatches++
+		}
+	}
+
+	sort.Strings(keys)
+	problemDays := 0
+	for _, key := range keys {
+		seen := make(map[int]int)
+		highest := 0
+		for _, count := range stored[key] {
+			seen[count]++
+			if count > highest {
+				highest = count
+			}
+		}
+		var gaps, duplicates []string
+		for n := 1; n <= highest; n++ {
+			if seen[n] == 0 {
+				gaps = append(gaps, strconv.Itoa(n))
+			} else if seen[n] > 1 {
+				duplicates = append(duplicates, fmt.Sprintf("%d (%d times)", n, seen[n]))
+			}
+		}
+		if len(gaps) == 0 && len(duplicates) == 0 {
+			continue
+		}
+		problemDays++
+		var parts []string
+		if len(gaps) > 0 {
+			parts = append(parts, "missing "+strings.Join(gaps, ", "))
+		}
+		if len(duplicates) > 0 {
+			parts = append(parts, "repeated "+strings.Join(duplicates, ", "))
+		}
+		fmt.Printf("%s: %s\n", key, strings.Join(parts, "; "))
+	}
+
+	if mismatches > 0 || problemDays > 0 {
+		fmt.Printf("%d check-ins have the wrong daily count and %d days have gaps or repeats in %s. Run -renumber=all to fix them.\n",
+			mismatches, problemDays, dataName())
+		os.Exit(1)
+	}
+	fmt.Printf("All daily counts in %s are consistent.\n", dataName())
+}
+
+// runRenumberMode rewrites the daily count column so each day's check-ins of
+// each record type are numbered from 1 in timestamp order, for the days in
+// spec (anything parseRange accepts) or every day when spec is "all"
+func runRenumberMode(spec string, cfg config) {
+	first, last := "", ""
+	if spec != "all" {
+		var err error
+		first, last, err = parseRange(spec, time.Now())
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+	}
+	records, sources, err := readDataFile()
+	if err != nil {
+		fmt.Println("Error reading CSV:", err)
+		fmt.Println("Renumbering rewrites the whole file, so fix the malformed lines first (see -check).")
+		return
+	}
+
+	// The selected records share their fields with records, so renumbering
+	// them renumbers the file's copy
+	var selected [][]string
+	var before []string
+	for _, record := range records {
+		if len(record) < 3 || len(record[0]) < 10 {
+			continue
+		}
+		if date := record[0][:10]; first == "" || (date >= first && date <= last) {
+			selected = append(selected, record)
+			before = append(before, record[2])
+		}
+	}
+	renumberDailyCounts(selected)
+	changed := 0
+	for i, record := range selected {
+		if record[2] != before[i] {
+			changed++
+		}
+	}
+	if changed == 0 {
+		fmt.Println("The daily counts are already in order.")
+		return
+	}
+
+	if !confirmDestructive(cfg, "renumber", changed, len(records)) {
+		return
+	}
+	if err := rewriteDataFile(records, sources); err != nil {
+		fmt.Println("Error rewriting data file:", err)
+		return
+	}
+	fmt.Printf("Renumbered %d check-ins in %s.\n", changed, dataName())
+	for _, record := range records {
+		if len(record) > 3 && record[3] != "" {
+			fmt.Println("Warning: Record checksums no longer match the rewritten file, so -verify will report it.")
+			break
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Attendance credits are what a check-in counts for in funding reports,
+// separately from the scan itself: one, unless the event's credits setting
+// or an operator's x<credits> modifier at the scan prompt says otherwise,
+// e.g. 2 for a double-length session. Check-ins worth other than one credit
+// have it in the credits file, whose rows are timestamp,id,credits,added_at.
+
+// loadCredits reads the credits file into the credits for each record key
+func loadCredits() (map[string][]string, error) {
+	return loadSidecar("credits")
+}
+
+// recordCredits returns the attendance credits a record earns: none for a
+// check-out, the credits file's latest value for it, or one
+func recordCredits(credits map[string][]string, record []string) float64 {
+	if recordDirection(record) == "out" {
+		return 0
+	}
+	values := credits[noteKey(record)]
+	if len(values) == 0 {
+		return 1
+	}
+	n, err := strconv.ParseFloat(values[len(values)-1], 64)
+	if err != nil || n < 0 {
+		return 1
+	}
+	return n
+}
+
+// formatCredits formats credits without trailing zeros, e.g. 2 or 1.5
+func formatCredits(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// parseCreditsModifier reads a line typed at the scan prompt as the x<credits>
+// modifier for the next check-in, e.g. x2 or x1.5
+func parseCreditsModifier(line string) (float64, bool) {
+	value, ok := strings.CutPrefix(strings.ToLower(line), "x")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// crmConfig is a CRM's REST endpoint, such as a Salesforce or HubSpot batch
+// API or a middleware in front of one, that visits are posted to as
+// activities on the visitor's contact
+type crmConfig struct {
+	URL     string            `json:"url"`     // each batch is POSTed here as JSON
+	Headers map[string]string `json:"headers"` // sent with each request, e.g. "Authorization": "Bearer ..."
+
+	// Roster columns matching a member to a CRM contact: contact_field
+	// holds the contact's ID in the CRM (default crm_id), and email_field
+	// (default email) lets the CRM match by email when there is no ID
+	ContactField string `json:"contact_field"`
+	EmailField   string `json:"email_field"`
+
+	BatchSize int `json:"batch_size"` // activities per request; default 100
+	Retries   int `json:"retries"`    // attempts per batch after the first; default 3
+}
+
+// crmActivity is one visit in a batch. ExternalID is the record's scan ID
+// (or its timestamp, ID and direction for older records), so a CRM that
+// upserts on it never records a retried visit twice.
+type crmActivity struct {
+	ExternalID string `json:"external_id"`
+	ContactID  string `json:"contact_id,omitempty"`
+	Email      string `json:"email,omitempty"`
+	Type       string `json:"type"`
+	Subject    string `json:"subject"`
+	Timestamp  string `json:"timestamp"`
+	RecordType string `json:"record_type"`
+	MemberID   string `json:"member_id"`
+}
+
+// crmBatch is the body of each request
+type crmBatch struct {
+	Activities []crmActivity `json:"activities"`
+}
+
+// syncCRM posts the check-ins not yet synced to the CRM in batches, each
+// retried with backoff on network errors, 429s and 5xx responses. Synced
+// visits are logged to the crm sidecar file (e.g. scans.crm.csv) as key,
+// contact and time, so the next sync picks up where this one stopped,
+// including after a batch that kept failing. It returns how many visits were
+// synced and how many were skipped for having no contact on the roster.
+func syncCRM(settings crmConfig, roster map[string]rosterEntry) (int, int, error) {
+	if settings.URL == "" {
+		return 0, 0, fmt.Errorf("no crm url is set in the config file")
+	}
+	contactField, emailField := crmContactColumn(settings), settings.EmailField
+	if emailField == "" {
+		emailField = "email"
+	}
+	batchSize := settings.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	retries := settings.Retries
+	if retries <= 0 {
+		retries = 3
+	}
+
+	synced, err := loadCSVColumn(sidecarFile("crm"), 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	records, _, err := readDataFile()
+	if err != nil {
+		return 0, 0, err
+	}
+	var pending []crmActivity
+	skipped := 0
+	for _, record := range records {
+		if _, err := parseRecord(record); err != nil {
+			continue
+		}
+		key := mergeKey(record)
+		if recordDirection(record) != "in" || synced[key] {
+			continue
+		}
+		member := roster[record[1]]
+		activity := crmActivity{
+			ExternalID: key,
+			ContactID:  strings.TrimSpace(member.Fields[strings.ToLower(contactField)]),
+			Email:      strings.TrimSpace(member.Fields[strings.ToLower(emailField)]),
+			Type:       "visit",
+			Subject:    "Checked in",
+			Timestamp:  record[0],
+			RecordType: recordType(record),
+			MemberID:   record[1],
+		}
+		if activity.ContactID == "" && activity.Email == "" {
+			skipped++
+			continue
+		}
+		pending = append(pending, activity)
+	}
+
+	sent := 0
+	for start := 0; start < len(pending); start += batchSize {
+		end := start + batchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batch := pending[start:end]
+		if err := postCRMBatch(settings, batch, retries); err != nil {
+			return sent, skipped, err
+		}
+		now := time.Now().Format("2006-01-02T15:04:05-07:00")
+		for _, activity := range batch {
+			contact := activity.ContactID
+			if contact == "" {
+				contact = activity.Email
+			}
+			if err := appendCSV(sidecarFile("crm"), []string{activity.ExternalID, contact, now}); err != nil {
+				return sent, skipped, err
+			}
+			sent++
+		}
+	}
+	return sent, skipped, nil
+}
+
+// postCRMBatch posts one batch, trying again up to retries times with a
+// doubling delay when the CRM is unreachable or asks to slow down. Other
+// 4xx responses mean the batch itself was refused and aren't retried.
+func postCRMBatch(settings crmConfig, batch []crmActivity, retries int) error {
+	body, err := json.Marshal(crmBatch{Activities: batch})
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 30 * time.Second}
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		trace := startSpan("crm sync", spanClient, nil)
+		err = func() error {
+			req, err := http.NewRequest(http.MethodPost, settings.URL, bytes.NewReader(body))
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			for name, value := range settings.Headers {
+				req.Header.Set(name, value)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+				return &crmError{Status: resp.StatusCode, Detail: strings.TrimSpace(resp.Status + " " + string(detail))}
+			}
+			return nil
+		}()
+		trace.finish(err)
+		if err == nil {
+			return nil
+		}
+		if e, ok := err.(*crmError); ok && e.Status < 500 && e.Status != http.StatusTooManyRequests {
+			return err
+		}
+		if attempt >= retries {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+		}
+		fmt.Printf("CRM sync failed (%v), retrying in %s.\n", err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// crmError is a response from the CRM other than success
+type crmError struct {
+	Status int
+	Detail string
+}
+
+// Error describes the response
+func (e *crmError) Error() string {
+	return "crm returned " + e.Detail
+}
+
+// runSyncCRMMode posts the visits not yet synced to the CRM
+func runSyncCRMMode(settings crmConfig, rosterFile string) {
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+	sent, skipped, err := syncCRM(settings, roster)
+	if sent > 0 || err == nil {
+		fmt.Printf("Synced %d visits to the CRM.\n", sent)
+	}
+	if skipped > 0 {
+		fmt.Printf("%d visits by people with no %s or email on the roster were left out.\n", skipped, crmContactColumn(settings))
+	}
+	if err != nil {
+		fmt.Println("Error syncing to the CRM:", err)
+		fmt.Println("The remaining visits are sent on the next sync.")
+	}
+}
+
+// crmContactColumn returns the roster column holding CRM contact IDs
+func crmContactColumn(settings crmConfig) string {
+	if settings.ContactField == "" {
+		return "crm_id"
+	}
+	return settings.ContactField
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// weekRange returns the first and last date (YYYY-MM-DD) of an ISO week given
+// as YYYY-Www, e.g. 2025-W14. ISO weeks start on Monday and week 1 is the week
+// containing January 4th.
+func weekRange(week string) (string, string, error) {
+	var year, number int
+	if _, err := fmt.Sscanf(week, "%4d-W%2d", &year, &number); err != nil || len(week) != 8 {
+		return "", "", fmt.Errorf("invalid week %q, expected format YYYY-Www", week)
+	}
+
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.Local)
+	offset := (int(jan4.Weekday()) + 6) % 7 // days since Monday
+	monday := time.Date(year, time.January, 4-offset+(number-1)*7, 0, 0, 0, 0, time.Local)
+
+	if isoYear, isoWeek := monday.ISOWeek(); number < 1 || isoYear != year || isoWeek != number {
+		return "", "", fmt.Errorf("week %q does not exist", week)
+	}
+
+	sunday := time.Date(monday.Year(), monday.Month(), monday.Day()+6, 0, 0, 0, 0, time.Local)
+	return monday.Format("2006-01-02"), sunday.Format("2006-01-02"), nil
+}
+
+// monthRange returns the first and last date (YYYY-MM-DD) of a month given as
+// YYYY-MM
+func monthRange(month string) (string, string, error) {
+	first, err := time.ParseInLocation("2006-01", month, time.Local)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid month %q, expected format YYYY-MM", month)
+	}
+
+	last := time.Date(first.Year(), first.Month()+1, 0, 0, 0, 0, 0, time.Local)
+	return first.Format("2006-01-02"), last.Format("2006-01-02"), nil
+}
+
+// relativeRange resolves a relative date keyword to a start and end date
+// (YYYY-MM-DD) based on now. Single-day keywords return an empty end date.
+// The last ok result is false if keyword isn't a recognized keyword.
+//
+// Recognized keywords are today, yesterday, this-week, last-week, this-month,
+// last-month and last-N-days (the N days ending today).
+func relativeRange(keyword string, now time.Time) (string, string, bool) {
+	year, month, day := now.Date()
+	date := func(d int) string {
+		return time.Date(year, month, d, 0, 0, 0, 0, now.Location()).Format("2006-01-02")
+	}
+	monday := day - (int(now.Weekday())+6)%7
+
+	var days int
+	switch keyword {
+	case "today":
+		return date(day), "", true
+	case "yesterday":
+		return date(day - 1), "", true
+	case "this-week":
+		return date(monday), date(monday + 6), true
+	case "last-week":
+		return date(monday - 7), date(monday - 1), true
+	case "this-month":
+		return date(1), time.Date(year, month+1, 0, 0, 0, 0, 0, now.Location()).Format("2006-01-02"), true
+	case "last-month":
+		return time.Date(year, month-1, 1, 0, 0, 0, 0, now.Location()).Format("2006-01-02"), date(0), true
+	}
+	if n, err := fmt.Sscanf(keyword, "last-%d-days", &days); err == nil && n == 1 && days > 0 &&
+		keyword == fmt.Sprintf("last-%d-days", days) {
+		return date(day - days + 1), date(day), true
+	}
+	return "", "", false
+}
+
+// nextMidnight returns the start of the calendar day after t in t's location
+func nextMidnight(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+}
+
+// resolveExportRange turns the export date flags into a start and end date
+// (YYYY-MM-DD). An ISO week or month replaces the start and end dates, and
+// relative keywords are resolved against now. The end date is empty for a
+// single day.
+func resolveExportRange(startDate, endDate, week, month string, now time.Time) (string, string, error) {
+	if week != "" || month != "" {
+		if startDate != "" || endDate != "" || (week != "" && month != "") {
+			return "", "", fmt.Errorf("use only one of -start/-end, -week or -month")
+		}
+		if week != "" {
+			return weekRange(week)
+		}
+		return monthRange(month)
+	}
+
+	if start, end, ok := relativeRange(startDate, now); ok {
+		if end != "" && endDate != "" {
+			return "", "", fmt.Errorf("-start=%s already covers a range and cannot be used with -end", startDate)
+		}
+		startDate = start
+		if end != "" {
+			endDate = end
+		}
+	}
+	// A range keyword as the end ends on the range's last day
+	if first, last, ok := relativeRange(endDate, now); ok {
+		endDate = first
+		if last != "" {
+			endDate = last
+		}
+	}
+	return startDate, endDate, nil
+}
+
+// humanDuration formats a duration in words, such as "2 hours" or
+// "90 minutes", for messages shown to attendees
+func humanDuration(d time.Duration) string {
+	unit := func(n int64, name string) string {
+		if n == 1 {
+			return "1 " + name
+		}
+		return fmt.Sprintf("%d %ss", n, name)
+	}
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return unit(int64(d/time.Hour), "hour")
+	case d >= time.Minute && d%time.Minute == 0:
+		return unit(int64(d/time.Minute), "minute")
+	default:
+		return unit(int64(d.Round(time.Second)/time.Second), "second")
+	}
+}
+
+// parseRange resolves a period given as a date (YYYY-MM-DD), an ISO week
+// (YYYY-Www), a month (YYYY-MM), a relative keyword or two dates joined by a
+// colon, e.g. 2025-03-03:2025-03-07, to its first and last date
+func parseRange(spec string, now time.Time) (string, string, error) {
+	if first, last, ok := relativeRange(spec, now); ok {
+		if last == "" {
+			last = first
+		}
+		return first, last, nil
+	}
+	if start, end, ok := strings.Cut(spec, ":"); ok {
+		first, _, err := parseRange(start, now)
+		if err != nil {
+			return "", "", err
+		}
+		_, last, err := parseRange(end, now)
+		if err != nil {
+			return "", "", err
+		}
+		if last < first {
+			return "", "", fmt.Errorf("period %q ends before it starts", spec)
+		}
+		return first, last, nil
+	}
+	switch {
+	case strings.Contains(spec, "W"):
+		return weekRange(spec)
+	case len(spec) == len("2006-01"):
+		return monthRange(spec)
+	}
+	if _, err := time.ParseInLocation("2006-01-02", spec, time.Local); err != nil {
+		return "", "", fmt.Errorf("invalid period %q, expected a date, week, month, keyword or start:end", spec)
+	}
+	return spec, spec, nil
+}
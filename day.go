@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dayConfig is the config file's "day" section: what -close-day saves at
+// the end of a session. Both take the settings of a scheduled job of their
+// type; the export's start and end are set to the day being closed.
+type dayConfig struct {
+	Export jobConfig `json:"export"` // default a CSV of the day in -dir
+	Backup jobConfig `json:"backup"` // default a copy of the data file in backups
+}
+
+// daySession is one -open-day or -close-day from the sessions sidecar file
+type daySession struct {
+	Time    string
+	Event   string // open or close
+	Date    string
+	Station string
+	User    string
+}
+
+// loadDaySessions reads the sessions sidecar file, e.g. scans.sessions.csv
+func loadDaySessions() ([]daySession, error) {
+	file, err := os.Open(sidecarFile("sessions"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	records, _, _ := readDelimitedRecords(file, ',')
+	var sessions []daySession
+	for _, row := range records {
+		for len(row) < 5 {
+			row = append(row, "")
+		}
+		sessions = append(sessions, daySession{Time: row[0], Event: row[1], Date: row[2], Station: row[3], User: row[4]})
+	}
+	return sessions, nil
+}
+
+// recordDaySession appends an open or close of a day to the sessions file
+func recordDaySession(event, date, station string, now time.Time) error {
+	username := ""
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+	return appendCSV(sidecarFile("sessions"), []string{now.Format("2006-01-02T15:04:05-07:00"), event, date, station, username})
+}
+
+// lastDaySession returns the latest session event recorded for a date, or
+// an empty one
+func lastDaySession(sessions []daySession, date string) daySession {
+	var last daySession
+	for _, session := range sessions {
+		if session.Date == date {
+			last = session
+		}
+	}
+	return last
+}
+
+// checkPrinter checks that the badge printer's command is installed and,
+// for the CUPS lp command, that the print scheduler is running
+func checkPrinter(settings badgePrinterConfig) healthCheck {
+	command := settings.Command
+	if command == "" {
+		command = "lp -o raw"
+	}
+	name := strings.Fields(command)[0]
+	check := healthCheck{Name: "printer", OK: true, Detail: command}
+	if _, err := exec.LookPath(name); err != nil {
+		check.OK, check.Detail = false, err.Error()
+		return check
+	}
+	if filepath.Base(name) == "lp" {
+		output, err := exec.Command("lpstat", "-r").CombinedOutput()
+		if err != nil || strings.Contains(string(output), "not running") {
+			check.OK, check.Detail = false, "CUPS scheduler is not running"
+		}
+	}
+	return check
+}
+
+// runOpenDayMode starts a day's session for the volunteers at a station: it
+// records the opening in the sessions sidecar file and runs the start-of-day
+// checklist, exiting with status 1 when any check fails
+func runOpenDayMode(cfg config, date, station string) {
+	sessions, err := loadDaySessions()
+	if err != nil {
+		fmt.Println("Error reading sessions file:", err)
+		return
+	}
+	if last := lastDaySession(sessions, date); last.Event == "open" {
+		fmt.Printf("%s was already opened at %s by %s.\n", date, last.Time, last.User)
+	}
+	now := time.Now()
+	if err := recordDaySession("open", date, station, now); err != nil {
+		fmt.Println("Error writing sessions file:", err)
+		return
+	}
+
+	fmt.Printf("Opening %s.\n\nStart-of-day checklist:\n", date)
+	checks := []healthCheck{checkClock(now, cfg.NTPServer), checkPrinter(cfg.BadgePrinter), checkDiskSpace(), checkDataFileWritable()}
+	failed := 0
+	for _, check := range checks {
+		status := " ok "
+		if !check.OK {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("  [%s] %-12s %s\n", status, check.Name, check.Detail)
+	}
+	if closure, closed := closureOn(cfg.Closures, date); closed {
+		fmt.Printf("  [note] %-12s %s is %s in the closures calendar\n", "closure", date, describeClosure(closure))
+	}
+	if pending, err := os.ReadDir(queueDir()); err == nil && len(pending) > 0 {
+		fmt.Printf("  [note] %-12s %d deliveries waiting from earlier (see -queue=status)\n", "queue", len(pending))
+	}
+	if failed > 0 {
+		fmt.Printf("\n%d of %d checks failed. Please fix them or tell a staff member before scanning.\n", failed, len(checks))
+		os.Exit(1)
+	}
+	fmt.Println("\nAll checks passed. Start scanning with -scan.")
+}
+
+// runCloseDayMode ends a day's session in one step: it prints the day's
+// summary and milestone visits and saves them as a CSV in dir, runs the
+// day's export and backup, records the closing in the sessions sidecar file
+// and fires the day_close hooks
+func runCloseDayMode(cfg config, rosterFile, date, station, dir string) {
+	sessions, err := loadDaySessions()
+	if err != nil {
+		fmt.Println("Error reading sessions file:", err)
+		return
+	}
+	switch last := lastDaySession(sessions, date); last.Event {
+	case "":
+		fmt.Printf("Note: %s was never opened with -open-day.\n", date)
+	case "close":
+		fmt.Printf("%s was already closed at %s by %s; closing it again.\n", date, last.Time, last.User)
+	}
+
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+	var day [][]string
+	for _, record := range records {
+		if record[0][:10] == date {
+			day = append(day, record)
+		}
+	}
+	history, err := loadVisitHistory()
+	if err != nil {
+		fmt.Println("Error reading visit history:", err)
+		return
+	}
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+	history.followBadges(badgeHolders(roster))
+	now := time.Now()
+	loc := cfg.locale()
+	rows := daySummary(day, date, history, now, loc)
+	fmt.Println(loc.textf("Summary for %s:", loc.date(date)))
+	width := loc.width(24, "new_visitors", "returning_visitors", "busiest_hour", "still_checked_in")
+	for _, row := range rows[1:] {
+		metric, recordType, typed := strings.Cut(row[0], ".")
+		label := loc.text(metric)
+		if typed {
+			label += "." + recordType
+		}
+		value := row[1]
+		if n, err := strconv.Atoi(value); err == nil {
+			value = loc.number(n)
+		}
+		fmt.Printf("  %-*s %s\n", width, label, value)
+	}
+
+	// Milestone visits, for handing out the prizes
+	ids, visits := history.milestonesOn(day, date, cfg.milestones())
+	if len(ids) > 0 {
+		fmt.Println("\n" + loc.text("Milestones:"))
+	}
+	for _, id := range ids {
+		fmt.Printf("  %-12s %-28s %s\n", id, rosterName(roster, id), loc.textf("visit #%s", loc.number(visits[id])))
+		rows = append(rows, []string{"milestone." + id, strconv.Itoa(visits[id])})
+	}
+	filename := "summary_" + date + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving summary:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving summary:", err)
+		return
+	}
+	fmt.Println("Saved to", filename)
+
+	fmt.Println("\nExporting the day:")
+	export := cfg.Day.Export
+	export.Name, export.Type, export.Start, export.End = "close-day export", "export", date, date
+	if export.Dir == "" {
+		export.Dir = dir
+	}
+	runJob(export, cfg, rosterFile, now)
+
+	fmt.Println("\nBacking up:")
+	backup := cfg.Day.Backup
+	backup.Name, backup.Type = "close-day backup", "backup"
+	runBackupJob(backup, cfg, now)
+
+	if err := recordDaySession("close", date, station, now); err != nil {
+		fmt.Println("Error writing sessions file:", err)
+		return
+	}
+	hooks.closeDay(date)
+	fmt.Printf("\nClosed %s.\n", date)
+}
+
+// daySummary returns the summary of a day's records as metric,value rows:
+// check-ins by record type, check-outs, the people seen, new and returning
+// visitors, the first and last scans, the busiest hour and, for today, who is
+// still checked in. The busiest hour is written in the report locale.
+func daySummary(records [][]string, date string, history visitHistory, now time.Time, loc reportLocale) [][]string {
+	rows := [][]string{{"metric", "value"}}
+	checkIns, checkOuts := make(map[string]int), 0
+	people := make(map[string]bool)
+	hours := make(map[string]int)
+	first, last := "", ""
+	for _, record := range records {
+		people[record[1]] = true
+		if first == "" || record[0] < first {
+			first = record[0]
+		}
+		if record[0] > last {
+			last = record[0]
+		}
+		if recordDirection(record) == "out" {
+			checkOuts++
+			continue
+		}
+		checkIns[recordType(record)]++
+		hours[record[0][11:13]]++
+	}
+	total := 0
+	var types []string
+	for t, n := range checkIns {
+		types = append(types, t)
+		total += n
+	}
+	sort.Strings(types)
+	rows = append(rows, []string{"check_ins", strconv.Itoa(total)})
+	for _, t := range types {
+		rows = append(rows, []string{"check_ins." + t, strconv.Itoa(checkIns[t])})
+	}
+	newcomers, returning := history.visitorCounts(records, date)
+	rows = append(rows, []string{"check_outs", strconv.Itoa(checkOuts)}, []string{"people", strconv.Itoa(len(people))},
+		[]string{"new_visitors", strconv.Itoa(newcomers)}, []string{"returning_visitors", strconv.Itoa(returning)})
+	if first != "" {
+		rows = append(rows, []string{"first_scan", first[11:19]}, []string{"last_scan", last[11:19]})
+	}
+	busiest := ""
+	for hour, n := range hours {
+		if busiest == "" || n > hours[busiest] || n == hours[busiest] && hour < busiest {
+			busiest = hour
+		}
+	}
+	if busiest != "" {
+		rows = append(rows, []string{"busiest_hour", loc.textf("%s:00 (%s check-ins)", busiest, loc.number(hours[busiest]))})
+	}
+	if date == now.Format("2006-01-02") {
+		rows = append(rows, []string{"still_checked_in", strconv.Itoa(len(presentIDs(records, now)))})
+	}
+	return rows
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runDedupeMode reports rows that are exact duplicates of an earlier row or
+// repeat the same ID within the window. With remove set, those rows are
+// dropped, the daily counts are recomputed and the data file is rewritten.
+func runDedupeMode(window time.Duration, remove bool, cfg config) {
+	records, sources, lines, err := readDataFileLines()
+	if err != nil {
+		fmt.Println("Error reading CSV:", err)
+		fmt.Println("Dedupe rewrites the whole file, so fix the malformed lines first (see -check).")
+		return
+	}
+
+	places := make([]string, len(records))
+	for i := range records {
+		places[i] = fmt.Sprintf("%s:%d", sources[i], lines[i])
+	}
+	duplicates := findDuplicates(records, places, window)
+	if len(duplicates) == 0 {
+		fmt.Println("No duplicate records found.")
+		return
+	}
+
+	for i, record := range records {
+		if reason, ok := duplicates[i]; ok {
+			fmt.Printf("%s: %s (%s)\n", places[i], strings.Join(record, ","), reason)
+		}
+	}
+	fmt.Printf("Found %d duplicate records.\n", len(duplicates))
+
+	if !remove {
+		fmt.Println("Run again with -remove to delete them and recompute daily counts.")
+		return
+	}
+
+	if !confirmDestructive(cfg, "remove", len(duplicates), len(records)) {
+		return
+	}
+
+	var kept [][]string
+	var keptSources []string
+	var trashed []trashedRow
+	for i, record := range records {
+		if reason, ok := duplicates[i]; ok {
+			trashed = append(trashed, trashedRow{Reason: reason, Source: sources[i], Fields: record})
+			continue
+		}
+		kept = append(kept, record)
+		keptSources = append(keptSources, sources[i])
+	}
+	renumberDailyCounts(kept)
+
+	batch, err := moveToTrash(cfg, "dedupe", trashed)
+	if err != nil {
+		fmt.Println("Error moving the duplicates to the trash, nothing was removed:", err)
+		return
+	}
+	if err := rewriteDataFile(kept, keptSources); err != nil {
+		fmt.Println("Error rewriting data file:", err)
+		discardTrashBatch(batch)
+		return
+	}
+	if partitioned {
+		fmt.Printf("Removed %d duplicate records from the monthly data files (backups saved as .bak files).\n", len(duplicates))
+	} else {
+		fmt.Printf("Removed %d duplicate records from %s (backup saved to %s).\n", len(duplicates), dataFile, dataFile+".bak")
+	}
+	trashNotice(cfg, batch, len(trashed))
+	for _, record := range kept {
+		if len(record) > 3 && record[3] != "" {
+			fmt.Println("Warning: Record checksums no longer match the rewritten file, so -verify will report it.")
+			break
+		}
+	}
+}
+
+// findDuplicates returns the indexes of duplicate records with the reason each
+// was flagged, naming an exact duplicate's original by its place, such as
+// scans.csv:12. Records are compared in timestamp order so the earliest scan
+// of a burst is the one kept.
+func findDuplicates(records [][]string, places []string, window time.Duration) map[int]string {
+	type scan struct {
+		index int
+		time  time.Time
+	}
+	var scans []scan
+	for i, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		recordTime, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+		if err != nil {
+			continue
+		}
+		scans = append(scans, scan{i, recordTime})
+	}
+	sort.SliceStable(scans, func(i, j int) bool { return scans[i].time.Before(scans[j].time) })
+
+	duplicates := make(map[int]string)
+	seenRows := make(map[string]int)
+	lastKept := make(map[string]time.Time)
+	for _, s := range scans {
+		record := records[s.index]
+		key := strings.Join(record, ",")
+		if first, ok := seenRows[key]; ok {
+			duplicates[s.index] = "exact duplicate of " + places[first]
+			continue
+		}
+		seenRows[key] = s.index
+
+		scanKey := record[1] + " " + recordDirection(record)
+		if last, ok := lastKept[scanKey]; ok && s.time.Sub(last) < window {
+			duplicates[s.index] = fmt.Sprintf("same ID %s after previous scan", s.time.Sub(last))
+			continue
+		}
+		lastKept[scanKey] = s.time
+	}
+
+	return duplicates
+}
+
+// renumberDailyCounts rewrites the daily count column so each day's check-ins
+// of each record type are numbered from 1 in timestamp order. Check-outs and rows without a valid
+// timestamp are left untouched.
+func renumberDailyCounts(records [][]string) {
+	type scan struct {
+		index int
+		time  time.Time
+	}
+	var scans []scan
+	for i, record := range records {
+		if len(record) < 3 || recordDirection(record) == "out" {
+			continue
+		}
+		recordTime, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+		if err != nil {
+			continue
+		}
+		scans = append(scans, scan{i, recordTime})
+	}
+	sort.SliceStable(scans, func(i, j int) bool { return scans[i].time.Before(scans[j].time) })
+
+	counts := make(map[string]int)
+	for _, s := range scans {
+		key := records[s.index][0][:10] + " " + recordType(records[s.index])
+		counts[key]++
+		records[s.index][2] = strconv.Itoa(counts[key])
+	}
+}
+
+// readDataFile reads every record from the data files, allowing rows with a
+// varying number of fields, along with the name of the file each came from
+func readDataFile() ([][]string, []string, error) {
+	records, sources, _, err := readDataFileLines()
+	return records, sources, err
+}
+
+// readDataFileLines is readDataFile that also returns the line each record
+// starts on in its file
+func readDataFileLines() ([][]string, []string, []int, error) {
+	names, err := dataFiles()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var records [][]string
+	var sources []string
+	var lines []int
+	for _, name := range names {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		reader := newDataReader(file)
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil && partitioned {
+				file.Close()
+				return nil, nil, nil, fmt.Errorf("%s: %w", name, err)
+			} else if err != nil {
+				file.Close()
+				return nil, nil, nil, err
+			}
+			line, _ := reader.FieldPos(0)
+			records = append(records, row)
+			sources = append(sources, name)
+			lines = append(lines, line)
+		}
+		file.Close()
+	}
+	return records, sources, lines, nil
+}
+
+// rewriteDataFile replaces each data file with the records that came from it,
+// or belong in it, as named in sources. Files left with no records are
+// emptied, and files named only in sources are created.
+func rewriteDataFile(records [][]string, sources []string) error {
+	names, err := dataFiles()
+	if err != nil {
+		return err
+	}
+	for _, source := range sources {
+		if !contains(names, source) {
+			names = append(names, source)
+		}
+	}
+	for _, name := range names {
+		var rows [][]string
+		for i, record := range records {
+			if sources[i] == name {
+				rows = append(rows, record)
+			}
+		}
+		if err := rewriteFile(name, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteFile replaces one data file with records, keeping a copy of the
+// previous contents in a .bak file. The new contents are written to a
+// temporary file first so a failed write never truncates the data file.
+func rewriteFile(name string, records [][]string) error {
+	if err := journalFile(name); err != nil {
+		return err
+	}
+	if err := copyFile(name, name+".bak"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("backing up data file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := newDataWriter(tmp)
+	writer.WriteAll(records)
+	if err := writer.Error(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// copyFile copies the contents of src to dst, replacing dst if it exists
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// dedupePolicy decides which repeat scans of an ID are duplicates: those
+// within a rolling window of each other, or with the daily policy, any after
+// the first of the calendar day. With the none policy every scan counts.
+type dedupePolicy struct {
+	Never  bool
+	Daily  bool
+	Window time.Duration
+}
+
+// dedupeRuleConfig is the config file's dedupe policy for one record type.
+// An empty window uses the dedupe window.
+type dedupeRuleConfig struct {
+	Policy string   `json:"policy"` // window, daily or none
+	Window duration `json:"window"`
+}
+
+// dedupeRules is the dedupe policy for each record type, falling back to a
+// default for the types the config doesn't list
+type dedupeRules struct {
+	Default dedupePolicy
+	ByType  map[string]dedupePolicy
+}
+
+// newDedupePolicy returns the named policy, "window" (the default), "daily"
+// or "none", with the window used by the window policy
+func newDedupePolicy(name string, window time.Duration) (dedupePolicy, error) {
+	switch name {
+	case "", "window":
+		return dedupePolicy{Window: window}, nil
+	case "daily":
+		return dedupePolicy{Daily: true, Window: window}, nil
+	case "none":
+		return dedupePolicy{Never: true, Window: window}, nil
+	}
+	return dedupePolicy{}, fmt.Errorf("unknown dedupe policy %q, expected window, daily or none", name)
+}
+
+// newDedupeRules builds the dedupe rules from the config. The default policy
+// is the event's when it sets one, else the profile's, else the config
+// file's, and dedupe_policies overrides it for each record type listed.
+func newDedupeRules(cfg config, profile profileConfig, event string, window time.Duration) (dedupeRules, error) {
+	name := cfg.DedupePolicy
+	if profile.DedupePolicy != "" {
+		name = profile.DedupePolicy
+	}
+	if theme, ok := cfg.Events[event]; ok && theme.DedupePolicy != "" {
+		name = theme.DedupePolicy
+	}
+	var rules dedupeRules
+	var err error
+	if rules.Default, err = newDedupePolicy(name, window); err != nil {
+		return rules, err
+	}
+
+	var types []string
+	for t := range cfg.DedupePolicies {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	rules.ByType = make(map[string]dedupePolicy)
+	for _, t := range types {
+		if !contains(recordTypes, t) {
+			return rules, fmt.Errorf("dedupe_policies: unknown record type %q", t)
+		}
+		rule := cfg.DedupePolicies[t]
+		typeWindow := window
+		if rule.Window > 0 {
+			typeWindow = time.Duration(rule.Window)
+		}
+		if rules.ByType[t], err = newDedupePolicy(rule.Policy, typeWindow); err != nil {
+			return rules, fmt.Errorf("dedupe_policies: %s: %w", t, err)
+		}
+	}
+	return rules, nil
+}
+
+// forType returns the policy for scans of a record type
+func (r dedupeRules) forType(t string) dedupePolicy {
+	if policy, ok := r.ByType[t]; ok {
+		return policy
+	}
+	return r.Default
+}
+
+// eligibleAt returns when an ID scanned at earlier may scan again: once the
+// window has passed, or under the daily policy at the next midnight
+func (p dedupePolicy) eligibleAt(earlier time.Time) time.Time {
+	if p.Daily {
+		day := earlier.In(time.Local)
+		return time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, time.Local)
+	}
+	return earlier.Add(p.Window)
+}
+
+// repeatTimes describes a refused repeat of a scan at earlier for someone
+// scanning at now: how long ago the scan was, e.g. 35 minutes, and when the
+// ID may scan again, e.g. at 3:42 PM, tomorrow at 9:05 AM or, under the daily
+// policy, tomorrow
+func (p dedupePolicy) repeatTimes(earlier, now time.Time) (ago, eligible string) {
+	since := now.Sub(earlier)
+	switch {
+	case since < time.Minute:
+		ago = "less than a minute"
+	case since < time.Hour:
+		ago = humanDuration(since.Truncate(time.Minute))
+	default:
+		ago = humanDuration(since.Truncate(time.Hour))
+		if minutes := since.Truncate(time.Minute) % time.Hour; minutes > 0 {
+			ago += " " + humanDuration(minutes)
+		}
+	}
+	next := p.eligibleAt(earlier).In(time.Local)
+	today := now.In(time.Local)
+	tomorrow := today.AddDate(0, 0, 1).Format("2006-01-02")
+	switch {
+	case p.Daily:
+		eligible = "tomorrow"
+	case next.Format("2006-01-02") == today.Format("2006-01-02"):
+		eligible = "at " + next.Format("3:04 PM")
+	case next.Format("2006-01-02") == tomorrow:
+		eligible = "tomorrow at " + next.Format("3:04 PM")
+	default:
+		eligible = "on " + next.Format("Jan 2 at 3:04 PM")
+	}
+	return ago, eligible
+}
+
+// duplicateMessage explains a refused repeat, e.g. "already checked in 35
+// minutes ago; eligible again at 3:42 PM"
+func (p dedupePolicy) duplicateMessage(direction string, earlier, now time.Time) string {
+	ago, eligible := p.repeatTimes(earlier, now)
+	if earlier.After(now) {
+		return fmt.Sprintf("already checked %s within %s of this scan; eligible again %s", direction, humanDuration(p.Window), eligible)
+	}
+	return fmt.Sprintf("already checked %s %s ago; eligible again %s", direction, ago, eligible)
+}
+
+// repeats reports whether a scan at t repeats one at earlier
+func (p dedupePolicy) repeats(earlier, t time.Time) bool {
+	if p.Never {
+		return false
+	}
+	if p.Daily {
+		return earlier.In(time.Local).Format("2006-01-02") == t.In(time.Local).Format("2006-01-02")
+	}
+	gap := t.Sub(earlier)
+	return gap < p.Window && gap > -p.Window
+}
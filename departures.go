@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// earlyDeparture is a day someone checked out before the session end and
+// didn't check back in
+type earlyDeparture struct {
+	Date     string
+	ID       string
+	Arrived  string // time of the day's first check-in, HH:MM:SS, or "" for none
+	Departed string // time of the day's last check-out, HH:MM:SS
+	Early    time.Duration
+}
+
+// checkSessionEnd validates the config's session_end, a time of day
+func checkSessionEnd(sessionEnd string) error {
+	if sessionEnd == "" {
+		return nil
+	}
+	if _, err := time.Parse("15:04", sessionEnd); err != nil {
+		return fmt.Errorf("session_end must be a time of day (HH:MM), not %q", sessionEnd)
+	}
+	return nil
+}
+
+// earlyDepartures finds, from first to last (YYYY-MM-DD, inclusive), the days
+// on which an ID's last scan was a check-out before sessionEnd (HH:MM) in the
+// recorded local time, sorted by date and departure time. Someone who steps
+// out and comes back before the end isn't counted.
+func earlyDepartures(records [][]string, sessionEnd, first, last string) []earlyDeparture {
+	end, err := time.Parse("15:04", sessionEnd)
+	if err != nil {
+		return nil
+	}
+	sorted := append([][]string{}, records...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i][0] < sorted[j][0] })
+
+	type day struct{ date, id string }
+	arrived := make(map[day]string)
+	latest := make(map[day][]string)
+	var order []day
+	for _, record := range sorted {
+		date := record[0][:10]
+		if date < first || date > last || len(record[0]) < 19 {
+			continue
+		}
+		key := day{date, record[1]}
+		if _, ok := latest[key]; !ok {
+			order = append(order, key)
+		}
+		latest[key] = record
+		if _, ok := arrived[key]; !ok && recordDirection(record) == "in" {
+			arrived[key] = record[0][11:19]
+		}
+	}
+
+	var departures []earlyDeparture
+	for _, key := range order {
+		record := latest[key]
+		if recordDirection(record) != "out" {
+			continue
+		}
+		departed, err := time.Parse("15:04:05", record[0][11:19])
+		if err != nil || !departed.Before(end) {
+			continue
+		}
+		departures = append(departures, earlyDeparture{Date: key.date, ID: key.id, Arrived: arrived[key], Departed: record[0][11:19], Early: end.Sub(departed)})
+	}
+	sort.SliceStable(departures, func(i, j int) bool {
+		if departures[i].Date != departures[j].Date {
+			return departures[i].Date < departures[j].Date
+		}
+		return departures[i].Departed < departures[j].Departed
+	})
+	return departures
+}
+
+// runEarlyDeparturesMode lists who checked out before the config's
+// session_end from first to last (YYYY-MM-DD, inclusive), with when they
+// arrived and left and how many minutes early, for programs whose funding
+// depends on attendees staying the full session. The list is also saved as
+// a CSV in dir.
+func runEarlyDeparturesMode(sessionEnd string, roster map[string]rosterEntry, first, last, dir string) {
+	if sessionEnd == "" {
+		fmt.Println("Error: No session end is set; add session_end (HH:MM) to the config file.")
+		return
+	}
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+
+	departures := earlyDepartures(records, sessionEnd, first, last)
+	rows := [][]string{{"date", "id", "name", "arrived", "departed", "minutes_early"}}
+	for _, d := range departures {
+		minutes := fmt.Sprint(int(d.Early.Round(time.Minute) / time.Minute))
+		rows = append(rows, []string{d.Date, d.ID, rosterName(roster, d.ID), d.Arrived, d.Departed, minutes})
+		fmt.Printf("%s  %-12s %-28s in %-8s out %s  %s min early\n", d.Date, d.ID, rosterName(roster, d.ID), d.Arrived, d.Departed, minutes)
+	}
+	fmt.Printf("%d early departures before %s from %s to %s.\n", len(departures), sessionEnd, first, last)
+
+	filename := "early_departures_" + first + "_" + last + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving report:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving report:", err)
+		return
+	}
+	fmt.Println("Saved to", filename)
+}
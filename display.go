@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// displayLatest is the most recent check-in shown on the welcome display,
+// with the event's greeting already rendered
+type displayLatest struct {
+	Timestamp string `json:"timestamp"`
+	Greeting  string `json:"greeting"`
+	Detail    string `json:"detail"`
+}
+
+// displayPageData is the data for the welcome page template
+type displayPageData struct {
+	eventTheme
+	TestMode bool
+}
+
+// handleDisplayPage serves the attendee-facing welcome page. It polls
+// /display/latest and shows a greeting for a few seconds after each scan. It
+// never shows badge IDs since the screen faces the line.
+func handleDisplayPage(w http.ResponseWriter, r *http.Request, theme eventTheme) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	displayPage.Execute(w, displayPageData{eventTheme: theme, TestMode: testMode})
+}
+
+// handleDisplayLatest returns the last record in the data file as JSON. A
+// first visit or a milestone visit, from the record's tags, is celebrated.
+func handleDisplayLatest(w http.ResponseWriter, r *http.Request, roster map[string]rosterEntry, theme eventTheme) {
+	record, err := lastRecord()
+	if err != nil {
+		http.Error(w, "error reading data file", http.StatusInternalServerError)
+		return
+	}
+	// A malformed last line shows nothing rather than half a greeting
+	if _, err := parseRecord(record); err != nil {
+		record = nil
+	}
+
+	var latest displayLatest
+	if recordDirection(record) == "out" {
+		latest = displayLatest{Timestamp: record[0], Greeting: "Goodbye!", Detail: rosterName(roster, record[1])}
+	} else if len(record) > 2 {
+		greeting := greetingData{Name: rosterName(roster, record[1]), Count: record[2]}
+		latest = displayLatest{
+			Timestamp: record[0],
+			Greeting:  renderGreeting(theme.Greeting, greeting),
+			Detail:    renderGreeting(theme.Detail, greeting),
+		}
+		tags, _ := loadTags()
+		for _, tag := range tags[noteKey(record)] {
+			if tag == firstVisitTag {
+				latest.Greeting = renderGreeting(theme.FirstVisit, greeting) + " " + latest.Greeting
+			} else if visits, ok := strings.CutPrefix(tag, "milestone_"); ok {
+				latest.Detail = renderGreeting(theme.Milestone, greetingData{Name: greeting.Name, Count: visits})
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(latest)
+}
+
+// lastRecord returns the last complete record in the data files without
+// reading them whole, or nil if there are no records
+func lastRecord() ([]string, error) {
+	files, err := dataFiles()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		record, err := lastRecordIn(files[i])
+		if record != nil || err != nil {
+			return record, err
+		}
+	}
+	return nil, nil
+}
+
+// lastRecordIn returns the last complete record in one file, or nil if the
+// file is empty or missing
+func lastRecordIn(name string) ([]string, error) {
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	const tailSize = 4096
+	offset := info.Size() - tailSize
+	if offset < 0 {
+		offset = 0
+	}
+	data := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(data, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	// Drop a partially written last line, then parse the line before it
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return nil, nil
+	}
+	data = data[:end]
+	line := data[bytes.LastIndexByte(data, '\n')+1:]
+
+	record, err := newDataReader(bytes.NewReader(line)).Read()
+	if err != nil {
+		return nil, nil
+	}
+	return record, nil
+}
+
+// displayPage shows the greeting for 8 seconds before returning to the idle
+// prompt, using the event theme's colors and success sound
+var displayPage = template.Must(template.ParseFS(assets, "assets/display.html"))
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDoorOpenFor is how long the door stays unlocked when the config
+// doesn't say
+const defaultDoorOpenFor = 5 * time.Second
+
+// doorConfig is the config file's "door" section: a relay that unlocks a
+// door for a few seconds after each accepted scan, so the station doubles as
+// an access control point. The relay is a GPIO line, through its sysfs value
+// file, or a networked relay board switched with an HTTP request to on_url
+// and then off_url.
+type doorConfig struct {
+	GPIO      string   `json:"gpio"`       // e.g. /sys/class/gpio/gpio17/value, exported as an output
+	ActiveLow bool     `json:"active_low"` // the relay closes when the line is low
+	OnURL     string   `json:"on_url"`     // e.g. http://relay.local/relay/0?turn=on
+	OffURL    string   `json:"off_url"`
+	Method    string   `json:"method"`   // for the URLs; default GET
+	OpenFor   duration `json:"open_for"` // default 5s
+
+	// Only unlock while the operating hours say the building is staffed
+	StaffedHoursOnly bool `json:"staffed_hours_only"`
+}
+
+// doorRelay drives the door relay. Another scan while the door is unlocked
+// keeps it unlocked for the full time from that scan.
+type doorRelay struct {
+	settings doorConfig
+	mu       sync.Mutex
+	lock     *time.Timer // locks the door again; nil while locked
+}
+
+// newDoorRelay returns the door relay, or nil when none is configured
+func newDoorRelay(settings doorConfig) *doorRelay {
+	if settings.GPIO == "" && settings.OnURL == "" {
+		return nil
+	}
+	if settings.OpenFor <= 0 {
+		settings.OpenFor = duration(defaultDoorOpenFor)
+	}
+	return &doorRelay{settings: settings}
+}
+
+// unlock unlocks the door and locks it again after the open time, reporting
+// relay errors to report
+func (d *doorRelay) unlock(report func(error)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lock != nil {
+		d.lock.Reset(time.Duration(d.settings.OpenFor))
+		return
+	}
+	if err := d.set(true); err != nil {
+		report(err)
+		return
+	}
+	d.lock = time.AfterFunc(time.Duration(d.settings.OpenFor), func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.lock = nil
+		if err := d.set(false); err != nil {
+			report(err)
+		}
+	})
+}
+
+// close locks the door now, for when scan mode exits with it unlocked
+func (d *doorRelay) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lock != nil && d.lock.Stop() {
+		d.lock = nil
+		if err := d.set(false); err != nil {
+			fmt.Println("Error locking door:", err)
+		}
+	}
+}
+
+// set switches the relay on to unlock or off to lock
+func (d *doorRelay) set(on bool) error {
+	s := d.settings
+	if s.GPIO != "" {
+		value := "0"
+		if on != s.ActiveLow {
+			value = "1"
+		}
+		if err := os.WriteFile(s.GPIO, []byte(value), 0644); err != nil {
+			return fmt.Errorf("door relay: %w", err)
+		}
+	}
+	url := s.OffURL
+	if on {
+		url = s.OnURL
+	}
+	if url == "" {
+		return nil
+	}
+	method := strings.ToUpper(s.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return fmt.Errorf("door relay: %w", err)
+	}
+	client := http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("door relay: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("door relay returned %s", resp.Status)
+	}
+	return nil
+}
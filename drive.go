@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	driveScope     = "https://www.googleapis.com/auth/drive"
+	driveUploadURL = "https://www.googleapis.com/upload/drive/v3/files?uploadType=multipart&supportsAllDrives=true"
+)
+
+// serviceAccountKey holds the fields used from a Google service account JSON
+// key file
+type serviceAccountKey struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// uploadDrive uploads the files into the configured Google Drive folder as
+// the service account. The folder must be shared with the service account's
+// email address.
+func uploadDrive(settings driveConfig, files []string) error {
+	if settings.CredentialsFile == "" || settings.FolderID == "" {
+		return fmt.Errorf("drive credentials_file and folder_id must be set in the config file")
+	}
+
+	token, err := driveAccessToken(settings.CredentialsFile)
+	if err != nil {
+		return fmt.Errorf("authenticating: %w", err)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	for _, file := range files {
+		if err := driveUploadFile(client, token, settings.FolderID, file); err != nil {
+			return fmt.Errorf("uploading %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// driveAccessToken exchanges a signed JWT for an OAuth access token using the
+// service account key
+func driveAccessToken(credentialsFile string) (string, error) {
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return "", err
+	}
+	var key serviceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return "", fmt.Errorf("parsing %s: %w", credentialsFile, err)
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("no private key in %s", credentialsFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("private key in %s is not an RSA key", credentialsFile)
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   key.ClientEmail,
+		"scope": driveScope,
+		"aud":   key.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	assertion := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	resp, err := http.PostForm(key.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// driveUploadFile uploads one file with its metadata in a single multipart
+// request
+func driveUploadFile(client *http.Client, token, folderID, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(file)
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	metadata, _ := json.Marshal(map[string]interface{}{"name": name, "parents": []string{folderID}})
+	part, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json; charset=UTF-8"}})
+	if err != nil {
+		return err
+	}
+	part.Write(metadata)
+	part, err = writer.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+	if err != nil {
+		return err
+	}
+	part.Write(data)
+	writer.Close()
+
+	req, err := http.NewRequest(http.MethodPost, driveUploadURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "multipart/related; boundary="+writer.Boundary())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sendEmail sends a plain text message with the files attached to each
+// recipient through the configured SMTP server
+func sendEmail(settings smtpConfig, to []string, subject, body string, attachments []string) error {
+	if settings.Host == "" || settings.From == "" {
+		return fmt.Errorf("smtp host and from address must be set in the config file")
+	}
+	port := settings.Port
+	if port == 0 {
+		port = 587
+	}
+
+	message, err := buildEmail(settings.From, to, subject, body, attachments)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(settings.Host, strconv.Itoa(port))
+	var auth smtp.Auth
+	if settings.Username != "" {
+		auth = smtp.PlainAuth("", settings.Username, settings.Password, settings.Host)
+	}
+
+	// smtp.SendMail upgrades with STARTTLS when the server offers it, but port
+	// 465 expects TLS from the first byte
+	if port != 465 {
+		return smtp.SendMail(addr, auth, settings.From, to, message)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: settings.Host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, settings.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(settings.From); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildEmail returns a MIME multipart message with a text body and the files
+// as base64-encoded attachments
+func buildEmail(from string, to []string, subject, body string, attachments []string) ([]byte, error) {
+	var msg bytes.Buffer
+	writer := multipart.NewWriter(&msg)
+
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	part.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+
+	for _, file := range attachments {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(file)
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Wrap the encoded data at 76 characters as MIME requires
+		encoded := base64.StdEncoding.EncodeToString(data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
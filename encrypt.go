@@ -0,0 +1,153 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WinZip AES settings. The archives open with the password in 7-Zip, WinZip
+// and most other archive tools.
+const (
+	zipMethodAES     = 99
+	zipAESExtraID    = 0x9901
+	zipAESSaltSize   = 16 // AES-256
+	zipAESKeySize    = 32
+	zipAESIterations = 1000
+	zipAESAuthSize   = 10
+)
+
+// encryptExports bundles the written export files into one AES-256 encrypted
+// zip named after the first file and removes the unencrypted files
+func encryptExports(files []string, password string) ([]string, error) {
+	if password == "" {
+		return nil, fmt.Errorf("export_password is not set in the config file")
+	}
+	archive := strings.TrimSuffix(files[0], filepath.Ext(files[0])) + ".zip"
+
+	out, err := os.Create(archive)
+	if err != nil {
+		return nil, err
+	}
+	writer := zip.NewWriter(out)
+	for _, file := range files {
+		if err := addEncryptedZipFile(writer, file, password); err != nil {
+			out.Close()
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		out.Close()
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		os.Remove(file)
+	}
+	return []string{archive}, nil
+}
+
+// addEncryptedZipFile deflates one file and adds it to the archive encrypted
+// in the WinZip AE-2 format: a random salt and password check value, the
+// AES-CTR encrypted data, then an HMAC-SHA1 authentication code
+func addEncryptedZipFile(writer *zip.Writer, file, password string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var compressed bytes.Buffer
+	deflater, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	deflater.Write(contents)
+	if err := deflater.Close(); err != nil {
+		return err
+	}
+
+	salt := make([]byte, zipAESSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	keys, err := pbkdf2.Key(sha1.New, password, salt, zipAESIterations, 2*zipAESKeySize+2)
+	if err != nil {
+		return err
+	}
+	encryptionKey, authKey, check := keys[:zipAESKeySize], keys[zipAESKeySize:2*zipAESKeySize], keys[2*zipAESKeySize:]
+
+	data := compressed.Bytes()
+	if err := zipAESCrypt(encryptionKey, data); err != nil {
+		return err
+	}
+	mac := hmac.New(sha1.New, authKey)
+	mac.Write(data)
+
+	// AE-2 entries leave the CRC at zero and record the real compression
+	// method in the extra field
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra[0:], zipAESExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], 2) // AE-2
+	copy(extra[6:], "AE")
+	extra[8] = 3 // AES-256
+	binary.LittleEndian.PutUint16(extra[9:], zip.Deflate)
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Method = zipMethodAES
+	header.Flags |= 0x1 // encrypted
+	header.Extra = extra
+	header.CRC32 = 0
+	header.UncompressedSize64 = uint64(len(contents))
+	header.CompressedSize64 = uint64(len(salt) + len(check) + len(data) + zipAESAuthSize)
+
+	w, err := writer.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	for _, part := range [][]byte{salt, check, data, mac.Sum(nil)[:zipAESAuthSize]} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zipAESCrypt encrypts data in place with AES in counter mode as WinZip does
+// it, with a little-endian counter starting at 1
+func zipAESCrypt(key, data []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	counter := make([]byte, aes.BlockSize)
+	stream := make([]byte, aes.BlockSize)
+	for offset, n := 0, uint64(1); offset < len(data); offset, n = offset+aes.BlockSize, n+1 {
+		binary.LittleEndian.PutUint64(counter, n)
+		block.Encrypt(stream, counter)
+		for i := 0; i < aes.BlockSize && offset+i < len(data); i++ {
+			data[offset+i] ^= stream[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envFlags are the flags that can also be set with a CHECKIN_ environment
+// variable, e.g. CHECKIN_DEDUPE_WINDOW for -dedupe-window. Flags given on the
+// command line take precedence over the environment, which in turn takes
+// precedence over profiles.
+var envFlags = []string{
+	"file",
+	"tz",
+	"dedupe-window",
+	"roster",
+	"config",
+	"profile",
+	"event",
+	"addr",
+	"state-file",
+	"accessibility",
+	"partition",
+	"readonly",
+	"log-format",
+	"log-file",
+	"station",
+	"hid-device",
+	"supervise",
+}
+
+// envName returns the environment variable name for a flag
+func envName(flagName string) string {
+	return "CHECKIN_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnvironment sets each env-configurable flag that wasn't given on the
+// command line from its environment variable
+func applyEnvironment() error {
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	for _, name := range envFlags {
+		value, ok := os.LookupEnv(envName(name))
+		if !ok || setFlags[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", envName(name), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,904 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// exportOptions holds the export mode settings other than the date range
+type exportOptions struct {
+	Formats    []string // csv and/or parquet, one file per format
+	Compress   string   // gzip or zip; empty leaves the files uncompressed
+	Encrypt    bool     // bundle the files into an AES-encrypted zip instead
+	Columns    []string // output columns in order; empty keeps the CSV records as stored
+	TimeFormat string   // CSV timestamps as rfc3339 (stored), local, split or unix
+	Excel      excelOptions
+	Delimiter  rune     // CSV field delimiter; zero for comma
+	Types      []string // record types to export; empty exports every type
+	Tags       []string // export only records with at least one of these tags
+	Sources    []string // export only records that arrived through these sources
+	RosterFile string
+	Filename   string // text/template for the file name; empty uses the default pattern
+	Dir        string // directory the export is written to
+	Split      string // "day" writes a file for each day of the range; empty writes one
+	Preview    bool   // print what the filters match instead of writing the export
+	Sort       string // timestamp, id or name; empty keeps the data file's order
+	Desc       bool   // sort in descending order, by timestamp unless Sort says otherwise
+
+	Aggregate []string // count check-ins by these dimensions instead of exporting the records
+	MinCount  int      // aggregate counts below this are suppressed
+
+	SinceLastExport bool   // export only records newer than the last incremental export
+	StateFile       string // where the last exported timestamp is remembered
+	AppendTo        string // append to this rolling CSV file instead of creating a new one
+	Sign            bool   // write a detached .sig signature for each export file
+
+	EmailTo []string // recipients the export files are emailed to
+	Upload  []string // destinations from the config file the files are uploaded to
+	Push    bool     // send the records to the instance in the config file's push section
+	Config  config
+}
+
+// excelOptions make CSV exports open cleanly in Excel
+type excelOptions struct {
+	BOM     bool // start with a UTF-8 byte order mark so names aren't mangled
+	CRLF    bool // end lines with \r\n
+	TextIDs bool // write IDs as ="00123" so leading zeros are kept
+}
+
+// parseExcelOptions parses a comma-separated list of bom, crlf and text, or
+// all for every one
+func parseExcelOptions(list string) (excelOptions, error) {
+	var options excelOptions
+	if list == "" {
+		return options, nil
+	}
+	for _, option := range strings.Split(list, ",") {
+		switch strings.TrimSpace(option) {
+		case "all":
+			options = excelOptions{BOM: true, CRLF: true, TextIDs: true}
+		case "bom":
+			options.BOM = true
+		case "crlf":
+			options.CRLF = true
+		case "text":
+			options.TextIDs = true
+		default:
+			return options, fmt.Errorf("unknown Excel option %q (available: bom, crlf, text, all)", option)
+		}
+	}
+	return options, nil
+}
+
+// exportState is persisted between incremental exports. Timestamps only
+// have whole seconds, so the records exported from the last one's second are
+// kept too: one recorded in that second after the export ran still goes in
+// the next.
+type exportState struct {
+	LastExported time.Time `json:"last_exported"`
+	LastSecond   []string  `json:"last_second"` // keys of the exported records timestamped LastExported
+}
+
+// exportedKey identifies a record in the export state: its scan ID, or for
+// records from before scan IDs its timestamp, ID and direction
+func exportedKey(record []string) string {
+	if scanID := recordScanID(record); scanID != "" {
+		return scanID
+	}
+	return noteKey(record) + "," + recordDirection(record)
+}
+
+// exportFilenameData is the data available to a filename template
+type exportFilenameData struct {
+	Start  string // first date of the range (YYYY-MM-DD)
+	End    string // last date of the range, the same as Start for a single day
+	Count  int    // number of exported records
+	Format string // file format, also the default extension
+}
+
+// validate checks the export options for unsupported or conflicting values
+func (options exportOptions) validate() error {
+	for _, format := range options.Formats {
+		if format != "csv" && format != "parquet" {
+			return fmt.Errorf("export format must be csv or parquet")
+		}
+	}
+	if options.Compress != "" && options.Compress != "gzip" && options.Compress != "zip" {
+		return fmt.Errorf("compression must be gzip or zip")
+	}
+	if options.AppendTo != "" && (len(options.Formats) != 1 || options.Formats[0] != "csv" || options.Compress != "" || options.Encrypt) {
+		return fmt.Errorf("only uncompressed csv exports can be appended to")
+	}
+	if options.TimeFormat != "" && !contains(exportTimeFormats, options.TimeFormat) {
+		return fmt.Errorf("time format must be rfc3339, local, split or unix")
+	}
+	if options.Encrypt && options.Compress == "gzip" {
+		return fmt.Errorf("encrypted exports are always zip archives and cannot be gzipped")
+	}
+	if options.Split != "" && options.Split != "day" {
+		return fmt.Errorf("split must be day")
+	}
+	if options.Split != "" && options.AppendTo != "" {
+		return fmt.Errorf("split exports can't be appended to a rolling file")
+	}
+	if options.Push && options.Config.Push.URL == "" {
+		return fmt.Errorf("-push needs a push url in the config file")
+	}
+	if options.Sort != "" && options.Sort != "timestamp" && options.Sort != "id" && options.Sort != "name" {
+		return fmt.Errorf("sort must be timestamp, id or name")
+	}
+	if len(options.Aggregate) > 0 {
+		switch {
+		case options.Sort != "" || options.Desc:
+			return fmt.Errorf("aggregate exports are ordered by their dimensions and can't be sorted")
+		case options.MinCount < 1:
+			return fmt.Errorf("-min-count must be at least 1")
+		case len(options.Columns) > 0:
+			return fmt.Errorf("aggregate exports have their own columns and can't be combined with -columns")
+		case len(options.Formats) != 1 || options.Formats[0] != "csv":
+			return fmt.Errorf("aggregate exports are csv only")
+		case options.Split != "" || options.AppendTo != "":
+			return fmt.Errorf("aggregate exports can't be split or appended to a rolling file")
+		case options.Push:
+			return fmt.Errorf("-push sends the records themselves, so it can't be combined with -aggregate")
+		case options.Excel.TextIDs || (options.TimeFormat != "" && options.TimeFormat != "rfc3339"):
+			return fmt.Errorf("aggregate exports have no IDs or timestamps for -excel=text or -time-format")
+		}
+	}
+	return nil
+}
+
+// runExportMode handles reading and exporting records from a date or date range,
+// or every record since the last incremental export
+func runExportMode(startDate, endDate string, options exportOptions) {
+	trace := startSpan("export", spanInternal, nil)
+	defer trace.finish(nil)
+
+	file, err := openDataFiles()
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	defer file.Close()
+
+	records, _, bad := readRecords(file)
+	defer reportBadRows(bad)
+
+	location := time.Now().Location()
+	var state exportState
+	var start, end time.Time
+	if options.SinceLastExport {
+		state, err = loadExportState(options.StateFile)
+		if err != nil {
+			fmt.Println("Error reading export state:", err)
+			return
+		}
+	} else {
+		// Parse the start date in local time
+		start, err = time.ParseInLocation("2006-01-02", startDate, location)
+		if err != nil {
+			fmt.Println("Error parsing start date:", err)
+			return
+		}
+
+		// Set the end of the range to the midnight after the last day. Days are
+		// stepped by calendar date rather than 24 hours so daylight saving
+		// transition days keep their 23 or 25 hours.
+		if endDate == "" {
+			end = nextMidnight(start) // end of the start day
+		} else {
+			end, err = time.ParseInLocation("2006-01-02", endDate, location)
+			if err != nil {
+				fmt.Println("Error parsing end date:", err)
+				return
+			}
+			end = nextMidnight(end) // end of the end day
+		}
+	}
+
+	tags, err := loadTags()
+	if err != nil {
+		fmt.Println("Error reading tags:", err)
+		return
+	}
+	credits, err := loadCredits()
+	if err != nil {
+		fmt.Println("Error reading credits:", err)
+		return
+	}
+	origins, err := loadOrigins()
+	if err != nil {
+		fmt.Println("Error reading origins:", err)
+		return
+	}
+
+	// Filter records by date range in local time, or by the last exported
+	// timestamp, keeping track of the span of the exported records
+	var filteredRecords [][]string
+	var first, last time.Time
+	for _, record := range records {
+		recordTime, err := time.ParseInLocation("2006-01-02T15:04:05-07:00", record[0], location)
+		if err != nil {
+			fmt.Println("Error parsing timestamp:", err)
+			continue
+		}
+
+		if len(options.Types) > 0 && !contains(options.Types, recordType(record)) {
+			continue
+		}
+		if len(options.Tags) > 0 && !hasAnyTag(tags, record, options.Tags) {
+			continue
+		}
+		if len(options.Sources) > 0 && !contains(options.Sources, origins[noteKey(record)].Source) {
+			continue
+		}
+		if options.SinceLastExport {
+			if recordTime.Before(state.LastExported) || (recordTime.Equal(state.LastExported) && contains(state.LastSecond, exportedKey(record))) {
+				continue
+			}
+		} else if recordTime.Before(start) || !recordTime.Before(end) {
+			continue
+		}
+
+		filteredRecords = append(filteredRecords, record)
+		if first.IsZero() || recordTime.Before(first) {
+			first = recordTime
+		}
+		if recordTime.After(last) {
+			last = recordTime
+		}
+	}
+
+	// Handle case where no records are found
+	if len(filteredRecords) == 0 {
+		if options.SinceLastExport {
+			fmt.Println("No new records since the last export.")
+		} else {
+			fmt.Println("No records found for the specified date range.")
+		}
+		return
+	}
+
+	// Funders count attendance credits rather than scans, so once any
+	// check-in counts for other than one the export says what they sum to
+	var summedCredits string
+	if len(credits) > 0 {
+		total := 0.0
+		for _, record := range filteredRecords {
+			total += recordCredits(credits, record)
+		}
+		summedCredits = fmt.Sprintf(" (%s attendance credits)", formatCredits(total))
+	}
+	if options.Preview {
+		printExportPreview(filteredRecords, first, last, location, summedCredits)
+		return
+	}
+
+	if options.Sort != "" || options.Desc {
+		roster, err := loadRoster(options.RosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		sortExportRecords(filteredRecords, options.Sort, options.Desc, roster)
+	}
+
+	// Incremental exports are named after the dates they actually cover
+	if options.SinceLastExport {
+		startDate = first.In(location).Format("2006-01-02")
+		endDate = last.In(location).Format("2006-01-02")
+		if endDate == startDate {
+			endDate = ""
+		}
+	}
+
+	// Resolve the output columns. CSV exports keep records as stored unless
+	// columns were chosen, while Parquet always needs one value per column.
+	csvRows := filteredRecords
+	var columnRows [][]string
+	columns := options.Columns
+	if len(columns) == 0 {
+		columns = defaultExportColumns
+	}
+	if len(options.Columns) > 0 || contains(options.Formats, "parquet") {
+		roster, err := loadRoster(options.RosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		notes, err := loadNotes()
+		if err != nil {
+			fmt.Println("Error reading notes:", err)
+			return
+		}
+		var previous map[string]string
+		if contains(columns, "days_since_previous_visit") {
+			previous = previousVisits(records)
+		}
+		answers, err := loadScreening()
+		if err != nil {
+			fmt.Println("Error reading screening answers:", err)
+			return
+		}
+		columnRows = make([][]string, len(filteredRecords))
+		for i, record := range filteredRecords {
+			columnRows[i] = selectColumns(record, columns, roster, notes, tags, credits, previous, answers, origins)
+		}
+		if len(options.Columns) > 0 {
+			csvRows = columnRows
+		}
+	}
+	if contains(options.Formats, "csv") && !options.Excel.BOM && hasNonASCII(csvRows) {
+		fmt.Println("Note: the export has names outside plain ASCII, such as Arabic or Chinese ones. Add -excel=bom so Excel")
+		fmt.Println("shows them correctly, or export the name_latin column for systems that can't handle Unicode.")
+	}
+	if options.Excel.TextIDs {
+		index := 1
+		if len(options.Columns) > 0 {
+			index = -1
+			for i, column := range columns {
+				if column == "barcode_id" {
+					index = i
+				}
+			}
+		}
+		if index >= 0 {
+			csvRows = textIDs(csvRows, index)
+		}
+	}
+	if options.TimeFormat != "" && options.TimeFormat != "rfc3339" {
+		index := 0
+		if len(options.Columns) > 0 {
+			index = -1
+			for i, column := range columns {
+				if column == "timestamp" {
+					index = i
+				}
+			}
+		}
+		if index >= 0 {
+			csvRows = formatTimestamps(csvRows, index, options.TimeFormat, location)
+		}
+	}
+
+	// Aggregate exports hold only counts, with the small ones suppressed, in
+	// place of the records
+	if len(options.Aggregate) > 0 {
+		roster, err := loadRoster(options.RosterFile)
+		if err != nil {
+			fmt.Println("Error loading roster:", err)
+			return
+		}
+		csvRows = aggregateRows(filteredRecords, options.Aggregate, roster, options.MinCount, location)
+	}
+
+	// The files to write: the whole range, or with -split=day a file for
+	// each day with records, in date order
+	parts := []exportPart{{Start: startDate, End: endDate, CSV: csvRows, Columns: columnRows}}
+	if options.Split == "day" {
+		parts = splitByDay(filteredRecords, csvRows, columnRows, location)
+	}
+
+	var written []string
+	for _, part := range parts {
+		for _, format := range options.Formats {
+			// Create a dynamic filename with the date range and record count,
+			// unless appending to a rolling file
+			filename := options.AppendTo
+			if filename == "" {
+				filename, err = exportFilename(options, format, part.Start, part.End, len(part.CSV))
+				if err != nil {
+					fmt.Println("Error creating export file:", err)
+					return
+				}
+			}
+
+			if format == "parquet" {
+				err = writeParquet(filename, part.Columns, columns, location)
+			} else {
+				err = writeCSVFile(filename, part.CSV, options.AppendTo != "", options.Excel, options.Delimiter)
+			}
+			if err != nil {
+				fmt.Println("Error writing to export file:", err)
+				return
+			}
+			written = append(written, filename)
+		}
+	}
+
+	if options.Encrypt {
+		written, err = encryptExports(written, options.Config.ExportPassword)
+		if err != nil {
+			fmt.Println("Error encrypting export:", err)
+			return
+		}
+	} else if options.Compress != "" {
+		written, err = compressExports(written, options.Compress)
+		if err != nil {
+			fmt.Println("Error compressing export:", err)
+			return
+		}
+	}
+	if len(options.Aggregate) > 0 {
+		fmt.Printf("Exported %d rows of counts, by %s, of %d records to %s\n", len(csvRows)-1, strings.Join(options.Aggregate, " and "),
+			len(filteredRecords), strings.Join(written, ", "))
+	} else {
+		fmt.Printf("Exported %d records%s to %s\n", len(filteredRecords), summedCredits, strings.Join(written, ", "))
+	}
+
+	// Signatures are sent along with the files they cover
+	if options.Sign {
+		signatures, err := signFiles(options.Config.SigningKeyFile, written)
+		if err != nil {
+			fmt.Println("Error signing export:", err)
+			return
+		}
+		fmt.Println("Signed export:", strings.Join(signatures, ", "))
+		written = append(written, signatures...)
+	}
+
+	if len(options.EmailTo) > 0 {
+		period := startDate
+		if endDate != "" {
+			period = startDate + " to " + endDate
+		}
+		subject := fmt.Sprintf("Check-in export %s (%d records)", period, len(filteredRecords))
+		body := fmt.Sprintf("Attached is the check-in export for %s with %d records.\n", period, len(filteredRecords))
+		if len(options.Aggregate) > 0 {
+			subject = "Check-in counts " + period
+			body = fmt.Sprintf("Attached are the check-in counts for %s by %s. Counts below %d are shown as <%d.\n",
+				period, strings.Join(options.Aggregate, " and "), options.MinCount, options.MinCount)
+		}
+		email := startSpan("smtp send", spanClient, trace)
+		email.set("server.address", options.Config.SMTP.Host)
+		err := sendEmail(options.Config.SMTP, options.EmailTo, subject, body, written)
+		email.finish(err)
+		if err != nil {
+			fmt.Println("Error emailing export, queued to retry (see -queue=status):", err)
+			outbox.add(delivery{Channel: "export email", Email: &queuedEmail{To: options.EmailTo, Subject: subject, Body: body, Attachments: written}})
+		} else {
+			fmt.Println("Emailed export to", strings.Join(options.EmailTo, ", "))
+		}
+	}
+
+	for _, destination := range options.Upload {
+		if err := uploadExports(options.Config, []string{destination}, written, trace); err != nil {
+			fmt.Println("Error uploading export, queued to retry (see -queue=status):", err)
+			outbox.add(delivery{Channel: destination + " upload", Upload: &queuedUpload{Destination: destination, Files: written}})
+		}
+	}
+	if options.Push {
+		pushRecords(options.Config.Push, filteredRecords, trace)
+	}
+	hooks.fire(hookEvent{Event: "export", Start: startDate, End: endDate, Records: len(filteredRecords), Files: written})
+
+	if options.SinceLastExport {
+		next := exportState{LastExported: last}
+		if last.Equal(state.LastExported) {
+			next.LastSecond = state.LastSecond
+		}
+		for _, record := range filteredRecords {
+			if recordTime, err := time.ParseInLocation("2006-01-02T15:04:05-07:00", record[0], location); err == nil && recordTime.Equal(last) {
+				next.LastSecond = append(next.LastSecond, exportedKey(record))
+			}
+		}
+		if err := saveExportState(options.StateFile, next); err != nil {
+			fmt.Println("Error saving export state:", err)
+		}
+	}
+}
+
+// printExportPreview prints how many records an export would have, the
+// first and last timestamps and the records on each day from the first to
+// the last, so a range can be checked before the export is sent anywhere
+func printExportPreview(records [][]string, first, last time.Time, location *time.Location, credits string) {
+	perDay := make(map[string]int)
+	for _, record := range records {
+		recordTime, _ := time.ParseInLocation("2006-01-02T15:04:05-07:00", record[0], location)
+		perDay[recordTime.In(location).Format("2006-01-02")]++
+	}
+	firstDay, lastDay := first.In(location).Format("2006-01-02"), last.In(location).Format("2006-01-02")
+	fmt.Printf("Preview, nothing was written: %d records match%s\n", len(records), credits)
+	fmt.Println("  First:", first.In(location).Format("2006-01-02T15:04:05-07:00"))
+	fmt.Println("  Last: ", last.In(location).Format("2006-01-02T15:04:05-07:00"))
+	fmt.Println("  Per day:")
+	day, _ := time.ParseInLocation("2006-01-02", firstDay, location)
+	for ; day.Format("2006-01-02") <= lastDay; day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		fmt.Printf("    %s %s %6d\n", date, day.Format("Mon"), perDay[date])
+	}
+}
+
+// exportPart is the rows of one export file: the CSV rows and, when columns
+// are resolved, the column rows, for Start to End (End empty for one day)
+type exportPart struct {
+	Start, End string
+	CSV        [][]string
+	Columns    [][]string
+}
+
+// splitByDay divides the rows of the records into a part for each local
+// date, in date order. columnRows may be nil.
+func splitByDay(records, csvRows, columnRows [][]string, location *time.Location) []exportPart {
+	index := make(map[string]int)
+	var parts []exportPart
+	for i, record := range records {
+		t, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+		if err != nil {
+			continue
+		}
+		date := t.In(location).Format("2006-01-02")
+		n, ok := index[date]
+		if !ok {
+			n = len(parts)
+			index[date] = n
+			parts = append(parts, exportPart{Start: date})
+		}
+		parts[n].CSV = append(parts[n].CSV, csvRows[i])
+		if columnRows != nil {
+			parts[n].Columns = append(parts[n].Columns, columnRows[i])
+		}
+	}
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].Start < parts[j].Start })
+	return parts
+}
+
+// writeCSVExport writes rows to filename, appending to it instead of replacing
+// it when appendMode is set
+func writeCSVExport(filename string, rows [][]string, appendMode bool) error {
+	return writeCSVFile(filename, rows, appendMode, excelOptions{}, ',')
+}
+
+// writeCSVFile is writeCSVExport with the Excel options and a field
+// delimiter, comma when zero. The byte order mark only starts a new or empty
+// file, never the middle of one being appended to.
+func writeCSVFile(filename string, rows [][]string, appendMode bool, excel excelOptions, comma rune) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendMode {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	exportFile, err := os.OpenFile(filename, flags, 0644)
+	if err != nil {
+		return err
+	}
+	if info, err := exportFile.Stat(); err == nil && info.Size() == 0 && excel.BOM {
+		if _, err := exportFile.WriteString("\ufeff"); err != nil {
+			exportFile.Close()
+			return err
+		}
+	}
+
+	writer := csv.NewWriter(exportFile)
+	writer.UseCRLF = excel.CRLF
+	if comma != 0 {
+		writer.Comma = comma
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		exportFile.Close()
+		return err
+	}
+	return exportFile.Close()
+}
+
+// loadExportState reads the incremental export state. A missing state file
+// means nothing has been exported yet.
+func loadExportState(path string) (exportState, error) {
+	var state exportState
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// saveExportState writes the incremental export state
+func saveExportState(path string, state exportState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// textIDs returns copies of the rows with the ID at index written as an
+// Excel formula for the text, so IDs like 00123 keep their leading zeros
+func textIDs(rows [][]string, index int) [][]string {
+	formatted := make([][]string, len(rows))
+	for i, row := range rows {
+		formatted[i] = append([]string{}, row...)
+		formatted[i][index] = `="` + row[index] + `"`
+	}
+	return formatted
+}
+
+// exportTimeFormats are the ways CSV exports can write timestamps
+var exportTimeFormats = []string{"rfc3339", "local", "split", "unix"}
+
+// formatTimestamps returns copies of the rows with the timestamp at index
+// written in the time format, for systems that can't read the stored offset:
+// local time without the offset, separate date and time columns, or Unix
+// seconds
+func formatTimestamps(rows [][]string, index int, format string, location *time.Location) [][]string {
+	formatted := make([][]string, len(rows))
+	for i, row := range rows {
+		t, err := time.Parse("2006-01-02T15:04:05-07:00", row[index])
+		if err != nil {
+			formatted[i] = row
+			continue
+		}
+		t = t.In(location)
+		var value []string
+		switch format {
+		case "local":
+			value = []string{t.Format("2006-01-02 15:04:05")}
+		case "split":
+			value = []string{t.Format("2006-01-02"), t.Format("15:04:05")}
+		case "unix":
+			value = []string{strconv.FormatInt(t.Unix(), 10)}
+		}
+		formatted[i] = append(append(append([]string{}, row[:index]...), value...), row[index+1:]...)
+	}
+	return formatted
+}
+
+// defaultExportColumns are the columns a stored record holds, in file order
+var defaultExportColumns = []string{"timestamp", "barcode_id", "daily_count"}
+
+// exportColumnAliases maps accepted -columns names to their canonical name
+var exportColumnAliases = map[string]string{
+	"timestamp":   "timestamp",
+	"time":        "timestamp",
+	"id":          "barcode_id",
+	"barcode_id":  "barcode_id",
+	"count":       "daily_count",
+	"daily_count": "daily_count",
+	"name":        "name",
+	"name_latin":  "name_latin",
+	"latin":       "name_latin",
+	"direction":   "direction",
+	"type":        "type",
+	"note":        "note",
+	"notes":       "note",
+	"tag":         "tags",
+	"tags":        "tags",
+	"scan_id":     "scan_id",
+	"credits":     "credits",
+	"source":      "source",
+
+	"day_of_week":               "day_of_week",
+	"weekday":                   "day_of_week",
+	"week_number":               "week_number",
+	"week":                      "week_number",
+	"hour_bucket":               "hour_bucket",
+	"hour":                      "hour_bucket",
+	"is_weekend":                "is_weekend",
+	"weekend":                   "is_weekend",
+	"days_since_previous_visit": "days_since_previous_visit",
+	"days_since_last_visit":     "days_since_previous_visit",
+}
+
+// parseExportColumns parses a comma-separated column list such as
+// "timestamp,name,id" into canonical column names
+func parseExportColumns(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	var columns []string
+	for _, column := range strings.Split(list, ",") {
+		column = strings.ToLower(strings.TrimSpace(column))
+		canonical, ok := exportColumnAliases[column]
+		if question, found := strings.CutPrefix(column, "answer."); found && screeningID.MatchString(question) {
+			canonical, ok = column, true
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown export column %q (available: timestamp, id, count, name, name_latin, direction, type, note, tags, scan_id, credits, source, day_of_week, week_number, hour_bucket, is_weekend, days_since_previous_visit, answer.<question>)", column)
+		}
+		columns = append(columns, canonical)
+	}
+	return columns, nil
+}
+
+// selectColumns returns a row holding the record's value for each column,
+// resolving names through the roster. A record's notes are joined with "; "
+// and its tags with ",". The derived date columns use local time, previous
+// holds each record's days since the previous visit, and answers its
+// screening answers. credits are check-ins' attendance credits, none for a
+// check-out. origins holds the sources records arrived through.
+func selectColumns(record []string, columns []string, roster map[string]rosterEntry, notes, tags, credits map[string][]string, previous map[string]string, answers map[string]map[string]string, origins map[string]recordOrigin) []string {
+	row := make([]string, len(columns))
+	t, _ := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+	t = t.In(time.Local)
+	for i, column := range columns {
+		switch column {
+		case "timestamp":
+			row[i] = record[0]
+		case "barcode_id":
+			row[i] = record[1]
+		case "daily_count":
+			if len(record) > 2 {
+				row[i] = record[2]
+			}
+		case "name":
+			row[i] = rosterName(roster, record[1])
+		case "name_latin":
+			row[i] = latinName(roster[record[1]])
+		case "direction":
+			row[i] = recordDirection(record)
+		case "type":
+			row[i] = recordType(record)
+		case "note":
+			row[i] = strings.Join(notes[noteKey(record)], "; ")
+		case "tags":
+			row[i] = strings.Join(tags[noteKey(record)], ",")
+		case "scan_id":
+			row[i] = recordScanID(record)
+		case "credits":
+			row[i] = formatCredits(recordCredits(credits, record))
+		case "source":
+			row[i] = origins[noteKey(record)].Source
+		case "day_of_week":
+			row[i] = t.Weekday().String()
+		case "week_number":
+			_, week := t.ISOWeek()
+			row[i] = strconv.Itoa(week)
+		case "hour_bucket":
+			row[i] = t.Format("15") + ":00"
+		case "is_weekend":
+			row[i] = strconv.FormatBool(t.Weekday() == time.Saturday || t.Weekday() == time.Sunday)
+		case "days_since_previous_visit":
+			row[i] = previous[noteKey(record)]
+		default:
+			if question, ok := strings.CutPrefix(column, "answer."); ok {
+				row[i] = answers[noteKey(record)][question]
+			}
+		}
+	}
+	return row
+}
+
+// previousVisits returns the days from each ID's previous check-in on an
+// earlier day to each of its records, by note key, counting calendar days in
+// local time. First visits are left out.
+func previousVisits(records [][]string) map[string]string {
+	visits := make(map[string][]time.Time) // each ID's check-in days, sorted
+	for _, record := range records {
+		if day, ok := localDay(record[0]); ok && recordDirection(record) == "in" {
+			visits[record[1]] = append(visits[record[1]], day)
+		}
+	}
+	for _, days := range visits {
+		sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	}
+
+	previous := make(map[string]string)
+	for _, record := range records {
+		day, ok := localDay(record[0])
+		if !ok {
+			continue
+		}
+		days := visits[record[1]]
+		if i := sort.Search(len(days), func(i int) bool { return !days[i].Before(day) }); i > 0 {
+			// Rounded, since a day with a daylight saving change isn't 24 hours
+			previous[noteKey(record)] = strconv.Itoa(int(day.Sub(days[i-1]).Hours()/24 + 0.5))
+		}
+	}
+	return previous
+}
+
+// localDay returns the local midnight starting the day of a timestamp
+func localDay(timestamp string) (time.Time, bool) {
+	t, err := time.Parse("2006-01-02T15:04:05-07:00", timestamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	year, month, day := t.In(time.Local).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local), true
+}
+
+// contains reports whether list holds value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// exportFilename builds the path for an export of count records from the
+// filename template, or the default export_<range>_<count>_records pattern
+// when no template is set. The output directory is created if needed.
+func exportFilename(options exportOptions, format, startDate, endDate string, count int) (string, error) {
+	var filename string
+	if options.Filename == "" && len(options.Aggregate) > 0 {
+		// Aggregates are shared outside, so their names don't give the count
+		filename = "aggregate_" + startDate
+		if endDate != "" {
+			filename += "_to_" + endDate
+		}
+		filename += "." + format
+	} else if options.Filename == "" {
+		if endDate == "" {
+			filename = fmt.Sprintf("export_%s_%d_records.%s", startDate, count, format)
+		} else {
+			filename = fmt.Sprintf("export_%s_to_%s_%d_records.%s", startDate, endDate, count, format)
+		}
+	} else {
+		tmpl, err := template.New("filename").Parse(options.Filename)
+		if err != nil {
+			return "", fmt.Errorf("parsing filename template: %w", err)
+		}
+		data := exportFilenameData{Start: startDate, End: endDate, Count: count, Format: format}
+		if data.End == "" {
+			data.End = startDate
+		}
+		var name strings.Builder
+		if err := tmpl.Execute(&name, data); err != nil {
+			return "", fmt.Errorf("expanding filename template: %w", err)
+		}
+		filename = name.String()
+		if filename == "" {
+			return "", fmt.Errorf("filename template %q produced an empty name", options.Filename)
+		}
+	}
+
+	if options.Dir == "" {
+		return filename, nil
+	}
+	if err := os.MkdirAll(options.Dir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(options.Dir, filename), nil
+}
+
+// sortExportRecords orders records by timestamp, ID or roster name (by
+// timestamp when by is empty), descending with desc. Ties go by timestamp
+// and then ID, and records the same in all of those keep their file order.
+// Timestamps compare as instants, so records written with different offsets
+// come out in the order they happened.
+func sortExportRecords(records [][]string, by string, desc bool, roster map[string]rosterEntry) {
+	type keyed struct {
+		record []string
+		key    string
+		t      time.Time
+	}
+	sorted := make([]keyed, len(records))
+	for i, record := range records {
+		t, _ := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+		sorted[i] = keyed{record: record, t: t}
+		switch by {
+		case "id":
+			sorted[i].key = record[1]
+		case "name":
+			sorted[i].key = strings.ToLower(rosterName(roster, record[1]))
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if desc {
+			a, b = b, a
+		}
+		switch {
+		case a.key != b.key:
+			return a.key < b.key
+		case !a.t.Equal(b.t):
+			return a.t.Before(b.t)
+		}
+		return a.record[1] < b.record[1]
+	})
+	for i := range sorted {
+		records[i] = sorted[i].record
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// familyMembers returns the other roster IDs in the same family as id, going
+// by the roster's "family" column, sorted by name
+func familyMembers(roster map[string]rosterEntry, id string) []string {
+	family := roster[id].Fields["family"]
+	if family == "" {
+		return nil
+	}
+	var members []string
+	for other, entry := range roster {
+		if other != id && entry.Fields["family"] == family {
+			members = append(members, other)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if roster[members[i]].Name != roster[members[j]].Name {
+			return roster[members[i]].Name < roster[members[j]].Name
+		}
+		return members[i] < members[j]
+	})
+	return members
+}
+
+// confirmFamily lists family members of the scanned person and asks which of
+// them are present. Enter selects everyone, numbers select some of them, and
+// anything else selects no one. With JSON logs there is no one at a console
+// to ask, so no one is selected.
+func (options scanOptions) confirmFamily(readAnswer func() (string, error), members []string) []string {
+	if len(members) == 0 || options.jsonLogs() {
+		return nil
+	}
+
+	verb := "check in"
+	if options.Direction == "out" {
+		verb = "check out"
+	}
+	var names []string
+	for i, member := range members {
+		name := rosterName(options.Roster, member)
+		fmt.Printf("  %d) %s (%s)\n", i+1, name, member)
+		names = append(names, fmt.Sprintf("%d, %s", i+1, name))
+	}
+	options.announce(announceInfo,
+		fmt.Sprintf("Press Enter to %s the whole family, type the numbers present (e.g. 1 3), or n for none.", verb),
+		fmt.Sprintf("Family members: %s. Press Enter to %s everyone, type the numbers present, or n for none.", strings.Join(names, "; "), verb))
+	fmt.Print("Family: ")
+
+	line, _ := readAnswer()
+	answer := strings.TrimSpace(line)
+	if answer == "" {
+		return members
+	}
+	var selected []string
+	for _, field := range strings.FieldsFunc(answer, func(r rune) bool { return r == ' ' || r == ',' }) {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 1 || n > len(members) {
+			if !strings.EqualFold(field, "n") {
+				fmt.Printf("Ignoring %q, which is not on the list.\n", field)
+			}
+			continue
+		}
+		if !contains(selected, members[n-1]) {
+			selected = append(selected, members[n-1])
+		}
+	}
+	return selected
+}
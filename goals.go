@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// goalConfig is one attendance target from the config file's "goals", or a
+// profile's for a program with its own records. -stats shows the progress in
+// each period of its report, and -watch and the server's /goals endpoint the
+// current period's.
+type goalConfig struct {
+	Name   string   `json:"name"`   // e.g. "Enrollment target"; default "weekly goal" for the period
+	Period string   `json:"period"` // day, week (Monday to Sunday) or month
+	Target int      `json:"target"` // check-ins, or people, to reach in each period
+	Types  []string `json:"types"`  // record types counted; empty counts all
+	Count  string   `json:"count"`  // check_ins (default) or people, counting each person once per period
+}
+
+// goalPeriods are the goal periods with the adjective describing them
+var goalPeriods = map[string]string{"day": "daily", "week": "weekly", "month": "monthly"}
+
+// checkGoals validates attendance goals
+func checkGoals(goals []goalConfig) error {
+	for _, goal := range goals {
+		if goalPeriods[goal.Period] == "" {
+			return fmt.Errorf("goals: period must be day, week or month, not %q", goal.Period)
+		}
+		if goal.Target <= 0 {
+			return fmt.Errorf("goals: the %s target must be a positive number", goal.label())
+		}
+		if goal.Count != "" && goal.Count != "check_ins" && goal.Count != "people" {
+			return fmt.Errorf("goals: count must be check_ins or people, not %q", goal.Count)
+		}
+		for _, t := range goal.Types {
+			if !contains(recordTypes, t) {
+				return fmt.Errorf("goals: unknown record type %q", t)
+			}
+		}
+	}
+	return nil
+}
+
+// label returns the goal's name, by default its period's, e.g. "weekly goal"
+func (goal goalConfig) label() string {
+	if goal.Name != "" {
+		return goal.Name
+	}
+	return goalPeriods[goal.Period] + " goal"
+}
+
+// periodKey returns the period of the goal a date (YYYY-MM-DD) falls in: the
+// date itself, its ISO week (YYYY-Www) or its month (YYYY-MM)
+func (goal goalConfig) periodKey(date string) string {
+	switch goal.Period {
+	case "week":
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return ""
+		}
+		year, week := day.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case "month":
+		return date[:7]
+	}
+	return date
+}
+
+// counts returns the goal's count in each period with records, by period key
+func (goal goalConfig) counts(records [][]string) map[string]int {
+	counts := make(map[string]int)
+	seen := make(map[string]bool) // period and ID, when counting people
+	for _, record := range records {
+		if recordDirection(record) != "in" || (len(goal.Types) > 0 && !contains(goal.Types, recordType(record))) {
+			continue
+		}
+		key := goal.periodKey(record[0][:10])
+		if goal.Count == "people" {
+			if seen[key+" "+record[1]] {
+				continue
+			}
+			seen[key+" "+record[1]] = true
+		}
+		counts[key]++
+	}
+	return counts
+}
+
+// goalProgress is a goal's count in one period
+type goalProgress struct {
+	Goal    string `json:"goal"`
+	Period  string `json:"period"` // YYYY-MM-DD, YYYY-Www or YYYY-MM
+	Count   int    `json:"count"`
+	Target  int    `json:"target"`
+	Percent int    `json:"percent"`
+}
+
+// newGoalProgress returns the goal's progress in a period
+func newGoalProgress(goal goalConfig, period string, count int) goalProgress {
+	return goalProgress{Goal: goal.label(), Period: period, Count: count, Target: goal.Target, Percent: count * 100 / goal.Target}
+}
+
+// String describes the progress, e.g. "312 of 400 weekly goal (78%)"
+func (p goalProgress) String() string {
+	return fmt.Sprintf("%d of %d %s (%d%%)", p.Count, p.Target, p.Goal, p.Percent)
+}
+
+// currentGoals returns each goal's progress in the period containing now
+func currentGoals(goals []goalConfig, now time.Time) ([]goalProgress, error) {
+	progress := []goalProgress{}
+	if len(goals) == 0 {
+		return progress, nil
+	}
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+	today := now.Format("2006-01-02")
+	for _, goal := range goals {
+		key := goal.periodKey(today)
+		progress = append(progress, newGoalProgress(goal, key, goal.counts(records)[key]))
+	}
+	return progress, nil
+}
+
+// handleGoals returns each goal's progress in the current period as JSON for
+// dashboards
+func handleGoals(w http.ResponseWriter, r *http.Request, goals []goalConfig) {
+	progress, err := currentGoals(goals, time.Now())
+	if err != nil {
+		http.Error(w, "error reading data file", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(progress)
+}
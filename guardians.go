@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Default guardian texts, with {name}, {time} and {station} filled in
+const (
+	defaultGuardianInMessage  = "{name} checked in at {time}."
+	defaultGuardianOutMessage = "{name} checked out at {time}."
+)
+
+// guardianSMSConfig is the config file's "guardian_sms" section: texts to a
+// child's guardians when the child checks in or out. Families opt in per
+// roster entry by giving the numbers to text in the roster's guardian_sms
+// column, separated by ";"; entries without any get no texts.
+type guardianSMSConfig struct {
+	Gateway    smsConfig `json:"gateway"`     // its to list is unused; the numbers come from the roster
+	Column     string    `json:"column"`      // roster column of numbers to text; default guardian_sms
+	Types      []string  `json:"types"`       // record types texted about, e.g. ["member"]; empty for all
+	InMessage  string    `json:"in_message"`  // default "{name} checked in at {time}."
+	OutMessage string    `json:"out_message"` // default "{name} checked out at {time}."
+}
+
+// request builds the form post sending body to a number, or returns nil
+// when no gateway URL is set
+func (s smsConfig) request(to, body string) (*http.Request, error) {
+	if s.URL == "" {
+		return nil, nil
+	}
+	form := url.Values{"To": {to}, "From": {s.From}, "Body": {body}}
+	req, err := http.NewRequest("POST", s.URL, strings.NewReader(form.Encode()))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if s.Username != "" {
+			req.SetBasicAuth(s.Username, s.Password)
+		}
+	}
+	return req, err
+}
+
+// numbers returns the opted-in numbers to text about a roster entry
+func (settings guardianSMSConfig) numbers(entry rosterEntry) []string {
+	column := settings.Column
+	if column == "" {
+		column = "guardian_sms"
+	}
+	var numbers []string
+	for _, number := range strings.Split(entry.Fields[strings.ToLower(column)], ";") {
+		if number = strings.TrimSpace(number); number != "" {
+			numbers = append(numbers, number)
+		}
+	}
+	return numbers
+}
+
+// notify queues a text to each of an entry's guardians about a recorded
+// check-in or check-out. It does nothing for entries that haven't opted in
+// or record types the texts aren't sent for.
+func (settings guardianSMSConfig) notify(entry rosterEntry, recordType, direction string, now time.Time, station string, report func(error)) {
+	if settings.Gateway.URL == "" || len(settings.Types) > 0 && !contains(settings.Types, recordType) {
+		return
+	}
+	numbers := settings.numbers(entry)
+	if len(numbers) == 0 {
+		return
+	}
+	template := settings.InMessage
+	if template == "" {
+		template = defaultGuardianInMessage
+	}
+	if direction == "out" {
+		template = settings.OutMessage
+		if template == "" {
+			template = defaultGuardianOutMessage
+		}
+	}
+	name := entry.Name
+	if name == "" {
+		name = "ID " + entry.ID
+	}
+	message := strings.NewReplacer("{name}", name, "{time}", now.Format("15:04"), "{station}", station).Replace(template)
+	for _, to := range numbers {
+		req, err := settings.Gateway.request(to, message)
+		if err != nil {
+			report(err)
+			continue
+		}
+		queueRequest("guardian sms", req)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// minFreeDiskBytes is the free space below which the data directory is
+	// reported as not ready
+	minFreeDiskBytes = 100 << 20
+
+	// backendDialTimeout limits how long each backend connectivity check waits
+	backendDialTimeout = 3 * time.Second
+
+	// maxClockLag is how far the newest record may be ahead of the clock
+	// before the clock is reported as having gone backwards
+	maxClockLag = 5 * time.Minute
+
+	// maxClockOffset is how far the clock may be from the NTP server's
+	maxClockOffset = time.Minute
+
+	// ntpEpochOffset is the seconds from the NTP epoch, 1900, to the Unix one
+	ntpEpochOffset = 2208988800
+)
+
+// healthCheck is the result of one readiness check
+type healthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// handleHealthz reports that the server is up
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz runs the readiness checks and reports them as JSON, with
+// status 503 when any check fails
+func handleReadyz(w http.ResponseWriter, r *http.Request, cfg config) {
+	checks := readinessChecks(cfg, time.Now())
+	status := "ok"
+	for _, check := range checks {
+		if !check.OK {
+			status = "failing"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(struct {
+		Status string        `json:"status"`
+		Checks []healthCheck `json:"checks"`
+	}{status, checks})
+}
+
+// readinessChecks checks that scan mode could keep recording: the data file
+// can be written, its disk has space, the configured backends and network
+// share are reachable and the clock is right
+func readinessChecks(cfg config, now time.Time) []healthCheck {
+	checks := []healthCheck{checkDataFileWritable(), checkDiskSpace(), checkClock(now, cfg.NTPServer)}
+	if cfg.Share.Path != "" {
+		checks = append(checks, checkShare(cfg.Share))
+	}
+
+	var backends [][2]string
+	if cfg.SMTP.Host != "" {
+		port := cfg.SMTP.Port
+		if port == 0 {
+			port = 587
+		}
+		backends = append(backends, [2]string{"smtp", net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(port))})
+	}
+	if cfg.SFTP.Host != "" {
+		port := cfg.SFTP.Port
+		if port == 0 {
+			port = 22
+		}
+		backends = append(backends, [2]string{"sftp", net.JoinHostPort(cfg.SFTP.Host, strconv.Itoa(port))})
+	}
+	if cfg.Drive.CredentialsFile != "" {
+		backends = append(backends, [2]string{"drive", "www.googleapis.com:443"})
+	}
+	if webhook, err := url.Parse(cfg.Capacity.Webhook); err == nil && webhook.Host != "" {
+		port := webhook.Port()
+		if port == "" {
+			port = "443"
+			if webhook.Scheme == "http" {
+				port = "80"
+			}
+		}
+		backends = append(backends, [2]string{"webhook", net.JoinHostPort(webhook.Hostname(), port)})
+	}
+	for _, backend := range backends {
+		check := healthCheck{Name: backend[0], OK: true, Detail: backend[1]}
+		conn, err := net.DialTimeout("tcp", backend[1], backendDialTimeout)
+		if err != nil {
+			check.OK, check.Detail = false, err.Error()
+		} else {
+			conn.Close()
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// checkDataFileWritable checks that the file scan mode records to can be
+// opened for appending, without writing to it. A file that doesn't exist yet
+// is checked by creating and removing a file in its directory.
+func checkDataFileWritable() healthCheck {
+	name := currentDataFile()
+	check := healthCheck{Name: "data_file", OK: true, Detail: name}
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if os.IsNotExist(err) {
+		file, err = os.CreateTemp(filepath.Dir(name), ".checkin-health*")
+		if err == nil {
+			defer os.Remove(file.Name())
+		}
+	}
+	if err != nil {
+		check.OK, check.Detail = false, err.Error()
+		return check
+	}
+	file.Close()
+	return check
+}
+
+// checkDiskSpace checks the free space on the data file's disk
+func checkDiskSpace() healthCheck {
+	check := healthCheck{Name: "disk_space", OK: true}
+	free, err := freeDiskBytes(filepath.Dir(currentDataFile()))
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	check.Detail = fmt.Sprintf("%d MB free", free>>20)
+	if free < minFreeDiskBytes {
+		check.OK = false
+		check.Detail += fmt.Sprintf(", below %d MB", minFreeDiskBytes>>20)
+	}
+	return check
+}
+
+// checkClock checks that the clock was set, such as on a board without a
+// battery-backed clock that booted offline, that it isn't behind the newest
+// record, and, when ntpServer is set, that it agrees with the server
+func checkClock(now time.Time, ntpServer string) healthCheck {
+	check := healthCheck{Name: "clock", OK: true, Detail: now.Format("2006-01-02T15:04:05-07:00")}
+	if now.Year() < 2020 {
+		check.OK = false
+		check.Detail += " looks unset"
+		return check
+	}
+	if ntpServer != "" {
+		offset, err := ntpOffset(ntpServer)
+		if err == nil && (offset > maxClockOffset || offset < -maxClockOffset) {
+			check.OK = false
+			check.Detail += fmt.Sprintf(" is %s off from %s", offset.Round(time.Second), ntpServer)
+			return check
+		}
+	}
+	record, err := lastRecord()
+	if err != nil || record == nil {
+		return check
+	}
+	if last, err := time.Parse("2006-01-02T15:04:05-07:00", record[0]); err == nil && last.Sub(now) > maxClockLag {
+		check.OK = false
+		check.Detail += " is behind the newest record at " + record[0]
+	}
+	return check
+}
+
+// ntpOffset asks an NTP server for the time with a single SNTP request and
+// returns how far ahead of the local clock the server is, allowing for half
+// the round trip
+func ntpOffset(server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", server, backendDialTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(backendDialTimeout))
+
+	request := make([]byte, 48)
+	request[0] = 0x23 // version 4, client mode
+	sent := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+	response := make([]byte, 48)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return 0, err
+	}
+	received := time.Now()
+
+	// The transmit timestamp: seconds and a binary fraction since 1900
+	seconds := binary.BigEndian.Uint32(response[40:44])
+	fraction := binary.BigEndian.Uint32(response[44:48])
+	if seconds == 0 {
+		return 0, fmt.Errorf("%s sent no time", server)
+	}
+	serverTime := time.Unix(int64(seconds)-ntpEpochOffset, int64(fraction)*1e9>>32)
+	return serverTime.Sub(sent.Add(received.Sub(sent) / 2)), nil
+}
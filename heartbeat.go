@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHeartbeatInterval is how often scan mode sends a heartbeat when
+	// the config doesn't say
+	defaultHeartbeatInterval = time.Minute
+
+	// missedHeartbeats is how many intervals a station can go without a
+	// heartbeat before it's listed as down
+	missedHeartbeats = 3
+)
+
+// heartbeatConfig is the config file's "heartbeat" section: the central
+// server scan stations report to, so a station that stopped is noticed when
+// it stops rather than at closing time
+type heartbeatConfig struct {
+	URL      string   `json:"url"`      // the central server's -serve address, e.g. "http://office:8080"
+	Token    string   `json:"token"`    // an operator API token on the central server
+	Interval duration `json:"interval"` // how often scan mode sends one; default 1m
+}
+
+// interval returns how often heartbeats are sent
+func (settings heartbeatConfig) interval() time.Duration {
+	if settings.Interval > 0 {
+		return time.Duration(settings.Interval)
+	}
+	return defaultHeartbeatInterval
+}
+
+// stationHeartbeat is the body of a POST to /api/heartbeats, and the latest
+// one from each station in the server's stations file
+type stationHeartbeat struct {
+	Station         string    `json:"station"`
+	Direction       string    `json:"direction"`
+	SentAt          time.Time `json:"sent_at"`
+	StartedAt       time.Time `json:"started_at"` // when scan mode started
+	IntervalSeconds int       `json:"interval_seconds"`
+	LastScan        time.Time `json:"last_scan,omitzero"`
+	ScansToday      int       `json:"scans_today"`         // recorded today since scan mode started
+	ScansPerMinute  float64   `json:"scans_per_minute"`    // over the arrival_rate window
+	RateHigh        bool      `json:"rate_high,omitempty"` // over the station's arrival_rate alert threshold
+	Errors          int       `json:"errors"`              // since scan mode started
+	LastError       string    `json:"last_error,omitempty"`
+	FreeMB          int       `json:"free_mb"` // on the data file's disk; -1 when unknown
+	Stopped         bool      `json:"stopped,omitempty"`
+	Paused          string    `json:"paused,omitempty"`     // the reason scans are paused at the station
+	ReceivedAt      time.Time `json:"received_at,omitzero"` // set by the server
+}
+
+// status returns whether the station is alive, paused, stopped (scan mode
+// exited) or down (missedHeartbeats intervals without a heartbeat)
+func (beat stationHeartbeat) status(now time.Time) string {
+	interval := time.Duration(beat.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	switch {
+	case beat.Stopped:
+		return "stopped"
+	case now.Sub(beat.ReceivedAt) > missedHeartbeats*interval:
+		return "down"
+	case beat.Paused != "":
+		return "paused"
+	}
+	return "alive"
+}
+
+// heartbeat sends a scan station's heartbeats in the background. Its methods
+// do nothing on a nil heartbeat, for stations without a central server.
+type heartbeat struct {
+	settings heartbeatConfig
+	arrival  arrivalRateConfig
+	warn     func(error) // called when sending starts failing
+
+	mu      sync.Mutex
+	beat    stationHeartbeat
+	scans   arrivalCounter
+	today   string // the day ScansToday counts
+	failing bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startHeartbeat starts sending heartbeats for the station, returning nil
+// when the config has no heartbeat url. Heartbeats carry the rate scans arrive
+// at, flagged when it is over the arrival rate alert threshold.
+func startHeartbeat(settings heartbeatConfig, arrival arrivalRateConfig, station, direction string, warn func(error)) *heartbeat {
+	if settings.URL == "" {
+		return nil
+	}
+	now := time.Now()
+	h := &heartbeat{
+		settings: settings,
+		arrival:  arrival,
+		warn:     warn,
+		scans:    arrivalCounter{window: arrival.window()},
+		beat:     stationHeartbeat{Station: station, Direction: direction, StartedAt: now, IntervalSeconds: int(settings.interval() / time.Second)},
+		today:    now.Format("2006-01-02"),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(h.done)
+		ticker := time.NewTicker(settings.interval())
+		defer ticker.Stop()
+		h.send(false)
+		for {
+			select {
+			case <-ticker.C:
+				h.send(false)
+			case <-h.stop:
+				h.send(true)
+				return
+			}
+		}
+	}()
+	return h
+}
+
+// scanned counts a recorded scan
+func (h *heartbeat) scanned(now time.Time) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rollOver(now)
+	h.beat.LastScan = now
+	h.beat.ScansToday++
+	h.scans.add(now)
+}
+
+// failed counts an error scan mode logged
+func (h *heartbeat) failed(message string, err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.beat.Errors++
+	h.beat.LastError = fmt.Sprintf("%s: %v", message, err)
+}
+
+// paused reports the reason scans were paused for, or "" once they resume
+func (h *heartbeat) paused(reason string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.beat.Paused = reason
+}
+
+// rollOver starts a new day's count after midnight
+func (h *heartbeat) rollOver(now time.Time) {
+	if date := now.Format("2006-01-02"); date != h.today {
+		h.today = date
+		h.beat.ScansToday = 0
+	}
+}
+
+// send posts one heartbeat, the last one marked stopped. Heartbeats aren't
+// queued, since a late one says nothing about the station now; the first
+// failure after a success is passed to warn.
+func (h *heartbeat) send(stopped bool) {
+	now := time.Now()
+	h.mu.Lock()
+	h.rollOver(now)
+	beat := h.beat
+	rate := h.scans.rate(now)
+	h.mu.Unlock()
+	beat.ScansPerMinute, beat.RateHigh = math.Round(rate*10)/10, beat.Direction != "out" && h.arrival.high(rate)
+	beat.SentAt, beat.Stopped, beat.FreeMB = now, stopped, -1
+	if free, err := freeDiskBytes(filepath.Dir(currentDataFile())); err == nil {
+		beat.FreeMB = int(free >> 20)
+	}
+
+	body, err := json.Marshal(beat)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(h.settings.URL, "/")+"/api/heartbeats", bytes.NewReader(body))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+h.settings.Token)
+		client := http.Client{Timeout: 10 * time.Second}
+		var resp *http.Response
+		resp, err = client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("%s", resp.Status)
+			}
+		}
+	}
+	h.mu.Lock()
+	failing := h.failing
+	h.failing = err != nil
+	h.mu.Unlock()
+	if err != nil && !failing && h.warn != nil {
+		h.warn(err)
+	}
+}
+
+// close sends a last heartbeat saying the station stopped, for when scan
+// mode exits
+func (h *heartbeat) close() {
+	if h == nil {
+		return
+	}
+	close(h.stop)
+	<-h.done
+}
+
+// stationsFile returns the file next to the data file the server keeps each
+// station's latest heartbeat in, e.g. scans.stations.json for scans.csv
+func stationsFile() string {
+	return strings.TrimSuffix(dataFile, filepath.Ext(dataFile)) + ".stations.json"
+}
+
+// loadStations returns the latest heartbeat from each station, sorted by
+// name
+func loadStations() ([]stationHeartbeat, error) {
+	data, err := os.ReadFile(stationsFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var stations []stationHeartbeat
+	if err := json.Unmarshal(data, &stations); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", stationsFile(), err)
+	}
+	sort.Slice(stations, func(i, j int) bool { return stations[i].Station < stations[j].Station })
+	return stations, nil
+}
+
+// handleHeartbeats records a station's heartbeat in the stations file
+func (api mobileAPI) handleHeartbeats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if api.ReadOnly {
+		http.Error(w, "the server is read-only", http.StatusForbidden)
+		return
+	}
+	var beat stationHeartbeat
+	if err := json.NewDecoder(r.Body).Decode(&beat); err != nil || beat.Station == "" {
+		http.Error(w, "invalid heartbeat: expected a JSON object with a station", http.StatusBadRequest)
+		return
+	}
+	beat.ReceivedAt = time.Now()
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	stations, err := loadStations()
+	if err == nil {
+		known := false
+		for i := range stations {
+			if stations[i].Station == beat.Station {
+				if stations[i].status(beat.ReceivedAt) == "down" {
+					fmt.Printf("Station %s is sending heartbeats again.\n", beat.Station)
+				}
+				stations[i], known = beat, true
+			}
+		}
+		if !known {
+			fmt.Printf("First heartbeat from station %s.\n", beat.Station)
+			stations = append(stations, beat)
+		}
+		var data []byte
+		if data, err = json.MarshalIndent(stations, "", "  "); err == nil {
+			err = writeFileAtomic(stationsFile(), data, 0644)
+		}
+	}
+	if err != nil {
+		http.Error(w, "saving heartbeat: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// stationStatus is one station in /api/stations and on the /stations page
+type stationStatus struct {
+	stationHeartbeat
+	Status string `json:"status"`
+}
+
+// currentStations returns each station's latest heartbeat with its status
+func currentStations(now time.Time) ([]stationStatus, error) {
+	stations, err := loadStations()
+	statuses := []stationStatus{}
+	for _, beat := range stations {
+		statuses = append(statuses, stationStatus{beat, beat.status(now)})
+	}
+	return statuses, err
+}
+
+// handleStations returns each station's latest heartbeat and status as JSON
+// for dashboards
+func handleStations(w http.ResponseWriter, r *http.Request) {
+	statuses, err := currentStations(time.Now())
+	if err != nil {
+		http.Error(w, "error reading stations file", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// handleStationsPage shows the stations panel, which reloads itself every
+// half minute
+func handleStationsPage(w http.ResponseWriter, r *http.Request) {
+	statuses, err := currentStations(time.Now())
+	if err != nil {
+		http.Error(w, "error reading stations file", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	stationsTemplate.Execute(w, statuses)
+}
+
+// ago describes how long before now a heartbeat or scan was, e.g. "3m ago",
+// or "never" for a zero time
+func ago(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	since := time.Since(t)
+	switch {
+	case since < time.Minute:
+		return fmt.Sprintf("%ds ago", int(since.Seconds()))
+	case since < time.Hour:
+		return fmt.Sprintf("%dm ago", int(since.Minutes()))
+	case since < 48*time.Hour:
+		return fmt.Sprintf("%dh%02dm ago", int(since.Hours()), int(since.Minutes())%60)
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// stationsTemplate renders the stations panel
+var stationsTemplate = template.Must(template.New("stations.html").Funcs(template.FuncMap{"ago": ago}).ParseFS(assets, "assets/stations.html"))
+
+// runStationsMode lists the stations that have sent the server heartbeats,
+// with those that stopped sending them flagged as down
+func runStationsMode() {
+	statuses, err := currentStations(time.Now())
+	if err != nil {
+		fmt.Println("Error reading stations file:", err)
+		return
+	}
+	if len(statuses) == 0 {
+		fmt.Println("No station has sent a heartbeat to this server.")
+		return
+	}
+	down := 0
+	fmt.Printf("  %-20s %-8s %-16s %-16s %6s %8s %6s %9s\n", "station", "status", "heartbeat", "last scan", "today", "rate/min", "errors", "free disk")
+	for _, station := range statuses {
+		flag := " "
+		if station.Status == "down" {
+			flag = "!"
+			down++
+		}
+		free := ""
+		if station.FreeMB >= 0 {
+			free = fmt.Sprintf("%d MB", station.FreeMB)
+		}
+		rate := fmt.Sprintf("%.1f", station.ScansPerMinute)
+		if station.RateHigh && station.Status == "alive" {
+			rate = "high " + rate
+		}
+		fmt.Printf("%s %-20s %-8s %-16s %-16s %6d %8s %6d %9s\n", flag, station.Station, station.Status, ago(station.ReceivedAt), ago(station.LastScan),
+			station.ScansToday, rate, station.Errors, free)
+		if station.Status == "paused" {
+			fmt.Printf("    paused for %s\n", station.Paused)
+		}
+		if station.LastError != "" {
+			fmt.Printf("    last error: %s\n", station.LastError)
+		}
+	}
+	if down > 0 {
+		fmt.Printf("\n%d station(s) down (!): no heartbeat for %d intervals.\n", down, missedHeartbeats)
+	}
+}
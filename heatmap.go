@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// heatmapShades are the terminal background colors for no check-ins and the
+// four quartiles of the busiest day, from the 256-color palette
+var heatmapShades = []int{236, 22, 28, 34, 46}
+
+// heatmapColors are the same shades for the HTML calendar
+var heatmapColors = []string{"#ebedf0", "#9be9a8", "#40c463", "#30a14e", "#216e39"}
+
+// heatmapDay is one day cell of the calendar
+type heatmapDay struct {
+	Label string // the date and its count, shown on hover
+	Color string
+	X, Y  int
+}
+
+// heatmapPage is the data for the HTML heatmap template
+type heatmapPage struct {
+	Lang, Title, Heading, Note string
+	Weekdays                   [4]string // the Monday, Wednesday, Friday and Sunday row labels
+	Days                       []heatmapDay
+	Months                     []heatmapMonth
+	Width, Height              int
+}
+
+// heatmapMonth labels the week column a month starts in
+type heatmapMonth struct {
+	Name string
+	X    int
+}
+
+// runHeatmapMode shows check-ins per day from first to last (YYYY-MM-DD) as
+// a calendar grid with a column per week and a row per weekday, shaded by how
+// busy each day was, and saves the same calendar as an HTML page with an SVG
+// in dir, both in the report locale
+func runHeatmapMode(first, last, dir string, loc reportLocale) {
+	start, err := time.ParseInLocation("2006-01-02", first, time.Local)
+	if err != nil {
+		fmt.Println("Error parsing start date:", err)
+		return
+	}
+	end, err := time.ParseInLocation("2006-01-02", last, time.Local)
+	if err != nil {
+		fmt.Println("Error parsing end date:", err)
+		return
+	}
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+
+	counts := make(map[string]int)
+	busiest := 0
+	for _, record := range records {
+		date := record[0][:10]
+		if recordDirection(record) == "in" && date >= first && date <= last {
+			counts[date]++
+			if counts[date] > busiest {
+				busiest = counts[date]
+			}
+		}
+	}
+	// shade returns the heatmap level of a day's count
+	shade := func(count int) int {
+		if count == 0 {
+			return 0
+		}
+		return (count*4-1)/busiest + 1
+	}
+
+	// Weeks start on Monday, so the grid starts at the Monday on or
+	// before the first date
+	gridStart := start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	weeks := int(end.Sub(gridStart).Hours()/24)/7 + 1
+
+	fmt.Println(loc.textf("Check-ins per day, %s to %s (busiest day: %s)", loc.date(first), loc.date(last), loc.number(busiest)) + "\n")
+	page := heatmapPage{
+		Lang:     loc.Tag,
+		Title:    loc.textf("Check-ins %s to %s", loc.date(first), loc.date(last)),
+		Heading:  loc.textf("Check-ins per day, %s to %s", loc.date(first), loc.date(last)),
+		Note:     loc.textf("Busiest day: %s check-ins. Hover over a day for its count.", loc.number(busiest)),
+		Weekdays: [4]string{loc.Weekdays[time.Monday], loc.Weekdays[time.Wednesday], loc.Weekdays[time.Friday], loc.Weekdays[time.Sunday]},
+		Width:    40 + weeks*14, Height: 30 + 7*14,
+	}
+
+	// Month names go above the week each month starts in, where they fit
+	header := []rune(fmt.Sprintf("%*s", 5+weeks*2+6, ""))
+	next := 0
+	for w := 0; w < weeks; w++ {
+		monday := gridStart.AddDate(0, 0, w*7)
+		if position := 5 + w*2; (w == 0 || monday.Day() <= 7) && position >= next {
+			name := loc.Short[monday.AddDate(0, 0, 6).Month()-1]
+			copy(header[position:], []rune(name))
+			next = position + len([]rune(name)) + 1
+			page.Months = append(page.Months, heatmapMonth{Name: name, X: 40 + w*14})
+		}
+	}
+	fmt.Println(strings.TrimRight(string(header), " "))
+
+	for weekday := 0; weekday < 7; weekday++ {
+		fmt.Printf("%-4s ", loc.Weekdays[(weekday+1)%7])
+		for w := 0; w < weeks; w++ {
+			day := gridStart.AddDate(0, 0, w*7+weekday)
+			if day.Before(start) || day.After(end) {
+				fmt.Print("  ")
+				continue
+			}
+			date := day.Format("2006-01-02")
+			level := shade(counts[date])
+			fmt.Printf("\033[48;5;%dm  \033[0m", heatmapShades[level])
+			page.Days = append(page.Days, heatmapDay{
+				Label: loc.textf("%s: %s", loc.date(date), loc.number(counts[date])), Color: heatmapColors[level],
+				X: 40 + w*14, Y: 30 + weekday*14,
+			})
+		}
+		fmt.Println()
+	}
+	fmt.Print("\n     " + loc.text("less") + " ")
+	for _, color := range heatmapShades {
+		fmt.Printf("\033[48;5;%dm  \033[0m", color)
+	}
+	fmt.Println(" " + loc.text("more"))
+
+	filename := "heatmap_" + first + "_" + last + ".html"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving heatmap:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	out, err := os.Create(filename)
+	if err != nil {
+		fmt.Println("Error saving heatmap:", err)
+		return
+	}
+	if err := heatmapTemplate.Execute(out, page); err != nil {
+		out.Close()
+		fmt.Println("Error saving heatmap:", err)
+		return
+	}
+	if err := out.Close(); err != nil {
+		fmt.Println("Error saving heatmap:", err)
+		return
+	}
+	fmt.Println("\nSaved to", filename)
+}
+
+// heatmapTemplate renders the calendar as a standalone HTML page
+var heatmapTemplate = template.Must(template.ParseFS(assets, "assets/heatmap.html"))
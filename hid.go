@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Linux input event constants from linux/input.h
+const (
+	evKey     = 0x01       // EV_KEY event type
+	keyPress  = 1          // key event value for a press
+	evioCGrab = 0x40044590 // EVIOCGRAB ioctl, for exclusive access to a device
+)
+
+// hidKeys maps the evdev key codes a barcode scanner types to characters.
+// Scanners send digits from the main row or the keypad, followed by Enter.
+var hidKeys = map[uint16]byte{
+	2: '1', 3: '2', 4: '3', 5: '4', 6: '5', 7: '6', 8: '7', 9: '8', 10: '9', 11: '0',
+	79: '1', 80: '2', 81: '3', 75: '4', 76: '5', 77: '6', 71: '7', 72: '8', 73: '9', 82: '0',
+	28: '\n', 96: '\n', // Enter and keypad Enter
+}
+
+// hidShiftKeys are the left and right Shift key codes, which scanners press
+// around some characters
+var hidShiftKeys = map[uint16]bool{42: true, 54: true}
+
+// scanInput returns where scan mode reads IDs from. Without a HID device
+// that is standard input. With one, the scanner's key presses are read
+// straight from its evdev device (e.g. /dev/input/by-id/usb-...-event-kbd),
+// which it is grabbed from other programs, so scans are captured whichever
+// window has focus. Lines typed at the terminal, such as exit, still work.
+// Closing the input releases the device.
+func scanInput(device string) (io.ReadCloser, error) {
+	if device == "" {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	file, err := os.Open(device)
+	if err != nil {
+		return nil, err
+	}
+	if err := grabDevice(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("grabbing %s: %w", device, err)
+	}
+
+	reader, writer := io.Pipe()
+	var mu sync.Mutex
+	writeLine := func(line []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		_, err := writer.Write(line)
+		return err
+	}
+
+	// A closed or detached terminal leaves the scanner running, as at an
+	// unattended kiosk. Once the input is closed, the next line typed ends
+	// this reader so it doesn't compete with a newer one.
+	go func() {
+		terminal := bufio.NewReader(os.Stdin)
+		for {
+			line, err := terminal.ReadBytes('\n')
+			if len(line) > 0 && line[len(line)-1] == '\n' {
+				if writeLine(line) != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Each input_event is a struct timeval followed by a 16-bit type and code
+	// and a 32-bit value
+	eventSize := 2*strconv.IntSize/8 + 8
+	go func() {
+		defer file.Close()
+		event := make([]byte, eventSize)
+		var line []byte
+		for {
+			if _, err := io.ReadFull(file, event); err != nil {
+				writer.CloseWithError(fmt.Errorf("reading %s: %w", device, err))
+				return
+			}
+			kind := binary.NativeEndian.Uint16(event[eventSize-8:])
+			code := binary.NativeEndian.Uint16(event[eventSize-6:])
+			value := int32(binary.NativeEndian.Uint32(event[eventSize-4:]))
+			if kind != evKey || value != keyPress {
+				continue
+			}
+			char, ok := hidKeys[code]
+			if hidShiftKeys[code] {
+				continue
+			} else if !ok {
+				// Keep the line from passing as a valid ID
+				char = '?'
+			}
+			line = append(line, char)
+			if char == '\n' {
+				if writeLine(line) != nil {
+					return
+				}
+				line = nil
+			}
+		}
+	}()
+	return hidInput{reader, file}, nil
+}
+
+// hidInput is the merged input of a HID scanner and the terminal
+type hidInput struct {
+	*io.PipeReader
+	device *os.File
+}
+
+// Close stops reading and releases the device's grab
+func (input hidInput) Close() error {
+	input.PipeReader.Close()
+	return input.device.Close()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// historySources is set by -history, or the config file's "history": data
+// files from earlier years, and folders of them, that the modes reading the
+// records read first, before the archives and the live records. They are only
+// ever opened for reading, so they can sit on a read-only mount, and the
+// maintenance commands that rewrite the data files leave them alone.
+var historySources []string
+
+// historyFiles expands the history sources to files, oldest first: each file
+// as it is, and each folder's data files in name order, which sorts dated
+// names such as scans-2023.csv. A folder's data files are those named like the
+// data file, its monthly partitions and archives, or those with a year in
+// place of the month, gzipped or not; sidecars such as scans.tags.csv, exports
+// and the roster are left out. Files that are also among the live data files
+// or archives in skip are left out too, so pointing history at the data folder
+// doesn't read records twice.
+func historyFiles(skip []string) ([]string, error) {
+	skipped := make(map[string]bool)
+	for _, name := range skip {
+		if abs, err := filepath.Abs(name); err == nil {
+			skipped[abs] = true
+		}
+	}
+
+	var files []string
+	for _, source := range historySources {
+		info, err := os.Stat(source)
+		if err != nil {
+			return nil, fmt.Errorf("history: %w", err)
+		}
+		matches := []string{source}
+		if info.IsDir() {
+			matches = nil
+			entries, err := os.ReadDir(source)
+			if err != nil {
+				return nil, fmt.Errorf("history: %w", err)
+			}
+			for _, entry := range entries {
+				name := entry.Name()
+				if !entry.IsDir() && isHistoryName(name) {
+					matches = append(matches, filepath.Join(source, name))
+				}
+			}
+			sort.Strings(matches)
+		}
+		for _, name := range matches {
+			abs, err := filepath.Abs(name)
+			if err != nil || skipped[abs] {
+				continue
+			}
+			skipped[abs] = true
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// isHistoryName reports whether a file name in a history folder is one of the
+// data file's names: scans.csv, scans-2023.csv, scans-2023-04.csv or
+// scans.archive-2023-04.csv.gz for scans.csv
+func isHistoryName(name string) bool {
+	ext := filepath.Ext(dataFile)
+	base := strings.TrimSuffix(filepath.Base(dataFile), ext)
+	name = strings.TrimSuffix(name, ".gz")
+	if !strings.HasSuffix(name, ext) || !strings.HasPrefix(name, base) {
+		return false
+	}
+	date := strings.TrimSuffix(strings.TrimPrefix(name, base), ext)
+	if date == "" {
+		return true
+	}
+	if strings.HasPrefix(date, ".archive-") {
+		date = strings.TrimPrefix(date, ".archive")
+	}
+	for _, layout := range []string{"-2006", "-2006-01"} {
+		if _, err := time.Parse(layout, date); err == nil {
+			return true
+		}
+	}
+	return false
+}
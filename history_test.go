@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistoryFilesSkipsSidecars(t *testing.T) {
+	dir := filepath.Dir(useDataFile(t, ""))
+	for _, name := range []string{
+		"scans-2023.csv", "scans-2024-03.csv", "scans.archive-2024-09.csv.gz", "scans-2022.csv.gz",
+		"scans.tags.csv", "scans.repeats.csv", "scans.notes.csv", "scans-2024-03.tags.csv",
+		"export_2024-03.csv", "roster.csv", "practice.csv", "scansx.csv", "scans-march.csv",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	previous := historySources
+	historySources = []string{dir}
+	defer func() { historySources = previous }()
+
+	files, err := historyFiles([]string{dataFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"scans-2022.csv.gz", "scans-2023.csv", "scans-2024-03.csv", "scans.archive-2024-09.csv.gz"}
+	if len(files) != len(want) {
+		t.Fatalf("got %v, want %v", files, want)
+	}
+	for i, name := range files {
+		if filepath.Base(name) != want[i] {
+			t.Errorf("got %v, want %v", files, want)
+			break
+		}
+	}
+}
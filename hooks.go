@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultHookTimeout is how long a hook command may run when the config
+// doesn't say
+const defaultHookTimeout = 10 * time.Second
+
+// hooksConfig is the config file's "hooks" section: commands run on events
+// so sites can script their own behavior, such as a door strike relay or
+// custom logging. Each command is split on spaces like sound_command and gets
+// the event as JSON on standard input and in CHECKIN_EVENT_JSON, with its
+// main fields in CHECKIN_* variables too. Hooks run in the background and
+// their output is only shown when they fail.
+type hooksConfig struct {
+	OnScan      []string `json:"on_scan"`      // each recorded scan
+	OnDuplicate []string `json:"on_duplicate"` // each repeat scan skipped
+	OnDayClose  []string `json:"on_day_close"` // once a day is over, with its check-ins by record type
+	OnExport    []string `json:"on_export"`    // each finished export, with its files
+	Timeout     duration `json:"timeout"`      // default 10s
+}
+
+// hookEvent is what a hook is told about the event
+type hookEvent struct {
+	Event   string `json:"event"` // scan, duplicate, day_close or export
+	Time    string `json:"time"`
+	Station string `json:"station,omitempty"`
+
+	// Scans and duplicates
+	ID        string   `json:"id,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Direction string   `json:"direction,omitempty"`
+	Type      string   `json:"type,omitempty"`
+	Count     string   `json:"count,omitempty"`
+	Record    []string `json:"record,omitempty"`
+
+	// Day close
+	Date     string         `json:"date,omitempty"`
+	CheckIns map[string]int `json:"check_ins,omitempty"`
+
+	// Exports
+	Start   string   `json:"start,omitempty"`
+	End     string   `json:"end,omitempty"`
+	Records int      `json:"records,omitempty"`
+	Files   []string `json:"files,omitempty"`
+}
+
+// hookRunner runs the configured hooks
+type hookRunner struct {
+	settings hooksConfig
+	running  sync.WaitGroup
+}
+
+// hooks is the process's hook runner. main sets its settings.
+var hooks = &hookRunner{}
+
+// commands returns the commands for an event
+func (h *hookRunner) commands(event string) []string {
+	switch event {
+	case "scan":
+		return h.settings.OnScan
+	case "duplicate":
+		return h.settings.OnDuplicate
+	case "day_close":
+		return h.settings.OnDayClose
+	case "export":
+		return h.settings.OnExport
+	}
+	return nil
+}
+
+// fire runs the event's hooks in the background
+func (h *hookRunner) fire(event hookEvent) {
+	commands := h.commands(event.Event)
+	if len(commands) == 0 {
+		return
+	}
+	if event.Time == "" {
+		event.Time = time.Now().Format("2006-01-02T15:04:05-07:00")
+	}
+	data, _ := json.Marshal(event)
+	env := append(os.Environ(),
+		"CHECKIN_EVENT="+event.Event,
+		"CHECKIN_EVENT_JSON="+string(data),
+		"CHECKIN_TIME="+event.Time,
+		"CHECKIN_STATION="+event.Station,
+		"CHECKIN_ID="+event.ID,
+		"CHECKIN_NAME="+event.Name,
+		"CHECKIN_DIRECTION="+event.Direction,
+		"CHECKIN_TYPE="+event.Type,
+		"CHECKIN_COUNT="+event.Count,
+		"CHECKIN_DATE="+event.Date,
+		"CHECKIN_FILES="+strings.Join(event.Files, ","),
+	)
+	timeout := time.Duration(h.settings.Timeout)
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	for _, command := range commands {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			continue
+		}
+		h.running.Add(1)
+		go func() {
+			defer h.running.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+			cmd.Stdin = bytes.NewReader(data)
+			cmd.Env = env
+			if output, err := cmd.CombinedOutput(); err != nil {
+				fmt.Printf("Error running %s hook %s: %v: %s\n", event.Event, args[0], err, strings.TrimSpace(string(output)))
+			}
+		}()
+	}
+}
+
+// wait blocks until the hooks still running have finished
+func (h *hookRunner) wait() {
+	h.running.Wait()
+}
+
+// closeDay fires the day close hooks for a finished day (YYYY-MM-DD) with
+// its check-ins by record type across the data files. Closed days are logged
+// to the closed_days sidecar file, so the day closes once even with several
+// stations and the daemon watching for it.
+func (h *hookRunner) closeDay(date string) {
+	if len(h.settings.OnDayClose) == 0 || date == "" {
+		return
+	}
+	closed, err := loadCSVColumn(sidecarFile("closed_days"), 0)
+	if err != nil {
+		fmt.Println("Error reading closed days:", err)
+		return
+	}
+	if closed[date] {
+		return
+	}
+	if err := appendCSV(sidecarFile("closed_days"), []string{date, time.Now().Format("2006-01-02T15:04:05-07:00")}); err != nil {
+		fmt.Println("Error writing closed days:", err)
+		return
+	}
+
+	counts := make(map[string]int)
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	if err == nil {
+		records, _, _ := readRecords(file)
+		file.Close()
+		for _, record := range records {
+			if record[0][:10] == date && recordDirection(record) == "in" {
+				counts[recordType(record)]++
+			}
+		}
+	}
+	h.fire(hookEvent{Event: "day_close", Date: date, CheckIns: counts})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// hoursConfig is the weekly schedule of when the building is open. Scans
+// outside it are flagged at the station, or refused with reject set, and
+// listed by -after-hours. An empty schedule allows scans at any time.
+type hoursConfig struct {
+	// Comma-separated HH:MM-HH:MM ranges by weekday (mon to sun), e.g.
+	// "mon": "07:00-12:00,13:00-21:00". Days not listed are closed, and a
+	// range can't cross midnight.
+	Weekly map[string]string `json:"weekly"`
+	Reject bool              `json:"reject"`
+}
+
+// hoursDays are the weekday keys of the schedule, indexed by time.Weekday
+var hoursDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// hoursRange is one opening period of a day, in minutes after midnight
+type hoursRange struct {
+	start, end int
+}
+
+// parseHoursRanges parses a day's comma-separated HH:MM-HH:MM ranges
+func parseHoursRanges(spec string) ([]hoursRange, error) {
+	var ranges []hoursRange
+	for _, part := range strings.Split(spec, ",") {
+		from, to, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return nil, fmt.Errorf("%q is not an HH:MM-HH:MM range", part)
+		}
+		start, err := parseClockMinutes(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClockMinutes(to)
+		if err != nil {
+			return nil, err
+		}
+		if end <= start {
+			return nil, fmt.Errorf("%q ends before it starts; split ranges that cross midnight between two days", part)
+		}
+		ranges = append(ranges, hoursRange{start, end})
+	}
+	return ranges, nil
+}
+
+// parseClockMinutes parses an HH:MM time of day, allowing 24:00 for the end
+// of the day, as minutes after midnight
+func parseClockMinutes(clock string) (int, error) {
+	var hours, minutes int
+	if n, err := fmt.Sscanf(clock, "%d:%d", &hours, &minutes); err != nil || n != 2 || len(clock) != 5 ||
+		hours < 0 || minutes < 0 || minutes > 59 || hours*60+minutes > 24*60 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	return hours*60 + minutes, nil
+}
+
+// validate checks every day of the schedule so scans can't be let through
+// or refused by a typo
+func (h hoursConfig) validate() error {
+	for day, spec := range h.Weekly {
+		if !contains(hoursDays, day) {
+			return fmt.Errorf("hours: unknown day %q, expected mon to sun", day)
+		}
+		if _, err := parseHoursRanges(spec); err != nil {
+			return fmt.Errorf("hours: %s: %w", day, err)
+		}
+	}
+	return nil
+}
+
+// open reports whether t falls inside the schedule, in local time
+func (h hoursConfig) open(t time.Time) bool {
+	if len(h.Weekly) == 0 {
+		return true
+	}
+	t = t.In(time.Local)
+	ranges, _ := parseHoursRanges(h.Weekly[hoursDays[t.Weekday()]])
+	minute := t.Hour()*60 + t.Minute()
+	for _, r := range ranges {
+		if minute >= r.start && minute < r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// runAfterHoursMode lists the scans from first to last (YYYY-MM-DD,
+// inclusive) made outside the operating hours, so staff can follow up on
+// badges used while the building was closed. The list is also saved as a CSV
+// in dir.
+func runAfterHoursMode(hours hoursConfig, roster map[string]rosterEntry, first, last, dir string) {
+	if len(hours.Weekly) == 0 {
+		fmt.Println("Error: No operating hours are set; add an hours schedule to the config file.")
+		return
+	}
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+
+	var outside [][]string
+	for _, record := range records {
+		date := record[0][:10]
+		if date < first || date > last {
+			continue
+		}
+		t, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+		if err == nil && !hours.open(t) {
+			outside = append(outside, record)
+		}
+	}
+	sort.SliceStable(outside, func(i, j int) bool { return outside[i][0] < outside[j][0] })
+
+	rows := [][]string{{"timestamp", "id", "name", "direction"}}
+	for _, record := range outside {
+		rows = append(rows, []string{record[0], record[1], rosterName(roster, record[1]), recordDirection(record)})
+		fmt.Printf("%s  %-4s %-12s %s\n", record[0], recordDirection(record), record[1], rosterName(roster, record[1]))
+	}
+	fmt.Printf("%d scans outside operating hours from %s to %s.\n", len(outside), first, last)
+
+	filename := "after_hours_" + first + "_" + last + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving report:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving report:", err)
+		return
+	}
+	fmt.Println("Saved to", filename)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ingestTimeFormats are the timestamp formats accepted from offline
+// scanners. Times without a zone are local time.
+var ingestTimeFormats = []string{
+	"2006-01-02T15:04:05-07:00",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// parseIngestTime parses an offline scanner's timestamp
+func parseIngestTime(value string) (time.Time, error) {
+	for _, format := range ingestTimeFormats {
+		if t, err := time.ParseInLocation(format, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
+
+// runIngestMode adds the check-ins captured offline in a file of
+// "timestamp,id" lines, such as a portable memory scanner's download, with
+// their original timestamps. Scans of an ID that repeat another scan of it,
+// recorded or ingested, under the dedupe policy are skipped. The new records are
+// merged into the data file in timestamp order and the daily counts are
+// renumbered.
+func runIngestMode(path, rosterFile string, dedupe dedupeRules, typePrefixes map[string]string, scanner scannerConfig, comma rune) {
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+
+	ids, times, err := readOfflineScans(path, scanner, comma)
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	scans := make([][]string, len(ids))
+	for i, id := range ids {
+		record := Record{Timestamp: times[i], BadgeID: id, Direction: "in", Type: deriveType(id, roster, typePrefixes), ScanID: newScanID()}
+		scans[i] = record.Fields()
+	}
+
+	records, sources, err := readDataFile()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error reading CSV:", err)
+		fmt.Println("Ingest rewrites the whole file, so fix the malformed lines first (see -check).")
+		return
+	}
+
+	// Check-in times of each ID, recorded or accepted so far
+	seen := make(map[string][]time.Time)
+	for _, fields := range records {
+		if record, err := parseRecord(fields); err == nil && record.Direction == "in" {
+			seen[record.BadgeID] = append(seen[record.BadgeID], record.Timestamp)
+		}
+	}
+	order := make([]int, len(scans))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return times[order[a]].Before(times[order[b]]) })
+
+	var added [][]string
+	var addedTimes []time.Time
+	skipped := 0
+	for _, i := range order {
+		duplicate := false
+		for _, t := range seen[scans[i][1]] {
+			if dedupe.forType(recordType(scans[i])).repeats(t, times[i]) {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			skipped++
+			continue
+		}
+		seen[scans[i][1]] = append(seen[scans[i][1]], times[i])
+		added = append(added, scans[i])
+		addedTimes = append(addedTimes, times[i])
+	}
+	if len(added) == 0 {
+		fmt.Printf("No new scans to ingest from %s (%d duplicates skipped).\n", path, skipped)
+		return
+	}
+
+	merged, mergedSources := mergeRecords(records, sources, added, addedTimes)
+	renumberDailyCounts(merged)
+
+	if err := rewriteDataFile(merged, mergedSources); err != nil {
+		fmt.Println("Error rewriting data file:", err)
+		return
+	}
+	if err := logOrigins(added, "import"); err != nil {
+		fmt.Println("Error writing origins file:", err)
+	}
+	fmt.Printf("Ingested %d scans from %s into %s (%d duplicates skipped).\n", len(added), path, dataName(), skipped)
+	for _, record := range merged {
+		if len(record) > 3 && record[3] != "" {
+			fmt.Println("Warning: Record checksums no longer match the rewritten file, so -verify will report it.")
+			break
+		}
+	}
+}
+
+// readOfflineScans reads a file of "timestamp,id" lines from an offline or
+// capture-only scanner, returning each valid line's ID and time. Lines that
+// can't be read are reported and skipped.
+func readOfflineScans(path string, scanner scannerConfig, comma rune) ([]string, []time.Time, error) {
+	input, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer input.Close()
+	reader := csv.NewReader(input)
+	if comma != 0 {
+		reader.Comma = comma
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	var ids []string
+	var times []time.Time
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			fmt.Printf("%s: skipped: %v\n", path, err)
+			continue
+		}
+		if len(row) < 2 {
+			fmt.Printf("%s line %d: skipped: expected timestamp,id\n", path, line)
+			continue
+		}
+		scanTime, err := parseIngestTime(strings.TrimSpace(row[0]))
+		if err != nil {
+			// A header line isn't worth a warning
+			if line != 1 {
+				fmt.Printf("%s line %d: skipped: %v\n", path, line, err)
+			}
+			continue
+		}
+		id, symbology := scanner.normalize(row[1])
+		if !barcodePattern.MatchString(id) {
+			fmt.Printf("%s line %d: skipped: invalid barcode ID %q\n", path, line, row[1])
+			continue
+		}
+		if err := scanner.check(id, symbology); err != nil {
+			fmt.Printf("%s line %d: skipped: %v\n", path, line, err)
+			continue
+		}
+		ids = append(ids, id)
+		times = append(times, scanTime)
+	}
+	return ids, times, nil
+}
+
+// mergeRecords merges added records, sorted by their times, into the
+// existing records from the data files named by sources. Each goes in the
+// data file its month belongs in, before the first of that file's records
+// later than it, keeping the existing order. It returns the merged records and
+// the file each belongs in.
+func mergeRecords(records [][]string, sources []string, added [][]string, addedTimes []time.Time) ([][]string, []string) {
+	// The added records for each file, still in time order
+	groups := make(map[string][]int)
+	var targets []string
+	for i, t := range addedTimes {
+		target := ingestFile(t)
+		if _, ok := groups[target]; !ok {
+			targets = append(targets, target)
+		}
+		groups[target] = append(groups[target], i)
+	}
+
+	var merged [][]string
+	var mergedSources []string
+	// flush adds the rest of a file's added records after its existing ones
+	flush := func(source string) {
+		for _, next := range groups[source] {
+			merged = append(merged, added[next])
+			mergedSources = append(mergedSources, source)
+		}
+		delete(groups, source)
+	}
+	for i, record := range records {
+		source := sources[i]
+		group := groups[source]
+		recordTime, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+		for err == nil && len(group) > 0 && addedTimes[group[0]].Before(recordTime) {
+			merged = append(merged, added[group[0]])
+			mergedSources = append(mergedSources, source)
+			group = group[1:]
+		}
+		if len(group) > 0 {
+			groups[source] = group
+		} else {
+			delete(groups, source)
+		}
+		merged = append(merged, record)
+		mergedSources = append(mergedSources, source)
+		if i == len(records)-1 || sources[i+1] != source {
+			flush(source)
+		}
+	}
+	// Files without existing records
+	for _, target := range targets {
+		flush(target)
+	}
+	return merged, mergedSources
+}
+
+// ingestFile returns the data file an ingested scan from t belongs in
+func ingestFile(t time.Time) string {
+	if partitioned {
+		return partitionFile(t)
+	}
+	return dataFile
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergeRecordsIntoEachMonthsFile(t *testing.T) {
+	useDataFile(t, "")
+	partitioned = true
+	defer func() { partitioned = false }()
+
+	at := func(value string) time.Time {
+		t, err := time.Parse("2006-01-02T15:04:05-07:00", value)
+		if err != nil {
+			panic(err)
+		}
+		return t.In(time.Local)
+	}
+	record := func(value, id string) []string { return []string{at(value).Format("2006-01-02T15:04:05-07:00"), id} }
+	february, march := partitionFile(at("2026-02-15T12:00:00+00:00")), partitionFile(at("2026-03-15T12:00:00+00:00"))
+
+	tests := []struct {
+		name    string
+		records [][]string
+		sources []string
+		want    []string // IDs in order
+		files   []string
+	}{
+		{
+			"both months recorded",
+			[][]string{record("2026-02-01T12:00:00+00:00", "feb1"), record("2026-03-01T12:00:00+00:00", "mar1"), record("2026-03-10T12:00:00+00:00", "mar10")},
+			[]string{february, march, march},
+			[]string{"feb1", "feb20", "mar1", "mar5", "mar10"},
+			[]string{february, february, march, march, march},
+		},
+		{
+			"earlier month not recorded yet",
+			[][]string{record("2026-03-01T12:00:00+00:00", "mar1"), record("2026-03-10T12:00:00+00:00", "mar10")},
+			[]string{march, march},
+			[]string{"mar1", "mar5", "mar10", "feb20"},
+			[]string{march, march, march, february},
+		},
+	}
+	added := [][]string{record("2026-02-20T12:00:00+00:00", "feb20"), record("2026-03-05T12:00:00+00:00", "mar5")}
+	addedTimes := []time.Time{at(added[0][0]), at(added[1][0])}
+	for _, test := range tests {
+		merged, sources := mergeRecords(test.records, test.sources, added, addedTimes)
+		if len(merged) != len(test.want) {
+			t.Errorf("%s: %d records, want %d", test.name, len(merged), len(test.want))
+			continue
+		}
+		for i := range merged {
+			if merged[i][1] != test.want[i] || sources[i] != test.files[i] {
+				t.Errorf("%s: record %d is %s in %s, want %s in %s", test.name, i, merged[i][1], sources[i], test.want[i], test.files[i])
+			}
+		}
+	}
+}
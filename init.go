@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// initAttempts is how many times the setup wizard asks for a badge scan
+// before giving up on the scanner test
+const initAttempts = 3
+
+// wizard reads a new site's answers to the setup questions
+type wizard struct {
+	input *bufio.Reader
+}
+
+// ask shows a question and returns the answer, or the default for a blank one
+func (w wizard) ask(question, fallback string) string {
+	if fallback != "" {
+		fmt.Printf("%s [%s]: ", question, fallback)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	answer, _ := w.input.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return fallback
+	}
+	return answer
+}
+
+// confirm asks a yes or no question
+func (w wizard) confirm(question string, fallback bool) bool {
+	choices := "y/N"
+	if fallback {
+		choices = "Y/n"
+	}
+	for {
+		answer := strings.ToLower(w.ask(question+" ("+choices+")", ""))
+		switch {
+		case answer == "":
+			return fallback
+		case answer == "y" || answer == "yes":
+			return true
+		case answer == "n" || answer == "no":
+			return false
+		}
+		fmt.Println("  Please answer y or n.")
+	}
+}
+
+// hours asks for a day's opening hours until they parse, returning "" when
+// the site has none set for it
+func (w wizard) hours(day string) string {
+	for {
+		spec := w.ask("Opening hours on "+day+", e.g. 09:00-17:00 or 07:00-12:00,13:00-21:00 (blank for none)", "")
+		if spec == "" {
+			return ""
+		}
+		if _, err := parseHoursRanges(spec); err != nil {
+			fmt.Println("  That isn't a set of opening hours:", err)
+			continue
+		}
+		return spec
+	}
+}
+
+// scan asks for one badge scan and returns the raw read
+func (w wizard) scan(prompt string) string {
+	fmt.Print(prompt + ": ")
+	raw, _ := w.input.ReadString('\n')
+	return strings.TrimRight(raw, "\r\n")
+}
+
+// testScanner has the operator scan a badge twice, working out what the
+// scanner adds around the number and checking that both reads agree. It
+// returns the scanner settings and the badge ID, or false when no good read
+// came after initAttempts tries.
+func (w wizard) testScanner() (scannerConfig, string, bool) {
+	for attempt := 1; attempt <= initAttempts; attempt++ {
+		raw := w.scan("Scan a badge now (or type its number and press Enter)")
+		var settings scannerConfig
+		if symbologyID.MatchString(raw) {
+			settings.SymbologyIDs = true
+			fmt.Println("  The scanner sends a barcode type identifier first; it will be removed.")
+		}
+		id, _ := settings.normalize(raw)
+		if id == "" {
+			fmt.Println("  Nothing was read. Check the scanner is plugged in and acts as a keyboard, then try again.")
+			continue
+		}
+		// Letters or symbols around the digits are something the scanner
+		// adds, such as a B: prefix, rather than part of the badge number
+		start := strings.IndexFunc(id, unicode.IsDigit)
+		end := strings.LastIndexFunc(id, unicode.IsDigit)
+		if start < 0 || !barcodePattern.MatchString(id[start:end+1]) {
+			fmt.Printf("  %q isn't a badge number; badges carry digits only. Try another badge.\n", id)
+			continue
+		}
+		if prefix := id[:start]; prefix != "" {
+			fmt.Printf("  The scanner adds %q before the number; it will be removed.\n", prefix)
+			settings.StripPrefixes = []string{prefix}
+		}
+		if suffix := id[end+1:]; suffix != "" {
+			fmt.Printf("  The scanner adds %q after the number; it will be removed.\n", suffix)
+			settings.StripSuffixes = []string{suffix}
+		}
+		id, _ = settings.normalize(raw)
+
+		again, _ := settings.normalize(w.scan("Scan the same badge again"))
+		if again != id {
+			fmt.Printf("  The reads differ (%s, then %s). Hold the badge steady under the scanner and start again.\n", id, again)
+			continue
+		}
+		fmt.Printf("  Read badge %s twice. The scanner works.\n", id)
+		if w.confirm(fmt.Sprintf("Do all your badges have %d digits?", len(id)), false) {
+			settings.Formats = []idFormat{{Length: len(id)}}
+		}
+		return settings, id, true
+	}
+	return scannerConfig{}, "", false
+}
+
+// runInitMode sets up a new site interactively: the folder for its files, a
+// config file with its opening hours and what its scanner sends, a roster
+// template and a test scan recorded to the practice file, then says how to
+// start scanning. configFile and rosterFile are placed in the folder unless
+// they are absolute paths.
+func runInitMode(configFile, rosterFile string) {
+	w := wizard{input: bufio.NewReader(os.Stdin)}
+	fmt.Println("This sets up check-in for a new site. Press Enter to take the suggestion in [brackets].")
+	fmt.Println()
+
+	dir := w.ask("Folder for this site's check-in files", ".")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Println("Error creating folder:", err)
+		return
+	}
+	inDir := func(name string) string {
+		if filepath.IsAbs(name) {
+			return name
+		}
+		return filepath.Join(dir, name)
+	}
+	configPath, rosterPath, dataPath := inDir(configFile), inDir(rosterFile), inDir(dataFile)
+	if _, err := os.Stat(configPath); err == nil && !w.confirm(configPath+" already exists. Replace it?", false) {
+		fmt.Println("Nothing was changed.")
+		return
+	}
+
+	fmt.Println()
+	weekly := make(map[string]string)
+	if spec := w.hours("weekdays (Monday to Friday)"); spec != "" {
+		for _, day := range []string{"mon", "tue", "wed", "thu", "fri"} {
+			weekly[day] = spec
+		}
+	}
+	if spec := w.hours("Saturday"); spec != "" {
+		weekly["sat"] = spec
+	}
+	if spec := w.hours("Sunday"); spec != "" {
+		weekly["sun"] = spec
+	}
+
+	fmt.Println()
+	scanner, badge, ok := w.testScanner()
+	if !ok {
+		fmt.Println("The scanner test didn't get a good read, so the config file has no scanner settings. Run -init again once the scanner works.")
+	}
+
+	// Only the answered sections are written, so the file stays short enough
+	// for staff to read; everything else keeps its default
+	settings := make(map[string]any)
+	if len(weekly) > 0 {
+		settings["hours"] = hoursConfig{Weekly: weekly}
+	}
+	section := make(map[string]any)
+	if len(scanner.StripPrefixes) > 0 {
+		section["strip_prefixes"] = scanner.StripPrefixes
+	}
+	if len(scanner.StripSuffixes) > 0 {
+		section["strip_suffixes"] = scanner.StripSuffixes
+	}
+	if scanner.SymbologyIDs {
+		section["symbology_ids"] = true
+	}
+	if len(scanner.Formats) > 0 {
+		section["formats"] = []map[string]int{{"length": scanner.Formats[0].Length}}
+	}
+	if len(section) > 0 {
+		settings["scanner"] = section
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err == nil {
+		err = os.WriteFile(configPath, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		fmt.Println("Error writing config file:", err)
+		return
+	}
+	if _, err := loadConfig(configPath); err != nil {
+		fmt.Println("Error checking the new config file:", err)
+		return
+	}
+	fmt.Println("\nWrote", configPath)
+
+	file, err := os.OpenFile(dataPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Println("Error creating data file:", err)
+		return
+	}
+	file.Close()
+
+	if _, err := os.Stat(rosterPath); err == nil {
+		fmt.Println("Kept the existing roster", rosterPath)
+	} else if err := os.WriteFile(rosterPath, []byte("id,name,type\n"), 0644); err != nil {
+		fmt.Println("Error writing roster template:", err)
+		return
+	} else {
+		fmt.Println("Wrote the roster template", rosterPath, "- add one line per person: badge number, name and type (member, visitor, staff or contractor).")
+	}
+
+	if ok {
+		practice := practiceFile(dataPath)
+		record := Record{Timestamp: time.Now(), BadgeID: badge, Seq: 1, Direction: "in", Type: "member", ScanID: newScanID()}
+		if err := appendRecord(practice, record.Fields()); err != nil {
+			fmt.Println("Error recording the test scan:", err)
+			return
+		}
+		fmt.Printf("Recorded a test scan of badge %s to the practice file %s; the real records in %s are untouched.\n", badge, practice, dataPath)
+		fmt.Printf("Scanning it again in practice within %s is refused as a repeat, which shows duplicate protection works.\n", humanDuration(defaultDedupeWindow))
+	}
+
+	fmt.Println("\nNext steps:")
+	if dir != "." {
+		fmt.Printf("  cd %s\n", dir)
+	}
+	fmt.Println("  ./checkin -check                 check the setup")
+	fmt.Println("  ./checkin -scan -test-mode       practice scanning without touching the real records")
+	fmt.Println("  ./checkin -scan                  start checking people in")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadIntegrityKey reads the HMAC key used for record checksums. An empty path
+// means checksums are disabled.
+func loadIntegrityKey(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := []byte(strings.TrimSpace(string(data)))
+	if len(key) == 0 {
+		return nil, fmt.Errorf("integrity key file %s is empty", path)
+	}
+	return key, nil
+}
+
+// recordChecksum returns the HMAC-SHA256 of every field of a record other than
+// the checksum itself, chained to the previous record's checksum, so
+// inserting, removing or altering any row breaks the chain from that row on.
+// Each field is prefixed with its length, so moving a comma from one field to
+// the next changes the checksum.
+func recordChecksum(key []byte, previous string, record []string) string {
+	fields := append([]string{previous}, record[:3]...)
+	if len(record) > 4 {
+		fields = append(fields, record[4:]...)
+	}
+	mac := hmac.New(sha256.New, key)
+	for _, field := range fields {
+		fmt.Fprintf(mac, "%d:%s", len(field), field)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// lastChecksum returns the checksum of the last record in the data file, or an
+// empty string when the file is empty or the last record has none
+func lastChecksum() (string, error) {
+	record, err := lastRecord()
+	if err != nil || len(record) < 4 {
+		return "", err
+	}
+	return record[3], nil
+}
+
+// verifyResult is -verify's -output=json result
+type verifyResult struct {
+	DataFile string          `json:"data_file"`
+	OK       bool            `json:"ok"`
+	Verified int             `json:"verified"`
+	Unsigned int             `json:"unsigned"` // records from before checksums were enabled, not checked
+	Problems []verifyProblem `json:"problems"`
+}
+
+// verifyProblem is a line of the data files that failed verification
+type verifyProblem struct {
+	Line    int    `json:"line"`
+	Problem string `json:"problem"`
+}
+
+// runVerifyMode checks every record's checksum against the chain and reports
+// rows that were altered, inserted or follow a removed row. Records from
+// before checksums were enabled are counted but not checked. With asJSON the
+// outcome is printed as a verifyResult. It exits with status 1 when the chain
+// is broken.
+func runVerifyMode(key []byte, asJSON bool) {
+	if key == nil {
+		printError(asJSON, "Error: Set integrity_key_file in the config file to verify checksums.")
+		os.Exit(1)
+	}
+
+	file, err := openDataFiles()
+	if err != nil {
+		printError(asJSON, "Error opening file:", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	records, lines, bad := readRecords(file)
+	problems := []verifyProblem{}
+	for _, row := range bad {
+		problems = append(problems, verifyProblem{row.Line, row.Reason})
+	}
+	verified, unsigned, chainProblems := verifyChain(key, records, lines)
+	problems = append(problems, chainProblems...)
+
+	if asJSON {
+		printJSON(verifyResult{DataFile: dataName(), OK: len(problems) == 0, Verified: verified, Unsigned: unsigned, Problems: problems})
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	for _, problem := range problems {
+		fmt.Printf("line %d: %s\n", problem.Line, problem.Problem)
+	}
+	if unsigned > 0 {
+		fmt.Printf("%d records from before checksums were enabled were not checked.\n", unsigned)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d problems found in %s, %d records verified.\n", len(problems), dataName(), verified)
+		os.Exit(1)
+	}
+	fmt.Printf("All %d checksummed records in %s verified.\n", verified, dataName())
+}
+
+// verifyChain checks the records' checksums against the chain, returning how
+// many verified, how many are from before checksums were enabled and the
+// problems found, by the records' line numbers
+func verifyChain(key []byte, records [][]string, lines []int) (int, int, []verifyProblem) {
+	var problems []verifyProblem
+	unsigned, verified := 0, 0
+	previous := ""
+	chained := false
+	for i, record := range records {
+		if len(record) < 4 || record[3] == "" {
+			if chained {
+				problems = append(problems, verifyProblem{lines[i], "no checksum after checksums were enabled (inserted row?)"})
+			} else {
+				unsigned++
+			}
+			continue
+		}
+		chained = true
+
+		expected := recordChecksum(key, previous, record)
+		if !hmac.Equal([]byte(expected), []byte(record[3])) {
+			problems = append(problems, verifyProblem{lines[i], "checksum mismatch (row altered, or a row before it was removed or inserted)"})
+		} else {
+			verified++
+		}
+		previous = record[3]
+	}
+	return verified, unsigned, problems
+}
@@ -0,0 +1,167 @@
+package main
+
+import "testing"
+
+// signedRecords returns the records with their checksums chained as scan mode
+// writes them
+func signedRecords(key []byte, records [][]string) [][]string {
+	signed := make([][]string, len(records))
+	previous := ""
+	for i, record := range records {
+		record = append([]string{}, record...)
+		record[3] = recordChecksum(key, previous, record)
+		previous = record[3]
+		signed[i] = record
+	}
+	return signed
+}
+
+func TestRecordChecksum(t *testing.T) {
+	key := []byte("secret")
+	record := []string{"2026-03-02T09:15:00-05:00", "1001", "1", "", "in", "member", "a1"}
+	sum := recordChecksum(key, "", record)
+
+	withSum := append([]string{}, record...)
+	withSum[3] = sum
+	if recordChecksum(key, "", withSum) != sum {
+		t.Errorf("the checksum depends on the checksum column")
+	}
+	for i := range record {
+		if i == 3 {
+			continue
+		}
+		changed := append([]string{}, record...)
+		changed[i] += "x"
+		if recordChecksum(key, "", changed) == sum {
+			t.Errorf("changing field %d leaves the checksum the same", i)
+		}
+	}
+	if recordChecksum(key, "previous", record) == sum {
+		t.Errorf("the checksum doesn't depend on the previous one")
+	}
+	if recordChecksum([]byte("other"), "", record) == sum {
+		t.Errorf("the checksum doesn't depend on the key")
+	}
+
+	// Moving a comma between fields changes the checksum
+	joined := append([]string{}, record...)
+	joined[5], joined[6] = "member,a1", ""
+	if recordChecksum(key, "", joined) == sum {
+		t.Errorf("moving a separator into a field leaves the checksum the same")
+	}
+	if recordChecksum(key, "", []string{"a,b", "c", ""}) == recordChecksum(key, "", []string{"a", "b,c", ""}) {
+		t.Errorf("fields with the same joined text have the same checksum")
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	key := []byte("secret")
+	chain := signedRecords(key, [][]string{
+		{"2026-03-02T09:00:00-05:00", "1001", "1", "", "in", "member", "a1"},
+		{"2026-03-02T09:01:00-05:00", "1002", "2", "", "in", "member", "a2"},
+		{"2026-03-02T09:02:00-05:00", "1003", "3", "", "in", "visitor", "a3"},
+		{"2026-03-02T09:03:00-05:00", "1001", "", "", "out", "member", "a4"},
+	})
+	legacy := [][]string{
+		{"2026-03-01T09:00:00-05:00", "1001", "1"},
+		{"2026-03-01T09:05:00-05:00", "1004", "2", ""},
+	}
+	copyRecords := func(records [][]string) [][]string {
+		copied := make([][]string, len(records))
+		for i, record := range records {
+			copied[i] = append([]string{}, record...)
+		}
+		return copied
+	}
+
+	tests := []struct {
+		name     string
+		records  func() [][]string
+		key      []byte
+		verified int
+		unsigned int
+		lines    []int // lines with problems
+	}{
+		{"intact", func() [][]string { return copyRecords(chain) }, key, 4, 0, nil},
+		{"wrong key", func() [][]string { return copyRecords(chain) }, []byte("guess"), 0, 0, []int{1, 2, 3, 4}},
+		{"altered ID", func() [][]string {
+			records := copyRecords(chain)
+			records[1][1] = "9999"
+			return records
+		}, key, 3, 0, []int{2}},
+		{"altered timestamp", func() [][]string {
+			records := copyRecords(chain)
+			records[2][0] = "2026-03-02T08:02:00-05:00"
+			return records
+		}, key, 3, 0, []int{3}},
+		{"altered direction", func() [][]string {
+			records := copyRecords(chain)
+			records[3][4] = "in"
+			return records
+		}, key, 3, 0, []int{4}},
+		{"altered checksum", func() [][]string {
+			records := copyRecords(chain)
+			records[0][3] = recordChecksum([]byte("guess"), "", records[0])
+			return records
+		}, key, 2, 0, []int{1, 2}},
+		{"first row deleted", func() [][]string {
+			return copyRecords(chain[1:])
+		}, key, 2, 0, []int{1}},
+		{"middle row deleted", func() [][]string {
+			records := copyRecords(chain)
+			return append(records[:1], records[2:]...)
+		}, key, 2, 0, []int{2}},
+		{"rows swapped", func() [][]string {
+			records := copyRecords(chain)
+			records[1], records[2] = records[2], records[1]
+			return records
+		}, key, 1, 0, []int{2, 3, 4}},
+		{"row inserted without a checksum", func() [][]string {
+			records := copyRecords(chain)
+			inserted := []string{"2026-03-02T09:01:30-05:00", "1005", "9", "", "in", "member", "x1"}
+			return append(records[:2], append([][]string{inserted}, records[2:]...)...)
+		}, key, 4, 0, []int{3}},
+		{"row inserted with a forged checksum", func() [][]string {
+			records := copyRecords(chain)
+			inserted := []string{"2026-03-02T09:01:30-05:00", "1005", "9", "", "in", "member", "x1"}
+			inserted[3] = recordChecksum([]byte("guess"), records[1][3], inserted)
+			return append(records[:2], append([][]string{inserted}, records[2:]...)...)
+		}, key, 3, 0, []int{3, 4}},
+		{"row copied from elsewhere in the chain", func() [][]string {
+			records := copyRecords(chain)
+			return append(records, append([]string{}, records[1]...))
+		}, key, 4, 0, []int{5}},
+		{"records from before checksums", func() [][]string {
+			return append(copyRecords(legacy), copyRecords(chain)...)
+		}, key, 4, 2, nil},
+		{"unsigned row after the chain started", func() [][]string {
+			records := copyRecords(chain)
+			return append(records, []string{"2026-03-02T09:04:00-05:00", "1006", "5"})
+		}, key, 4, 0, []int{5}},
+	}
+	for _, test := range tests {
+		records := test.records()
+		lines := make([]int, len(records))
+		for i := range lines {
+			lines[i] = i + 1
+		}
+		verified, unsigned, problems := verifyChain(test.key, records, lines)
+		if verified != test.verified || unsigned != test.unsigned {
+			t.Errorf("%s: %d verified and %d unsigned, want %d and %d", test.name, verified, unsigned, test.verified, test.unsigned)
+		}
+		var got []int
+		for _, problem := range problems {
+			got = append(got, problem.Line)
+		}
+		if len(got) != len(test.lines) {
+			t.Errorf("%s: problems on lines %v, want %v", test.name, got, test.lines)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.lines[i] {
+				t.Errorf("%s: problems on lines %v, want %v", test.name, got, test.lines)
+				break
+			}
+		}
+	}
+}
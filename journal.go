@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// journal is one maintenance command's entry in the admin journal: a copy of
+// each file as it was before the command first changed it
+type journal struct {
+	id     int
+	action string
+	files  []string // changed files, in the order they were saved
+	absent []bool   // whether each file didn't exist before
+}
+
+// activeJournal is the entry files are saved to before they change, or nil
+// outside maintenance commands
+var activeJournal *journal
+
+// journalDir returns the directory next to the data file holding the
+// journal, e.g. scans.journal for scans.csv. Its journal.csv lists the entries
+// as id,timestamp,user,action,files,states, and each entry's snapshots are
+// in a subdirectory named by its id. The states are each file's fileState
+// once the command finished, so an undo can tell what changed since.
+func journalDir() string {
+	return strings.TrimSuffix(dataFile, filepath.Ext(dataFile)) + ".journal"
+}
+
+// startJournal starts a journal entry for a maintenance command
+func startJournal(action string) error {
+	entries, err := loadJournal()
+	if err != nil {
+		return err
+	}
+	id := 1
+	if len(entries) > 0 {
+		id = entries[len(entries)-1].id + 1
+	}
+	activeJournal = &journal{id: id, action: action}
+	return nil
+}
+
+// journalFile saves a copy of a file to the active journal entry before it is
+// first changed. It does nothing outside maintenance commands.
+func journalFile(name string) error {
+	j := activeJournal
+	if j == nil || contains(j.files, name) {
+		return nil
+	}
+	dir := filepath.Join(journalDir(), strconv.Itoa(j.id))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("journaling %s: %w", name, err)
+	}
+	err := copyFile(name, filepath.Join(dir, strconv.Itoa(len(j.files))))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("journaling %s: %w", name, err)
+	}
+	j.files = append(j.files, name)
+	j.absent = append(j.absent, os.IsNotExist(err))
+	return nil
+}
+
+// finishJournal adds the active entry to the journal's index if the command
+// changed any files
+func finishJournal() {
+	j := activeJournal
+	activeJournal = nil
+	if j == nil || len(j.files) == 0 {
+		return
+	}
+	var files, states []string
+	for i, name := range j.files {
+		state, err := fileState(name)
+		if err != nil {
+			fmt.Println("Error writing journal:", err)
+			return
+		}
+		states = append(states, state)
+		if j.absent[i] {
+			name = "!" + name
+		}
+		files = append(files, name)
+	}
+	username := ""
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+	row := []string{strconv.Itoa(j.id), time.Now().Format("2006-01-02T15:04:05-07:00"), username, j.action, strings.Join(files, ";"), strings.Join(states, ";")}
+	if err := appendCSV(filepath.Join(journalDir(), "journal.csv"), row); err != nil {
+		fmt.Println("Error writing journal:", err)
+		return
+	}
+	fmt.Printf("Journaled as entry %d; -undo-admin reverts it.\n", j.id)
+}
+
+// journalEntry is one line of the journal's index
+type journalEntry struct {
+	id                    int
+	timestamp, user, what string
+	files                 []string
+	absent                []bool
+	states                []string // each file's fileState after the command, or "" in entries from before they were noted
+}
+
+// loadJournal reads the journal's index, oldest entry first
+func loadJournal() ([]journalEntry, error) {
+	file, err := os.Open(filepath.Join(journalDir(), "journal.csv"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []journalEntry
+	for _, row := range rows {
+		if len(row) < 5 {
+			continue
+		}
+		id, err := strconv.Atoi(row[0])
+		if err != nil {
+			continue
+		}
+		entry := journalEntry{id: id, timestamp: row[1], user: row[2], what: row[3]}
+		for _, name := range strings.Split(row[4], ";") {
+			entry.absent = append(entry.absent, strings.HasPrefix(name, "!"))
+			entry.files = append(entry.files, strings.TrimPrefix(name, "!"))
+		}
+		entry.states = make([]string, len(entry.files))
+		if len(row) > 5 {
+			copy(entry.states, strings.Split(row[5], ";"))
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// runJournalMode lists the journal's entries, newest first
+func runJournalMode() {
+	entries, err := loadJournal()
+	if err != nil {
+		fmt.Println("Error reading journal:", err)
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println("The journal is empty.")
+		return
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		fmt.Printf("%4d  %s  %-10s %s (%s)\n", entry.id, entry.timestamp, entry.user, entry.what, strings.Join(entry.files, ", "))
+	}
+}
+
+// fileState returns a file's size and SHA-256 as "size:hash", or "-" when
+// it doesn't exist
+func fileState(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return "-", nil
+	} else if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return strconv.Itoa(len(data)) + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// addedSince returns what was appended to a file since it was left in state,
+// such as scans recorded after a maintenance command, and whether the file
+// only grew; a file changed any other way since, or whose state wasn't
+// noted, returns false
+func addedSince(name, state string) ([]byte, bool, error) {
+	if state == "" {
+		return nil, false, nil
+	}
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, state == "-", nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if state == "-" {
+		return data, true, nil
+	}
+	size, hash, _ := strings.Cut(state, ":")
+	n, err := strconv.Atoi(size)
+	if err != nil || n > len(data) {
+		return nil, false, nil
+	}
+	sum := sha256.Sum256(data[:n])
+	if hex.EncodeToString(sum[:]) != hash {
+		return nil, false, nil
+	}
+	return data[n:], true, nil
+}
+
+// restoreSnapshot puts a file back as its snapshot had it, or removes it if
+// it didn't exist then, keeping added after it
+func restoreSnapshot(snapshot, name string, absent bool, added []byte) error {
+	var data []byte
+	if !absent {
+		var err error
+		if data, err = os.ReadFile(snapshot); err != nil {
+			return err
+		}
+	}
+	if absent && len(added) == 0 {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if len(data) > 0 && len(added) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	return os.WriteFile(name, append(data, added...), 0644)
+}
+
+// runUndoAdminMode puts back the files a journal entry saved, the latest one
+// when id is 0. The undo is journaled itself, so undoing it again redoes the
+// original command. Records appended to a file since the command, such as
+// scans from a station or pushed from another site, are kept after the
+// restored copy. Reverting an entry when a file changed in any other way
+// since, as a later entry rewrote it, throws those changes away, so it has
+// to be confirmed.
+func runUndoAdminMode(id int, cfg config) {
+	entries, err := loadJournal()
+	if err != nil {
+		fmt.Println("Error reading journal:", err)
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println("The journal is empty, so there is nothing to undo.")
+		return
+	}
+	index := len(entries) - 1
+	if id != 0 {
+		for index >= 0 && entries[index].id != id {
+			index--
+		}
+		if index < 0 {
+			fmt.Printf("Error: Journal entry %d does not exist (see -journal).\n", id)
+			return
+		}
+	}
+	entry := entries[index]
+
+	var later []string
+	for _, newer := range entries[index+1:] {
+		for _, name := range newer.files {
+			if contains(entry.files, name) && !contains(later, strconv.Itoa(newer.id)) {
+				later = append(later, strconv.Itoa(newer.id))
+			}
+		}
+	}
+	added := make([][]byte, len(entry.files))
+	var changed []string
+	for i, name := range entry.files {
+		tail, grew, err := addedSince(name, entry.states[i])
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", name, err)
+			return
+		}
+		added[i] = tail
+		if !grew {
+			changed = append(changed, name)
+		}
+	}
+	fmt.Printf("Reverting entry %d from %s: %s\n", entry.id, entry.timestamp, entry.what)
+	if len(later) > 0 || len(changed) > 0 {
+		if len(later) > 0 {
+			fmt.Printf("Entries %s changed the same files later, and their changes will be lost.\n", strings.Join(later, ", "))
+		}
+		if len(changed) > 0 {
+			fmt.Printf("%s changed since the command in ways that can't be kept, and will be put back as they were before it.\n", strings.Join(changed, ", "))
+		}
+		if !confirmDestructive(cfg, "restore", len(entry.files), len(entry.files)) {
+			return
+		}
+	}
+
+	if err := startJournal(fmt.Sprintf("undo of entry %d", entry.id)); err != nil {
+		fmt.Println("Error reading journal:", err)
+		return
+	}
+	defer finishJournal()
+	for i, name := range entry.files {
+		if err := journalFile(name); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		snapshot := filepath.Join(journalDir(), strconv.Itoa(entry.id), strconv.Itoa(i))
+		if err := restoreSnapshot(snapshot, name, entry.absent[i], added[i]); err != nil {
+			fmt.Printf("Error restoring %s: %v\n", name, err)
+			return
+		}
+		if len(added[i]) > 0 {
+			fmt.Printf("Restored %s, keeping the %d lines added since.\n", name, bytes.Count(added[i], []byte("\n")))
+		} else {
+			fmt.Println("Restored", name)
+		}
+	}
+}
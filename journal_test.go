@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useDataFile points the data file at a scratch directory for a test
+func useDataFile(t *testing.T, contents string) string {
+	t.Helper()
+	previous := dataFile
+	dataFile = filepath.Join(t.TempDir(), "scans.csv")
+	t.Cleanup(func() { dataFile = previous })
+	if err := os.WriteFile(dataFile, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dataFile
+}
+
+func TestUndoKeepsScansAddedSince(t *testing.T) {
+	before := "2026-03-02T09:00:00-05:00,1001,1\n2026-03-02T09:00:30-05:00,1001,2\n2026-03-02T09:01:00-05:00,1002,3\n"
+	name := useDataFile(t, before)
+
+	// A maintenance command rewrites the data file
+	if err := startJournal("removing records"); err != nil {
+		t.Fatal(err)
+	}
+	if err := journalFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte("2026-03-02T09:00:00-05:00,1001,1\n2026-03-02T09:01:00-05:00,1002,3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	finishJournal()
+
+	// and a station records more scans afterwards
+	added := "2026-03-02T10:00:00-05:00,1003,4\n2026-03-02T10:05:00-05:00,1004,5\n"
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(added)
+	file.Close()
+
+	runUndoAdminMode(0, config{})
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != before+added {
+		t.Errorf("after the undo the data file is\n%s\nwant\n%s", data, before+added)
+	}
+}
+
+func TestAddedSince(t *testing.T) {
+	name := useDataFile(t, "a\nb\n")
+	state, err := fileState(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(filepath.Dir(name), "missing.csv")
+
+	tests := []struct {
+		name     string
+		file     string
+		contents *string // nil leaves the file as it is
+		state    string
+		added    string
+		grew     bool
+	}{
+		{"unchanged", name, nil, state, "", true},
+		{"appended", name, ptr("a\nb\nc\n"), state, "c\n", true},
+		{"rewritten", name, ptr("a\nx\nc\n"), state, "", false},
+		{"truncated", name, ptr("a\n"), state, "", false},
+		{"state not noted", name, ptr("a\nb\n"), "", "", false},
+		{"created since", name, ptr("a\n"), "-", "a\n", true},
+		{"still missing", missing, nil, "-", "", true},
+		{"removed since", missing, nil, state, "", false},
+	}
+	for _, test := range tests {
+		if test.contents != nil {
+			if err := os.WriteFile(test.file, []byte(*test.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		added, grew, err := addedSince(test.file, test.state)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(added) != test.added || grew != test.grew {
+			t.Errorf("%s: got %q, %v, want %q, %v", test.name, added, grew, test.added, test.grew)
+		}
+	}
+}
+
+// ptr returns a pointer to s
+func ptr(s string) *string {
+	return &s
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSignatureSize is the largest drawn signature the kiosk accepts
+const maxSignatureSize = 1 << 20
+
+// defaultWaiverText is shown on the kiosk when the config has no waiver text
+// file
+const defaultWaiverText = "I have read and understood the liability waiver posted at the front desk, " +
+	"I accept its terms, and I take part at my own risk."
+
+// kioskPage is the data for the kiosk page template
+type kioskPage struct {
+	Step    string // scan, waiver, done or locked
+	ID      string
+	Name    string
+	Known   bool // on the roster, so no name is asked for
+	Problem string
+	Text    string
+	Message string
+	Error   bool
+}
+
+// registerKiosk adds the check-in kiosk at /kiosk, a page for a tablet at
+// the door. A badge scanned or typed in is checked in, and when waivers are
+// enforced someone without a valid one is first shown the waiver to sign by
+// typing their name or drawing on the screen. Visitors not yet on the roster
+// are added with the name they give, so one device handles both sign-up and
+// check-in. With the kiosk lock on, it's locked after hours until unlocked
+// with the admin PIN.
+func (api mobileAPI) registerKiosk(mux *http.ServeMux, cfg config) {
+	lock := &kioskLock{settings: cfg.Kiosk, hours: cfg.Hours, closures: cfg.Closures}
+	protect := func(handler http.HandlerFunc) http.HandlerFunc {
+		return cfg.requireToken(roleOperator, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "use POST", http.StatusMethodNotAllowed)
+				return
+			}
+			if api.ReadOnly {
+				http.Error(w, "the server is read-only", http.StatusForbidden)
+				return
+			}
+			if !sameOrigin(r) {
+				http.Error(w, "cross-site request refused", http.StatusForbidden)
+				return
+			}
+			handler(w, r)
+		})
+	}
+	mux.HandleFunc("/kiosk", cfg.requireToken(roleOperator, lock.guard(api, func(w http.ResponseWriter, r *http.Request) {
+		api.showKiosk(w, kioskPage{Step: "scan"})
+	})))
+	mux.HandleFunc("/kiosk/checkin", protect(lock.guard(api, api.handleKioskCheckIn)))
+	mux.HandleFunc("/kiosk/waiver", protect(lock.guard(api, api.handleKioskWaiver)))
+	mux.HandleFunc("/kiosk/unlock", protect(lock.handleUnlock(api)))
+}
+
+// showKiosk renders a kiosk step
+func (api mobileAPI) showKiosk(w http.ResponseWriter, page kioskPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	kioskTemplate.Execute(w, page)
+}
+
+// handleKioskCheckIn checks in a scanned ID, or shows the waiver when the ID
+// needs one first
+func (api mobileAPI) handleKioskCheckIn(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(r.FormValue("id"))
+	if !barcodePattern.MatchString(id) {
+		api.showKiosk(w, kioskPage{Step: "scan", Message: "Badge not recognized. Please scan again.", Error: true})
+		return
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	roster, err := loadRoster(api.RosterFile)
+	if err != nil {
+		api.kioskError(w, "Error loading roster", err)
+		return
+	}
+	entry, known := roster[id]
+	if problem, err := api.kioskWaiverProblem(roster, id, time.Now()); err != nil {
+		api.kioskError(w, "Error reading waivers file", err)
+		return
+	} else if problem != "" {
+		text, err := api.Waivers.text()
+		if err != nil {
+			api.kioskError(w, "Error reading waiver text", err)
+			return
+		}
+		api.showKiosk(w, kioskPage{Step: "waiver", ID: id, Name: entry.Name, Known: known, Problem: problem, Text: text})
+		return
+	}
+	api.kioskCheckIn(w, id, entry.Name)
+}
+
+// handleKioskWaiver saves a signed waiver, adding a new visitor to the roster,
+// then checks them in
+func (api mobileAPI) handleKioskWaiver(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 2*maxSignatureSize)
+	id := strings.TrimSpace(r.FormValue("id"))
+	name := strings.TrimSpace(r.FormValue("name"))
+	typed := strings.TrimSpace(r.FormValue("typed"))
+	drawn := r.FormValue("drawn")
+	if !barcodePattern.MatchString(id) {
+		api.showKiosk(w, kioskPage{Step: "scan", Message: "Badge not recognized. Please scan again.", Error: true})
+		return
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	roster, err := loadRoster(api.RosterFile)
+	if err != nil {
+		api.kioskError(w, "Error loading roster", err)
+		return
+	}
+	entry, known := roster[id]
+	text, err := api.Waivers.text()
+	if err != nil {
+		api.kioskError(w, "Error reading waiver text", err)
+		return
+	}
+	retry := kioskPage{Step: "waiver", ID: id, Name: name, Known: known, Text: text, Error: true}
+	if known {
+		name = entry.Name
+	} else if name == "" {
+		retry.Message = "Please enter your name."
+		api.showKiosk(w, retry)
+		return
+	}
+	if typed == "" && drawn == "" {
+		retry.Message = "Please type your name or draw your signature to sign."
+		api.showKiosk(w, retry)
+		return
+	}
+
+	var signature []byte
+	if drawn != "" {
+		data, ok := strings.CutPrefix(drawn, "data:image/png;base64,")
+		if ok {
+			signature, err = base64.StdEncoding.DecodeString(data)
+		}
+		if !ok || err != nil || len(signature) > maxSignatureSize || http.DetectContentType(signature) != "image/png" {
+			retry.Message = "The drawn signature could not be read. Please sign again."
+			api.showKiosk(w, retry)
+			return
+		}
+	}
+
+	if !known {
+		if err := addKioskVisitor(api.RosterFile, id, name); err != nil {
+			api.kioskError(w, "Error adding visitor to roster", err)
+			return
+		}
+	}
+	if err := api.Waivers.saveSignature(id, name, typed, signature, text, time.Now()); err != nil {
+		api.kioskError(w, "Error saving waiver", err)
+		return
+	}
+	fmt.Printf("Kiosk: %s (%s) signed the waiver.\n", id, name)
+	api.kioskCheckIn(w, id, name)
+}
+
+// kioskWaiverProblem returns why an ID needs to sign a waiver before checking
+// in, or an empty string when it doesn't
+func (api mobileAPI) kioskWaiverProblem(roster map[string]rosterEntry, id string, now time.Time) (string, error) {
+	if api.Waivers.Enforce == "" || !api.Waivers.required(api.scanType(roster, nil, id)) {
+		return "", nil
+	}
+	waivers, err := loadWaivers(api.Waivers.path())
+	if err != nil {
+		return "", err
+	}
+	return api.Waivers.waiverProblem(id, roster[id], waivers, now), nil
+}
+
+// kioskCheckIn records a check-in as an upload from the kiosk, so it is
+// deduplicated and checked like the companion app's scans, and shows the
+// outcome
+func (api mobileAPI) kioskCheckIn(w http.ResponseWriter, id, name string) {
+	results, err := api.recordScans("kiosk", "kiosk", []mobileScan{{UUID: newScanID(), ID: id, Timestamp: time.Now().Format(time.RFC3339), Direction: "in"}})
+	if err != nil {
+		api.kioskError(w, "Error recording check-in", err)
+		return
+	}
+	page := kioskPage{Step: "done", Name: name}
+	switch results[0].Status {
+	case "recorded":
+		page.Message = "Welcome! You're checked in."
+	case "duplicate":
+		page.Message = "You " + results[0].Message + "."
+	default:
+		page.Message = "Not checked in: " + results[0].Error + ". Please see the front desk."
+		page.Error = true
+	}
+	api.showKiosk(w, page)
+}
+
+// kioskError logs an error and shows the kiosk's error screen
+func (api mobileAPI) kioskError(w http.ResponseWriter, context string, err error) {
+	fmt.Println(context+":", err)
+	api.showKiosk(w, kioskPage{Step: "done", Message: "Something went wrong. Please see the front desk.", Error: true})
+}
+
+// addKioskVisitor adds a visitor who signed up at the kiosk to the roster,
+// starting one if there is no roster yet
+func addKioskVisitor(rosterFile, id, name string) error {
+	table, err := readRosterTable(rosterFile)
+	if os.IsNotExist(err) {
+		table, err = &rosterTable{header: []string{"id", "name"}}, nil
+	}
+	if err != nil {
+		return err
+	}
+	row := make([]string, len(table.header))
+	row[table.column("id")] = id
+	table.rows = append(table.rows, row)
+	table.set(id, "name", name)
+	table.set(id, "type", "visitor")
+	return table.write(rosterFile)
+}
+
+// text returns the waiver shown on the kiosk
+func (settings waiverConfig) text() (string, error) {
+	if settings.TextFile == "" {
+		return defaultWaiverText, nil
+	}
+	data, err := os.ReadFile(settings.TextFile)
+	return strings.TrimSpace(string(data)), err
+}
+
+// saveSignature records a waiver signed at the kiosk in the waivers file,
+// with the name typed, the drawn signature's file and a hash of the waiver
+// text so it shows which version was signed. Drawn signatures are saved as
+// PNGs in a directory next to the waivers file, e.g. waivers.signatures.
+func (settings waiverConfig) saveSignature(id, name, typed string, signature []byte, text string, now time.Time) error {
+	file := ""
+	if signature != nil {
+		path := settings.path()
+		dir := strings.TrimSuffix(path, filepath.Ext(path)) + ".signatures"
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		file = filepath.Join(dir, id+"-"+strconv.FormatInt(now.Unix(), 10)+".png")
+		if err := writeFileAtomic(file, signature, 0600); err != nil {
+			return err
+		}
+	}
+	hash := sha256.Sum256([]byte(text))
+	return appendCSV(settings.path(), []string{id, now.Format("2006-01-02"), now.Format("2006-01-02T15:04:05-07:00"),
+		name, typed, file, "kiosk", hex.EncodeToString(hash[:8])})
+}
+
+// kioskTemplate renders the kiosk's steps
+var kioskTemplate = template.Must(template.ParseFS(assets, "assets/kiosk.html"))
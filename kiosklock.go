@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultKioskUnlockFor is how long the admin PIN unlocks a locked kiosk
+	// when the config doesn't say
+	defaultKioskUnlockFor = 30 * time.Minute
+
+	// defaultKioskLockMessage is shown on a locked kiosk when the config
+	// doesn't say
+	defaultKioskLockMessage = "Check-in is closed. Please come back during opening hours."
+
+	// maxKioskPINTries is how many wrong PINs in a row lock out unlocking
+	maxKioskPINTries = 5
+
+	// kioskPINLockout is how long unlocking is refused after too many wrong PINs
+	kioskPINLockout = 5 * time.Minute
+)
+
+// kioskConfig is the config file's "kiosk" section for the /kiosk page and
+// scan mode. With lock_after_hours set, either locks outside the weekly
+// operating hours and on closure days, so a tablet or station left running
+// overnight can't be used to check people in, and staff unlock it for a while
+// with the admin PIN.
+type kioskConfig struct {
+	LockAfterHours bool     `json:"lock_after_hours"` // lock outside the operating hours; needs hours and an admin_pin
+	AdminPIN       string   `json:"admin_pin"`        // at least 4 digits
+	UnlockFor      duration `json:"unlock_for"`       // how long the PIN unlocks the kiosk, e.g. "1h"; default 30m
+	LockMessage    string   `json:"lock_message"`     // shown while locked
+}
+
+// checkKiosk validates the kiosk lock, which needs operating hours to lock
+// outside of and a PIN to unlock with
+func checkKiosk(settings kioskConfig, hours hoursConfig) error {
+	if !settings.LockAfterHours {
+		return nil
+	}
+	if len(hours.Weekly) == 0 {
+		return fmt.Errorf("kiosk: lock_after_hours needs weekly hours")
+	}
+	if len(settings.AdminPIN) < 4 || strings.Trim(settings.AdminPIN, "0123456789") != "" {
+		return fmt.Errorf("kiosk: admin_pin must be at least 4 digits")
+	}
+	if settings.UnlockFor < 0 {
+		return fmt.Errorf("kiosk: unlock_for must not be negative")
+	}
+	return nil
+}
+
+// kioskLock decides whether the kiosk is locked. An unlock holds for every
+// device showing the kiosk, as they share one server.
+type kioskLock struct {
+	settings kioskConfig
+	hours    hoursConfig
+	closures []closureConfig
+
+	mu           sync.Mutex
+	unlocked     time.Time // unlocked with the PIN until then
+	failures     int       // wrong PINs since the last right one
+	blockedUntil time.Time // no unlocking until then after too many wrong PINs
+}
+
+// locked reports whether the kiosk is locked at now: outside the operating
+// hours or on a closure day, and not unlocked with the PIN
+func (lock *kioskLock) locked(now time.Time) bool {
+	if !lock.settings.LockAfterHours {
+		return false
+	}
+	if _, closed := closureOn(lock.closures, now.Format("2006-01-02")); !closed && lock.hours.open(now) {
+		return false
+	}
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	return !now.Before(lock.unlocked)
+}
+
+// unlock unlocks the kiosk when pin is the admin PIN, returning why not
+// otherwise. Too many wrong PINs in a row refuse every PIN for a while, so
+// the PIN can't be guessed overnight.
+func (lock *kioskLock) unlock(pin string, now time.Time) (string, bool) {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if now.Before(lock.blockedUntil) {
+		return "Too many wrong PINs. Try again later.", false
+	}
+	if subtle.ConstantTimeCompare([]byte(pin), []byte(lock.settings.AdminPIN)) != 1 {
+		lock.failures++
+		fmt.Println("Kiosk: wrong admin PIN entered.")
+		if lock.failures >= maxKioskPINTries {
+			lock.failures = 0
+			lock.blockedUntil = now.Add(kioskPINLockout)
+			fmt.Printf("Kiosk: %d wrong admin PINs, unlocking refused until %s.\n", maxKioskPINTries, lock.blockedUntil.Format("15:04"))
+			return "Too many wrong PINs. Try again later.", false
+		}
+		return "Wrong PIN.", false
+	}
+	unlockFor := time.Duration(lock.settings.UnlockFor)
+	if unlockFor == 0 {
+		unlockFor = defaultKioskUnlockFor
+	}
+	lock.failures = 0
+	lock.unlocked = now.Add(unlockFor)
+	fmt.Printf("Kiosk: unlocked with the admin PIN until %s.\n", lock.unlocked.Format("15:04"))
+	return "", true
+}
+
+// message returns what a locked kiosk shows
+func (lock *kioskLock) message() string {
+	if lock.settings.LockMessage != "" {
+		return lock.settings.LockMessage
+	}
+	return defaultKioskLockMessage
+}
+
+// guard shows the locked screen instead of running handler while the kiosk
+// is locked
+func (lock *kioskLock) guard(api mobileAPI, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if lock.locked(time.Now()) {
+			api.showKiosk(w, kioskPage{Step: "locked", Text: lock.message()})
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handleUnlock checks the admin PIN typed on the locked screen and, when it's
+// right, goes back to the scan screen
+func (lock *kioskLock) handleUnlock(api mobileAPI) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !lock.locked(time.Now()) {
+			http.Redirect(w, r, "/kiosk", http.StatusSeeOther)
+			return
+		}
+		if problem, ok := lock.unlock(strings.TrimSpace(r.FormValue("pin")), time.Now()); !ok {
+			api.showKiosk(w, kioskPage{Step: "locked", Text: lock.message(), Message: problem, Error: true})
+			return
+		}
+		http.Redirect(w, r, "/kiosk", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ldapLookupTimeout is how long scan mode waits for the directory before
+// recording a scan without a name
+const ldapLookupTimeout = 5 * time.Second
+
+// defaultLDAPCacheFor is how long a lookup is remembered when the config
+// doesn't say
+const defaultLDAPCacheFor = time.Hour
+
+// ldapConfig is a directory, such as Active Directory, scanned IDs missing
+// from the roster are looked up in. Lookups use the system ldapsearch client
+// (OpenLDAP's ldap-utils) with a simple bind.
+type ldapConfig struct {
+	URL      string `json:"url"`     // e.g. ldaps://dc1.example.org
+	BindDN   string `json:"bind_dn"` // empty for an anonymous bind
+	Password string `json:"password"`
+	BaseDN   string `json:"base_dn"`
+
+	IDAttribute   string `json:"id_attribute"`   // holds the badge ID; default employeeID
+	NameAttribute string `json:"name_attribute"` // default displayName
+
+	// Record type by group name, e.g. "Staff": "staff", for people in the
+	// group according to their memberOf attribute
+	GroupTypes map[string]string `json:"group_types"`
+
+	CacheFor duration `json:"cache_for"` // how long lookups, including misses, are remembered; default 1h
+}
+
+// lookupResult is a remembered directory or REST lookup
+type lookupResult struct {
+	entry rosterEntry
+	found bool
+	at    time.Time
+}
+
+// ldapResolver looks IDs up in the directory, remembering the results so a
+// busy scan line doesn't query it for every badge
+type ldapResolver struct {
+	settings ldapConfig
+	timeout  time.Duration
+	cache    map[string]lookupResult
+}
+
+// newLDAPResolver returns a resolver for the directory, or nil when none is
+// configured
+func newLDAPResolver(settings ldapConfig) *ldapResolver {
+	if settings.URL == "" {
+		return nil
+	}
+	if settings.IDAttribute == "" {
+		settings.IDAttribute = "employeeID"
+	}
+	if settings.NameAttribute == "" {
+		settings.NameAttribute = "displayName"
+	}
+	if settings.CacheFor <= 0 {
+		settings.CacheFor = duration(defaultLDAPCacheFor)
+	}
+	return &ldapResolver{settings: settings, timeout: ldapLookupTimeout, cache: make(map[string]lookupResult)}
+}
+
+// resolve returns the directory's entry for an ID as a roster entry with its
+// name, its groups joined with ";" in the groups field and the record type
+// of its first group in group_types. Failed lookups aren't remembered.
+func (r *ldapResolver) resolve(id string, now time.Time) (rosterEntry, bool, error) {
+	if cached, ok := r.cache[id]; ok && now.Sub(cached.at) < time.Duration(r.settings.CacheFor) {
+		return cached.entry, cached.found, nil
+	}
+	attributes, err := r.search(id)
+	if err != nil {
+		return rosterEntry{}, false, err
+	}
+	result := lookupResult{at: now}
+	if attributes != nil {
+		var groups []string
+		for _, dn := range attributes["memberof"] {
+			groups = append(groups, ldapGroupName(dn))
+		}
+		entry := rosterEntry{ID: id, Fields: map[string]string{"id": id, "groups": strings.Join(groups, ";")}}
+		if names := attributes[strings.ToLower(r.settings.NameAttribute)]; len(names) > 0 {
+			entry.Name = names[0]
+			entry.Fields["name"] = names[0]
+		}
+	groups:
+		for _, group := range groups {
+			for name, t := range r.settings.GroupTypes {
+				if strings.EqualFold(group, name) {
+					entry.Fields["type"] = t
+					break groups
+				}
+			}
+		}
+		result.entry, result.found = entry, true
+	}
+	r.cache[id] = result
+	return result.entry, result.found, nil
+}
+
+// search runs ldapsearch for the entry whose ID attribute is id and returns
+// its attributes by lowercased name, or nil when there is no such entry. The
+// password goes to ldapsearch on standard input so it never shows up in the
+// process list.
+func (r *ldapResolver) search(id string) (map[string][]string, error) {
+	s := r.settings
+	args := []string{"-LLL", "-x", "-H", s.URL, "-o", "nettimeout=" + fmt.Sprint(max(1, int(r.timeout.Seconds()))), "-z", "1"}
+	if s.BaseDN != "" {
+		args = append(args, "-b", s.BaseDN)
+	}
+	if s.BindDN != "" {
+		args = append(args, "-D", s.BindDN, "-y", "/dev/stdin")
+	}
+	args = append(args, "("+s.IDAttribute+"="+ldapEscape(id)+")", s.NameAttribute, "memberOf")
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ldapsearch", args...)
+	cmd.Stdin = strings.NewReader(s.Password)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// Exit status 4 is the size limit, hit when more than one entry has
+		// the ID; the first is used
+		if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != 4 {
+			return nil, fmt.Errorf("ldapsearch: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	return parseLDIFEntry(stdout.String()), nil
+}
+
+// parseLDIFEntry returns the attributes of the first entry in ldapsearch's
+// LDIF output by lowercased name, or nil when it holds no entry. Folded lines
+// are joined and base64 values (attr:: value) decoded.
+func parseLDIFEntry(ldif string) map[string][]string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(ldif, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(line, " ") && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var attributes map[string][]string
+	for _, line := range lines {
+		if line == "" {
+			if attributes != nil {
+				break
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(value, ":") {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		} else {
+			value = strings.TrimPrefix(value, " ")
+		}
+		if attributes == nil {
+			attributes = make(map[string][]string)
+		}
+		name = strings.ToLower(name)
+		attributes[name] = append(attributes[name], value)
+	}
+	return attributes
+}
+
+// ldapGroupName returns the name of a group from its DN, the value of its
+// first component, e.g. Staff for CN=Staff,OU=Groups,DC=example,DC=org
+func ldapGroupName(dn string) string {
+	first := dn
+	for i := 0; i < len(dn); i++ {
+		if dn[i] == '\\' {
+			i++
+		} else if dn[i] == ',' {
+			first = dn[:i]
+			break
+		}
+	}
+	if _, value, ok := strings.Cut(first, "="); ok {
+		return strings.ReplaceAll(value, `\`, "")
+	}
+	return first
+}
+
+// ldapEscape escapes a value for an LDAP search filter (RFC 4515)
+func ldapEscape(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, `\%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// runLDAPLookupMode looks an ID up in the directory, to check the ldap
+// settings
+func runLDAPLookupMode(settings ldapConfig, id string) {
+	resolver := newLDAPResolver(settings)
+	if resolver == nil {
+		fmt.Println("Error: No ldap directory is set in the config file.")
+		return
+	}
+	entry, found, err := resolver.resolve(id, time.Now())
+	if err != nil {
+		fmt.Println("Error looking up ID:", err)
+		return
+	}
+	if !found {
+		fmt.Printf("%s is not in the directory.\n", id)
+		return
+	}
+	fmt.Printf("%s: %s\n", id, entry.Name)
+	if entry.Fields["groups"] != "" {
+		fmt.Println("Groups:", strings.ReplaceAll(entry.Fields["groups"], ";", ", "))
+	}
+	if entry.Fields["type"] != "" {
+		fmt.Println("Record type:", entry.Fields["type"])
+	}
+}
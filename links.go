@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// rosterTable is a roster file held as rows so it can be edited and written
+// back with its columns and row order intact
+type rosterTable struct {
+	header []string
+	rows   [][]string
+}
+
+// readRosterTable reads the roster at path for editing
+func readRosterTable(path string) (*rosterTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("roster %s is empty", path)
+	}
+	trimBOM(rows[0])
+	table := &rosterTable{header: rows[0], rows: rows[1:]}
+	if table.column("id") < 0 {
+		return nil, fmt.Errorf("roster %s has no id column", path)
+	}
+	return table, nil
+}
+
+// column returns the index of the named column, or -1
+func (t *rosterTable) column(name string) int {
+	for i, column := range t.header {
+		if strings.ToLower(strings.TrimSpace(column)) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// row returns the row for an ID, or nil
+func (t *rosterTable) row(id string) []string {
+	idColumn := t.column("id")
+	for _, row := range t.rows {
+		if idColumn < len(row) && row[idColumn] == id {
+			return row
+		}
+	}
+	return nil
+}
+
+// get returns a row's value in the named column
+func (t *rosterTable) get(row []string, name string) string {
+	i := t.column(name)
+	if i < 0 || i >= len(row) {
+		return ""
+	}
+	return row[i]
+}
+
+// set stores a value in the named column of the ID's row, adding the column
+// when the roster doesn't have it yet
+func (t *rosterTable) set(id, name, value string) {
+	i := t.column(name)
+	if i < 0 {
+		t.header = append(t.header, name)
+		i = len(t.header) - 1
+	}
+	idColumn := t.column("id")
+	for r, row := range t.rows {
+		if idColumn < len(row) && row[idColumn] == id {
+			for len(row) <= i {
+				row = append(row, "")
+			}
+			row[i] = value
+			t.rows[r] = row
+		}
+	}
+}
+
+// write replaces the roster at path, going through a temporary file so a
+// failed write never truncates it
+func (t *rosterTable) write(path string) error {
+	if err := journalFile(path); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := csv.NewWriter(tmp)
+	writer.Write(t.header)
+	writer.WriteAll(t.rows)
+	if err := writer.Error(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// splitIDs splits a comma-separated ID list
+func splitIDs(list string) []string {
+	var ids []string
+	for _, id := range strings.Split(list, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// runLinkMode links roster IDs. A family relation puts every ID, and anyone
+// already sharing a family with one of them, in one family. A caregiver
+// relation makes the first ID a caregiver of each of the others.
+func runLinkMode(rosterFile, relation string, ids []string) {
+	table, err := readRosterTable(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+	message, err := table.link(relation, ids)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if err := table.write(rosterFile); err != nil {
+		fmt.Println("Error writing roster:", err)
+		return
+	}
+	fmt.Println(message)
+}
+
+// link links IDs in the table as runLinkMode describes and returns what was
+// done
+func (t *rosterTable) link(relation string, ids []string) (string, error) {
+	if len(ids) < 2 {
+		return "", fmt.Errorf("give at least two comma-separated IDs to link")
+	}
+	for _, id := range ids {
+		if t.row(id) == nil {
+			return "", fmt.Errorf("ID %s is not on the roster", id)
+		}
+	}
+
+	switch relation {
+	case "family":
+		family := ""
+		merged := make(map[string]bool)
+		for _, id := range ids {
+			if existing := t.get(t.row(id), "family"); existing != "" {
+				if family == "" {
+					family = existing
+				}
+				merged[existing] = true
+			}
+		}
+		if family == "" {
+			family = "family-" + ids[0]
+		}
+		for _, row := range t.rows {
+			if merged[t.get(row, "family")] {
+				t.set(t.get(row, "id"), "family", family)
+			}
+		}
+		for _, id := range ids {
+			t.set(id, "family", family)
+		}
+		return fmt.Sprintf("Linked %s as family %s.", strings.Join(ids, ", "), family), nil
+	case "caregiver":
+		caregiver := ids[0]
+		for _, id := range ids[1:] {
+			caregivers := splitIDs(strings.ReplaceAll(t.get(t.row(id), "caregivers"), ";", ","))
+			if !contains(caregivers, caregiver) {
+				caregivers = append(caregivers, caregiver)
+			}
+			t.set(id, "caregivers", strings.Join(caregivers, ";"))
+		}
+		return fmt.Sprintf("Linked %s as a caregiver of %s.", caregiver, strings.Join(ids[1:], ", ")), nil
+	}
+	return "", fmt.Errorf("relation must be family or caregiver")
+}
+
+// runUnlinkMode removes links. A family relation takes each ID out of its
+// family. A caregiver relation removes the first ID as a caregiver of the
+// others, or of everyone when it is the only ID given.
+func runUnlinkMode(rosterFile, relation string, ids []string) {
+	table, err := readRosterTable(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+	message, err := table.unlink(relation, ids)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if err := table.write(rosterFile); err != nil {
+		fmt.Println("Error writing roster:", err)
+		return
+	}
+	fmt.Println(message)
+}
+
+// unlink removes links from the table as runUnlinkMode describes and returns
+// what was done
+func (t *rosterTable) unlink(relation string, ids []string) (string, error) {
+	if len(ids) == 0 {
+		return "", fmt.Errorf("give the comma-separated IDs to unlink")
+	}
+
+	switch relation {
+	case "family":
+		for _, id := range ids {
+			t.set(id, "family", "")
+		}
+		return fmt.Sprintf("Removed %s from their families.", strings.Join(ids, ", ")), nil
+	case "caregiver":
+		caregiver, children := ids[0], ids[1:]
+		if len(children) == 0 {
+			for _, row := range t.rows {
+				children = append(children, t.get(row, "id"))
+			}
+		}
+		for _, id := range children {
+			var kept []string
+			for _, other := range splitIDs(strings.ReplaceAll(t.get(t.row(id), "caregivers"), ";", ",")) {
+				if other != caregiver {
+					kept = append(kept, other)
+				}
+			}
+			t.set(id, "caregivers", strings.Join(kept, ";"))
+		}
+		return fmt.Sprintf("Removed %s as a caregiver.", caregiver), nil
+	}
+	return "", fmt.Errorf("relation must be family or caregiver")
+}
+
+// runListLinksMode prints each family with its members and each person's
+// caregivers
+func runListLinksMode(rosterFile string) {
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+	label := func(id string) string {
+		if name := rosterName(roster, id); name != "" {
+			return name + " (" + id + ")"
+		}
+		return id
+	}
+
+	families := make(map[string][]string)
+	var caregiverLines []string
+	for id, entry := range roster {
+		if family := entry.Fields["family"]; family != "" {
+			families[family] = append(families[family], label(id))
+		}
+		if caregivers := splitIDs(strings.ReplaceAll(entry.Fields["caregivers"], ";", ",")); len(caregivers) > 0 {
+			for i, caregiver := range caregivers {
+				caregivers[i] = label(caregiver)
+			}
+			caregiverLines = append(caregiverLines, fmt.Sprintf("  %s: %s", label(id), strings.Join(caregivers, ", ")))
+		}
+	}
+
+	var names []string
+	for family := range families {
+		names = append(names, family)
+	}
+	sort.Strings(names)
+	fmt.Printf("Families: %d\n", len(names))
+	for _, family := range names {
+		sort.Strings(families[family])
+		fmt.Printf("  %s: %s\n", family, strings.Join(families[family], ", "))
+	}
+	sort.Strings(caregiverLines)
+	fmt.Printf("Caregivers: %d\n", len(caregiverLines))
+	for _, line := range caregiverLines {
+		fmt.Println(line)
+	}
+}
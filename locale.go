@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportLocale is the language and the date and number formats reports are
+// written in, chosen with the config file's "locale" or -locale. The default
+// is English with ISO dates and plain numbers, as reports have always been.
+// Reports look their headings up by the English text, so a heading a locale
+// doesn't translate stays in English.
+type reportLocale struct {
+	Tag       string // BCP 47 language tag, e.g. fr-CA, for the HTML lang attribute
+	Decimal   string // decimal separator
+	Thousands string // thousands separator; empty for none
+	Months    [12]string
+	Short     [12]string // abbreviated month names, for calendar labels
+	Days      [7]string  // weekday names, Sunday first as time.Weekday counts
+	Weekdays  [7]string  // abbreviated
+	DateOrder string     // fmt layout of a long date taking the day, the month name and the year, in that order
+	Text      map[string]string
+}
+
+// frenchText are the French report headings by their English text, as
+// partner organizations in Quebec write them
+var frenchText = map[string]string{
+	"Stats for %s to %s:":                 "Statistiques du %s au %s :",
+	"check-ins":                           "entrées",
+	"attendance credits":                  "crédits de présence",
+	"open days":                           "jours d'ouverture",
+	"average per open day":                "moyenne par jour d'ouverture",
+	"people":                              "personnes",
+	"busiest day":                         "jour le plus achalandé",
+	"%s (%s check-ins)":                   "%s (%s entrées)",
+	"closures left out":                   "fermetures exclues",
+	"check-ins on closed days":            "entrées les jours de fermeture",
+	"%s (not in the averages)":            "%s (exclues des moyennes)",
+	"to":                                  "au",
+	"Average check-ins by weekday:":       "Moyenne des entrées par jour de la semaine :",
+	"1 day":                               "1 jour",
+	"%s days":                             "%s jours",
+	"Goals:":                              "Objectifs :",
+	"%s of %s: met on %s of %s open days": "%s de %s : atteint %s jours d'ouverture sur %s",
+	"%s of %s %s (%s%%)":                  "%s sur %s, %s (%s %%)",
+	"daily goal":                          "objectif quotidien",
+	"weekly goal":                         "objectif hebdomadaire",
+	"monthly goal":                        "objectif mensuel",
+	" so far":                             " jusqu'ici",
+	"Longest attendance streaks (open days in a row):": "Plus longues séries de présences (jours d'ouverture consécutifs) :",
+	"%s (current %s)":      "%s (en cours %s)",
+	"Summary for %s:":      "Sommaire du %s :",
+	"check_ins":            "entrées",
+	"check_outs":           "sorties",
+	"new_visitors":         "nouveaux visiteurs",
+	"returning_visitors":   "visiteurs de retour",
+	"first_scan":           "premier passage",
+	"last_scan":            "dernier passage",
+	"busiest_hour":         "heure la plus achalandée",
+	"still_checked_in":     "encore sur place",
+	"%s:00 (%s check-ins)": "%s h (%s entrées)",
+	"Milestones:":          "Paliers :",
+	"visit #%s":            "visite no %s",
+	"Check-ins per day, %s to %s (busiest day: %s)":              "Entrées par jour, du %s au %s (jour le plus achalandé : %s)",
+	"Check-ins %s to %s":                                         "Entrées du %s au %s",
+	"Check-ins per day, %s to %s":                                "Entrées par jour, du %s au %s",
+	"Busiest day: %s check-ins. Hover over a day for its count.": "Jour le plus achalandé : %s entrées. Survolez un jour pour en voir le nombre.",
+	"%s: %s": "%s : %s",
+	"less":   "moins",
+	"more":   "plus",
+}
+
+// locales are the report locales by name
+var locales = map[string]reportLocale{
+	"": {
+		Tag: "en", Decimal: ".",
+		Months:   [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		Short:    [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		Days:     [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		Weekdays: [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	},
+	"en-US": {
+		Tag: "en-US", Decimal: ".", Thousands: ",",
+		Months:    [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		Short:     [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		Days:      [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		Weekdays:  [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+		DateOrder: "%[2]s %[1]d, %[3]d",
+	},
+	"fr-CA": {
+		Tag: "fr-CA", Decimal: ",", Thousands: " ",
+		Months:    [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		Short:     [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		Days:      [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		Weekdays:  [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		DateOrder: "%d %s %d",
+		Text:      frenchText,
+	},
+	"fr-FR": {
+		Tag: "fr-FR", Decimal: ",", Thousands: " ",
+		Months:    [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		Short:     [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		Days:      [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		Weekdays:  [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		DateOrder: "%d %s %d",
+		Text:      frenchText,
+	},
+}
+
+// checkLocale validates a locale name
+func checkLocale(name string) error {
+	if _, ok := locales[name]; !ok {
+		return fmt.Errorf("locale must be en-US, fr-CA or fr-FR, not %q", name)
+	}
+	return nil
+}
+
+// locale returns the locale reports are written in
+func (cfg config) locale() reportLocale {
+	return locales[cfg.Locale]
+}
+
+// text returns a heading in the locale's language, given its English text
+func (l reportLocale) text(english string) string {
+	if translated, ok := l.Text[english]; ok {
+		return translated
+	}
+	return english
+}
+
+// textf formats a heading in the locale's language; arguments are already
+// formatted strings, as the locale formats numbers and dates itself
+func (l reportLocale) textf(english string, args ...any) string {
+	return fmt.Sprintf(l.text(english), args...)
+}
+
+// number formats a whole number with the locale's thousands separator
+func (l reportLocale) number(n int) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	if l.Thousands == "" || len(digits) <= 3 {
+		return sign + digits
+	}
+	var b strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(l.Thousands)
+		}
+		b.WriteRune(digit)
+	}
+	return sign + b.String()
+}
+
+// decimal formats a number with the given digits after the locale's decimal
+// separator
+func (l reportLocale) decimal(f float64, digits int) string {
+	text := strconv.FormatFloat(f, 'f', digits, 64)
+	whole, fraction, _ := strings.Cut(text, ".")
+	n, _ := strconv.Atoi(whole)
+	result := l.number(n)
+	if strings.HasPrefix(whole, "-") && n == 0 {
+		result = "-" + result
+	}
+	if fraction != "" {
+		result += l.Decimal + fraction
+	}
+	return result
+}
+
+// date formats a date (YYYY-MM-DD) the locale's long way, e.g. 14 octobre
+// 2026, or leaves it as it is without one
+func (l reportLocale) date(date string) string {
+	day, err := time.Parse("2006-01-02", date)
+	if l.DateOrder == "" || err != nil {
+		return date
+	}
+	return fmt.Sprintf(l.DateOrder, day.Day(), l.Months[day.Month()-1], day.Year())
+}
+
+// width returns the column width fitting every label in the locale, and at
+// least min characters
+func (l reportLocale) width(min int, labels ...string) int {
+	width := min
+	for _, label := range labels {
+		width = max(width, len([]rune(l.text(label))))
+	}
+	return width
+}
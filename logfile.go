@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+)
+
+// logRotationConfig limits the -log-file activity log. Zero values use the
+// defaults.
+type logRotationConfig struct {
+	MaxSizeMB int      `json:"max_size_mb"` // rotate once the log reaches this size; default 10
+	MaxAge    duration `json:"max_age"`     // rotate once the log was started this long ago; default 24h
+	Keep      int      `json:"keep"`        // rotated logs to keep as .1 (newest) to .N; default 7
+}
+
+// ansiEscape matches terminal color and cursor sequences, which are left out
+// of the log file
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+// rotatingLog is a log file that is renamed to .1, .2 and so on once it is
+// too big or too old
+type rotatingLog struct {
+	path     string
+	settings logRotationConfig
+	file     *os.File
+	size     int64
+	started  time.Time
+}
+
+// openRotatingLog opens the log at path for appending, rotating it first if
+// it is already due
+func openRotatingLog(path string, settings logRotationConfig) (*rotatingLog, error) {
+	if settings.MaxSizeMB <= 0 {
+		settings.MaxSizeMB = 10
+	}
+	if settings.MaxAge <= 0 {
+		settings.MaxAge = duration(24 * time.Hour)
+	}
+	if settings.Keep <= 0 {
+		settings.Keep = 7
+	}
+	l := &rotatingLog{path: path, settings: settings}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	if l.due(time.Now()) {
+		if err := l.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// open opens the current log file, taking its start time from the timestamp
+// of its first line when it already has entries
+func (l *rotatingLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size, l.started = file, info.Size(), time.Now()
+	if info.Size() > 0 {
+		l.started = info.ModTime()
+		if existing, err := os.Open(l.path); err == nil {
+			first, _ := bufio.NewReader(existing).ReadString(' ')
+			existing.Close()
+			if started, err := time.Parse("2006-01-02T15:04:05-07:00 ", first); err == nil {
+				l.started = started
+			}
+		}
+	}
+	return nil
+}
+
+// due reports whether the log should be rotated before writing more to it
+func (l *rotatingLog) due(now time.Time) bool {
+	return l.size > 0 && (l.size >= int64(l.settings.MaxSizeMB)<<20 || now.Sub(l.started) >= time.Duration(l.settings.MaxAge))
+}
+
+// rotate shifts the rotated logs up by one, dropping the oldest, and starts
+// a new log file
+func (l *rotatingLog) rotate() error {
+	l.file.Close()
+	os.Remove(fmt.Sprintf("%s.%d", l.path, l.settings.Keep))
+	for i := l.settings.Keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// writeLine adds one line of output to the log with a timestamp
+func (l *rotatingLog) writeLine(now time.Time, line string) error {
+	if l.due(now) {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := fmt.Fprintf(l.file, "%s %s\n", now.Format("2006-01-02T15:04:05-07:00"), ansiEscape.ReplaceAllString(line, ""))
+	l.size += int64(n)
+	return err
+}
+
+// teeOutput copies everything the program prints to standard output into the
+// rotating log at path, one timestamped line at a time, while still showing
+// it on the terminal. The returned function stops copying once the output so
+// far is logged, and must be called before exiting.
+func teeOutput(path string, settings logRotationConfig) (func(), error) {
+	log, err := openRotatingLog(path, settings)
+	if err != nil {
+		return nil, err
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		log.file.Close()
+		return nil, err
+	}
+	terminal := os.Stdout
+	os.Stdout = writer
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// The terminal gets output as soon as it is printed, prompts
+		// included, while the log gets complete lines
+		lines := bufio.NewScanner(io.TeeReader(reader, terminal))
+		for lines.Scan() {
+			if err := log.writeLine(time.Now(), lines.Text()); err != nil {
+				fmt.Fprintln(terminal, "Error writing log file:", err)
+			}
+		}
+		log.file.Close()
+	}()
+
+	return func() {
+		os.Stdout = terminal
+		writer.Close()
+		<-done
+	}, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// logEvent is one line of scan mode's -log-format=json output
+type logEvent struct {
+	Time      string  `json:"time"`
+	Station   string  `json:"station"`
+	Event     string  `json:"event"`             // scan, error, roster or pause
+	Outcome   string  `json:"outcome,omitempty"` // recorded, duplicate, debounced, dry_run, invalid, rejected, waitlisted or paused
+	ID        string  `json:"id,omitempty"`
+	Direction string  `json:"direction,omitempty"`
+	Type      string  `json:"type,omitempty"`
+	Count     string  `json:"count,omitempty"`
+	LatencyMS float64 `json:"latency_ms,omitempty"` // from reading the scan to the outcome
+	Message   string  `json:"message,omitempty"`
+	TestMode  bool    `json:"test_mode,omitempty"`
+}
+
+// defaultStation returns the station name used in JSON logs when -station
+// isn't given, which is the host name
+func defaultStation() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}
+
+// jsonLogs reports whether scan mode writes JSON events instead of console
+// text
+func (options scanOptions) jsonLogs() bool {
+	return options.LogFormat == "json"
+}
+
+// writeEvent prints a JSON log event, filling in the time and station
+func (options scanOptions) writeEvent(event logEvent) {
+	event.Time = time.Now().Format("2006-01-02T15:04:05.000-07:00")
+	event.Station = options.Station
+	event.TestMode = testMode
+	line, _ := json.Marshal(event)
+	fmt.Println(string(line))
+}
+
+// logScan writes the JSON event for a scan's outcome. record is the record
+// written, or would have been, and is nil when none was built.
+func (options scanOptions) logScan(outcome, barcodeID string, record []string, started time.Time) {
+	if !options.jsonLogs() {
+		return
+	}
+	event := logEvent{Event: "scan", Outcome: outcome, ID: barcodeID, Direction: options.Direction,
+		LatencyMS: float64(time.Since(started).Microseconds()) / 1000}
+	if record != nil {
+		event.Type = recordType(record)
+		if len(record) > 2 {
+			event.Count = record[2]
+		}
+	}
+	options.writeEvent(event)
+}
+
+// logNotice reports a change scan mode made on its own, such as reloading
+// the roster, as console text or a JSON event of that kind
+func (options scanOptions) logNotice(event, message string) {
+	if !options.jsonLogs() {
+		fmt.Println(message + ".")
+		return
+	}
+	options.writeEvent(logEvent{Event: event, Message: message})
+}
+
+// logError reports a scan mode error, as console text or a JSON event
+func (options scanOptions) logError(message string, err error) {
+	options.Heartbeat.failed(message, err)
+	if !options.jsonLogs() {
+		fmt.Println(message+":", err)
+		return
+	}
+	options.writeEvent(logEvent{Event: "error", Message: fmt.Sprintf("%s: %v", message, err)})
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLookupMatches is the most people a lookup search lists
+const maxLookupMatches = 10
+
+// defaultBadgeTemplate is a ZPL label for Zebra-style badge printers with
+// the name, the event and the ID as a Code 128 barcode
+const defaultBadgeTemplate = "^XA^CI28^FO40,40^A0N,60,60^FD{name}^FS^FO40,120^A0N,30,30^FD{event}^FS^FO40,180^BCN,100,Y,N,N^FD{id}^FS^XZ\n"
+
+// badgePrinterConfig is the config file's "badge_printer" section, used by
+// -lookup to reprint lost badges
+type badgePrinterConfig struct {
+	Command  string `json:"command"`  // run with the badge file's path appended; default "lp -o raw"
+	Template string `json:"template"` // badge file contents with {id}, {name} and {event}; default a ZPL label
+}
+
+// lookupConfig is the config file's "lookup" section
+type lookupConfig struct {
+	// Roster column the attendee must give to prove who they are; default
+	// email. Staff can instead type "id" after checking a photo ID.
+	VerifyField string `json:"verify_field"`
+}
+
+// printBadge sends a badge for an attendee to the badge printer
+func (settings badgePrinterConfig) printBadge(entry rosterEntry, event string) error {
+	template := settings.Template
+	if template == "" {
+		template = defaultBadgeTemplate
+	}
+	badge := strings.NewReplacer("{id}", entry.ID, "{name}", entry.Name, "{event}", event).Replace(template)
+	file, err := os.CreateTemp("", "badge-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(badge); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	command := settings.Command
+	if command == "" {
+		command = "lp -o raw"
+	}
+	args := append(strings.Fields(command), file.Name())
+	if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// maskValue hides most of a value shown on the lookup screen, such as an
+// email, so the list doesn't give away someone else's details
+func maskValue(value string) string {
+	user, domain, isEmail := strings.Cut(value, "@")
+	if len(user) == 0 {
+		return ""
+	}
+	masked := user[:1] + strings.Repeat("*", len(user)-1)
+	if isEmail {
+		masked += "@" + domain
+	}
+	return masked
+}
+
+// lookupStation is the state of a -lookup session
+type lookupStation struct {
+	people  map[string]rosterEntry // the event's registrations, or the roster
+	event   string
+	verify  string
+	printer badgePrinterConfig
+	api     mobileAPI // records check-ins as the kiosk does
+	station string
+}
+
+// runLookupMode runs a help desk station for attendees who lost their
+// badge. They search for themselves by name or email, prove who they are
+// with the verify field or a photo ID shown to staff, and get a new badge
+// printed and are checked in for the day. Reprints are logged to the
+// reprints sidecar file, e.g. scans.reprints.csv. The people are reloaded
+// from peopleFile when it changes, so newly registered attendees can be found.
+func runLookupMode(people map[string]rosterEntry, peopleFile, event string, settings lookupConfig, printer badgePrinterConfig, api mobileAPI, station string) {
+	if len(people) == 0 {
+		fmt.Println("Error: -lookup needs a -roster or an -event with registrations to search.")
+		return
+	}
+	verify := strings.ToLower(settings.VerifyField)
+	if verify == "" {
+		verify = "email"
+	}
+	l := lookupStation{people: people, event: event, verify: verify, printer: printer, api: api, station: station}
+	watcher := watchRoster(peopleFile, people, func(change string, err error) {
+		if err != nil {
+			fmt.Println("\nError reloading roster:", err)
+		}
+	})
+	defer watcher.stop()
+	input := bufio.NewReader(os.Stdin)
+	fmt.Println("Badge lookup ready. Type 'exit' to quit.")
+	for {
+		fmt.Print("\nSearch by name or email: ")
+		line, err := input.ReadString('\n')
+		query := strings.TrimSpace(line)
+		if query == "exit" || (err != nil && query == "") {
+			fmt.Println("Exiting lookup mode.")
+			return
+		}
+		if query != "" {
+			l.people, _ = watcher.current()
+			l.serve(input, query)
+		}
+	}
+}
+
+// serve helps one attendee from their search to their new badge
+func (l lookupStation) serve(input *bufio.Reader, query string) {
+	matches := l.search(query)
+	if len(matches) == 0 {
+		fmt.Println("No one matches. Try part of the name, or the full email.")
+		return
+	}
+	for i, id := range matches {
+		entry := l.people[id]
+		fmt.Printf("  %d) %-30s %s\n", i+1, entry.Name, maskValue(entry.Fields["email"]))
+	}
+	fmt.Print("Number (or Enter to search again): ")
+	line, _ := input.ReadString('\n')
+	n, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || n < 1 || n > len(matches) {
+		return
+	}
+	entry := l.people[matches[n-1]]
+
+	expected := strings.TrimSpace(entry.Fields[l.verify])
+	fmt.Printf("Enter the %s registered for %s, or staff type id after checking a photo ID: ", l.verify, entry.Name)
+	line, _ = input.ReadString('\n')
+	answer := strings.TrimSpace(line)
+	method := l.verify
+	switch {
+	case strings.EqualFold(answer, "id"):
+		method = "photo_id"
+	case expected != "" && strings.EqualFold(answer, expected):
+	default:
+		fmt.Println("That doesn't match our records. Please show a photo ID to a staff member.")
+		return
+	}
+
+	if err := l.printer.printBadge(entry, l.event); err != nil {
+		fmt.Println("Error printing badge:", err)
+		return
+	}
+	fmt.Printf("Printing a new badge for %s.\n", entry.Name)
+	scanUUID := newScanID()
+	results, err := l.api.recordScans("lookup", "lookup", []mobileScan{{UUID: scanUUID, ID: entry.ID, Timestamp: time.Now().Format(time.RFC3339), Direction: "in"}})
+	outcome := "error"
+	if err != nil {
+		fmt.Println("Error recording check-in:", err)
+	} else {
+		outcome = results[0].Status
+		switch outcome {
+		case "recorded":
+			fmt.Printf("Checked in %s.\n", entry.Name)
+		case "duplicate":
+			fmt.Printf("%s %s.\n", entry.Name, results[0].Message)
+		default:
+			fmt.Printf("Not checked in: %s.\n", results[0].Error)
+		}
+	}
+	row := []string{time.Now().Format("2006-01-02T15:04:05-07:00"), entry.ID, method, outcome, l.station}
+	if err := appendCSV(sidecarFile("reprints"), row); err != nil {
+		fmt.Println("Error writing reprints file:", err)
+	}
+}
+
+// search returns the IDs of the people whose name contains the query or
+// whose email is the query, sorted by name
+func (l lookupStation) search(query string) []string {
+	query = strings.ToLower(query)
+	var matches []string
+	for id, entry := range l.people {
+		if strings.Contains(strings.ToLower(entry.Name), query) || strings.EqualFold(strings.TrimSpace(entry.Fields["email"]), query) {
+			matches = append(matches, id)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if l.people[matches[i]].Name != l.people[matches[j]].Name {
+			return l.people[matches[i]].Name < l.people[matches[j]].Name
+		}
+		return matches[i] < matches[j]
+	})
+	if len(matches) > maxLookupMatches {
+		fmt.Printf("%d people match; showing the first %d. Type more of the name to narrow it down.\n", len(matches), maxLookupMatches)
+		matches = matches[:maxLookupMatches]
+	}
+	return matches
+}
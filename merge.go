@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// clockSkewTolerance is how far a station's clock may be off before merge
+// reports it
+const clockSkewTolerance = time.Minute
+
+// mergeSource is one data file being merged, with the offset to add to its
+// timestamps to correct its station's clock
+type mergeSource struct {
+	Path   string
+	Offset time.Duration
+}
+
+// parseMergeSources parses -merge's comma-separated files, each optionally
+// followed by @ and an offset such as @-4m30s for a station whose clock runs
+// 4.5 minutes fast
+func parseMergeSources(list string) ([]mergeSource, error) {
+	var sources []mergeSource
+	for _, item := range strings.Split(list, ",") {
+		path, offset, hasOffset := strings.Cut(strings.TrimSpace(item), "@")
+		source := mergeSource{Path: path}
+		if hasOffset {
+			d, err := time.ParseDuration(offset)
+			if err != nil {
+				return nil, fmt.Errorf("invalid clock offset for %s: %w", path, err)
+			}
+			source.Offset = d
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// reportClockSkew warns about signs that the station that wrote a data file
+// had its clock wrong: records from the future, and records earlier than the
+// one before them, which an append-only file only gets when the clock jumps
+// back
+func reportClockSkew(path string, records [][]string, now time.Time) {
+	var future, backwards int
+	var ahead, jump time.Duration
+	var previous time.Time
+	for _, record := range records {
+		t, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+		if err != nil {
+			continue
+		}
+		if d := t.Sub(now); d > clockSkewTolerance {
+			future++
+			if d > ahead {
+				ahead = d
+			}
+		}
+		if d := previous.Sub(t); !previous.IsZero() && d > clockSkewTolerance {
+			backwards++
+			if d > jump {
+				jump = d
+			}
+		}
+		previous = t
+	}
+	if future > 0 {
+		fmt.Printf("Warning: %s has %d records from the future, up to %s ahead. Its station's clock may be fast; add an offset such as %s@-%s.\n",
+			path, future, ahead.Round(time.Second), path, ahead.Round(time.Second))
+	}
+	if backwards > 0 {
+		fmt.Printf("Warning: %s goes back in time %d times, by up to %s, so its station's clock was changed while scanning.\n",
+			path, backwards, jump.Round(time.Second))
+	}
+}
+
+// reportCrossStationSkew warns when people checked out at one station before
+// they checked in at another on the same day, which only happens when the
+// stations' clocks disagree. The typical gap suggests an offset for the
+// station doing the check-ins.
+func reportCrossStationSkew(records [][]string, origins []string) {
+	type scan struct {
+		t      time.Time
+		out    bool
+		origin string
+	}
+	days := make(map[string][]scan)
+	for i, record := range records {
+		t, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+		if err != nil {
+			continue
+		}
+		key := record[1] + " " + record[0][:10]
+		days[key] = append(days[key], scan{t, recordDirection(record) == "out", origins[i]})
+	}
+
+	gaps := make(map[string][]time.Duration) // by "check-in station / check-out station"
+	for _, scans := range days {
+		sort.Slice(scans, func(i, j int) bool { return scans[i].t.Before(scans[j].t) })
+		if len(scans) < 2 || !scans[0].out {
+			continue
+		}
+		for _, later := range scans[1:] {
+			if !later.out && later.origin != scans[0].origin {
+				pair := later.origin + " / " + scans[0].origin
+				gaps[pair] = append(gaps[pair], later.t.Sub(scans[0].t))
+				break
+			}
+		}
+	}
+	var pairs []string
+	for pair := range gaps {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	for _, pair := range pairs {
+		list := gaps[pair]
+		sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+		inAt, outAt, _ := strings.Cut(pair, " / ")
+		fmt.Printf("Warning: %d people checked out at %s before checking in at %s, typically %s before. One of the clocks is off.\n",
+			len(list), outAt, inAt, list[len(list)/2].Round(time.Second))
+	}
+}
+
+// mergeKey identifies a record when comparing data files: its scan ID, or
+// for records from before scan IDs its timestamp, ID and direction
+func mergeKey(record []string) string {
+	if scanID := recordScanID(record); scanID != "" {
+		return scanID
+	}
+	return record[0] + "," + record[1] + "," + recordDirection(record)
+}
+
+// runMergeMode adds the records in other stations' data files, or in exports
+// of this one written without -columns, that the data files don't already
+// hold. Records are matched by scan ID, so merging the same file again adds
+// nothing. New records are merged in timestamp order, ties broken by scan ID
+// so every station merging the same files ends up with the same order, and
+// the daily counts are renumbered.
+//
+// Each source is checked for clock problems, and its offset, if any, is added
+// to its timestamps before merging. The sources' fields are separated by
+// comma, or the data file's delimiter when comma is zero.
+func runMergeMode(paths []mergeSource, comma rune) {
+	if comma == 0 {
+		comma = dataDelimiter
+	}
+	records, sources, err := readDataFile()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error reading CSV:", err)
+		fmt.Println("Merge rewrites the whole file, so fix the malformed lines first (see -check).")
+		return
+	}
+	seen := make(map[string]bool)
+	origins := make([]string, len(records))
+	for i, record := range records {
+		if _, err := parseRecord(record); err == nil {
+			seen[mergeKey(record)] = true
+		}
+		origins[i] = dataName()
+	}
+	now := time.Now()
+
+	var added [][]string
+	var addedTimes []time.Time
+	skipped := 0
+	for _, source := range paths {
+		path := source.Path
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Println("Error opening file:", err)
+			return
+		}
+		incoming, _, bad := readDelimitedRecords(file, comma)
+		file.Close()
+		for _, row := range bad {
+			// An export's header line isn't worth a warning
+			if row.Line != 1 {
+				fmt.Printf("%s line %d: skipped: %s\n", path, row.Line, row.Reason)
+			}
+		}
+		reportClockSkew(path, incoming, now)
+		if source.Offset != 0 {
+			fmt.Printf("Shifting the times in %s by %s.\n", path, source.Offset)
+		}
+
+		for _, record := range incoming {
+			// Shifted first, so a record without a scan ID matches the copy
+			// an earlier merge of the file added
+			t, _ := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+			if source.Offset != 0 {
+				t = t.Add(source.Offset)
+				record = append([]string{t.Format("2006-01-02T15:04:05-07:00")}, record[1:]...)
+			}
+			key := mergeKey(record)
+			if seen[key] {
+				skipped++
+				continue
+			}
+			seen[key] = true
+			added = append(added, record)
+			addedTimes = append(addedTimes, t)
+			origins = append(origins, path)
+		}
+	}
+	reportCrossStationSkew(append(records, added...), origins)
+	if len(added) == 0 {
+		fmt.Printf("No new records to merge (%d already present).\n", skipped)
+		return
+	}
+
+	order := make([]int, len(added))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ta, tb := addedTimes[order[a]], addedTimes[order[b]]
+		if !ta.Equal(tb) {
+			return ta.Before(tb)
+		}
+		return mergeKey(added[order[a]]) < mergeKey(added[order[b]])
+	})
+	sortedRecords := make([][]string, len(order))
+	sortedTimes := make([]time.Time, len(order))
+	for i, index := range order {
+		sortedRecords[i], sortedTimes[i] = added[index], addedTimes[index]
+	}
+
+	merged, mergedSources := mergeRecords(records, sources, sortedRecords, sortedTimes)
+	renumberDailyCounts(merged)
+	if err := rewriteDataFile(merged, mergedSources); err != nil {
+		fmt.Println("Error rewriting data file:", err)
+		return
+	}
+	if err := logOrigins(sortedRecords, "merge"); err != nil {
+		fmt.Println("Error writing origins file:", err)
+	}
+	fmt.Printf("Merged %d records into %s (%d already present).\n", len(added), dataName(), skipped)
+	for _, record := range merged {
+		if len(record) > 3 && record[3] != "" {
+			fmt.Println("Warning: Record checksums no longer match the rewritten file, so -verify will report it.")
+			break
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeOffsetFileTwice(t *testing.T) {
+	name := useDataFile(t, "2026-03-02T09:00:00-05:00,1001,1\n")
+	station := filepath.Join(filepath.Dir(name), "station2.csv")
+	// Records from before scan IDs, from a station whose clock ran 5 minutes fast
+	if err := os.WriteFile(station, []byte("2026-03-02T09:15:00-05:00,1002,1\n2026-03-02T09:20:00-05:00,1003,2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sources := []mergeSource{{Path: station, Offset: -5 * time.Minute}}
+
+	runMergeMode(sources, 0)
+	first, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runMergeMode(sources, 0)
+	second, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(first), "\n"); lines != 3 {
+		t.Errorf("first merge left %d records, want 3:\n%s", lines, first)
+	}
+	if !strings.Contains(string(first), "2026-03-02T09:10:00-05:00,1002") {
+		t.Errorf("first merge didn't shift the times:\n%s", first)
+	}
+	if string(second) != string(first) {
+		t.Errorf("merging again changed the data file from\n%s\nto\n%s", first, second)
+	}
+}
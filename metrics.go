@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// scanMetrics is the timing of one scan, appended to the metrics log as
+// timestamp,id,outcome,dedupe_ms,write_ms,total_ms,file_bytes
+type scanMetrics struct {
+	Time      time.Time
+	ID        string
+	Outcome   string // recorded or duplicate
+	Dedupe    time.Duration
+	Write     time.Duration
+	Total     time.Duration
+	FileBytes int64 // data file size when the scan was handled
+}
+
+// metricStages are the timed stages of a scan, in metrics log column order
+var metricStages = []string{"dedupe", "write", "total"}
+
+// appendMetrics appends one scan's timings to the metrics log
+func appendMetrics(path string, m scanMetrics) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	milliseconds := func(d time.Duration) string {
+		return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+	}
+	writer := csv.NewWriter(file)
+	writer.Write([]string{
+		m.Time.Format("2006-01-02T15:04:05-07:00"), m.ID, m.Outcome,
+		milliseconds(m.Dedupe), milliseconds(m.Write), milliseconds(m.Total),
+		strconv.FormatInt(m.FileBytes, 10),
+	})
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// handleMetrics serves the scan timings from the metrics log and the data file
+// size in the Prometheus text format. Each stage is a summary with quantiles
+// over the whole log.
+func handleMetrics(w http.ResponseWriter, r *http.Request, metricsLog string) {
+	outcomes := make(map[string]int)
+	stages := make(map[string][]float64)
+	if metricsLog != "" {
+		file, err := os.Open(metricsLog)
+		if err != nil && !os.IsNotExist(err) {
+			http.Error(w, "error reading metrics log", http.StatusInternalServerError)
+			return
+		}
+		if err == nil {
+			reader := csv.NewReader(file)
+			reader.FieldsPerRecord = -1
+			records, _ := reader.ReadAll()
+			file.Close()
+			for _, record := range records {
+				if len(record) < 6 {
+					continue
+				}
+				outcomes[record[2]]++
+				for i, stage := range metricStages {
+					if stage == "write" && record[2] != "recorded" {
+						continue
+					}
+					if ms, err := strconv.ParseFloat(record[3+i], 64); err == nil {
+						stages[stage] = append(stages[stage], ms/1000)
+					}
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP checkin_scans_total Scans handled by scan mode, by outcome.")
+	fmt.Fprintln(w, "# TYPE checkin_scans_total counter")
+	for _, outcome := range []string{"recorded", "duplicate"} {
+		fmt.Fprintf(w, "checkin_scans_total{outcome=%q} %d\n", outcome, outcomes[outcome])
+	}
+
+	fmt.Fprintln(w, "# HELP checkin_scan_duration_seconds Time spent per scan, by stage.")
+	fmt.Fprintln(w, "# TYPE checkin_scan_duration_seconds summary")
+	for _, stage := range metricStages {
+		values := stages[stage]
+		sort.Float64s(values)
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		for _, q := range []float64{0.5, 0.9, 0.99} {
+			value := 0.0
+			if len(values) > 0 {
+				value = values[int(q*float64(len(values)-1))]
+			}
+			fmt.Fprintf(w, "checkin_scan_duration_seconds{stage=%q,quantile=\"%g\"} %g\n", stage, q, value)
+		}
+		fmt.Fprintf(w, "checkin_scan_duration_seconds_sum{stage=%q} %g\n", stage, sum)
+		fmt.Fprintf(w, "checkin_scan_duration_seconds_count{stage=%q} %d\n", stage, len(values))
+	}
+
+	var size int64
+	files, _ := dataFiles()
+	for _, name := range files {
+		if info, err := os.Stat(name); err == nil {
+			size += info.Size()
+		}
+	}
+	fmt.Fprintln(w, "# HELP checkin_data_file_bytes Current size of the data file, or of all its monthly partitions.")
+	fmt.Fprintln(w, "# TYPE checkin_data_file_bytes gauge")
+	fmt.Fprintf(w, "checkin_data_file_bytes %d\n", size)
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxUploadScans is the most scans one upload may carry
+const maxUploadScans = 1000
+
+// mobileAPI serves the endpoints the companion app uses to turn staff phones
+// into roaming check-in devices: roster sync, device registration and batched
+// scan uploads
+type mobileAPI struct {
+	RosterFile   string
+	Dedupe       dedupeRules // which uploaded scans of an ID repeat another, by record type
+	Hours        hoursConfig // with reject set, uploaded scans outside these hours are refused
+	TypePrefixes map[string]string
+	Passes       passesConfig
+	Badges       badgeConfig  // lost, replaced and expired badges are refused
+	Waivers      waiverConfig // with enforce set to block, scans without a valid waiver are refused
+	GuardianSMS  guardianSMSConfig
+	IntegrityKey []byte
+	ReadOnly     bool // refuse registrations and uploads
+
+	mu *sync.Mutex // serializes writes to the data, devices and uploads files
+}
+
+// mobileScan is one scan captured by a device, identified by a UUID the
+// device generates so a retried upload never records it twice
+type mobileScan struct {
+	UUID      string `json:"uuid"`
+	ID        string `json:"id"`
+	Timestamp string `json:"timestamp"` // RFC 3339
+	Direction string `json:"direction"` // in (default) or out
+}
+
+// mobileScanResult is the outcome of one uploaded scan: recorded, duplicate,
+// already_received, rejected or invalid. A duplicate says when the scan it
+// repeats was and when the ID may scan again, for the app to show.
+type mobileScanResult struct {
+	UUID       string `json:"uuid"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	Message    string `json:"message,omitempty"`     // e.g. "already checked in 35 minutes ago; eligible again at 3:42 PM"
+	LastScan   string `json:"last_scan,omitempty"`   // RFC 3339
+	EligibleAt string `json:"eligible_at,omitempty"` // RFC 3339
+}
+
+// register adds the mobile endpoints to the server. Reading the roster, with
+// its names and contact details, registering devices and uploading scans need
+// an operator, as scanning does, so they're refused until API tokens are
+// configured. Records pushed from other instances, and listing the records,
+// need an admin.
+func (api mobileAPI) register(mux *http.ServeMux, cfg config) {
+	api.mu = &sync.Mutex{}
+	mux.HandleFunc("/api/roster", cfg.requireToken(roleOperator, api.handleRoster))
+	mux.HandleFunc("/api/devices", cfg.requireToken(roleOperator, api.handleDevices))
+	mux.HandleFunc("/api/scans", cfg.requireToken(roleOperator, api.handleScans))
+	mux.HandleFunc("/api/records", cfg.requireToken(roleAdmin, api.handleRecords))
+	mux.HandleFunc("/api/heartbeats", cfg.requireToken(roleOperator, api.handleHeartbeats))
+	api.registerKiosk(mux, cfg)
+}
+
+// handleRoster returns the roster as JSON with an ETag of the roster file's
+// contents, answering 304 Not Modified when the device already has it
+func (api mobileAPI) handleRoster(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := os.ReadFile(api.RosterFile)
+	if err != nil && !os.IsNotExist(err) {
+		http.Error(w, "reading roster: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	roster, err := loadRoster(api.RosterFile)
+	if err != nil {
+		http.Error(w, "reading roster: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entries := []map[string]string{}
+	for _, entry := range roster {
+		entries = append(entries, entry.Fields)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i]["id"] < entries[j]["id"] })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"roster": entries})
+}
+
+// handleDevices registers a device by name and returns the device ID it sends
+// with its uploads
+func (api mobileAPI) handleDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if api.ReadOnly {
+		http.Error(w, "the server is read-only", http.StatusForbidden)
+		return
+	}
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" {
+		http.Error(w, `expected {"name": "..."}`, http.StatusBadRequest)
+		return
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	device := hex.EncodeToString(id)
+	api.mu.Lock()
+	err := appendCSV(sidecarFile("devices"), []string{device, body.Name, time.Now().Format("2006-01-02T15:04:05-07:00")})
+	api.mu.Unlock()
+	if err != nil {
+		http.Error(w, "saving device: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Printf("Registered device %s (%s).\n", device, body.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"device_id": device, "name": body.Name})
+}
+
+// handleScans records a batch of scans from a registered device. Scans whose
+// UUID was received before are acknowledged without being recorded again, so
+// a device can retry an upload that timed out.
+func (api mobileAPI) handleScans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if api.ReadOnly {
+		http.Error(w, "the server is read-only", http.StatusForbidden)
+		return
+	}
+	var body struct {
+		DeviceID string       `json:"device_id"`
+		Scans    []mobileScan `json:"scans"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid upload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body.Scans) > maxUploadScans {
+		http.Error(w, fmt.Sprintf("at most %d scans per upload", maxUploadScans), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	devices, err := loadCSVColumn(sidecarFile("devices"), 0)
+	if err != nil {
+		http.Error(w, "reading devices: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !devices[body.DeviceID] {
+		http.Error(w, "unknown device; register it at /api/devices first", http.StatusForbidden)
+		return
+	}
+	results, err := api.recordScans(body.DeviceID, "mobile", body.Scans)
+	if err != nil {
+		http.Error(w, "recording scans: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"results": results})
+}
+
+// recordScans appends a device's new scans to the data file, or with
+// partitioning to the partition of the month each was scanned in, in
+// timestamp order, skipping repeats within the dedupe window, and logs each
+// UUID to the uploads file with its outcome. Recorded scans are noted in the
+// origins file as coming from source.
+func (api mobileAPI) recordScans(device, source string, scans []mobileScan) ([]mobileScanResult, error) {
+	received, err := loadCSVColumn(sidecarFile("uploads"), 0)
+	if err != nil {
+		return nil, err
+	}
+	roster, err := loadRoster(api.RosterFile)
+	if err != nil {
+		return nil, err
+	}
+	passes, err := loadPasses(api.Passes.path())
+	if err != nil {
+		return nil, err
+	}
+	waivers, err := loadWaivers(api.Waivers.path())
+	if err != nil {
+		return nil, err
+	}
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+
+	results := make([]mobileScanResult, len(scans))
+	times := make([]time.Time, len(scans))
+	var order []int
+	for i, scan := range scans {
+		results[i] = mobileScanResult{UUID: scan.UUID, Status: "invalid"}
+		switch {
+		case scan.UUID == "":
+			results[i].Error = "missing uuid"
+		case received[scan.UUID]:
+			results[i].Status = "already_received"
+		case !barcodePattern.MatchString(scan.ID):
+			results[i].Error = "invalid barcode ID"
+		case scan.Direction != "" && scan.Direction != "in" && scan.Direction != "out":
+			results[i].Error = "direction must be in or out"
+		default:
+			t, err := time.Parse(time.RFC3339, scan.Timestamp)
+			if err != nil {
+				results[i].Error = "invalid timestamp"
+				continue
+			}
+			if scans[i].Direction == "" {
+				scans[i].Direction = "in"
+			}
+			times[i] = t.In(time.Local)
+			received[scan.UUID] = true
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool { return times[order[a]].Before(times[order[b]]) })
+
+	for _, i := range order {
+		scan, t := scans[i], times[i]
+		outcome := "recorded"
+		policy := api.Dedupe.forType(api.scanType(roster, passes, scan.ID))
+		if pass, ok := passes[scan.ID]; ok && !pass.validOn(t) {
+			outcome = "rejected"
+			results[i].Error = "day pass not valid on " + t.Format("2006-01-02")
+		} else if entry, ok := roster[scan.ID]; ok && api.Badges.badgeProblem(entry, t) != "" {
+			outcome = "rejected"
+			results[i].Error = api.Badges.badgeProblem(entry, t)
+		} else if entry, ok := roster[scan.ID]; ok && !rosterActive(entry) {
+			outcome = "rejected"
+			results[i].Error = "badge deactivated"
+		} else if api.Waivers.Enforce == "block" && scan.Direction == "in" && api.Waivers.required(api.scanType(roster, passes, scan.ID)) &&
+			api.Waivers.waiverProblem(scan.ID, roster[scan.ID], waivers, t) != "" {
+			outcome = "rejected"
+			results[i].Error = "no valid signed waiver"
+		} else if api.Hours.Reject && !api.Hours.open(t) {
+			outcome = "rejected"
+			results[i].Error = "outside operating hours"
+		} else if earlier, ok := hasRecentScan(records, scan.ID, scan.Direction, policy, t); ok {
+			outcome = "duplicate"
+			results[i].Message = policy.duplicateMessage(scan.Direction, earlier, t)
+			results[i].LastScan = earlier.Format(time.RFC3339)
+			results[i].EligibleAt = policy.eligibleAt(earlier).Format(time.RFC3339)
+		}
+
+		if outcome == "recorded" {
+			record := api.newRecord(records, roster, passes, scan, t)
+			if api.IntegrityKey != nil {
+				previous := ""
+				if len(records) > 0 && len(records[len(records)-1]) > 3 {
+					previous = records[len(records)-1][3]
+				}
+				for len(record) < 4 {
+					record = append(record, "")
+				}
+				record[3] = recordChecksum(api.IntegrityKey, previous, record)
+			}
+			// A scan kept offline since an earlier month goes in that month's file
+			if err := appendRecord(ingestFile(t), record); err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+			if err := logOrigin(record, "", "", source); err != nil {
+				return nil, err
+			}
+			api.GuardianSMS.notify(roster[scan.ID], recordType(record), scan.Direction, t, device, func(err error) {
+				fmt.Println("Error texting guardian:", err)
+			})
+		}
+		results[i].Status = outcome
+		if outcome == "duplicate" {
+			if err := logRepeat(t, scan.ID, scan.Direction, api.scanType(roster, passes, scan.ID), device, ""); err != nil {
+				return nil, err
+			}
+		}
+		if err := appendCSV(sidecarFile("uploads"), []string{scan.UUID, device, t.Format("2006-01-02T15:04:05-07:00"), scan.ID, outcome, time.Now().Format("2006-01-02T15:04:05-07:00")}); err != nil {
+			return nil, err
+		}
+	}
+	if len(order) > 0 {
+		fmt.Printf("Received %d scans from device %s.\n", len(order), device)
+	}
+	return results, nil
+}
+
+// scanType returns the record type of an uploaded scan of the ID. Day pass
+// holders are visitors.
+func (api mobileAPI) scanType(roster map[string]rosterEntry, passes map[string]dayPass, id string) string {
+	if _, ok := passes[id]; ok {
+		return "visitor"
+	}
+	return deriveType(id, roster, api.TypePrefixes)
+}
+
+// newRecord builds the data file record for an uploaded scan, numbering
+// check-ins after the highest count of their type on that date
+func (api mobileAPI) newRecord(records [][]string, roster map[string]rosterEntry, passes map[string]dayPass, scan mobileScan, t time.Time) []string {
+	record := Record{Timestamp: t, BadgeID: scan.ID, Direction: scan.Direction, Type: api.scanType(roster, passes, scan.ID), ScanID: scan.UUID}
+	if scan.Direction != "out" {
+		record.Seq = nextDailyCount(records, t.Format("2006-01-02"), record.Type)
+	}
+	return record.Fields()
+}
+
+// appendCSV appends one row to a CSV file, creating it if needed
+func appendCSV(path string, row []string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	writer.Write(row)
+	writer.Flush()
+	return writer.Error()
+}
+
+// loadCSVColumn returns the set of values in one column of a CSV file. A
+// missing file means no values.
+func loadCSVColumn(path string, column int) (map[string]bool, error) {
+	values := make(map[string]bool)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return values, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if column < len(row) {
+			values[row[column]] = true
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordScansRoutesToTheirMonth(t *testing.T) {
+	name := useDataFile(t, "")
+	os.Remove(name)
+	dir := filepath.Dir(name)
+	partitioned = true
+	defer func() { partitioned = false }()
+
+	api := mobileAPI{
+		RosterFile: filepath.Join(dir, "roster.csv"),
+		Passes:     passesConfig{File: filepath.Join(dir, "passes.csv")},
+		Waivers:    waiverConfig{File: filepath.Join(dir, "waivers.csv")},
+	}
+	now := time.Now()
+	earlier := time.Date(now.Year(), now.Month(), 1, 12, 0, 0, 0, time.Local).AddDate(0, 0, -1)
+	scans := []mobileScan{
+		{UUID: "u1", ID: "1001", Timestamp: earlier.Format(time.RFC3339)},
+		{UUID: "u2", ID: "1002", Timestamp: now.Format(time.RFC3339)},
+	}
+	results, err := api.recordScans("device", "mobile", scans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Status != "recorded" {
+			t.Fatalf("results %v", results)
+		}
+	}
+	for i, file := range []string{partitionFile(earlier), partitionFile(now)} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 1 || !strings.Contains(lines[0], scans[i].ID) {
+			t.Errorf("%s holds %q, want only scan %s", filepath.Base(file), data, scans[i].ID)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// latinFolds are ASCII spellings of the Latin letters that aren't an ASCII
+// letter with an accent. Accented letters are folded by asciiLetters.
+var latinFolds = map[rune]string{
+	'ß': "ss", 'Æ': "AE", 'æ': "ae", 'Œ': "OE", 'œ': "oe", 'Ø': "O", 'ø': "o",
+	'Ł': "L", 'ł': "l", 'Đ': "D", 'đ': "d", 'Ð': "D", 'ð': "d", 'Þ': "Th", 'þ': "th",
+	'ı': "i", 'ŋ': "ng", 'Ŋ': "NG", 'ʻ': "'", 'ʼ': "'", '‘': "'", '’': "'",
+}
+
+// accentedLetters lists accented Latin letters after the ASCII letter each
+// is written with when the accent is dropped
+var accentedLetters = map[byte]string{
+	'A': "ÀÁÂÃÄÅĀĂĄǍ", 'a': "àáâãäåāăąǎ", 'C': "ÇĆĈĊČ", 'c': "çćĉċč", 'D': "Ď", 'd': "ď",
+	'E': "ÈÉÊËĒĔĖĘĚ", 'e': "èéêëēĕėęě", 'G': "ĜĞĠĢ", 'g': "ĝğġģ", 'H': "ĤĦ", 'h': "ĥħ",
+	'I': "ÌÍÎÏĨĪĬĮİǏ", 'i': "ìíîïĩīĭįǐ", 'J': "Ĵ", 'j': "ĵ", 'K': "Ķ", 'k': "ķ",
+	'L': "ĹĻĽĿ", 'l': "ĺļľŀ", 'N': "ÑŃŅŇ", 'n': "ñńņňŉ", 'O': "ÒÓÔÕÖŌŎŐǑ", 'o': "òóôõöōŏőǒ",
+	'R': "ŔŖŘ", 'r': "ŕŗř", 'S': "ŚŜŞŠȘ", 's': "śŝşšș", 'T': "ŢŤŦȚ", 't': "ţťŧț",
+	'U': "ÙÚÛÜŨŪŬŮŰŲǓ", 'u': "ùúûüũūŭůűųǔ", 'W': "Ŵ", 'w': "ŵ", 'Y': "ÝŶŸ", 'y': "ýÿŷ",
+	'Z': "ŹŻŽ", 'z': "źżž",
+}
+
+// asciiLetters maps each accented letter to its ASCII letter, built from
+// accentedLetters
+var asciiLetters = func() map[rune]byte {
+	letters := make(map[rune]byte)
+	for ascii, accented := range accentedLetters {
+		for _, r := range accented {
+			letters[r] = ascii
+		}
+	}
+	return letters
+}()
+
+// foldASCII spells a name in ASCII where it is written in Latin letters,
+// dropping accents and combining marks. It reports false when the name has
+// letters of another script, such as Arabic or Chinese, which need a
+// transliteration from the roster instead.
+func foldASCII(name string) (string, bool) {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+		case asciiLetters[r] != 0:
+			b.WriteByte(asciiLetters[r])
+		case latinFolds[r] != "":
+			b.WriteString(latinFolds[r])
+		case unicode.IsSpace(r):
+			b.WriteByte(' ')
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// latinName returns a roster entry's name for systems that can't handle
+// Unicode: the roster's name_latin column when it has one, such as a
+// transliteration of an Arabic or Chinese name, or else the name with its
+// accents dropped. It is empty when neither gives an ASCII name.
+func latinName(entry rosterEntry) string {
+	if latin := strings.TrimSpace(entry.Fields["name_latin"]); latin != "" {
+		if folded, ok := foldASCII(latin); ok {
+			return folded
+		}
+		return ""
+	}
+	folded, _ := foldASCII(entry.Name)
+	return folded
+}
+
+// hasNonASCII reports whether any value in the rows is outside ASCII
+func hasNonASCII(rows [][]string) bool {
+	for _, row := range rows {
+		for _, value := range row {
+			for i := 0; i < len(value); i++ {
+				if value[i] >= utf8.RuneSelf {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// trimBOM removes the byte order mark Excel starts a "CSV UTF-8" file with
+// from its first header cell
+func trimBOM(header []string) {
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+}
+
+// joinedScript reports whether a rune is in a script whose letters join up
+// or are laid out right to left, so spacing them apart breaks the word
+func joinedScript(r rune) bool {
+	return unicode.In(r, unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana, unicode.Nko,
+		unicode.Devanagari, unicode.Bengali, unicode.Gurmukhi, unicode.Gujarati, unicode.Tamil, unicode.Thai, unicode.Mongolian)
+}
+
+// wideRune reports whether a rune takes two columns in a terminal, as
+// Chinese, Japanese and Korean characters do
+func wideRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		r >= 0xff01 && r <= 0xff60 || r >= 0x3000 && r <= 0x303f
+}
+
+// displayWidth returns how many terminal columns text takes, counting wide
+// characters twice and combining marks not at all
+func displayWidth(text string) int {
+	width := 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case wideRune(r):
+			width += 2
+		default:
+			width++
+		}
+	}
+	return width
+}
+
+// spaceLetters letter-spaces a banner line, keeping combining marks on their
+// letters and leaving words in joined scripts and wide characters, which are
+// already easy to read from a distance, as they are
+func spaceLetters(line string) string {
+	var words []string
+	for _, word := range strings.Split(line, " ") {
+		spaced := true
+		for _, r := range word {
+			if joinedScript(r) || wideRune(r) {
+				spaced = false
+				break
+			}
+		}
+		if !spaced {
+			words = append(words, word)
+			continue
+		}
+		var b strings.Builder
+		for i, r := range word {
+			if i > 0 && !unicode.Is(unicode.Mn, r) {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+		}
+		words = append(words, b.String())
+	}
+	return strings.Join(words, "   ")
+}
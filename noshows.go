@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultContactFields are the roster columns the no-show report includes
+// when the config file doesn't list any
+var defaultContactFields = []string{"email", "phone"}
+
+// runNoShowMode lists the expected people with no check-in from first to
+// last (YYYY-MM-DD, inclusive), with their contact fields from the roster, so
+// outreach staff can follow up. Expected people are the event's registrations
+// when there are any, and otherwise everyone on the roster. Check-ins with a
+// badge since reissued count for its holder. The list is also saved as a CSV
+// in dir.
+func runNoShowMode(expected, roster map[string]rosterEntry, contactFields []string, first, last, dir string) {
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+	rows := noShows(records, expected, roster, contactFields, first, last)
+
+	period := first
+	if last != first {
+		period = first + " to " + last
+	}
+	fmt.Printf("No-shows %s: %d of %d expected did not check in\n\n", period, len(rows)-1, len(expected))
+	for _, row := range rows[1:] {
+		fmt.Printf("  %-12s %-28s %s\n", row[0], row[1], strings.Join(nonEmpty(row[2:]), "  "))
+	}
+
+	filename := "noshows_" + first
+	if last != first {
+		filename += "_" + last
+	}
+	filename += ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving no-show report:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving no-show report:", err)
+		return
+	}
+	fmt.Println("\nSaved to", filename)
+}
+
+// noShows returns the expected people with no check-in in the records from
+// first to last as rows of their ID, name and contact fields, sorted by
+// name, after a header row
+func noShows(records [][]string, expected, roster map[string]rosterEntry, contactFields []string, first, last string) [][]string {
+	if len(contactFields) == 0 {
+		contactFields = defaultContactFields
+	}
+	arrived := arrivedIDs(records, first, last)
+	holders := badgeHolders(roster)
+	for id, current := range holders {
+		if arrived[id] {
+			arrived[current] = true
+		}
+	}
+
+	var missing []string
+	for id := range expected {
+		if _, reissued := holders[id]; !reissued && !arrived[holder(holders, id)] {
+			missing = append(missing, id)
+		}
+	}
+	// name returns the roster's name for an ID, or the registration's
+	name := func(id string) string {
+		if name := rosterName(roster, id); name != "" {
+			return name
+		}
+		return expected[id].Name
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		if name(missing[i]) != name(missing[j]) {
+			return name(missing[i]) < name(missing[j])
+		}
+		return missing[i] < missing[j]
+	})
+
+	rows := [][]string{append([]string{"id", "name"}, contactFields...)}
+	for _, id := range missing {
+		row := []string{id, name(id)}
+		for _, field := range contactFields {
+			value := roster[id].Fields[strings.ToLower(field)]
+			if value == "" {
+				value = expected[id].Fields[strings.ToLower(field)]
+			}
+			row = append(row, value)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// nonEmpty returns the values that aren't empty
+func nonEmpty(values []string) []string {
+	var kept []string
+	for _, value := range values {
+		if value != "" {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
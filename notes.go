@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sidecarFile returns the file next to the data file holding one kind of
+// extra detail on its records, e.g. scans.notes.csv for scans.csv. Details
+// live outside the data file so adding one never rewrites records or breaks
+// their checksums.
+func sidecarFile(kind string) string {
+	ext := filepath.Ext(dataFile)
+	return strings.TrimSuffix(dataFile, ext) + "." + kind + ext
+}
+
+// noteKey identifies a record by its timestamp and ID, which unlike its line
+// number survive the data file being rewritten
+func noteKey(record []string) string {
+	return record[0] + "," + record[1]
+}
+
+// loadNotes reads the notes file, whose rows are
+// timestamp,id,note,added_at, into the notes for each record key in the
+// order they were added
+func loadNotes() (map[string][]string, error) {
+	return loadSidecar("notes")
+}
+
+// loadSidecar reads a sidecar file whose rows start with timestamp,id,value
+// into the values for each record key. A missing file means no values.
+func loadSidecar(kind string) (map[string][]string, error) {
+	values := make(map[string][]string)
+	file, err := os.Open(sidecarFile(kind))
+	if os.IsNotExist(err) {
+		return values, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if len(row) < 3 {
+			continue
+		}
+		key := noteKey(row)
+		values[key] = append(values[key], row[2])
+	}
+	return values, nil
+}
+
+// appendSidecar adds a row to a sidecar file for each value
+func appendSidecar(kind string, record []string, values []string) error {
+	if err := journalFile(sidecarFile(kind)); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(sidecarFile(kind), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	added := time.Now().Format("2006-01-02T15:04:05-07:00")
+	for _, value := range values {
+		writer.Write([]string{record[0], record[1], value, added})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// runAnnotateMode attaches a note and tags to the record on the given line of
+// the data file, as shown by -search
+func runAnnotateMode(line int, note string, tags []string) {
+	note = strings.TrimSpace(note)
+	if note == "" && len(tags) == 0 {
+		fmt.Println("Error: Give a note to attach with -note or tags with -tag.")
+		return
+	}
+
+	file, err := openDataFiles()
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	records, lines, _ := readRecords(file)
+	file.Close()
+
+	var record []string
+	for i := range records {
+		if lines[i] == line {
+			record = records[i]
+		}
+	}
+	if record == nil {
+		fmt.Printf("Error: Line %d of %s is not a valid record.\n", line, dataName())
+		return
+	}
+
+	if note != "" {
+		if err := appendSidecar("notes", record, []string{note}); err != nil {
+			fmt.Println("Error writing notes file:", err)
+			return
+		}
+		fmt.Printf("Added note to line %d (%s, ID %s).\n", line, record[0], record[1])
+	}
+	if len(tags) > 0 {
+		if err := appendSidecar("tags", record, tags); err != nil {
+			fmt.Println("Error writing tags file:", err)
+			return
+		}
+		fmt.Printf("Tagged line %d (%s, ID %s) with %s.\n", line, record[0], record[1], strings.Join(tags, ", "))
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// presentIDs returns the IDs whose last scan on now's day was a check-in,
+// with the time they came in. Everyone is assumed to have left by midnight.
+func presentIDs(records [][]string, now time.Time) map[string]time.Time {
+	today := now.Format("2006-01-02")
+	present := make(map[string]time.Time)
+	for _, record := range records {
+		recordTime, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+		if err != nil || recordTime.In(now.Location()).Format("2006-01-02") != today {
+			continue
+		}
+		if recordDirection(record) == "out" {
+			delete(present, record[1])
+		} else if _, ok := present[record[1]]; !ok {
+			present[record[1]] = recordTime
+		}
+	}
+	return present
+}
+
+// runOccupancyMode prints how many people are in the building and who, in
+// the order they arrived
+func runOccupancyMode(rosterFile string) {
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+
+	ids, present, err := occupants()
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+
+	fmt.Printf("In the building: %d\n", len(ids))
+	for _, id := range ids {
+		name := rosterName(roster, id)
+		if name == "" {
+			name = "(not on roster)"
+		}
+		fmt.Printf("  %s  %-12s %s\n", present[id].Format("15:04"), id, name)
+	}
+}
+
+// occupants returns the IDs of the people in the building in the order they
+// arrived, with their check-in times
+func occupants() ([]string, map[string]time.Time, error) {
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	var records [][]string
+	if file != nil {
+		var bad []badRow
+		records, _, bad = readRecords(file)
+		file.Close()
+		reportBadRows(bad)
+	}
+
+	present := presentIDs(records, time.Now())
+	ids := make([]string, 0, len(present))
+	for id := range present {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return present[ids[i]].Before(present[ids[j]]) })
+	return ids, present, nil
+}
+
+// runEvacuateMode prints a headcount sheet of everyone checked in and not yet
+// checked out, for use at the muster point, and saves the same list as a CSV
+// in dir so it can be sent to a phone or printed elsewhere
+func runEvacuateMode(rosterFile, dir string) {
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		// A missing roster must not stop a headcount, so fall back to IDs
+		fmt.Println("Error loading roster, listing IDs only:", err)
+	}
+	ids, present, err := occupants()
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+
+	now := time.Now()
+	fmt.Printf("EVACUATION HEADCOUNT  %s\n", now.Format("2006-01-02 15:04"))
+	fmt.Printf("%d people checked in and not checked out:\n\n", len(ids))
+	rows := [][]string{{"id", "name", "checked_in"}}
+	for _, id := range ids {
+		name := rosterName(roster, id)
+		shown := name
+		if shown == "" {
+			shown = "(not on roster)"
+		}
+		fmt.Printf("  [ ]  %-28s %-12s in since %s\n", shown, id, present[id].Format("15:04"))
+		rows = append(rows, []string{id, name, present[id].Format("2006-01-02T15:04:05-07:00")})
+	}
+
+	filename := "evacuation_" + now.Format("20060102-150405") + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving headcount:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving headcount:", err)
+		return
+	}
+	fmt.Println("\nSaved to", filename)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// jsonOutputModes are the commands -output=json works with
+const jsonOutputModes = "-stats, -search, -verify and -queue"
+
+// printJSON prints a command's result as indented JSON, for -output=json
+func printJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// printError prints an error message as fmt.Println does, or with asJSON as
+// a JSON object with the message under "error", so scripts reading the output
+// always get JSON
+func printError(asJSON bool, a ...any) {
+	if !asJSON {
+		fmt.Println(a...)
+		return
+	}
+	printJSON(map[string]string{"error": strings.TrimSuffix(fmt.Sprintln(a...), "\n")})
+}
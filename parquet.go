@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Parquet physical types, converted types and enum values used by the writer.
+// Only the small subset needed for scan records is defined here.
+const (
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMillis = 9
+
+	parquetRequired     = 0
+	parquetPlain        = 0
+	parquetRLE          = 3
+	parquetDataPage     = 0
+	parquetUncompressed = 0
+)
+
+// Thrift compact protocol field types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// parquetColumn describes one column of the exported schema along with its
+// PLAIN-encoded values.
+type parquetColumn struct {
+	name          string
+	physicalType  int
+	convertedType int // -1 when the column has no converted type
+	values        bytes.Buffer
+}
+
+// writeParquet writes the rows to filename as a single row group Parquet file.
+// Each row holds one value per named column. The timestamp column is stored as
+// a typed timestamp, daily_count as a 32-bit integer and all others as UTF-8
+// strings.
+func writeParquet(filename string, rows [][]string, names []string, location *time.Location) error {
+	var columns []*parquetColumn
+	for _, name := range names {
+		switch name {
+		case "timestamp":
+			columns = append(columns, &parquetColumn{name: name, physicalType: parquetInt64, convertedType: parquetConvertedTimestampMillis})
+		case "daily_count":
+			columns = append(columns, &parquetColumn{name: name, physicalType: parquetInt32, convertedType: -1})
+		default:
+			columns = append(columns, &parquetColumn{name: name, physicalType: parquetByteArray, convertedType: parquetConvertedUTF8})
+		}
+	}
+
+	for _, row := range rows {
+		for i, column := range columns {
+			value := row[i]
+			switch column.physicalType {
+			case parquetInt64:
+				recordTime, err := time.ParseInLocation("2006-01-02T15:04:05-07:00", value, location)
+				if err != nil {
+					return fmt.Errorf("parsing timestamp %q: %w", value, err)
+				}
+				binary.Write(&column.values, binary.LittleEndian, recordTime.UnixMilli())
+			case parquetInt32:
+				count := 0
+				if value != "" {
+					var err error
+					count, err = strconv.Atoi(value)
+					if err != nil {
+						return fmt.Errorf("parsing %s %q: %w", column.name, value, err)
+					}
+				}
+				binary.Write(&column.values, binary.LittleEndian, int32(count))
+			default:
+				binary.Write(&column.values, binary.LittleEndian, uint32(len(value)))
+				column.values.WriteString(value)
+			}
+		}
+	}
+
+	// The file starts with the magic number, followed by one data page per
+	// column. Required, non-nested columns need no repetition or definition
+	// levels, so each page holds only the PLAIN values.
+	var out bytes.Buffer
+	out.WriteString("PAR1")
+
+	var chunks bytes.Buffer
+	var totalSize int64
+	for _, column := range columns {
+		offset := int64(out.Len())
+
+		var header thriftWriter
+		header.fieldI32(1, parquetDataPage)
+		header.fieldI32(2, int32(column.values.Len()))
+		header.fieldI32(3, int32(column.values.Len()))
+		header.fieldStruct(5)
+		header.fieldI32(1, int32(len(rows)))
+		header.fieldI32(2, parquetPlain)
+		header.fieldI32(3, parquetRLE)
+		header.fieldI32(4, parquetRLE)
+		header.stop()
+		header.stop()
+
+		out.Write(header.buf.Bytes())
+		out.Write(column.values.Bytes())
+		size := int64(out.Len()) - offset
+		totalSize += size
+
+		// ColumnChunk with its ColumnMetaData, written as a standalone list
+		// element and copied into the footer below
+		var chunk thriftWriter
+		chunk.fieldI64(2, offset)
+		chunk.fieldStruct(3)
+		chunk.fieldI32(1, int32(column.physicalType))
+		chunk.fieldList(2, thriftI32, 1)
+		chunk.i32(parquetPlain)
+		chunk.fieldList(3, thriftBinary, 1)
+		chunk.binary(column.name)
+		chunk.fieldI32(4, parquetUncompressed)
+		chunk.fieldI64(5, int64(len(rows)))
+		chunk.fieldI64(6, size)
+		chunk.fieldI64(7, size)
+		chunk.fieldI64(9, offset)
+		chunk.stop()
+		chunk.stop()
+		chunks.Write(chunk.buf.Bytes())
+	}
+
+	// FileMetaData footer
+	var meta thriftWriter
+	meta.fieldI32(1, 1)
+	meta.fieldList(2, thriftStruct, len(columns)+1)
+	meta.beginStruct()
+	meta.fieldBinary(4, "schema")
+	meta.fieldI32(5, int32(len(columns)))
+	meta.stop()
+	for _, column := range columns {
+		meta.beginStruct()
+		meta.fieldI32(1, int32(column.physicalType))
+		meta.fieldI32(3, parquetRequired)
+		meta.fieldBinary(4, column.name)
+		if column.convertedType >= 0 {
+			meta.fieldI32(6, int32(column.convertedType))
+		}
+		meta.stop()
+	}
+	meta.fieldI64(3, int64(len(rows)))
+	meta.fieldList(4, thriftStruct, 1)
+	meta.beginStruct()
+	meta.fieldList(1, thriftStruct, len(columns))
+	meta.buf.Write(chunks.Bytes())
+	meta.fieldI64(2, totalSize)
+	meta.fieldI64(3, int64(len(rows)))
+	meta.stop()
+	meta.fieldBinary(6, "checkin")
+	meta.stop()
+
+	out.Write(meta.buf.Bytes())
+	binary.Write(&out, binary.LittleEndian, uint32(meta.buf.Len()))
+	out.WriteString("PAR1")
+
+	return os.WriteFile(filename, out.Bytes(), 0644)
+}
+
+// thriftWriter encodes structs using the Thrift compact protocol, which is
+// what Parquet uses for page headers and file metadata. Field IDs are tracked
+// per struct so nested structs must be closed with stop.
+type thriftWriter struct {
+	buf       bytes.Buffer
+	lastField []int16
+	current   int16
+}
+
+func (w *thriftWriter) fieldHeader(id int16, fieldType byte) {
+	delta := id - w.current
+	if delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta<<4) | fieldType)
+	} else {
+		w.buf.WriteByte(fieldType)
+		w.varint(uint64(uint16(id)<<1 ^ uint16(id>>15)))
+	}
+	w.current = id
+}
+
+func (w *thriftWriter) fieldI32(id int16, v int32) {
+	w.fieldHeader(id, thriftI32)
+	w.i32(v)
+}
+
+func (w *thriftWriter) fieldI64(id int16, v int64) {
+	w.fieldHeader(id, thriftI64)
+	w.varint(uint64(v<<1 ^ v>>63))
+}
+
+func (w *thriftWriter) fieldBinary(id int16, s string) {
+	w.fieldHeader(id, thriftBinary)
+	w.binary(s)
+}
+
+// fieldStruct opens a nested struct; it must be closed with stop.
+func (w *thriftWriter) fieldStruct(id int16) {
+	w.fieldHeader(id, thriftStruct)
+	w.beginStruct()
+}
+
+// beginStruct starts a struct that isn't introduced by a field header, such as
+// a list element. It must be closed with stop.
+func (w *thriftWriter) beginStruct() {
+	w.lastField = append(w.lastField, w.current)
+	w.current = 0
+}
+
+// fieldList writes a list header. Struct elements are written by calling
+// beginStruct, the field methods and stop for each element.
+func (w *thriftWriter) fieldList(id int16, elemType byte, size int) {
+	w.fieldHeader(id, thriftList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size<<4) | elemType)
+	} else {
+		w.buf.WriteByte(0xF0 | elemType)
+		w.varint(uint64(size))
+	}
+}
+
+// stop ends the current struct and restores the enclosing field ID.
+func (w *thriftWriter) stop() {
+	w.buf.WriteByte(0)
+	if n := len(w.lastField); n > 0 {
+		w.current = w.lastField[n-1]
+		w.lastField = w.lastField[:n-1]
+	}
+}
+
+func (w *thriftWriter) i32(v int32) {
+	w.varint(uint64(uint32(v<<1 ^ v>>31)))
+}
+
+func (w *thriftWriter) binary(s string) {
+	w.varint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	for v >= 0x80 {
+		w.buf.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	w.buf.WriteByte(byte(v))
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestThriftWriterEncodings(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w *thriftWriter)
+		want  []byte
+	}{
+		{"varint one byte", func(w *thriftWriter) { w.varint(1) }, []byte{0x01}},
+		{"varint two bytes", func(w *thriftWriter) { w.varint(300) }, []byte{0xAC, 0x02}},
+		{"i32 zero", func(w *thriftWriter) { w.i32(0) }, []byte{0x00}},
+		{"i32 positive zigzag", func(w *thriftWriter) { w.i32(1) }, []byte{0x02}},
+		{"i32 negative zigzag", func(w *thriftWriter) { w.i32(-1) }, []byte{0x01}},
+		{"i32 min", func(w *thriftWriter) { w.i32(-2147483648) }, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x0F}},
+		{"binary", func(w *thriftWriter) { w.binary("id") }, []byte{0x02, 'i', 'd'}},
+		{"field short delta", func(w *thriftWriter) { w.fieldI32(1, 3) }, []byte{0x15, 0x06}},
+		{"field deltas add up", func(w *thriftWriter) { w.fieldI32(1, 0); w.fieldI32(4, 0) }, []byte{0x15, 0x00, 0x35, 0x00}},
+		{"field long delta", func(w *thriftWriter) { w.fieldI32(16, 0) }, []byte{0x05, 0x20, 0x00}},
+		{"field going back", func(w *thriftWriter) { w.fieldI32(3, 0); w.fieldI32(2, 0) }, []byte{0x35, 0x00, 0x05, 0x04, 0x00}},
+		{"i64 field", func(w *thriftWriter) { w.fieldI64(2, -2) }, []byte{0x26, 0x03}},
+		{"i64 large", func(w *thriftWriter) { w.fieldI64(1, 1<<40) }, []byte{0x16, 0x80, 0x80, 0x80, 0x80, 0x80, 0x40}},
+		{"binary field", func(w *thriftWriter) { w.fieldBinary(4, "a") }, []byte{0x48, 0x01, 'a'}},
+		{"short list", func(w *thriftWriter) { w.fieldList(2, thriftI32, 14) }, []byte{0x29, 0xE5}},
+		{"long list", func(w *thriftWriter) { w.fieldList(2, thriftStruct, 15) }, []byte{0x29, 0xFC, 0x0F}},
+		{
+			"nested struct restores field ID",
+			func(w *thriftWriter) {
+				w.fieldI32(1, 0)
+				w.fieldStruct(5)
+				w.fieldI32(1, 0)
+				w.stop()
+				w.fieldI32(6, 0)
+				w.stop()
+			},
+			[]byte{0x15, 0x00, 0x4C, 0x15, 0x00, 0x00, 0x15, 0x00, 0x00},
+		},
+		{
+			"list elements start their own field IDs",
+			func(w *thriftWriter) {
+				w.fieldList(2, thriftStruct, 2)
+				for i := 0; i < 2; i++ {
+					w.beginStruct()
+					w.fieldI32(3, 0)
+					w.stop()
+				}
+				w.fieldI32(3, 0)
+			},
+			[]byte{0x29, 0x2C, 0x35, 0x00, 0x00, 0x35, 0x00, 0x00, 0x15, 0x00},
+		},
+	}
+	for _, test := range tests {
+		var w thriftWriter
+		test.write(&w)
+		if got := w.buf.Bytes(); !bytes.Equal(got, test.want) {
+			t.Errorf("%s: got % x, want % x", test.name, got, test.want)
+		}
+	}
+}
+
+// thriftReader decodes the Thrift compact protocol subset thriftWriter
+// writes, with structs as their fields by ID
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) varint() uint64 {
+	value, n := binary.Uvarint(r.data[r.pos:])
+	r.pos += n
+	return value
+}
+
+func (r *thriftReader) value(fieldType byte) any {
+	switch fieldType {
+	case thriftI32:
+		v := uint32(r.varint())
+		return int32(v>>1) ^ -int32(v&1)
+	case thriftI64:
+		v := r.varint()
+		return int64(v>>1) ^ -int64(v&1)
+	case thriftBinary:
+		n := int(r.varint())
+		s := string(r.data[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case thriftList:
+		header := r.data[r.pos]
+		r.pos++
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.varint())
+		}
+		list := make([]any, size)
+		for i := range list {
+			list[i] = r.value(header & 0x0F)
+		}
+		return list
+	case thriftStruct:
+		return r.structFields()
+	}
+	panic("unexpected thrift type")
+}
+
+func (r *thriftReader) structFields() map[int16]any {
+	fields := make(map[int16]any)
+	var id int16
+	for {
+		header := r.data[r.pos]
+		r.pos++
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			v := uint16(r.varint())
+			id = int16(v>>1) ^ -int16(v&1)
+		}
+		fields[id] = r.value(header & 0x0F)
+	}
+}
+
+func TestWriteParquet(t *testing.T) {
+	rows := [][]string{
+		{"2026-03-02T09:15:00-05:00", "00123", "1"},
+		{"2026-03-02T09:16:30-05:00", "00456", ""},
+	}
+	names := []string{"timestamp", "id", "daily_count"}
+	filename := filepath.Join(t.TempDir(), "scans.parquet")
+	if err := writeParquet(filename, rows, names, time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatalf("file doesn't start and end with PAR1")
+	}
+	footerSize := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &thriftReader{data: data[len(data)-8-footerSize : len(data)-8]}
+	meta := footer.structFields()
+	if footer.pos != footerSize {
+		t.Fatalf("footer decoded to %d of %d bytes", footer.pos, footerSize)
+	}
+
+	if meta[1] != int32(1) || meta[3] != int64(len(rows)) || meta[6] != "checkin" {
+		t.Errorf("file metadata version %v, rows %v, created by %v", meta[1], meta[3], meta[6])
+	}
+	schema := meta[2].([]any)
+	if len(schema) != len(names)+1 {
+		t.Fatalf("schema has %d elements, want %d", len(schema), len(names)+1)
+	}
+	if root := schema[0].(map[int16]any); root[4] != "schema" || root[5] != int32(len(names)) {
+		t.Errorf("schema root %v", root)
+	}
+	wantTypes := []struct {
+		physical  int32
+		converted any
+	}{
+		{parquetInt64, int32(parquetConvertedTimestampMillis)},
+		{parquetByteArray, int32(parquetConvertedUTF8)},
+		{parquetInt32, nil},
+	}
+	for i, want := range wantTypes {
+		element := schema[i+1].(map[int16]any)
+		if element[4] != names[i] || element[1] != want.physical || element[3] != int32(parquetRequired) || element[6] != want.converted {
+			t.Errorf("schema element %d: %v", i+1, element)
+		}
+	}
+
+	groups := meta[4].([]any)
+	if len(groups) != 1 {
+		t.Fatalf("%d row groups, want 1", len(groups))
+	}
+	group := groups[0].(map[int16]any)
+	if group[3] != int64(len(rows)) {
+		t.Errorf("row group has %v rows", group[3])
+	}
+	chunks := group[1].([]any)
+	var values [][]byte
+	var total int64
+	for i, c := range chunks {
+		chunk := c.(map[int16]any)
+		columnMeta := chunk[3].(map[int16]any)
+		offset := chunk[2].(int64)
+		if columnMeta[9] != offset || columnMeta[5] != int64(len(rows)) {
+			t.Errorf("column %d metadata %v", i, columnMeta)
+		}
+		if path := columnMeta[3].([]any); len(path) != 1 || path[0] != names[i] {
+			t.Errorf("column %d path %v", i, path)
+		}
+		page := &thriftReader{data: data[offset:]}
+		header := page.structFields()
+		size := int(header[2].(int32))
+		if header[1] != int32(parquetDataPage) || header[3] != int32(size) {
+			t.Errorf("column %d page header %v", i, header)
+		}
+		if dataPage := header[5].(map[int16]any); dataPage[1] != int32(len(rows)) || dataPage[2] != int32(parquetPlain) {
+			t.Errorf("column %d data page header %v", i, dataPage)
+		}
+		if int64(page.pos+size) != columnMeta[6] {
+			t.Errorf("column %d is %d bytes, metadata says %v", i, page.pos+size, columnMeta[6])
+		}
+		total += columnMeta[6].(int64)
+		values = append(values, data[int(offset)+page.pos:int(offset)+page.pos+size])
+	}
+	if group[2] != total {
+		t.Errorf("row group total size %v, columns add up to %d", group[2], total)
+	}
+
+	first, _ := time.Parse(time.RFC3339, rows[0][0])
+	second, _ := time.Parse(time.RFC3339, rows[1][0])
+	var wantTimestamps bytes.Buffer
+	binary.Write(&wantTimestamps, binary.LittleEndian, []int64{first.UnixMilli(), second.UnixMilli()})
+	wantIDs := []byte{5, 0, 0, 0, '0', '0', '1', '2', '3', 5, 0, 0, 0, '0', '0', '4', '5', '6'}
+	wantCounts := []byte{1, 0, 0, 0, 0, 0, 0, 0}
+	for i, want := range [][]byte{wantTimestamps.Bytes(), wantIDs, wantCounts} {
+		if !bytes.Equal(values[i], want) {
+			t.Errorf("column %s values % x, want % x", names[i], values[i], want)
+		}
+	}
+}
+
+func TestWriteParquetRejectsBadValues(t *testing.T) {
+	tests := []struct {
+		name string
+		row  []string
+	}{
+		{"bad timestamp", []string{"2026-03-02 09:15", "1", "1"}},
+		{"bad count", []string{"2026-03-02T09:15:00-05:00", "1", "one"}},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(t.TempDir(), "scans.parquet")
+		if err := writeParquet(filename, [][]string{test.row}, []string{"timestamp", "id", "daily_count"}, time.UTC); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
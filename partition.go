@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// partitioned is set by -partition=monthly. Scan mode then records to one
+// file per month named after the data file, e.g. scans-2025-03.csv for
+// scans.csv, and the other modes read every month's file in order, after any
+// records left in the data file itself from before partitioning.
+var partitioned bool
+
+// partitionFile returns the data file partition holding records from t's month
+func partitionFile(t time.Time) string {
+	ext := filepath.Ext(dataFile)
+	return strings.TrimSuffix(dataFile, ext) + "-" + t.Format("2006-01") + ext
+}
+
+// currentDataFile returns the file scan mode records to right now
+func currentDataFile() string {
+	if !partitioned {
+		return dataFile
+	}
+	return partitionFile(time.Now())
+}
+
+// dataName describes where the records are kept, for messages
+func dataName() string {
+	if !partitioned {
+		return dataFile
+	}
+	return "the monthly files of " + dataFile
+}
+
+// dataFiles returns the files holding the records, oldest first. Without
+// partitioning that is just the data file, whether or not it exists.
+func dataFiles() ([]string, error) {
+	if !partitioned {
+		return []string{dataFile}, nil
+	}
+
+	var files []string
+	if _, err := os.Stat(dataFile); err == nil {
+		files = append(files, dataFile)
+	}
+	ext := filepath.Ext(dataFile)
+	partitions, err := filepath.Glob(strings.TrimSuffix(dataFile, ext) + "-[0-9][0-9][0-9][0-9]-[0-9][0-9]" + ext)
+	if err != nil {
+		return nil, err
+	}
+	// Glob sorts the names, which sorts the months
+	return append(files, partitions...), nil
+}
+
+// dataReader reads the records of every data file as one stream, so line
+// numbers count through the history, archives and partitions in order
+type dataReader struct {
+	io.Reader
+	files   []*os.File
+	readers []io.Reader
+}
+
+// add opens a data file, or a gzipped one, as the next part of the stream
+func (d *dataReader) add(name string, compressed bool) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	d.files = append(d.files, file)
+	if compressed {
+		records, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", name, err)
+		}
+		d.readers = append(d.readers, records)
+		return nil
+	}
+	d.readers = append(d.readers, file)
+
+	// End a file missing its final newline so its last line isn't joined
+	// to the first line of the next
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			d.readers = append(d.readers, bytes.NewReader([]byte("\n")))
+		}
+	}
+	return nil
+}
+
+// Close closes every data file
+func (d *dataReader) Close() error {
+	for _, file := range d.files {
+		file.Close()
+	}
+	return nil
+}
+
+// openDataFiles opens the records for reading, starting with the history
+// files and then the archived ones when includeArchives is set. Without
+// partitioning, history or archives it opens the data file itself; otherwise
+// it fails as a missing file when no partitions exist yet.
+func openDataFiles() (io.ReadCloser, error) {
+	return openRecords(includeArchives)
+}
+
+// openRecords opens the records for reading as openDataFiles does, starting
+// with the archived ones when archives is set
+func openRecords(archives bool) (io.ReadCloser, error) {
+	if !partitioned && !archives && len(historySources) == 0 {
+		return os.Open(dataFile)
+	}
+
+	names, err := dataFiles()
+	if err != nil {
+		return nil, err
+	}
+	var archived []string
+	if archives {
+		if archived, err = archiveFiles(); err != nil {
+			return nil, err
+		}
+	}
+	history, err := historyFiles(append(names, archived...))
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 && len(history) == 0 {
+		return nil, &os.PathError{Op: "open", Path: partitionFile(time.Now()), Err: os.ErrNotExist}
+	}
+
+	d := &dataReader{}
+	for _, name := range history {
+		if err := d.add(name, strings.HasSuffix(name, ".gz")); err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	for _, name := range archived {
+		if err := d.add(name, true); err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	for _, name := range names {
+		if _, err := os.Stat(name); os.IsNotExist(err) && len(history) > 0 {
+			continue // only history so far, as on a reporting machine
+		}
+		if err := d.add(name, false); err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	d.Reader = io.MultiReader(d.readers...)
+	return d, nil
+}
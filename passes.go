@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+// dayPassDigits is the number of random digits after the prefix in issued
+// day-pass IDs
+const dayPassDigits = 6
+
+// dayPass is a temporary guest ID from the passes file, valid from the first
+// to the last date inclusive
+type dayPass struct {
+	ID, Name    string
+	First, Last string // YYYY-MM-DD
+}
+
+// passesConfig is the config file's "passes" section
+type passesConfig struct {
+	File   string `json:"file"`   // defaults to passes.csv
+	Prefix string `json:"prefix"` // digits every pass ID starts with, default 77
+}
+
+// path returns the passes file
+func (settings passesConfig) path() string {
+	if settings.File == "" {
+		return "passes.csv"
+	}
+	return settings.File
+}
+
+// loadPasses reads the passes file, whose rows are
+// id,name,first_date,last_date,issued_at. A missing file means no passes.
+func loadPasses(path string) (map[string]dayPass, error) {
+	passes := make(map[string]dayPass)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return passes, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if len(row) < 4 {
+			continue
+		}
+		passes[row[0]] = dayPass{ID: row[0], Name: row[1], First: row[2], Last: row[3]}
+	}
+	return passes, nil
+}
+
+// validOn reports whether the pass can be used at t
+func (pass dayPass) validOn(t time.Time) bool {
+	date := t.Format("2006-01-02")
+	return date >= pass.First && date <= pass.Last
+}
+
+// runIssuePassMode issues a day pass for a guest, valid from the first to the
+// last date (YYYY-MM-DD, the last may be empty for a single day), and prints
+// its ID. Pass IDs never collide with roster IDs or earlier passes.
+func runIssuePassMode(settings passesConfig, guest, first, last, rosterFile string) {
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+	path, prefix := settings.path(), settings.Prefix
+	if prefix == "" {
+		prefix = "77"
+	}
+	passes, err := loadPasses(path)
+	if err != nil {
+		fmt.Println("Error reading passes:", err)
+		return
+	}
+
+	if last == "" {
+		last = first
+	}
+	if _, err := time.Parse("2006-01-02", first); err != nil {
+		fmt.Println("Error parsing start date:", err)
+		return
+	}
+	if _, err := time.Parse("2006-01-02", last); err != nil || last < first {
+		fmt.Println("Error: End date must be a date on or after the start date.")
+		return
+	}
+
+	var id string
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(dayPassDigits), nil)
+	for id == "" || passes[id].ID != "" || roster[id].ID != "" {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			fmt.Println("Error generating pass ID:", err)
+			return
+		}
+		id = fmt.Sprintf("%s%0*d", prefix, dayPassDigits, n)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Println("Error opening passes file:", err)
+		return
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	writer.Write([]string{id, guest, first, last, time.Now().Format("2006-01-02T15:04:05-07:00")})
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		fmt.Println("Error writing passes file:", err)
+		return
+	}
+
+	if last == first {
+		fmt.Printf("Issued day pass %s for %s, valid on %s.\n", id, guest, first)
+	} else {
+		fmt.Printf("Issued day pass %s for %s, valid %s to %s.\n", id, guest, first, last)
+	}
+}
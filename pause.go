@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPauseReasons are the reason codes a pause can give when the config
+// doesn't list its own
+var defaultPauseReasons = []string{"lunch", "break", "incident", "cleaning"}
+
+// defaultPauseMessage is shown for scans while the station is paused when
+// the config doesn't say
+const defaultPauseMessage = "Check-in is paused. Please wait, a staff member will be right back."
+
+// pauseConfig is the config file's "pause" section for scan mode's pause
+// command. Staff type "pause <reason>" at the prompt, optionally followed by
+// a note, to refuse scans for a while, and "resume" to take them again. The
+// pause is logged to the pauses file with its reason, so a gap in the
+// records can be explained later with -pauses.
+type pauseConfig struct {
+	Reasons []string `json:"reasons"` // reason codes a pause must give; default lunch, break, incident and cleaning
+	Message string   `json:"message"` // shown for scans while paused
+}
+
+// reasons returns the reason codes a pause can give
+func (settings pauseConfig) reasons() []string {
+	if len(settings.Reasons) > 0 {
+		return settings.Reasons
+	}
+	return defaultPauseReasons
+}
+
+// checkPause validates the pause reason codes
+func checkPause(settings pauseConfig) error {
+	for _, reason := range settings.Reasons {
+		if reason == "" || strings.ContainsAny(reason, " ,") {
+			return fmt.Errorf("pause: reason %q must be one word", reason)
+		}
+	}
+	return nil
+}
+
+// scanPause is a pause in progress at a scan station
+type scanPause struct {
+	Reason  string
+	Note    string
+	Started time.Time
+}
+
+// parsePauseCommand reads a line typed at the scan prompt as "pause <reason>
+// [note]" or "resume", returning the command and, for a pause, the reason
+// and note. ok is false for anything else, such as a badge.
+func parsePauseCommand(line string) (command, reason, note string, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", "", "", false
+	}
+	switch command = strings.ToLower(fields[0]); command {
+	case "pause":
+		if len(fields) > 1 {
+			reason = strings.ToLower(fields[1])
+		}
+		if len(fields) > 2 {
+			note = strings.Join(fields[2:], " ")
+		}
+		return command, reason, note, true
+	case "resume":
+		return command, "", "", len(fields) == 1
+	}
+	return "", "", "", false
+}
+
+// startPause starts refusing scans for the reason, returning the pause, or
+// nil when the reason isn't one of the configured codes
+func (options scanOptions) startPause(reason, note string, now time.Time) *scanPause {
+	if !contains(options.Pause.reasons(), reason) {
+		fmt.Printf("Usage: pause <reason> [note], with the reason one of %s.\n", strings.Join(options.Pause.reasons(), ", "))
+		return nil
+	}
+	text := "Paused for " + reason
+	if note != "" {
+		text += " (" + note + ")"
+	}
+	options.logNotice("pause", text+" at "+now.Format("15:04")+"; scans are refused until 'resume'")
+	options.Heartbeat.paused(reason)
+	return &scanPause{Reason: reason, Note: note, Started: now}
+}
+
+// refusePaused tells the person scanning that the station is paused
+func (options scanOptions) refusePaused(barcodeID string, started time.Time) {
+	message := options.Pause.Message
+	if message == "" {
+		message = defaultPauseMessage
+	}
+	options.announce(announceError, message+" Not recorded.", message)
+	playSound(options.SoundCommand, options.Theme.DuplicateSound)
+	options.logScan("paused", barcodeID, nil, started)
+}
+
+// endPause takes scans again after a pause and logs its window to the
+// pauses file. Dry runs don't write the file.
+func (options scanOptions) endPause(pause *scanPause, now time.Time) {
+	minutes := int(now.Sub(pause.Started).Minutes())
+	options.logNotice("pause", fmt.Sprintf("Resumed after %d minutes paused for %s", minutes, pause.Reason))
+	options.Heartbeat.paused("")
+	if options.DryRun {
+		return
+	}
+	row := []string{pause.Started.Format("2006-01-02T15:04:05-07:00"), now.Format("2006-01-02T15:04:05-07:00"),
+		strconv.Itoa(minutes), options.Station, pause.Reason, pause.Note}
+	if err := appendCSV(sidecarFile("pauses"), row); err != nil {
+		options.logError("Error writing pauses file", err)
+	}
+}
+
+// runPausesMode lists the pauses scan stations logged from first to last
+// (YYYY-MM-DD, inclusive), with the minutes paused for each reason, and
+// saves the list as a CSV in dir
+func runPausesMode(first, last, dir string) {
+	file, err := os.Open(sidecarFile("pauses"))
+	if os.IsNotExist(err) {
+		fmt.Println("No pauses have been logged.")
+		return
+	} else if err != nil {
+		fmt.Println("Error opening pauses file:", err)
+		return
+	}
+	records, _, _ := readDelimitedRecords(file, ',')
+	file.Close()
+	sort.SliceStable(records, func(i, j int) bool { return records[i][0] < records[j][0] })
+
+	rows := [][]string{{"started", "ended", "minutes", "station", "reason", "note"}}
+	byReason := make(map[string]int)
+	var reasons []string
+	fmt.Printf("  %-25s  %-8s %7s  %-16s %-10s %s\n", "started", "ended", "minutes", "station", "reason", "note")
+	for _, row := range records {
+		for len(row) < 6 {
+			row = append(row, "")
+		}
+		if date := row[0][:10]; date < first || date > last {
+			continue
+		}
+		ended := row[1]
+		if len(ended) >= 19 {
+			ended = ended[11:19]
+		}
+		fmt.Printf("  %-25s  %-8s %7s  %-16s %-10s %s\n", row[0], ended, row[2], row[3], row[4], row[5])
+		rows = append(rows, row[:6])
+		if _, ok := byReason[row[4]]; !ok {
+			reasons = append(reasons, row[4])
+		}
+		minutes, _ := strconv.Atoi(row[2])
+		byReason[row[4]] += minutes
+	}
+	if len(rows) == 1 {
+		fmt.Println("No pauses found for the specified date range.")
+		return
+	}
+	sort.Strings(reasons)
+	fmt.Printf("\n%d pauses:", len(rows)-1)
+	for i, reason := range reasons {
+		if i > 0 {
+			fmt.Print(",")
+		}
+		fmt.Printf(" %s %d minutes", reason, byReason[reason])
+	}
+	fmt.Println(".")
+
+	filename := "pauses_" + first + "_" + last + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving pauses report:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving pauses report:", err)
+		return
+	}
+	fmt.Println("\nSaved to", filename)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pickupConfig is the config file's "pickup" section. With it enabled, a
+// station checking children out asks who is collecting each one and only
+// records the check-out for an authorized adult: one of the child's
+// caregivers (linked with -link -relation=caregiver) or a name in the
+// roster's pickup column, separated by ";", for adults without a badge.
+// Every pickup and refused attempt is logged to the pickups sidecar file,
+// e.g. scans.pickups.csv, and listed by -pickups.
+type pickupConfig struct {
+	Enabled bool     `json:"enabled"`
+	Types   []string `json:"types"`  // record types checked, e.g. ["member"]; empty for anyone with an authorized adult on file
+	Column  string   `json:"column"` // roster column of authorized names; default pickup
+}
+
+// pickupPerson is an adult authorized to collect a child
+type pickupPerson struct {
+	ID   string // roster ID of a caregiver, empty for a name in the pickup column
+	Name string
+}
+
+// label returns how the person is shown and logged
+func (p pickupPerson) label() string {
+	if p.ID == "" {
+		return p.Name
+	}
+	return p.Name + " (" + p.ID + ")"
+}
+
+// authorizedPickups returns the adults authorized to collect a child
+func (settings pickupConfig) authorizedPickups(roster map[string]rosterEntry, child string) []pickupPerson {
+	var people []pickupPerson
+	entry := roster[child]
+	for _, id := range splitIDs(strings.ReplaceAll(entry.Fields["caregivers"], ";", ",")) {
+		people = append(people, pickupPerson{ID: id, Name: rosterName(roster, id)})
+	}
+	column := settings.Column
+	if column == "" {
+		column = "pickup"
+	}
+	for _, name := range strings.Split(entry.Fields[strings.ToLower(column)], ";") {
+		if name = strings.TrimSpace(name); name != "" {
+			people = append(people, pickupPerson{Name: name})
+		}
+	}
+	return people
+}
+
+// confirmPickup asks who is collecting a child being checked out, reading
+// the answer with read: the number of an authorized adult, their badge or
+// their name. It returns the adult, and false when the check-out must not be
+// recorded because no authorized adult was given. Refused attempts are
+// logged and flagged at the station.
+func (options scanOptions) confirmPickup(read func() (string, error), child, recordType string, now time.Time) (pickupPerson, bool) {
+	settings := options.Pickup
+	if !settings.Enabled || options.Direction != "out" {
+		return pickupPerson{}, true
+	}
+	people := settings.authorizedPickups(options.Roster, child)
+	if len(settings.Types) > 0 && !contains(settings.Types, recordType) || len(settings.Types) == 0 && len(people) == 0 {
+		return pickupPerson{}, true
+	}
+	name := rosterName(options.Roster, child)
+	if name == "" {
+		name = child
+	}
+	if len(people) == 0 {
+		options.announce(announceError, fmt.Sprintf("PICKUP: no authorized adult is on file for %s. Not checked out; please see a staff member.", name),
+			"No one is authorized to collect this child. Please see a staff member.")
+		playSound(options.SoundCommand, options.Theme.DuplicateSound)
+		options.logPickup(now, child, pickupPerson{}, "no_authorized_adult")
+		return pickupPerson{}, false
+	}
+
+	var choices []string
+	for i, person := range people {
+		if !options.jsonLogs() {
+			fmt.Printf("  %d) %s\n", i+1, person.label())
+		}
+		choices = append(choices, fmt.Sprintf("%d, %s", i+1, person.Name))
+	}
+	options.announce(announceInfo, fmt.Sprintf("Who is collecting %s? Type the number, scan their badge or type their name.", name),
+		fmt.Sprintf("Who is collecting %s? %s.", name, strings.Join(choices, "; ")))
+	if !options.jsonLogs() {
+		fmt.Print("Collected by: ")
+	}
+	line, err := read()
+	answer := strings.TrimSpace(line)
+	if answer == "" || strings.EqualFold(answer, "n") {
+		if err == nil || answer != "" {
+			options.announce(announceInfo, "Check-out cancelled.", "Check-out cancelled.")
+		}
+		return pickupPerson{}, false
+	}
+
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(people) {
+		options.logPickup(now, child, people[n-1], "authorized")
+		return people[n-1], true
+	}
+	for _, person := range people {
+		if person.ID != "" && person.ID == answer || person.ID == "" && strings.EqualFold(person.Name, answer) {
+			options.logPickup(now, child, person, "authorized")
+			return person, true
+		}
+	}
+
+	attempt := pickupPerson{Name: answer}
+	if barcodePattern.MatchString(answer) {
+		attempt = pickupPerson{ID: answer, Name: rosterName(options.Roster, answer)}
+	}
+	options.announce(announceError, fmt.Sprintf("UNAUTHORIZED PICKUP: %s is not authorized to collect %s. Not checked out; please see a staff member.", attempt.label(), name),
+		"This person is not authorized to collect this child. Please see a staff member.")
+	playSound(options.SoundCommand, options.Theme.DuplicateSound)
+	options.logPickup(now, child, attempt, "unauthorized")
+	return pickupPerson{}, false
+}
+
+// logPickup appends a pickup or refused attempt to the pickups sidecar file
+// as timestamp,child,adult_id,adult_name,outcome,station. Dry runs log
+// nothing.
+func (options scanOptions) logPickup(now time.Time, child string, person pickupPerson, outcome string) {
+	if options.DryRun {
+		return
+	}
+	row := []string{now.Format("2006-01-02T15:04:05-07:00"), child, person.ID, person.Name, outcome, options.Station}
+	if err := appendCSV(sidecarFile("pickups"), row); err != nil {
+		options.logError("Error writing pickups file", err)
+	}
+}
+
+// runPickupsMode lists the pickups and refused attempts from first to last
+// (YYYY-MM-DD, inclusive), refused ones flagged, and saves them as a CSV in
+// dir
+func runPickupsMode(roster map[string]rosterEntry, first, last, dir string) {
+	file, err := os.Open(sidecarFile("pickups"))
+	if os.IsNotExist(err) {
+		fmt.Println("No pickups have been recorded.")
+		return
+	} else if err != nil {
+		fmt.Println("Error opening pickups file:", err)
+		return
+	}
+	records, _, _ := readDelimitedRecords(file, ',')
+	file.Close()
+	sort.SliceStable(records, func(i, j int) bool { return records[i][0] < records[j][0] })
+
+	rows := [][]string{{"timestamp", "child_id", "child", "adult_id", "adult", "outcome", "station"}}
+	refused := 0
+	for _, row := range records {
+		for len(row) < 6 {
+			row = append(row, "")
+		}
+		if date := row[0][:10]; date < first || date > last {
+			continue
+		}
+		flag := " "
+		if row[4] != "authorized" {
+			flag = "!"
+			refused++
+		}
+		adult := pickupPerson{ID: row[2], Name: row[3]}
+		fmt.Printf("%s %s  %-28s %-32s %s\n", flag, row[0], rosterName(roster, row[1])+" ("+row[1]+")", adult.label(), row[4])
+		rows = append(rows, []string{row[0], row[1], rosterName(roster, row[1]), row[2], row[3], row[4], row[5]})
+	}
+	if len(rows) == 1 {
+		fmt.Println("No pickups found for the specified date range.")
+		return
+	}
+	fmt.Printf("\n%d pickups, %d refused.\n", len(rows)-1-refused, refused)
+
+	filename := "pickups_" + first + "_" + last + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving pickups report:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving pickups report:", err)
+		return
+	}
+	fmt.Println("\nSaved to", filename)
+}
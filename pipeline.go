@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sync"
+)
+
+// scanPipelineDepth is how many scanner reads, or recorded scans' follow-up
+// work, can wait while scan mode is busy before the stage feeding them blocks
+const scanPipelineDepth = 64
+
+// scanRead is one line read from the scanner, with the error that ended the
+// input after it, if any
+type scanRead struct {
+	Line string
+	Err  error
+}
+
+// stdinReads are the lines read from standard input. One goroutine reads it
+// for the whole process, so when the supervisor restarts scan mode the new
+// run gets the next line instead of a reader left over from the old one.
+var (
+	stdinReads     <-chan scanRead
+	stdinReadsOnce sync.Once
+)
+
+// readScans reads lines from the scanner on their own goroutine, so badges
+// presented while the station is still saving the scan before are taken off
+// the device straight away and processed in order. The channel is closed
+// after the read that ends the input.
+func readScans(source io.Reader) <-chan scanRead {
+	reads := make(chan scanRead, scanPipelineDepth)
+	go func() {
+		defer close(reads)
+		input := bufio.NewReader(source)
+		for {
+			line, err := input.ReadString('\n')
+			reads <- scanRead{line, err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return reads
+}
+
+// scanReads returns the reads from the scan mode input: standard input's
+// shared reader, or a new reader for an evdev device
+func scanReads(source io.Reader, device string) <-chan scanRead {
+	if device != "" {
+		return readScans(source)
+	}
+	stdinReadsOnce.Do(func() { stdinReads = readScans(source) })
+	return stdinReads
+}
+
+// nextRead returns the next line from the reads, or io.EOF once they end
+func nextRead(reads <-chan scanRead) (string, error) {
+	read, ok := <-reads
+	if !ok {
+		return "", io.EOF
+	}
+	return read.Line, read.Err
+}
+
+// scanFollowUps runs the work after a scan is recorded that the next scan
+// doesn't depend on, such as the sidecar files, the door relay, guardian
+// texts and the hooks. It runs in order on one goroutine, so a slow SD card,
+// relay or gateway never holds up the prompt.
+type scanFollowUps struct {
+	jobs chan func()
+	done chan struct{}
+}
+
+// startScanFollowUps starts the goroutine running the follow-up work. A job
+// that panics is reported through logError with its stack trace, and the jobs
+// after it still run, so a bad hook can't take the station down.
+func startScanFollowUps(logError func(string, error)) *scanFollowUps {
+	f := &scanFollowUps{jobs: make(chan func(), scanPipelineDepth), done: make(chan struct{})}
+	run := func(job func()) {
+		defer func() {
+			if r := recover(); r != nil {
+				logError("Error after recording a scan", fmt.Errorf("panic: %v\n%s", r, debug.Stack()))
+			}
+		}()
+		job()
+	}
+	go func() {
+		defer close(f.done)
+		for job := range f.jobs {
+			run(job)
+		}
+	}()
+	return f
+}
+
+// add queues follow-up work. The job must not use anything the scan loop
+// changes afterwards, such as the roster, so callers copy what it needs.
+func (f *scanFollowUps) add(job func()) {
+	f.jobs <- job
+}
+
+// wait runs the work still queued and stops the goroutine, for when scan
+// mode exits
+func (f *scanFollowUps) wait() {
+	close(f.jobs)
+	<-f.done
+}
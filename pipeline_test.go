@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestScanFollowUpsRecoverFromPanics(t *testing.T) {
+	var logged []error
+	followUps := startScanFollowUps(func(message string, err error) { logged = append(logged, err) })
+	ran := false
+	followUps.add(func() { panic("hook failed") })
+	followUps.add(func() { ran = true })
+	followUps.wait()
+	if len(logged) != 1 {
+		t.Errorf("%d errors logged, want 1", len(logged))
+	}
+	if !ran {
+		t.Errorf("the job after the panic didn't run")
+	}
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// grabDevice takes exclusive access to an evdev device, so its key presses
+// don't also reach the focused window
+func grabDevice(file *os.File) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), evioCGrab, 1); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// freeDiskBytes returns the space available to unprivileged users on the disk
+// holding dir
+func freeDiskBytes(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+// usersPolicyFile holds the roles of login names, at a path users can't
+// override; it should be writable only by root
+const usersPolicyFile = "/etc/checkin/users.json"
@@ -0,0 +1,35 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// grabDevice is for Linux evdev devices, which Windows doesn't have; a
+// keyboard-mode scanner types into the focused window there
+func grabDevice(file *os.File) error {
+	return errors.New("reading a HID scanner as a device needs Linux; leave -hid-device unset on Windows")
+}
+
+// freeDiskBytes returns the space available to the user on the disk holding
+// dir
+func freeDiskBytes(dir string) (uint64, error) {
+	name, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	proc := syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+	if ok, _, err := proc.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(&free)), 0, 0); ok == 0 {
+		return 0, err
+	}
+	return free, nil
+}
+
+// usersPolicyFile holds the roles of login names, at a path users can't
+// override; it should be writable only by administrators
+const usersPolicyFile = `C:\ProgramData\checkin\users.json`
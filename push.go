@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxPushRecords is the most records one push request may carry
+const maxPushRecords = 1000
+
+// pushConfig is the config file's "push" section: another checkin instance,
+// such as the central office's, that -push sends exported records to
+type pushConfig struct {
+	URL     string `json:"url"`     // the other instance's -serve address, e.g. "https://checkin.example.org"
+	Token   string `json:"token"`   // an admin API token on the other instance
+	Station string `json:"station"` // this site's name in the other instance's pushes file; default the host name
+}
+
+// pushRequest is the body of a POST to /api/records
+type pushRequest struct {
+	Station string   `json:"station"`
+	Records []Record `json:"records"`
+}
+
+// pushResult is the outcome of one pushed record: recorded, already_received
+// or invalid
+type pushResult struct {
+	ScanID string `json:"scan_id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// pushScanID returns the ID a record is pushed under: its scan ID, or for
+// records from before scan IDs one derived from the station, timestamp, ID
+// and direction, so pushing the same records again never duplicates them
+func pushScanID(station string, record []string) string {
+	if scanID := recordScanID(record); scanID != "" {
+		return scanID
+	}
+	sum := sha256.Sum256([]byte(station + "," + mergeKey(record)))
+	b := sum[:16]
+	b[6] = b[6]&0x0f | 0x50
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// newPushRequest builds the POST sending one batch of records
+func newPushRequest(settings pushConfig, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest("POST", strings.TrimSuffix(settings.URL, "/")+"/api/records", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+settings.Token)
+	return req, nil
+}
+
+// pushRecords sends records to the instance in the push settings, in
+// batches of maxPushRecords. A batch that can't be sent goes through the
+// delivery queue; the other instance acknowledges records it already has, so
+// a retried batch never records them twice.
+func pushRecords(settings pushConfig, records [][]string, parent *span) {
+	if settings.URL == "" {
+		fmt.Println("Error pushing export: the config file has no push url.")
+		return
+	}
+	station := settings.Station
+	if station == "" {
+		station = defaultStation()
+	}
+	counts := make(map[string]int)
+	queued := 0
+	for start := 0; start < len(records); start += maxPushRecords {
+		end := min(start+maxPushRecords, len(records))
+		batch := pushRequest{Station: station}
+		for _, fields := range records[start:end] {
+			record, err := parseRecord(fields)
+			if err != nil {
+				counts["invalid"]++
+				continue
+			}
+			record.ScanID = pushScanID(station, fields)
+			record.Station = station
+			batch.Records = append(batch.Records, record)
+		}
+		body, err := json.Marshal(batch)
+		if err != nil {
+			fmt.Println("Error pushing export:", err)
+			return
+		}
+		results, err := sendPush(settings, body, parent)
+		if err != nil {
+			fmt.Println("Error pushing export, queued to retry (see -queue=status):", err)
+			if req, err := newPushRequest(settings, body); err == nil {
+				queueRequest("push", req)
+			}
+			queued += len(batch.Records)
+			continue
+		}
+		for _, result := range results {
+			counts[result.Status]++
+		}
+	}
+	fmt.Printf("Pushed to %s: %d recorded, %d already there", settings.URL, counts["recorded"], counts["already_received"])
+	if counts["invalid"] > 0 {
+		fmt.Printf(", %d invalid", counts["invalid"])
+	}
+	if queued > 0 {
+		fmt.Printf(", %d queued", queued)
+	}
+	fmt.Println()
+}
+
+// sendPush posts one batch and returns the other instance's result for each
+// record
+func sendPush(settings pushConfig, body []byte, parent *span) ([]pushResult, error) {
+	req, err := newPushRequest(settings, body)
+	if err != nil {
+		return nil, err
+	}
+	push := startSpan("push", spanClient, parent)
+	push.set("server.address", req.URL.Host)
+	client := http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("%s", resp.Status)
+		}
+	}
+	var response struct {
+		Results []pushResult `json:"results"`
+	}
+	if err == nil {
+		err = json.NewDecoder(resp.Body).Decode(&response)
+	}
+	push.finish(err)
+	return response.Results, err
+}
+
+// handleRecords records a batch of records pushed from another instance, or
+// for a GET lists the records a page at a time (see listRecords).
+// Records whose scan ID the data file or the pushes file already holds are
+// acknowledged without being recorded again. Pushed records were already
+// checked against the rules at the site that scanned them, so they aren't
+// deduplicated again; check-ins are numbered after this instance's own.
+func (api mobileAPI) handleRecords(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		api.listRecords(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "use GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if api.ReadOnly {
+		http.Error(w, "the server is read-only", http.StatusForbidden)
+		return
+	}
+	var body pushRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid push: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body.Records) > maxPushRecords {
+		http.Error(w, fmt.Sprintf("at most %d records per push", maxPushRecords), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	results, err := api.recordPushed(body.Station, body.Records)
+	if err != nil {
+		http.Error(w, "recording records: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"results": results})
+}
+
+// recordPushed appends the pushed records this instance doesn't have to the
+// current data file in timestamp order and logs each scan ID to the pushes
+// file with the station that sent it
+func (api mobileAPI) recordPushed(station string, pushed []Record) ([]pushResult, error) {
+	received, err := loadCSVColumn(sidecarFile("pushes"), 0)
+	if err != nil {
+		return nil, err
+	}
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+	for _, record := range records {
+		received[mergeKey(record)] = true
+	}
+
+	results := make([]pushResult, len(pushed))
+	var order []int
+	for i, record := range pushed {
+		results[i] = pushResult{ScanID: record.ScanID, Status: "invalid"}
+		switch {
+		case record.ScanID == "":
+			results[i].Error = "missing scan_id"
+		case received[record.ScanID]:
+			results[i].Status = "already_received"
+		case !barcodePattern.MatchString(record.BadgeID):
+			results[i].Error = "invalid barcode ID"
+		case record.Direction != "in" && record.Direction != "out":
+			results[i].Error = "direction must be in or out"
+		case !contains(recordTypes, record.Type):
+			results[i].Error = "unknown record type"
+		default:
+			pushed[i].Timestamp = record.Timestamp.In(time.Local)
+			received[record.ScanID] = true
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool { return pushed[order[a]].Timestamp.Before(pushed[order[b]].Timestamp) })
+
+	data, err := os.OpenFile(currentDataFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	writer := newDataWriter(data)
+	now := time.Now().Format("2006-01-02T15:04:05-07:00")
+	for _, i := range order {
+		record := Record{Timestamp: pushed[i].Timestamp, BadgeID: pushed[i].BadgeID, Direction: pushed[i].Direction, Type: pushed[i].Type, ScanID: pushed[i].ScanID}
+		if record.Direction == "in" {
+			record.Seq = nextDailyCount(records, record.Timestamp.Format("2006-01-02"), record.Type)
+		}
+		fields := record.Fields()
+		if api.IntegrityKey != nil {
+			previous := ""
+			if len(records) > 0 && len(records[len(records)-1]) > 3 {
+				previous = records[len(records)-1][3]
+			}
+			for len(fields) < 4 {
+				fields = append(fields, "")
+			}
+			fields[3] = recordChecksum(api.IntegrityKey, previous, fields)
+		}
+		writer.Write(fields)
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return nil, err
+		}
+		records = append(records, fields)
+		results[i].Status = "recorded"
+		if err := appendCSV(sidecarFile("pushes"), []string{record.ScanID, station, now}); err != nil {
+			return nil, err
+		}
+		if err := logOrigin(fields, station, pushed[i].Event, "push"); err != nil {
+			return nil, err
+		}
+	}
+	if len(order) > 0 {
+		fmt.Printf("Received %d records pushed from %s.\n", len(order), station)
+	}
+	return results, nil
+}
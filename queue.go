@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// deliveryPoll is how often the worker looks for deliveries due a retry
+	deliveryPoll = 15 * time.Second
+	// firstRetryDelay and maxRetryDelay bound the doubling delay between
+	// attempts at a delivery
+	firstRetryDelay = 10 * time.Second
+	maxRetryDelay   = time.Hour
+	// staleClaim is how long a delivery can stay claimed before another
+	// process takes it over, as after a crash mid-send
+	staleClaim = 5 * time.Minute
+)
+
+// delivery is one outbound message waiting in the queue: a webhook or SMS
+// gateway request, an export email or an export upload. Deliveries are never
+// dropped; one that keeps failing is retried at most hourly until it is sent
+// or -queue=flush gets it through.
+type delivery struct {
+	Channel   string    `json:"channel"` // e.g. "watch list webhook", for status and errors
+	Created   time.Time `json:"created"`
+	Attempts  int       `json:"attempts"`
+	NextTry   time.Time `json:"next_try"`
+	LastError string    `json:"last_error,omitempty"`
+
+	// One of these is set. Emails and uploads use the config file's smtp,
+	// sftp and drive settings as they are when the delivery is sent, so no
+	// passwords are kept in the queue.
+	Request *queuedRequest `json:"request,omitempty"`
+	Email   *queuedEmail   `json:"email,omitempty"`
+	Upload  *queuedUpload  `json:"upload,omitempty"`
+}
+
+// queuedRequest is an HTTP request to send. Its Authorization header isn't
+// kept; the push token or gateway password is added from the config when it
+// is sent.
+type queuedRequest struct {
+	Method string            `json:"method"`
+	URL    string            `json:"url"`
+	Header map[string]string `json:"header"`
+	Body   []byte            `json:"body"`
+}
+
+// queuedEmail is an email to send with files attached
+type queuedEmail struct {
+	To          []string `json:"to"`
+	Subject     string   `json:"subject"`
+	Body        string   `json:"body"`
+	Attachments []string `json:"attachments"`
+}
+
+// queuedUpload is files to upload to a destination
+type queuedUpload struct {
+	Destination string   `json:"destination"`
+	Files       []string `json:"files"`
+}
+
+// deliveryQueue sends the deliveries in the queue directory. Each delivery is
+// a file, claimed by renaming it while it is being sent, so the scan
+// station, the server and the daemon can share one queue.
+type deliveryQueue struct {
+	cfg  config
+	wake chan struct{}
+	mu   sync.Mutex // one pass over the queue at a time
+}
+
+// outbox is the process's delivery queue. main sets its config.
+var outbox = &deliveryQueue{}
+
+// queueDir returns the directory next to the data file holding the queue,
+// e.g. scans.queue for scans.csv
+func queueDir() string {
+	return strings.TrimSuffix(dataFile, filepath.Ext(dataFile)) + ".queue"
+}
+
+// add saves a delivery to the queue and wakes the worker to send it
+func (q *deliveryQueue) add(d delivery) {
+	d.Created = time.Now()
+	d.NextTry = d.Created
+	data, err := json.Marshal(d)
+	if err == nil {
+		err = os.MkdirAll(queueDir(), 0700)
+	}
+	if err == nil {
+		name := filepath.Join(queueDir(), strconv.FormatInt(d.Created.UnixNano(), 10)+"-"+strconv.Itoa(os.Getpid())+".json")
+		err = writeFileAtomic(name, data, 0600)
+	}
+	if err != nil {
+		fmt.Printf("Error queueing %s: %v\n", d.Channel, err)
+		return
+	}
+	if q.wake != nil {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// queueRequest queues an HTTP request through the outbox. The request's body
+// must be a bytes, strings or nil reader.
+func queueRequest(channel string, req *http.Request) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+	}
+	header := make(map[string]string)
+	for name := range req.Header {
+		if name != "Authorization" {
+			header[name] = req.Header.Get(name)
+		}
+	}
+	outbox.add(delivery{Channel: channel, Request: &queuedRequest{Method: req.Method, URL: req.URL.String(), Header: header, Body: body}})
+}
+
+// start runs the worker that sends deliveries as they are queued and retries
+// failed ones when they are due, for the long-running modes
+func (q *deliveryQueue) start() {
+	q.wake = make(chan struct{}, 1)
+	go func() {
+		ticker := time.NewTicker(deliveryPoll)
+		defer ticker.Stop()
+		for {
+			q.run(false, func(d delivery, err error) {
+				if err != nil {
+					fmt.Printf("Error sending %s, will retry (see -queue=status): %v\n", d.Channel, err)
+				}
+			})
+			select {
+			case <-q.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// wait makes one attempt at the deliveries that are due, after the worker's
+// pass in flight if there is one, so what was just queued goes out before the
+// process exits. Failures stay queued for the next run.
+func (q *deliveryQueue) wait() {
+	q.run(false, nil)
+}
+
+// run makes one attempt at each delivery that is due, or at every delivery
+// with force set, in the order they were queued, passing each result to
+// report when it isn't nil. It returns how many were sent and how many
+// failed.
+func (q *deliveryQueue) run(force bool, report func(delivery, error)) (int, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	// Take back deliveries claimed by a process that died mid-send
+	claims, _ := filepath.Glob(filepath.Join(queueDir(), "*.json.claim"))
+	for _, claim := range claims {
+		if info, err := os.Stat(claim); err == nil && now.Sub(info.ModTime()) > staleClaim {
+			os.Rename(claim, strings.TrimSuffix(claim, ".claim"))
+		}
+	}
+
+	names, _ := filepath.Glob(filepath.Join(queueDir(), "*.json"))
+	sort.Strings(names)
+	sent, failed := 0, 0
+	for _, name := range names {
+		d, err := readDelivery(name)
+		if err != nil || (!force && d.NextTry.After(now)) {
+			continue
+		}
+		claim := name + ".claim"
+		if err := os.Rename(name, claim); err != nil {
+			continue // another process is sending it
+		}
+		os.Chtimes(claim, now, now)
+
+		trace := startSpan(d.Channel, spanClient, nil)
+		err = q.send(d)
+		trace.finish(err)
+		if report != nil {
+			report(d, err)
+		}
+		if err == nil {
+			os.Remove(claim)
+			sent++
+			continue
+		}
+		failed++
+		d.Attempts++
+		d.LastError = err.Error()
+		d.NextTry = time.Now().Add(retryDelay(d.Attempts))
+		if data, err := json.Marshal(d); err == nil {
+			os.WriteFile(claim, data, 0600)
+		}
+		os.Rename(claim, name)
+	}
+	return sent, failed
+}
+
+// retryDelay returns how long to wait after a delivery's nth failed attempt
+func retryDelay(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// send makes one attempt at a delivery
+func (q *deliveryQueue) send(d delivery) error {
+	switch {
+	case d.Request != nil:
+		req, err := http.NewRequest(d.Request.Method, d.Request.URL, bytes.NewReader(d.Request.Body))
+		if err != nil {
+			return err
+		}
+		for name, value := range d.Request.Header {
+			req.Header.Set(name, value)
+		}
+		q.authorize(d.Channel, req)
+		client := http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("%s", resp.Status)
+		}
+		return nil
+	case d.Email != nil:
+		return sendEmail(q.cfg.SMTP, d.Email.To, d.Email.Subject, d.Email.Body, d.Email.Attachments)
+	case d.Upload != nil:
+		return uploadExports(q.cfg, []string{d.Upload.Destination}, d.Upload.Files, nil)
+	}
+	return fmt.Errorf("empty delivery")
+}
+
+// authorize adds the credentials of a queued request's channel from the
+// config: the push token, or the SMS gateway's username and password for a
+// request to that gateway
+func (q *deliveryQueue) authorize(channel string, req *http.Request) {
+	if channel == "push" && q.cfg.Push.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+q.cfg.Push.Token)
+		return
+	}
+	gateways := map[string]smsConfig{"guardian sms": q.cfg.GuardianSMS.Gateway, "watch list sms": q.cfg.WatchList.SMS, "storage alert": q.cfg.Storage.SMS}
+	gateway, ok := gateways[channel]
+	if !ok || gateway.Username == "" {
+		return
+	}
+	if u, err := url.Parse(gateway.URL); err == nil && u.String() == req.URL.String() {
+		req.SetBasicAuth(gateway.Username, gateway.Password)
+	}
+}
+
+// readDelivery reads a queued delivery
+func readDelivery(name string) (delivery, error) {
+	var d delivery
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return d, err
+	}
+	return d, json.Unmarshal(data, &d)
+}
+
+// writeFileAtomic writes a file through a temporary file and a rename, so
+// readers never see half of it
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	if err := os.WriteFile(name+".tmp", data, perm); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+// queueEntry is a waiting delivery in -queue=status's -output=json result
+type queueEntry struct {
+	File      string    `json:"file"`
+	Channel   string    `json:"channel"`
+	Created   time.Time `json:"created"`
+	Attempts  int       `json:"attempts"`
+	NextTry   time.Time `json:"next_try"`
+	Sending   bool      `json:"sending"` // claimed by a process sending it now
+	LastError string    `json:"last_error,omitempty"`
+	Error     string    `json:"error,omitempty"` // why the queued file can't be read
+}
+
+// queueFlushed is one delivery tried by -queue=flush with -output=json
+type queueFlushed struct {
+	Channel string    `json:"channel"`
+	Created time.Time `json:"created"`
+	Sent    bool      `json:"sent"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// runQueueMode shows the deliveries waiting in the queue, or with flush
+// tries to send all of them now. With asJSON the deliveries are printed as
+// JSON, without what they send, which can hold webhook URLs and addresses.
+func runQueueMode(command string, asJSON bool) {
+	switch command {
+	case "status":
+		names, _ := filepath.Glob(filepath.Join(queueDir(), "*.json"))
+		claims, _ := filepath.Glob(filepath.Join(queueDir(), "*.json.claim"))
+		names = append(names, claims...)
+		sort.Strings(names)
+		if asJSON {
+			entries := []queueEntry{}
+			for _, name := range names {
+				entry := queueEntry{File: filepath.Base(name), Sending: strings.HasSuffix(name, ".claim")}
+				if d, err := readDelivery(name); err != nil {
+					entry.Error = err.Error()
+				} else {
+					entry.Channel, entry.Created, entry.Attempts, entry.NextTry, entry.LastError = d.Channel, d.Created, d.Attempts, d.NextTry, d.LastError
+				}
+				entries = append(entries, entry)
+			}
+			printJSON(map[string]any{"queue_dir": queueDir(), "deliveries": entries})
+			return
+		}
+		if len(names) == 0 {
+			fmt.Println("The delivery queue is empty.")
+			return
+		}
+		fmt.Printf("%d deliveries waiting in %s:\n", len(names), queueDir())
+		for _, name := range names {
+			d, err := readDelivery(name)
+			if err != nil {
+				fmt.Printf("  %s: unreadable: %v\n", filepath.Base(name), err)
+				continue
+			}
+			state := "next try " + d.NextTry.Format("2006-01-02 15:04:05")
+			if strings.HasSuffix(name, ".claim") {
+				state = "sending now"
+			}
+			fmt.Printf("  %s  %-22s %d attempts, %s\n", d.Created.Format("2006-01-02 15:04:05"), d.Channel, d.Attempts, state)
+			if d.LastError != "" {
+				fmt.Printf("      last error: %s\n", d.LastError)
+			}
+		}
+	case "flush":
+		tried := []queueFlushed{}
+		sent, failed := outbox.run(true, func(d delivery, err error) {
+			if asJSON {
+				result := queueFlushed{Channel: d.Channel, Created: d.Created, Sent: err == nil}
+				if err != nil {
+					result.Error = err.Error()
+				}
+				tried = append(tried, result)
+			} else if err != nil {
+				fmt.Printf("Failed: %s queued %s: %v\n", d.Channel, d.Created.Format("2006-01-02 15:04:05"), err)
+			} else {
+				fmt.Printf("Sent: %s queued %s\n", d.Channel, d.Created.Format("2006-01-02 15:04:05"))
+			}
+		})
+		if asJSON {
+			printJSON(map[string]any{"sent": sent, "waiting": failed, "deliveries": tried})
+		} else {
+			fmt.Printf("Sent %d deliveries; %d still waiting.\n", sent, failed)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+	default:
+		printError(asJSON, "Error: -queue must be status or flush.")
+	}
+}
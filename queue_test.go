@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQueuedRequestsKeepNoCredentials(t *testing.T) {
+	useDataFile(t, "")
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	previous := outbox.cfg
+	defer func() { outbox.cfg = previous }()
+	outbox.cfg = config{}
+	outbox.cfg.Push.Token = "push-secret"
+	outbox.cfg.WatchList.SMS = smsConfig{URL: server.URL + "/sms", Username: "user", Password: "sms-secret"}
+
+	push, _ := http.NewRequest("POST", server.URL+"/api/records", strings.NewReader("{}"))
+	push.Header.Set("Authorization", "Bearer push-secret")
+	queueRequest("push", push)
+	sms, err := outbox.cfg.WatchList.SMS.request("+15550100", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queueRequest("watch list sms", sms)
+
+	names, _ := filepath.Glob(filepath.Join(queueDir(), "*.json"))
+	if len(names) != 2 {
+		t.Fatalf("%d deliveries queued, want 2", len(names))
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "secret") || strings.Contains(string(data), "Authorization") {
+			t.Errorf("%s keeps the credentials: %s", filepath.Base(name), data)
+		}
+	}
+
+	if sent, failed := outbox.run(true, nil); sent != 2 || failed != 0 {
+		t.Fatalf("%d sent and %d failed, want 2 and 0", sent, failed)
+	}
+	want := []string{"Bearer push-secret", sms.Header.Get("Authorization")}
+	if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("sent with %q, want %q", got, want)
+	}
+}
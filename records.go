@@ -0,0 +1,310 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Data file records hold these fields, in order:
+//
+//	timestamp, barcode ID, daily count, checksum, direction, type, scan ID
+//
+// Only the timestamp and ID are required. The daily count numbers each day's
+// check-ins of the record's type and is empty for check-outs, the checksum is
+// empty unless integrity checksums are enabled, an empty direction means "in"
+// and an empty type means "member". The scan ID is a UUID given to each scan
+// when it is recorded, so merging the same scans again never duplicates
+// them; records from before scan IDs have none. Trailing empty fields are
+// left off, so a member check-in without a checksum or scan ID is just the
+// first three fields.
+
+// Record is a data file record with its fields parsed. Name, Event, Station
+// and Note aren't stored in the data file; commands that show them fill them
+// in from the roster, the config and the notes sidecar file.
+type Record struct {
+	Timestamp time.Time
+	BadgeID   string
+	Seq       int    // daily count; 0 for check-outs
+	Checksum  string // empty unless integrity checksums are enabled
+	Direction string // "in" or "out"
+	Type      string // one of recordTypes
+	ScanID    string // empty for records from before scan IDs
+	Name      string
+	Event     string
+	Station   string
+	Source    string // how the record arrived; see recordSources
+	Note      string
+}
+
+// parseRecord parses a data file record's fields. It returns an error rather
+// than a partial record when the fields are too few, the timestamp or daily
+// count is invalid or the ID is empty, as on a malformed line.
+func parseRecord(fields []string) (Record, error) {
+	if len(fields) < 2 {
+		return Record{}, fmt.Errorf("expected at least 2 fields, found %d", len(fields))
+	}
+	t, err := time.Parse("2006-01-02T15:04:05-07:00", fields[0])
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid timestamp %q", fields[0])
+	}
+	if fields[1] == "" {
+		return Record{}, errors.New("empty barcode ID")
+	}
+	record := Record{Timestamp: t, BadgeID: fields[1], Direction: recordDirection(fields), Type: recordType(fields), ScanID: recordScanID(fields)}
+	if len(fields) > 2 && fields[2] != "" {
+		if record.Seq, err = strconv.Atoi(fields[2]); err != nil || record.Seq < 0 {
+			return Record{}, fmt.Errorf("invalid daily count %q", fields[2])
+		}
+	}
+	if len(fields) > 3 {
+		record.Checksum = fields[3]
+	}
+	return record, nil
+}
+
+// Fields returns the record's fields as the data file stores them, leaving
+// off trailing empty fields after the daily count
+func (r Record) Fields() []string {
+	fields := []string{r.Timestamp.Format("2006-01-02T15:04:05-07:00"), r.BadgeID, "", r.Checksum, "", "", r.ScanID}
+	if r.Seq > 0 {
+		fields[2] = strconv.Itoa(r.Seq)
+	}
+	if r.Direction == "out" {
+		fields[4] = "out"
+	}
+	if r.Type != "member" {
+		fields[5] = r.Type
+	}
+	for len(fields) > 3 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	return fields
+}
+
+// MarshalJSON writes a record with the same keys wherever records are
+// output as JSON. The timestamp keeps the offset it was recorded with.
+func (r Record) MarshalJSON() ([]byte, error) {
+	direction, recordType := r.Direction, r.Type
+	if direction == "" {
+		direction = "in"
+	}
+	if recordType == "" {
+		recordType = "member"
+	}
+	return json.Marshal(recordJSON{r.Timestamp.Format("2006-01-02T15:04:05-07:00"), r.BadgeID, r.Seq, direction, recordType, r.ScanID, r.Checksum, r.Name, r.Event, r.Station, r.Source, r.Note})
+}
+
+// UnmarshalJSON reads a record written by MarshalJSON, such as one pushed
+// from another instance
+func (r *Record) UnmarshalJSON(data []byte) error {
+	var v recordJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	t, err := time.Parse(time.RFC3339, v.Timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", v.Timestamp)
+	}
+	if v.Direction == "" {
+		v.Direction = "in"
+	}
+	if v.Type == "" {
+		v.Type = "member"
+	}
+	*r = Record{Timestamp: t, BadgeID: v.ID, Seq: v.Seq, Checksum: v.Checksum, Direction: v.Direction, Type: v.Type, ScanID: v.ScanID,
+		Name: v.Name, Event: v.Event, Station: v.Station, Source: v.Source, Note: v.Note}
+	return nil
+}
+
+// recordJSON is the JSON form of a Record
+type recordJSON struct {
+	Timestamp string `json:"timestamp"`
+	ID        string `json:"id"`
+	Seq       int    `json:"seq,omitempty"`
+	Direction string `json:"direction"`
+	Type      string `json:"type"`
+	ScanID    string `json:"scan_id,omitempty"`
+	Checksum  string `json:"checksum,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Event     string `json:"event,omitempty"`
+	Station   string `json:"station,omitempty"`
+	Source    string `json:"source,omitempty"`
+	Note      string `json:"note,omitempty"`
+}
+
+// maxReportedBadRows limits how many skipped lines are listed individually
+const maxReportedBadRows = 10
+
+// badRow is a data file line that was skipped while reading records
+type badRow struct {
+	Line   int
+	Reason string
+}
+
+// dataDelimiter separates the data file's fields, set with data_delimiter in
+// the config file
+var dataDelimiter = ','
+
+// parseDelimiter parses a field delimiter: comma, tab, semicolon, or the
+// character itself
+func parseDelimiter(name string) (rune, error) {
+	switch name {
+	case "", "comma":
+		return ',', nil
+	case "tab":
+		return '\t', nil
+	case "semicolon":
+		return ';', nil
+	}
+	if runes := []rune(name); len(runes) == 1 && runes[0] != '"' && runes[0] != '\n' && runes[0] != '\r' {
+		return runes[0], nil
+	}
+	return 0, fmt.Errorf("unknown delimiter %q (available: comma, tab, semicolon)", name)
+}
+
+// newDataReader returns a reader for lines in the data file's format, which
+// may have any number of fields
+func newDataReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = dataDelimiter
+	reader.FieldsPerRecord = -1
+	return reader
+}
+
+// newDataWriter returns a writer for lines in the data file's format
+func newDataWriter(w io.Writer) *csv.Writer {
+	writer := csv.NewWriter(w)
+	writer.Comma = dataDelimiter
+	return writer
+}
+
+// readRecords reads the data file records from r line by line. Lines that are
+// malformed CSV, have fewer than two fields or don't start with a valid
+// timestamp are skipped and returned as bad rows rather than failing the
+// whole read. The line each record starts on is returned alongside it.
+func readRecords(r io.Reader) ([][]string, []int, []badRow) {
+	return readDelimitedRecords(r, dataDelimiter)
+}
+
+// readDelimitedRecords is readRecords for a file whose fields are separated
+// by comma instead of the data file's delimiter
+func readDelimitedRecords(r io.Reader, comma rune) ([][]string, []int, []badRow) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+
+	var records [][]string
+	var lines []int
+	var bad []badRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			bad = append(bad, badRow{parseErr.StartLine, "malformed CSV: " + parseErr.Err.Error()})
+			continue
+		} else if err != nil {
+			bad = append(bad, badRow{0, "reading CSV: " + err.Error()})
+			break
+		}
+		line, _ := reader.FieldPos(0)
+
+		if len(record) < 2 {
+			bad = append(bad, badRow{line, fmt.Sprintf("expected at least 2 fields, found %d", len(record))})
+			continue
+		}
+		if _, err := time.Parse("2006-01-02T15:04:05-07:00", record[0]); err != nil {
+			bad = append(bad, badRow{line, fmt.Sprintf("invalid timestamp %q", record[0])})
+			continue
+		}
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+	return records, lines, bad
+}
+
+// recordScanID returns a record's scan ID, or an empty string for records
+// from before scan IDs
+func recordScanID(record []string) string {
+	if len(record) > 6 {
+		return record[6]
+	}
+	return ""
+}
+
+// withScanID stores a scan ID in a record
+func withScanID(record []string, scanID string) []string {
+	for len(record) < 6 {
+		record = append(record, "")
+	}
+	return append(record[:6], scanID)
+}
+
+// newScanID returns a random version 4 UUID for a new scan
+func newScanID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// recordDirection returns whether a record is a check-in ("in") or a
+// check-out ("out")
+func recordDirection(record []string) string {
+	if len(record) > 4 && record[4] == "out" {
+		return "out"
+	}
+	return "in"
+}
+
+// reportBadRows prints the lines skipped while reading the data file
+func reportBadRows(bad []badRow) {
+	if len(bad) == 0 {
+		return
+	}
+	fmt.Printf("Skipped %d malformed lines in %s:\n", len(bad), dataName())
+	for i, row := range bad {
+		if i == maxReportedBadRows {
+			fmt.Printf("  ... and %d more (run -check for the full list)\n", len(bad)-i)
+			break
+		}
+		fmt.Printf("  line %d: %s\n", row.Line, row.Reason)
+	}
+}
+
+// nextDailyCount returns the count for the next check-in of a record type on
+// a date (YYYY-MM-DD), one past the highest count recorded so far
+func nextDailyCount(records [][]string, date, t string) int {
+	count := 0
+	for _, record := range records {
+		if len(record) > 2 && record[0][:10] == date && recordType(record) == t {
+			if n, err := strconv.Atoi(record[2]); err == nil && n > count {
+				count = n
+			}
+		}
+	}
+	return count + 1
+}
+
+// appendRecord appends one record to a data file, creating it if needed
+func appendRecord(name string, record []string) error {
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := newDataWriter(file)
+	writer.Write(record)
+	writer.Flush()
+	return writer.Error()
+}
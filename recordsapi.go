@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultRecordsLimit is how many records a page of GET /api/records
+	// holds when the request doesn't say
+	defaultRecordsLimit = 100
+
+	// maxRecordsLimit is the most records one page may hold
+	maxRecordsLimit = 1000
+)
+
+// recordOrigin is the station and event a record was scanned at and the
+// source it arrived through, from the origins sidecar file, whose rows are
+// timestamp,id,station,event,source
+type recordOrigin struct {
+	Station string
+	Event   string
+	Source  string // one of recordSources; empty for records from before sources were noted
+}
+
+// logOrigin notes the station and event a record was scanned at, and its
+// source, in the origins file
+func logOrigin(record []string, station, event, source string) error {
+	return appendCSV(sidecarFile("origins"), []string{record[0], record[1], station, event, source})
+}
+
+// loadOrigins reads the origins file into the origin of each record key
+func loadOrigins() (map[string]recordOrigin, error) {
+	origins := make(map[string]recordOrigin)
+	file, err := os.Open(sidecarFile("origins"))
+	if os.IsNotExist(err) {
+		return origins, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	rows, _, _ := readDelimitedRecords(file, ',')
+	for _, row := range rows {
+		for len(row) < 5 {
+			row = append(row, "")
+		}
+		origins[noteKey(row)] = recordOrigin{Station: row[2], Event: row[3], Source: row[4]}
+	}
+	return origins, nil
+}
+
+// recordsQuery is a GET /api/records request: the filters, the order and
+// the page after the cursor
+type recordsQuery struct {
+	First, Last string   // local dates, inclusive; empty for no limit
+	IDs         []string // empty for every ID
+	Event       string
+	Station     string
+	Source      string
+	Direction   string
+	Type        string
+	Sort        string // timestamp, id or name
+	Desc        bool
+	Limit       int
+	After       *recordsCursor // the last record of the previous page; nil for the first page
+}
+
+// recordsCursor is where a page of records ends, as the values it was sorted
+// on. It's sent to clients as opaque base64 JSON.
+type recordsCursor struct {
+	Key    string `json:"k"` // the sort column's value
+	Time   int64  `json:"t"` // Unix nanoseconds
+	ID     string `json:"i"`
+	ScanID string `json:"s,omitempty"`
+	Line   int    `json:"l"` // position in the data files, for records the same in all else
+}
+
+// parseRecordsQuery reads a GET /api/records query string. start and end
+// take dates or the relative keywords -start does, and either may be left
+// out for no limit on that side; id takes a comma-separated list.
+func parseRecordsQuery(values url.Values, now time.Time) (recordsQuery, error) {
+	query := recordsQuery{Event: values.Get("event"), Station: values.Get("station"),
+		Source: values.Get("source"), Direction: values.Get("direction"),
+		Type: values.Get("type"), Sort: values.Get("sort"), Limit: defaultRecordsLimit}
+	var err error
+	if query.First, query.Last, err = resolveExportRange(values.Get("start"), values.Get("end"), "", "", now); err != nil {
+		return query, err
+	}
+	for _, date := range []string{query.First, query.Last} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			return query, fmt.Errorf("invalid date %q", date)
+		}
+	}
+	if ids := values.Get("id"); ids != "" {
+		query.IDs = strings.Split(ids, ",")
+	}
+	if query.Direction != "" && query.Direction != "in" && query.Direction != "out" {
+		return query, fmt.Errorf("direction must be in or out")
+	}
+	if query.Type != "" && !contains(recordTypes, query.Type) {
+		return query, fmt.Errorf("unknown record type %q", query.Type)
+	}
+	if query.Source != "" && !contains(recordSources, query.Source) {
+		return query, fmt.Errorf("unknown source %q", query.Source)
+	}
+	if query.Sort == "" {
+		query.Sort = "timestamp"
+	}
+	if query.Sort != "timestamp" && query.Sort != "id" && query.Sort != "name" {
+		return query, fmt.Errorf("sort must be timestamp, id or name")
+	}
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return query, fmt.Errorf("order must be asc or desc")
+	}
+	if limit := values.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 || query.Limit > maxRecordsLimit {
+			return query, fmt.Errorf("limit must be 1 to %d", maxRecordsLimit)
+		}
+	}
+	if cursor := values.Get("cursor"); cursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(cursor)
+		query.After = &recordsCursor{}
+		if err != nil || json.Unmarshal(data, query.After) != nil {
+			return query, fmt.Errorf("invalid cursor")
+		}
+	}
+	return query, nil
+}
+
+// listedRecord is a record matching a records query, with what it's sorted by
+type listedRecord struct {
+	record Record
+	cursor recordsCursor
+}
+
+// before reports whether a sorts before b in ascending order
+func (a recordsCursor) before(b recordsCursor) bool {
+	switch {
+	case a.Key != b.Key:
+		return a.Key < b.Key
+	case a.Time != b.Time:
+		return a.Time < b.Time
+	case a.ID != b.ID:
+		return a.ID < b.ID
+	case a.ScanID != b.ScanID:
+		return a.ScanID < b.ScanID
+	}
+	return a.Line < b.Line
+}
+
+// listRecords answers GET /api/records with a page of the records matching
+// the query, in its order, filling in their names, notes, stations, events
+// and sources. The response's next_cursor, empty on the last page, asks for the
+// page after it; total counts every match. As it hands out everyone's names
+// and notes, it needs an admin token and is refused when no API tokens are
+// configured.
+func (api mobileAPI) listRecords(w http.ResponseWriter, r *http.Request) {
+	query, err := parseRecordsQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		http.Error(w, "reading records: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+	roster, err := loadRoster(api.RosterFile)
+	if err != nil {
+		http.Error(w, "reading roster: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	notes, err := loadNotes()
+	if err != nil {
+		http.Error(w, "reading notes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	origins, err := loadOrigins()
+	if err != nil {
+		http.Error(w, "reading origins: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var matches []listedRecord
+	for line, fields := range records {
+		record, err := parseRecord(fields)
+		if err != nil {
+			continue
+		}
+		date := record.Timestamp.In(time.Local).Format("2006-01-02")
+		origin := origins[noteKey(fields)]
+		switch {
+		case query.First != "" && date < query.First, query.Last != "" && date > query.Last:
+			continue
+		case len(query.IDs) > 0 && !contains(query.IDs, record.BadgeID):
+			continue
+		case query.Event != "" && origin.Event != query.Event, query.Station != "" && origin.Station != query.Station:
+			continue
+		case query.Source != "" && origin.Source != query.Source:
+			continue
+		case query.Direction != "" && record.Direction != query.Direction, query.Type != "" && record.Type != query.Type:
+			continue
+		}
+		record.Name = rosterName(roster, record.BadgeID)
+		record.Note = strings.Join(notes[noteKey(fields)], "; ")
+		record.Station, record.Event, record.Source = origin.Station, origin.Event, origin.Source
+		cursor := recordsCursor{Time: record.Timestamp.UnixNano(), ID: record.BadgeID, ScanID: record.ScanID, Line: line}
+		switch query.Sort {
+		case "id":
+			cursor.Key = record.BadgeID
+		case "name":
+			cursor.Key = strings.ToLower(record.Name)
+		}
+		matches = append(matches, listedRecord{record, cursor})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if query.Desc {
+			return matches[j].cursor.before(matches[i].cursor)
+		}
+		return matches[i].cursor.before(matches[j].cursor)
+	})
+
+	// The page starts after the cursor's record, which needn't still exist
+	start := 0
+	if query.After != nil {
+		start = sort.Search(len(matches), func(i int) bool {
+			if query.Desc {
+				return matches[i].cursor.before(*query.After)
+			}
+			return query.After.before(matches[i].cursor)
+		})
+	}
+	end := min(start+query.Limit, len(matches))
+	page := []Record{}
+	for _, match := range matches[start:end] {
+		page = append(page, match.record)
+	}
+	next := ""
+	if end < len(matches) {
+		data, _ := json.Marshal(matches[end-1].cursor)
+		next = base64.RawURLEncoding.EncodeToString(data)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]any{"records": page, "next_cursor": next, "total": len(matches)})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// recordTypes are the kinds of people a record can belong to. Each type has
+// its own daily count, and records without a type are members.
+var recordTypes = []string{"member", "visitor", "staff", "contractor"}
+
+// recordType returns the type stored in a record
+func recordType(record []string) string {
+	if len(record) > 5 && record[5] != "" {
+		return record[5]
+	}
+	return "member"
+}
+
+// withType stores the type in a record. Members are left without one so their
+// rows keep the original layout.
+func withType(record []string, t string) []string {
+	if t == "" || t == "member" {
+		return record
+	}
+	for len(record) < 5 {
+		record = append(record, "")
+	}
+	return append(record, t)
+}
+
+// parseRecordTypes parses a comma-separated list of record types
+func parseRecordTypes(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var types []string
+	for _, t := range strings.Split(list, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if !contains(recordTypes, t) {
+			return nil, fmt.Errorf("unknown record type %q (expected %s)", t, strings.Join(recordTypes, ", "))
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// deriveType works out the type of a scanned ID from the roster's "type"
+// column, or else the longest matching ID prefix, and defaults to member
+func deriveType(id string, roster map[string]rosterEntry, prefixes map[string]string) string {
+	if t := strings.ToLower(roster[id].Fields["type"]); contains(recordTypes, t) {
+		return t
+	}
+	derived, longest := "member", 0
+	for prefix, t := range prefixes {
+		if strings.HasPrefix(id, prefix) && len(prefix) > longest {
+			derived, longest = t, len(prefix)
+		}
+	}
+	return derived
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// redactedSidecars are the sidecar files copied into a redacted sample.
+// Notes and screening answers are left out, as they're free text or about
+// someone's health.
+var redactedSidecars = []string{"tags", "credits", "origins"}
+
+// maxPseudonymRounds is how many pseudonyms are tried for an ID before it may
+// keep its own, as with an ID of only dashes or the last free one-digit ID,
+// and then how many more before each extra digit is added, once every
+// pseudonym of its shape is taken
+const maxPseudonymRounds = 100
+
+// pseudonymizer replaces IDs with pseudonyms that keep their shape, so a bug
+// that depends on ID formats, lengths or type prefixes still shows up in the
+// sample. The key is random and thrown away afterwards, so the pseudonyms
+// can't be traced back to the IDs, even by trying every badge number.
+type pseudonymizer struct {
+	key      []byte
+	prefixes map[string]string // the config's type prefixes, kept as they are
+	ids      map[string]string // pseudonym by ID
+	taken    map[string]bool
+}
+
+// newPseudonymizer returns a pseudonymizer with a new random key
+func newPseudonymizer(prefixes map[string]string) (*pseudonymizer, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &pseudonymizer{key: key, prefixes: prefixes, ids: make(map[string]string), taken: make(map[string]bool)}, nil
+}
+
+// pseudonym returns the ID's pseudonym, the same every time it's asked for:
+// the ID's type prefix, if any, followed by digits for its digits and
+// letters for its letters, with other characters such as dashes kept. Only
+// when IDs of that shape run out is it longer.
+func (p *pseudonymizer) pseudonym(id string) string {
+	if pseudonym, ok := p.ids[id]; ok {
+		return pseudonym
+	}
+	prefix := ""
+	for candidate := range p.prefixes {
+		if strings.HasPrefix(id, candidate) && len(candidate) > len(prefix) {
+			prefix = candidate
+		}
+	}
+	rest := id[len(prefix):]
+	for round := uint32(0); ; round++ {
+		extra := 0
+		if round >= maxPseudonymRounds {
+			extra = int(round/maxPseudonymRounds) - 1
+		}
+		// Enough keyed hash bytes for every character of the rest
+		var stream []byte
+		for block := uint32(0); len(stream) < len(rest)+extra; block++ {
+			mac := hmac.New(sha256.New, p.key)
+			mac.Write([]byte(id))
+			mac.Write(binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, round), block))
+			stream = mac.Sum(stream)
+		}
+		var b strings.Builder
+		b.WriteString(prefix)
+		for i, c := range []byte(rest) {
+			switch {
+			case c >= '0' && c <= '9':
+				b.WriteByte('0' + stream[i]%10)
+			case c >= 'a' && c <= 'z':
+				b.WriteByte('a' + stream[i]%26)
+			case c >= 'A' && c <= 'Z':
+				b.WriteByte('A' + stream[i]%26)
+			default:
+				b.WriteByte(c)
+			}
+		}
+		for i := 0; i < extra; i++ {
+			b.WriteByte('0' + stream[len(rest)+i]%10)
+		}
+		// Two people never share a pseudonym, and no one keeps their own ID
+		// unless IDs this short leave nothing else
+		if pseudonym := b.String(); !p.taken[pseudonym] && (pseudonym != id || round >= maxPseudonymRounds) {
+			p.ids[id] = pseudonym
+			p.taken[pseudonym] = true
+			return pseudonym
+		}
+	}
+}
+
+// runRedactSampleMode saves the records from first to last (YYYY-MM-DD,
+// inclusive) as a sample that can be attached to a bug report without
+// sharing who attended: a folder in dir holding the records as scans.csv,
+// with their tags, credits and origins, and a roster of their types. IDs are
+// pseudonymized consistently across the files and names are left out, while
+// timestamps, counts, directions, types and scan IDs are kept as recorded so
+// the problem can be reproduced. Checksums are dropped, as they no longer
+// match the changed IDs.
+func runRedactSampleMode(roster map[string]rosterEntry, prefixes map[string]string, first, last, dir string) {
+	file, err := openDataFiles()
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	records, _, _ := readRecords(file)
+	file.Close()
+
+	p, err := newPseudonymizer(prefixes)
+	if err != nil {
+		fmt.Println("Error creating pseudonym key:", err)
+		return
+	}
+	var sample [][]string
+	kept := make(map[string]bool) // note keys of the sampled records
+	var people []string
+	for _, record := range records {
+		if date := record[0][:10]; date < first || date > last {
+			continue
+		}
+		kept[noteKey(record)] = true
+		if _, ok := p.ids[record[1]]; !ok {
+			people = append(people, record[1])
+		}
+		redacted := append([]string{}, record...)
+		redacted[1] = p.pseudonym(record[1])
+		if len(redacted) > 3 {
+			redacted[3] = ""
+		}
+		sample = append(sample, redacted)
+	}
+	if len(sample) == 0 {
+		fmt.Println("No records found for the specified date range.")
+		return
+	}
+
+	folder := filepath.Join(dir, "sample_"+first+"_"+last)
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		fmt.Println("Error saving sample:", err)
+		return
+	}
+	if err := writeCSVExport(filepath.Join(folder, "scans.csv"), sample, false); err != nil {
+		fmt.Println("Error saving sample:", err)
+		return
+	}
+	for _, kind := range redactedSidecars {
+		sidecar, err := os.Open(sidecarFile(kind))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			fmt.Printf("Error reading %s file: %v\n", kind, err)
+			return
+		}
+		rows, _, _ := readDelimitedRecords(sidecar, ',')
+		sidecar.Close()
+		var redacted [][]string
+		for _, row := range rows {
+			if len(row) > 1 && kept[noteKey(row)] {
+				row[1] = p.pseudonym(row[1])
+				redacted = append(redacted, row)
+			}
+		}
+		if len(redacted) == 0 {
+			continue
+		}
+		if err := writeCSVExport(filepath.Join(folder, "scans."+kind+".csv"), redacted, false); err != nil {
+			fmt.Println("Error saving sample:", err)
+			return
+		}
+	}
+	rows := [][]string{{"id", "name", "type"}}
+	for _, id := range people {
+		rows = append(rows, []string{p.pseudonym(id), "", roster[id].Fields["type"]})
+	}
+	if err := writeCSVExport(filepath.Join(folder, "roster.csv"), rows, false); err != nil {
+		fmt.Println("Error saving sample:", err)
+		return
+	}
+	fmt.Printf("Saved a redacted sample of %d records of %d people from %s to %s in %s.\n", len(sample), len(people), first, last, folder)
+	fmt.Println("IDs are pseudonyms from a key used only for this sample; names, notes and screening answers are left out.")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// arrivedIDs returns the IDs with a check-in on a date from first to last
+// (YYYY-MM-DD, inclusive) in the records
+func arrivedIDs(records [][]string, first, last string) map[string]bool {
+	arrived := make(map[string]bool)
+	for _, record := range records {
+		date := record[0][:10]
+		if recordDirection(record) == "in" && date >= first && date <= last {
+			arrived[record[1]] = true
+		}
+	}
+	return arrived
+}
+
+// announceRegistrations tells the station whether a check-in was expected
+// and how many of the event's registered attendees have arrived today. file
+// is the data file scan mode records to and extra the unrecorded dry run
+// scans.
+func (options scanOptions) announceRegistrations(file *os.File, extra [][]string, id string) {
+	if options.Registrations == nil {
+		return
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		options.logError("Error seeking to beginning of file", err)
+		return
+	}
+	records, _, _ := readRecords(file)
+	today := time.Now().Format("2006-01-02")
+	arrived := arrivedIDs(append(records, extra...), today, today)
+	count := 0
+	for registered := range options.Registrations {
+		if arrived[registered] {
+			count++
+		}
+	}
+
+	if _, ok := options.Registrations[id]; !ok {
+		options.announce(announceWarning, "Not pre-registered for this event.",
+			"Not on the registration list. Please see the front desk.")
+	}
+	options.announce(announceInfo, fmt.Sprintf("%d of %d registered have arrived", count, len(options.Registrations)),
+		fmt.Sprintf("%d of %d registered have arrived.", count, len(options.Registrations)))
+}
+
+// runMissingMode lists the registered attendees of an event with no
+// check-in from first to last (YYYY-MM-DD, inclusive; last may be empty for
+// a single day), sorted by name
+func runMissingMode(registrations map[string]rosterEntry, first, last string) {
+	if last == "" {
+		last = first
+	}
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+	arrived := arrivedIDs(records, first, last)
+
+	var missing []string
+	for id := range registrations {
+		if !arrived[id] {
+			missing = append(missing, id)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		if registrations[missing[i]].Name != registrations[missing[j]].Name {
+			return registrations[missing[i]].Name < registrations[missing[j]].Name
+		}
+		return missing[i] < missing[j]
+	})
+
+	period := "on " + first
+	if last != first {
+		period = "from " + first + " to " + last
+	}
+	fmt.Printf("%d of %d registered have arrived %s; %d still missing:\n",
+		len(registrations)-len(missing), len(registrations), period, len(missing))
+	for _, id := range missing {
+		fmt.Printf("  %-12s %s\n", id, registrations[id].Name)
+	}
+}
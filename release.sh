@@ -0,0 +1,47 @@
+#!/bin/sh
+# release.sh builds a release: a single static binary per platform, with the
+# web pages, report templates and sounds built in, laid out for -update.
+#
+#	./release.sh 1.4.0 signing.pem
+#
+# writes dist/1.4.0/checkin-<os>-<arch> for each platform, its SHA256SUMS,
+# ending with the release's version line, SHA256SUMS.sig signed with the
+# PKCS #8 PEM Ed25519 or RSA key, and dist/latest. Copy dist/ to the update url
+# to publish it.
+set -eu
+
+if [ $# -ne 2 ]; then
+	echo "Usage: $0 <version> <signing key>" >&2
+	exit 1
+fi
+version=$1
+key=$2
+platforms="linux/amd64 linux/arm64 linux/arm darwin/amd64 darwin/arm64 windows/amd64"
+
+out=dist/$version
+rm -rf "$out"
+mkdir -p "$out"
+for platform in $platforms; do
+	os=${platform%/*}
+	arch=${platform#*/}
+	name=checkin-$os-$arch
+	if [ "$os" = windows ]; then
+		name=$name.exe
+	fi
+	echo "Building $name"
+	CGO_ENABLED=0 GOOS=$os GOARCH=$arch go build -trimpath -ldflags "-s -w -X main.version=$version" -o "$out/$name" .
+done
+
+(cd "$out" && sha256sum checkin-* > SHA256SUMS)
+# Signed along with the checksums, so -update can tell this release's files
+# from an older one's published under a newer version
+echo "version $version" >> "$out/SHA256SUMS"
+# Signed the way -sign and -update expect: Ed25519 over the file itself, RSA
+# over its SHA-256 digest
+if openssl pkey -in "$key" -noout -text 2>/dev/null | grep -q ED25519; then
+	openssl pkeyutl -sign -inkey "$key" -rawin -in "$out/SHA256SUMS" -out "$out/SHA256SUMS.sig"
+else
+	openssl dgst -sha256 -sign "$key" -out "$out/SHA256SUMS.sig" "$out/SHA256SUMS"
+fi
+echo "$version" > dist/latest
+echo "Release $version is in dist/"
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// doubleReadGap is how soon after the recorded scan a repeat attempt is
+// taken for the scanner reading the badge twice rather than someone
+// presenting it again
+const doubleReadGap = 10 * time.Second
+
+// logRepeat appends a scan refused as a duplicate to the repeats sidecar
+// file as timestamp,id,direction,type,station,previous, previous being the
+// recorded scan it repeated when known
+func logRepeat(now time.Time, id, direction, recordType, station, previous string) error {
+	row := []string{now.Format("2006-01-02T15:04:05-07:00"), id, direction, recordType, station, previous}
+	return appendCSV(sidecarFile("repeats"), row)
+}
+
+// repeatDay is one ID's refused repeat scans on one day
+type repeatDay struct {
+	Date, ID    string
+	Attempts    int
+	DoubleReads int // within doubleReadGap of the recorded scan
+	Stations    map[string]bool
+	First, Last string // times of the first and last attempt
+}
+
+// runRepeatsMode lists, per ID per day from first to last (YYYY-MM-DD,
+// inclusive), the scans refused as duplicates: how many there were, how many
+// came so soon after the recorded scan that the scanner probably read the
+// badge twice, and at which stations. IDs presented again later, or at more
+// than one station, are flagged, as a badge may be being shared. The list is
+// also saved as a CSV in dir.
+func runRepeatsMode(roster map[string]rosterEntry, first, last, dir string) {
+	file, err := os.Open(sidecarFile("repeats"))
+	if os.IsNotExist(err) {
+		fmt.Println("No repeat scans have been recorded.")
+		return
+	} else if err != nil {
+		fmt.Println("Error opening repeats file:", err)
+		return
+	}
+	records, _, _ := readDelimitedRecords(file, ',')
+	file.Close()
+	sort.SliceStable(records, func(i, j int) bool { return records[i][0] < records[j][0] })
+
+	days := make(map[string]*repeatDay)
+	var keys []string
+	for _, row := range records {
+		for len(row) < 6 {
+			row = append(row, "")
+		}
+		date := row[0][:10]
+		if date < first || date > last {
+			continue
+		}
+		key := date + " " + row[1]
+		day := days[key]
+		if day == nil {
+			day = &repeatDay{Date: date, ID: row[1], Stations: make(map[string]bool), First: row[0][11:19]}
+			days[key] = day
+			keys = append(keys, key)
+		}
+		day.Attempts++
+		day.Last = row[0][11:19]
+		if row[4] != "" {
+			day.Stations[row[4]] = true
+		}
+		attempt, err := time.Parse("2006-01-02T15:04:05-07:00", row[0])
+		previous, previousErr := time.Parse("2006-01-02T15:04:05-07:00", row[5])
+		if err == nil && previousErr == nil && attempt.Sub(previous) <= doubleReadGap {
+			day.DoubleReads++
+		}
+	}
+	if len(keys) == 0 {
+		fmt.Println("No repeat scans found for the specified date range.")
+		return
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		if days[keys[i]].Attempts != days[keys[j]].Attempts {
+			return days[keys[i]].Attempts > days[keys[j]].Attempts
+		}
+		return keys[i] < keys[j]
+	})
+
+	rows := [][]string{{"date", "id", "name", "attempts", "double_reads", "later_attempts", "stations", "first_attempt", "last_attempt"}}
+	attempts, doubleReads, flagged := 0, 0, 0
+	fmt.Printf("  %-10s  %-12s %-28s %8s %12s  %s\n", "date", "id", "name", "attempts", "double reads", "stations")
+	for _, key := range keys {
+		day := days[key]
+		var stations []string
+		for station := range day.Stations {
+			stations = append(stations, station)
+		}
+		sort.Strings(stations)
+		flag := " "
+		if day.Attempts > day.DoubleReads || len(stations) > 1 {
+			flag = "!"
+			flagged++
+		}
+		attempts += day.Attempts
+		doubleReads += day.DoubleReads
+		fmt.Printf("%s %-10s  %-12s %-28s %8d %12d  %s\n", flag, day.Date, day.ID, rosterName(roster, day.ID), day.Attempts, day.DoubleReads, strings.Join(stations, ", "))
+		rows = append(rows, []string{day.Date, day.ID, rosterName(roster, day.ID), strconv.Itoa(day.Attempts), strconv.Itoa(day.DoubleReads),
+			strconv.Itoa(day.Attempts - day.DoubleReads), strings.Join(stations, ";"), day.First, day.Last})
+	}
+	fmt.Printf("\n%d repeat scans refused; %d within %s of the recorded scan, likely scanner double reads.\n", attempts, doubleReads, humanDuration(doubleReadGap))
+	if flagged > 0 {
+		fmt.Printf("%d flagged (!) with badges presented again later or at more than one station.\n", flagged)
+	}
+
+	filename := "repeats_" + first + "_" + last + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving repeats report:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving repeats report:", err)
+		return
+	}
+	fmt.Println("\nSaved to", filename)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// replayReasons are the rules a replayed record can fail, in the order scan
+// mode applies them
+var replayReasons = []string{"invalid", "not_on_roster", "after_hours", "duplicate"}
+
+// replayRules are the rules -replay puts the recorded scans through again:
+// the badge ID formats, the roster, the operating hours and the dedupe
+// policies as they are configured now
+type replayRules struct {
+	Scanner    scannerConfig
+	Roster     map[string]rosterEntry
+	RosterOnly bool // drop IDs that aren't on the roster
+	Hours      hoursConfig
+	Dedupe     dedupeRules
+}
+
+// replayDay counts one day's records as recorded and as the rules would
+// have recorded them
+type replayDay struct {
+	Recorded int
+	Kept     int
+	Dropped  map[string]int            // by reason
+	Types    map[string]map[string]int // check-ins by record type, recorded and kept
+}
+
+// replayRecords puts every record through the rules in time order and
+// returns the reason each would have been refused, or "" when it would have
+// been recorded. Records before the first day of a report are replayed too,
+// so the dedupe policy sees the scans before it.
+func replayRecords(records [][]string, rules replayRules) []string {
+	order := make([]int, len(records))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return records[order[a]][0] < records[order[b]][0] })
+
+	reasons := make([]string, len(records))
+	lastKept := make(map[string]time.Time) // by ID and direction
+	for _, i := range order {
+		record := records[i]
+		t, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+		key := record[1] + " " + recordDirection(record)
+		switch {
+		case err != nil || !barcodePattern.MatchString(record[1]) || rules.Scanner.check(record[1], "") != nil:
+			reasons[i] = "invalid"
+		case rules.RosterOnly && rules.Roster[record[1]].ID == "":
+			reasons[i] = "not_on_roster"
+		case rules.Hours.Reject && !rules.Hours.open(t):
+			reasons[i] = "after_hours"
+		default:
+			if last, ok := lastKept[key]; ok && rules.Dedupe.forType(recordType(record)).repeats(last, t) {
+				reasons[i] = "duplicate"
+				continue
+			}
+			lastKept[key] = t
+		}
+	}
+	return reasons
+}
+
+// describePolicy describes a dedupe policy for the replay report
+func describePolicy(p dedupePolicy) string {
+	switch {
+	case p.Never:
+		return "none"
+	case p.Daily:
+		return "daily"
+	}
+	return "window of " + humanDuration(p.Window)
+}
+
+// runReplayMode re-processes the records from first to last (YYYY-MM-DD,
+// inclusive; empty for the whole file) through the current rules and reports
+// how the daily counts would differ, so a new dedupe window, ID format or
+// roster filter can be tried on past days before it is enabled at the
+// stations. The data file isn't changed. The comparison is also saved as a
+// CSV in dir.
+func runReplayMode(rules replayRules, first, last, dir string) {
+	if rules.RosterOnly && len(rules.Roster) == 0 {
+		fmt.Println("Error: -roster-only needs a roster; the roster file is missing or empty.")
+		return
+	}
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+	reasons := replayRecords(records, rules)
+
+	days := make(map[string]*replayDay)
+	var dates []string
+	for i, record := range records {
+		date := record[0][:10]
+		if first != "" && date < first || last != "" && date > last {
+			continue
+		}
+		day := days[date]
+		if day == nil {
+			day = &replayDay{Dropped: make(map[string]int), Types: make(map[string]map[string]int)}
+			days[date] = day
+			dates = append(dates, date)
+		}
+		day.Recorded++
+		kind := "check_outs"
+		if recordDirection(record) == "in" {
+			kind = "check_ins." + recordType(record)
+		}
+		if day.Types[kind] == nil {
+			day.Types[kind] = make(map[string]int)
+		}
+		day.Types[kind]["recorded"]++
+		if reasons[i] != "" {
+			day.Dropped[reasons[i]]++
+			continue
+		}
+		day.Kept++
+		day.Types[kind]["kept"]++
+	}
+	if len(dates) == 0 {
+		fmt.Println("No records to replay.")
+		return
+	}
+	sort.Strings(dates)
+	if first == "" {
+		first = dates[0]
+	}
+	if last == "" {
+		last = dates[len(dates)-1]
+	}
+
+	fmt.Printf("Replaying %s to %s under the current rules:\n", first, last)
+	fmt.Printf("  dedupe:    %s", describePolicy(rules.Dedupe.Default))
+	var types []string
+	for t := range rules.Dedupe.ByType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		fmt.Printf(", %s %s", t, describePolicy(rules.Dedupe.ByType[t]))
+	}
+	fmt.Println()
+	formats, roster, hours := "any number", "any ID", "scans at any time"
+	if len(rules.Scanner.Formats) > 0 {
+		formats = "the scanner formats"
+	}
+	if rules.RosterOnly {
+		roster = "only IDs on the roster"
+	}
+	if rules.Hours.Reject && len(rules.Hours.Weekly) > 0 {
+		hours = "refused outside operating hours"
+	}
+	fmt.Printf("  ID format: %s\n  roster:    %s\n  hours:     %s\n\n", formats, roster, hours)
+
+	header := append([]string{"date", "recorded", "would_record", "difference"}, replayReasons...)
+	rows := [][]string{header}
+	fmt.Printf("%-10s  %8s  %12s  %10s  %7s  %13s  %11s  %9s\n", "date", "recorded", "would_record", "difference", "invalid", "not_on_roster", "after_hours", "duplicate")
+	total := replayDay{Dropped: make(map[string]int), Types: make(map[string]map[string]int)}
+	for _, date := range dates {
+		day := days[date]
+		row := []string{date, strconv.Itoa(day.Recorded), strconv.Itoa(day.Kept), strconv.Itoa(day.Kept - day.Recorded)}
+		for _, reason := range replayReasons {
+			row = append(row, strconv.Itoa(day.Dropped[reason]))
+			total.Dropped[reason] += day.Dropped[reason]
+		}
+		rows = append(rows, row)
+		fmt.Printf("%-10s  %8d  %12d  %+10d  %7d  %13d  %11d  %9d\n", date, day.Recorded, day.Kept, day.Kept-day.Recorded,
+			day.Dropped["invalid"], day.Dropped["not_on_roster"], day.Dropped["after_hours"], day.Dropped["duplicate"])
+		total.Recorded += day.Recorded
+		total.Kept += day.Kept
+		for kind, counts := range day.Types {
+			if total.Types[kind] == nil {
+				total.Types[kind] = make(map[string]int)
+			}
+			total.Types[kind]["recorded"] += counts["recorded"]
+			total.Types[kind]["kept"] += counts["kept"]
+		}
+	}
+	row := []string{"total", strconv.Itoa(total.Recorded), strconv.Itoa(total.Kept), strconv.Itoa(total.Kept - total.Recorded)}
+	for _, reason := range replayReasons {
+		row = append(row, strconv.Itoa(total.Dropped[reason]))
+	}
+	rows = append(rows, row)
+	fmt.Printf("%-10s  %8d  %12d  %+10d  %7d  %13d  %11d  %9d\n\n", "total", total.Recorded, total.Kept, total.Kept-total.Recorded,
+		total.Dropped["invalid"], total.Dropped["not_on_roster"], total.Dropped["after_hours"], total.Dropped["duplicate"])
+
+	var kinds []string
+	for kind := range total.Types {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		recorded, kept := total.Types[kind]["recorded"], total.Types[kind]["kept"]
+		fmt.Printf("  %-24s %d -> %d\n", kind, recorded, kept)
+	}
+	if total.Kept == total.Recorded {
+		fmt.Println("\nThe current rules would have recorded the same scans.")
+	} else {
+		fmt.Printf("\nThe current rules would have recorded %d of %d scans (%+d).\n", total.Kept, total.Recorded, total.Kept-total.Recorded)
+	}
+
+	filename := "replay_" + first + "_" + last + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving report:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving report:", err)
+		return
+	}
+	fmt.Println("Saved to", filename)
+}
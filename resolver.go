@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultResolverTimeout is how long a REST resolver waits for an answer
+	// when its step doesn't say
+	defaultResolverTimeout = 5 * time.Second
+
+	// defaultResolverCacheFor is how long a REST resolver remembers a lookup
+	// when its step doesn't say
+	defaultResolverCacheFor = time.Hour
+)
+
+// resolverTypes are the kinds of step in the resolver chain
+var resolverTypes = []string{"roster", "ldap", "rest", "unknown"}
+
+// resolverConfig is one step of the config file's "resolvers" chain, which
+// scan mode asks in order for the name and details of each scanned ID until
+// one knows it. roster is the roster file, ldap the config file's ldap
+// directory and rest a lookup URL; unknown, which ends the chain, says what
+// happens to an ID none of them knows. Without a chain, IDs are looked up in
+// the roster and then the ldap directory, and unknown IDs are recorded
+// without a name.
+type resolverConfig struct {
+	Type string `json:"type"` // roster, ldap, rest or unknown
+
+	// rest: the member's JSON object is fetched from URL, with {id} replaced
+	// by the ID; a 404 means the source doesn't know it. Its fields become
+	// roster fields, with NameField (default "name") as the name.
+	URL       string            `json:"url"`     // e.g. https://members.example.org/api/members/{id}
+	Headers   map[string]string `json:"headers"` // sent with each request, e.g. "Authorization": "Bearer ..."
+	NameField string            `json:"name_field"`
+
+	Timeout  duration `json:"timeout"`   // ldap and rest: how long to wait before asking the next step; default 5s
+	CacheFor duration `json:"cache_for"` // ldap and rest: how long lookups, including misses, are remembered; default 1h
+
+	// unknown: "record" (default) records the scan, with the name and
+	// record_type when set, e.g. "Walk-in" and "visitor"; "reject" refuses it
+	Action string `json:"action"`
+	Name   string `json:"name"`
+	Kind   string `json:"record_type"`
+}
+
+// checkResolvers validates the resolver chain
+func checkResolvers(chain []resolverConfig, directory ldapConfig) error {
+	for i, step := range chain {
+		if !contains(resolverTypes, step.Type) {
+			return fmt.Errorf("resolvers: type must be roster, ldap, rest or unknown, not %q", step.Type)
+		}
+		switch {
+		case step.Type == "ldap" && directory.URL == "":
+			return fmt.Errorf("resolvers: the ldap step needs the config file's ldap url")
+		case step.Type == "rest" && !strings.Contains(step.URL, "{id}"):
+			return fmt.Errorf("resolvers: the rest url %q has no {id}", step.URL)
+		case step.Type == "unknown" && i != len(chain)-1:
+			return fmt.Errorf("resolvers: the unknown step must come last")
+		case step.Type == "unknown" && step.Action != "" && step.Action != "record" && step.Action != "reject":
+			return fmt.Errorf("resolvers: the unknown action must be record or reject, not %q", step.Action)
+		case step.Kind != "" && !contains(recordTypes, step.Kind):
+			return fmt.Errorf("resolvers: unknown record type %q", step.Kind)
+		}
+	}
+	return nil
+}
+
+// resolverStep is one step of a chain, with the resolver that does its
+// lookups
+type resolverStep struct {
+	settings resolverConfig
+	ldap     *ldapResolver
+	rest     *restResolver
+}
+
+// resolverChain looks scanned IDs up in order, roster first by default
+type resolverChain struct {
+	steps   []resolverStep
+	unknown resolverConfig // the closing unknown step; its zero value records unknown IDs without a name
+}
+
+// newResolverChain returns the config file's resolver chain, or the roster
+// followed by the ldap directory when there is none
+func newResolverChain(chain []resolverConfig, directory ldapConfig) *resolverChain {
+	if len(chain) == 0 {
+		chain = []resolverConfig{{Type: "roster"}}
+		if directory.URL != "" {
+			chain = append(chain, resolverConfig{Type: "ldap"})
+		}
+	}
+	c := &resolverChain{}
+	for _, settings := range chain {
+		step := resolverStep{settings: settings}
+		switch settings.Type {
+		case "ldap":
+			if settings.CacheFor > 0 {
+				directory.CacheFor = settings.CacheFor
+			}
+			step.ldap = newLDAPResolver(directory)
+			if settings.Timeout > 0 {
+				step.ldap.timeout = time.Duration(settings.Timeout)
+			}
+		case "rest":
+			step.rest = newRESTResolver(settings)
+		case "unknown":
+			c.unknown = settings
+			continue
+		}
+		c.steps = append(c.steps, step)
+	}
+	return c
+}
+
+// resolve returns the entry of the first step in the chain that knows id,
+// and that step's type, or the unknown step's entry with the type "unknown"
+// when none does. Steps that fail, e.g. a directory that timed out, are
+// passed over and their errors returned, so a source being down only costs
+// the names it would have given.
+func (c *resolverChain) resolve(id string, roster map[string]rosterEntry, now time.Time) (rosterEntry, string, []error) {
+	var errs []error
+	for _, step := range c.steps {
+		var entry rosterEntry
+		var found bool
+		var err error
+		switch step.settings.Type {
+		case "roster":
+			entry, found = roster[id]
+		case "ldap":
+			entry, found, err = step.ldap.resolve(id, now)
+		case "rest":
+			entry, found, err = step.rest.resolve(id, now)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", step.settings.Type, err))
+			continue
+		}
+		if found {
+			return entry, step.settings.Type, errs
+		}
+	}
+	entry := rosterEntry{ID: id, Name: c.unknown.Name, Fields: map[string]string{"id": id}}
+	if c.unknown.Name != "" {
+		entry.Fields["name"] = c.unknown.Name
+	}
+	if c.unknown.Kind != "" {
+		entry.Fields["type"] = c.unknown.Kind
+	}
+	return entry, "unknown", errs
+}
+
+// rejectsUnknown reports whether IDs nothing in the chain knows are refused
+func (c *resolverChain) rejectsUnknown() bool {
+	return c.unknown.Action == "reject"
+}
+
+// restResolver looks IDs up at a REST endpoint, remembering the results
+type restResolver struct {
+	settings resolverConfig
+	client   http.Client
+	cache    map[string]lookupResult
+}
+
+// newRESTResolver returns a resolver for the step
+func newRESTResolver(settings resolverConfig) *restResolver {
+	timeout := defaultResolverTimeout
+	if settings.Timeout > 0 {
+		timeout = time.Duration(settings.Timeout)
+	}
+	if settings.CacheFor <= 0 {
+		settings.CacheFor = duration(defaultResolverCacheFor)
+	}
+	if settings.NameField == "" {
+		settings.NameField = "name"
+	}
+	return &restResolver{settings: settings, client: http.Client{Timeout: timeout}, cache: make(map[string]lookupResult)}
+}
+
+// resolve fetches an ID's member from the endpoint as a roster entry. Failed
+// lookups aren't remembered.
+func (r *restResolver) resolve(id string, now time.Time) (rosterEntry, bool, error) {
+	if cached, ok := r.cache[id]; ok && now.Sub(cached.at) < time.Duration(r.settings.CacheFor) {
+		return cached.entry, cached.found, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.ReplaceAll(r.settings.URL, "{id}", url.PathEscape(id)), nil)
+	if err != nil {
+		return rosterEntry{}, false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range r.settings.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return rosterEntry{}, false, err
+	}
+	defer resp.Body.Close()
+
+	result := lookupResult{at: now}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		decoder := json.NewDecoder(resp.Body)
+		decoder.UseNumber()
+		var member map[string]interface{}
+		if err := decoder.Decode(&member); err != nil {
+			return rosterEntry{}, false, fmt.Errorf("reading response: %w", err)
+		}
+		entry := rosterEntry{ID: id, Fields: map[string]string{}}
+		for key, value := range member {
+			entry.Fields[strings.ToLower(strings.TrimSpace(key))] = jsonText(value)
+		}
+		entry.Name = jsonText(member[r.settings.NameField])
+		entry.Fields["id"], entry.Fields["name"] = id, entry.Name
+		result.entry, result.found = entry, true
+	case http.StatusNotFound:
+	default:
+		return rosterEntry{}, false, fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	r.cache[id] = result
+	return result.entry, result.found, nil
+}
+
+// runResolveMode looks an ID up through the resolver chain and says which
+// step knew it, to check the resolvers settings
+func runResolveMode(chain *resolverChain, roster map[string]rosterEntry, id string) {
+	entry, source, errs := chain.resolve(id, roster, time.Now())
+	for _, err := range errs {
+		fmt.Println("Error looking up ID:", err)
+	}
+	if source == "unknown" {
+		action := "recorded"
+		if chain.rejectsUnknown() {
+			action = "refused"
+		}
+		fmt.Printf("%s is unknown to every resolver; scans of it are %s", id, action)
+		if entry.Name != "" && !chain.rejectsUnknown() {
+			fmt.Printf(" as %s", entry.Name)
+		}
+		fmt.Println(".")
+		return
+	}
+	fmt.Printf("%s: %s (from %s)\n", id, entry.Name, source)
+	if entry.Fields["type"] != "" {
+		fmt.Println("Record type:", entry.Fields["type"])
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// retentionPeriod numbers the weeks or months check-ins fall in, so cohorts
+// and the periods after them can be counted with plain arithmetic
+type retentionPeriod string
+
+// index returns the number of the week or month containing t, counting weeks
+// from the Monday of the Unix epoch week
+func (p retentionPeriod) index(t time.Time) int {
+	if p == "month" {
+		return t.Year()*12 + int(t.Month()) - 1
+	}
+	days := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+	return int((days + 3) / 7) // 1970-01-01 was a Thursday
+}
+
+// label returns the YYYY-MM month or YYYY-Www ISO week with the given number
+func (p retentionPeriod) label(index int) string {
+	if p == "month" {
+		return fmt.Sprintf("%04d-%02d", index/12, index%12+1)
+	}
+	monday := time.Unix(int64(index*7-3)*86400, 0).UTC()
+	year, week := monday.ISOWeek()
+	return fmt.Sprintf("%04d-W%02d", year, week)
+}
+
+// runRetentionMode groups people by the week or month of their first
+// check-in and shows what fraction of each cohort checked in again in each
+// following period. Cohorts are limited to those starting from first to last
+// (YYYY-MM-DD, either may be empty), while return visits are counted up to
+// today. Periods the facility was closed throughout, for the closures and
+// operating hours in cfg, are shown as closed and left out of the average
+// row. The matrix is also saved as a CSV in dir.
+func runRetentionMode(period retentionPeriod, cfg config, first, last, dir string) {
+	file, err := openDataFiles()
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	records, _, _ := readRecords(file)
+	file.Close()
+
+	// Earliest check-in and every period each ID checked in during
+	firstSeen := make(map[string]time.Time)
+	active := make(map[string]map[int]bool)
+	for _, record := range records {
+		if recordDirection(record) != "in" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+		if err != nil {
+			continue
+		}
+		t = t.In(time.Local)
+		id := record[1]
+		if seen, ok := firstSeen[id]; !ok || t.Before(seen) {
+			firstSeen[id] = t
+		}
+		if active[id] == nil {
+			active[id] = make(map[int]bool)
+		}
+		active[id][period.index(t)] = true
+	}
+
+	cohorts := make(map[int][]string)
+	var earliest time.Time
+	for id, t := range firstSeen {
+		date := t.Format("2006-01-02")
+		if (first != "" && date < first) || (last != "" && date > last) {
+			continue
+		}
+		cohorts[period.index(t)] = append(cohorts[period.index(t)], id)
+		if earliest.IsZero() || t.Before(earliest) {
+			earliest = t
+		}
+	}
+	if len(cohorts) == 0 {
+		fmt.Println("No first-time attendees in that range.")
+		return
+	}
+	var starts []int
+	for start := range cohorts {
+		starts = append(starts, start)
+	}
+	sort.Ints(starts)
+	current := period.index(time.Now())
+	width := current - starts[0] + 1
+
+	// Periods with at least one open day
+	open := make(map[int]bool)
+	for day := earliest; !day.After(time.Now()); day = day.AddDate(0, 0, 1) {
+		if cfg.openOn(day.Format("2006-01-02")) {
+			open[period.index(day)] = true
+		}
+	}
+	sums, cells := make([]float64, width), make([]int, width)
+
+	header := []string{"cohort", "size"}
+	fmt.Printf("%-9s %6s", "cohort", "size")
+	for k := 0; k < width; k++ {
+		header = append(header, fmt.Sprintf("%s_%d", period, k))
+		fmt.Printf(" %6s", fmt.Sprintf("+%d", k))
+	}
+	fmt.Println()
+	rows := [][]string{header}
+	for _, start := range starts {
+		ids := cohorts[start]
+		row := []string{period.label(start), strconv.Itoa(len(ids))}
+		fmt.Printf("%-9s %6d", row[0], len(ids))
+		for k := 0; start+k <= current; k++ {
+			if !open[start+k] {
+				row = append(row, "closed")
+				fmt.Printf(" %6s", "closed")
+				continue
+			}
+			returned := 0
+			for _, id := range ids {
+				if active[id][start+k] {
+					returned++
+				}
+			}
+			fraction := float64(returned) / float64(len(ids))
+			sums[k] += fraction
+			cells[k]++
+			row = append(row, strconv.FormatFloat(fraction, 'f', 3, 64))
+			fmt.Printf(" %5.0f%%", fraction*100)
+		}
+		fmt.Println()
+		rows = append(rows, row)
+	}
+	row := []string{"average", ""}
+	fmt.Printf("%-9s %6s", "average", "")
+	for k := 0; k < width; k++ {
+		if cells[k] == 0 {
+			row = append(row, "")
+			fmt.Printf(" %6s", "")
+			continue
+		}
+		row = append(row, strconv.FormatFloat(sums[k]/float64(cells[k]), 'f', 3, 64))
+		fmt.Printf(" %5.0f%%", sums[k]/float64(cells[k])*100)
+	}
+	fmt.Println()
+	rows = append(rows, row)
+
+	filename := "retention_" + string(period) + "_" + period.label(starts[0]) + "_" + period.label(starts[len(starts)-1]) + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving retention report:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving retention report:", err)
+		return
+	}
+	fmt.Println("\nSaved to", filename)
+}
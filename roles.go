@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"strings"
+)
+
+// role is a permission level. Each role can do everything the roles below it
+// can.
+type role int
+
+const (
+	roleNone     role = iota
+	roleViewer        // watch, search, check and read-only server endpoints
+	roleOperator      // also scan
+	roleAdmin         // also export, list attendees by name, edit the data file and run scheduled jobs
+)
+
+// roleNames maps config role names to roles
+var roleNames = map[string]role{
+	"viewer":   roleViewer,
+	"operator": roleOperator,
+	"admin":    roleAdmin,
+}
+
+// String returns the config name of the role
+func (r role) String() string {
+	for name, value := range roleNames {
+		if value == r {
+			return name
+		}
+	}
+	return "none"
+}
+
+// parseRole returns the role with the given config name
+func parseRole(name string) (role, error) {
+	r, ok := roleNames[strings.ToLower(name)]
+	if !ok {
+		return roleNone, fmt.Errorf("unknown role %q (expected viewer, operator or admin)", name)
+	}
+	return r, nil
+}
+
+// usersPolicy is the users policy file, giving roles (viewer, operator or
+// admin) by login name for commands
+type usersPolicy struct {
+	Users map[string]string `json:"users"`
+}
+
+// loadUsersPolicy reads the users policy from usersPolicyFile. It's at a fixed
+// path and not in the config file, because whoever runs a command chooses
+// the config file with -config, and could pick one without users to make
+// themselves an admin. A missing file yields no users.
+func loadUsersPolicy() (map[string]string, error) {
+	data, err := os.ReadFile(usersPolicyFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var policy usersPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", usersPolicyFile, err)
+	}
+	return policy.Users, nil
+}
+
+// authorize checks that the user running the command has at least the needed
+// role. Users are matched by their login name against the users policy file.
+// Without one everyone is an admin, as before roles existed, unless the config
+// file still lists users, which must be moved to the policy file rather than
+// silently stop applying.
+func (cfg config) authorize(needed role, action string) error {
+	users, err := loadUsersPolicy()
+	if err != nil {
+		return fmt.Errorf("reading the users policy: %w", err)
+	}
+	if len(users) == 0 {
+		if len(cfg.Users) > 0 {
+			return fmt.Errorf("users in the config file are no longer used; move them to %s, writable only by administrators", usersPolicyFile)
+		}
+		return nil
+	}
+	current, err := user.Current()
+	if err != nil {
+		return fmt.Errorf("looking up the current user: %w", err)
+	}
+	name, ok := users[current.Username]
+	if !ok {
+		return fmt.Errorf("user %s is not listed in %s", current.Username, usersPolicyFile)
+	}
+	have, err := parseRole(name)
+	if err != nil {
+		return fmt.Errorf("user %s: %w", current.Username, err)
+	}
+	if have < needed {
+		return fmt.Errorf("%s needs the %s role, but %s has the %s role", action, needed, current.Username, have)
+	}
+	return nil
+}
+
+// requireToken wraps a server handler so it only runs for requests carrying
+// an API token from the config file with at least the needed role, given as
+// "Authorization: Bearer <token>" or, from a browser, as the password of HTTP
+// basic authentication. Without any tokens in the config file only viewer
+// endpoints are open; the others are refused, since the server listens on
+// every interface and anyone on the network could otherwise record scans or
+// read the records.
+func (cfg config) requireToken(needed role, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(cfg.APITokens) == 0 {
+			if needed > roleViewer {
+				http.Error(w, "this endpoint needs an API token with the "+needed.String()+" role in the config file's api_tokens", http.StatusForbidden)
+				return
+			}
+			handler(w, r)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if _, password, ok := r.BasicAuth(); ok {
+			token = password
+		}
+		have := roleNone
+		for candidate, name := range cfg.APITokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+				have, _ = parseRole(name)
+			}
+		}
+		if have == roleNone {
+			w.Header().Set("WWW-Authenticate", `Basic realm="checkin"`)
+			http.Error(w, "missing or unknown API token", http.StatusUnauthorized)
+			return
+		}
+		if have < needed {
+			http.Error(w, "this API token needs the "+needed.String()+" role", http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}
+}
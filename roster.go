@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// rosterEntry is one member from the roster file. Columns other than id and
+// name are kept in Fields keyed by their header so sites can add their own.
+type rosterEntry struct {
+	ID     string
+	Name   string
+	Fields map[string]string
+}
+
+// loadRoster reads a roster CSV with a header row containing at least an "id"
+// column. A missing file is not an error and yields an empty roster.
+func loadRoster(path string) (map[string]rosterEntry, error) {
+	roster := make(map[string]rosterEntry)
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return roster, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return roster, nil
+	}
+
+	header := rows[0]
+	trimBOM(header)
+	idColumn := -1
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(column))
+		if header[i] == "id" {
+			idColumn = i
+		}
+	}
+	if idColumn < 0 {
+		return nil, fmt.Errorf("roster %s has no id column", path)
+	}
+
+	encoded := true
+	for _, row := range rows[1:] {
+		if idColumn >= len(row) || row[idColumn] == "" {
+			continue
+		}
+		for _, value := range row {
+			encoded = encoded && utf8.ValidString(value)
+		}
+		entry := rosterEntry{Fields: make(map[string]string)}
+		for i, value := range row {
+			if i >= len(header) {
+				break
+			}
+			entry.Fields[header[i]] = value
+		}
+		entry.ID = entry.Fields["id"]
+		entry.Name = entry.Fields["name"]
+		roster[entry.ID] = entry
+	}
+	if !encoded {
+		fmt.Printf("Warning: roster %s is not UTF-8, so names with accents or non-Latin letters will show wrongly. Save it from Excel as \"CSV UTF-8\".\n", path)
+	}
+
+	return roster, nil
+}
+
+// rosterActive reports whether a member may check in. Members are active
+// unless their "active" column says false, no or 0, as the admin page sets
+// when deactivating them.
+func rosterActive(entry rosterEntry) bool {
+	switch strings.ToLower(strings.TrimSpace(entry.Fields["active"])) {
+	case "false", "no", "0":
+		return false
+	}
+	return true
+}
+
+// rosterName returns the member's name for an ID, or an empty string if the ID
+// isn't on the roster
+func rosterName(roster map[string]rosterEntry, id string) string {
+	return roster[id].Name
+}
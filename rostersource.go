@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRosterSyncInterval is how often the roster is fetched from its
+// source when the config doesn't say
+const defaultRosterSyncInterval = 15 * time.Minute
+
+// rosterSourceConfig is a REST endpoint, such as a membership system's API,
+// the roster is fetched from. The members replace the roster CSV, which every
+// mode keeps reading, so the station still works from the last copy while the
+// endpoint is down.
+type rosterSourceConfig struct {
+	URL      string            `json:"url"`
+	Headers  map[string]string `json:"headers"`  // sent with each request, e.g. "Authorization": "Bearer ..."
+	Interval duration          `json:"interval"` // time between fetches; default 15m
+
+	// The response is a JSON array of member objects, or an object holding
+	// the array under Items. Each member's fields become roster columns,
+	// with IDField and NameField (default "id" and "name") renamed to id and
+	// name.
+	Items     string `json:"items"`
+	IDField   string `json:"id_field"`
+	NameField string `json:"name_field"`
+}
+
+// interval returns the time between fetches
+func (s rosterSourceConfig) interval() time.Duration {
+	if s.Interval <= 0 {
+		return defaultRosterSyncInterval
+	}
+	return time.Duration(s.Interval)
+}
+
+// fetchRoster gets the members from the source, each as its fields by column
+func fetchRoster(source rosterSourceConfig) ([]map[string]string, error) {
+	req, err := http.NewRequest(http.MethodGet, source.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range source.Headers {
+		req.Header.Set(name, value)
+	}
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("roster source returned %s", resp.Status)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	var items []map[string]interface{}
+	if source.Items == "" {
+		err = decoder.Decode(&items)
+	} else {
+		var body map[string]json.RawMessage
+		if err = decoder.Decode(&body); err == nil {
+			list, ok := body[source.Items]
+			if !ok {
+				return nil, fmt.Errorf("roster source response has no %q field", source.Items)
+			}
+			inner := json.NewDecoder(strings.NewReader(string(list)))
+			inner.UseNumber()
+			err = inner.Decode(&items)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading roster source response: %w", err)
+	}
+
+	idField, nameField := source.IDField, source.NameField
+	if idField == "" {
+		idField = "id"
+	}
+	if nameField == "" {
+		nameField = "name"
+	}
+	members := make([]map[string]string, 0, len(items))
+	for _, item := range items {
+		member := make(map[string]string)
+		for key, value := range item {
+			column := strings.ToLower(strings.TrimSpace(key))
+			switch key {
+			case idField:
+				column = "id"
+			case nameField:
+				column = "name"
+			}
+			member[column] = jsonText(value)
+		}
+		if member["id"] != "" {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+// jsonText returns a JSON value decoded with UseNumber as a roster column's
+// text: strings as they are, numbers and booleans as written, null as empty
+// and anything else as its JSON
+func jsonText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// syncRoster replaces the roster at path with the source's members and
+// returns how many there are. Columns the source doesn't have, such as the
+// family and caregivers columns -link keeps, are carried over for members
+// already on the roster. An empty member list is refused rather than
+// emptying the roster.
+func syncRoster(source rosterSourceConfig, path string) (int, error) {
+	members, err := fetchRoster(source)
+	if err != nil {
+		return 0, err
+	}
+	if len(members) == 0 {
+		return 0, fmt.Errorf("roster source returned no members; keeping the current roster")
+	}
+
+	columns := make(map[string]bool)
+	for _, member := range members {
+		for column := range member {
+			columns[column] = true
+		}
+	}
+	header := []string{"id", "name"}
+	var fetched []string
+	for column := range columns {
+		if column != "id" && column != "name" {
+			fetched = append(fetched, column)
+		}
+	}
+	sort.Strings(fetched)
+	header = append(header, fetched...)
+
+	// A missing or unreadable roster has nothing to carry over
+	local, _ := readRosterTable(path)
+	if local != nil {
+		for _, column := range local.header {
+			if column = strings.ToLower(strings.TrimSpace(column)); column != "" && !columns[column] && !contains(header, column) {
+				header = append(header, column)
+			}
+		}
+	}
+
+	table := &rosterTable{header: header}
+	for _, member := range members {
+		row := make([]string, len(header))
+		var old []string
+		if local != nil {
+			old = local.row(member["id"])
+		}
+		for i, column := range header {
+			if value, ok := member[column]; ok {
+				row[i] = value
+			} else if old != nil {
+				row[i] = local.get(old, column)
+			}
+		}
+		table.rows = append(table.rows, row)
+	}
+	if err := table.write(path); err != nil {
+		return 0, err
+	}
+	return len(members), nil
+}
+
+// startRosterSync fetches the roster from its source now and then every
+// interval in the background, passing failures to report. The previous
+// roster stays in place after a failure.
+func startRosterSync(source rosterSourceConfig, path string, report func(error)) {
+	go func() {
+		for {
+			if _, err := syncRoster(source, path); err != nil {
+				report(err)
+			}
+			time.Sleep(source.interval())
+		}
+	}()
+}
+
+// runSyncRosterMode fetches the roster from its source once
+func runSyncRosterMode(source rosterSourceConfig, path string) {
+	if source.URL == "" {
+		fmt.Println("Error: No roster_source is set in the config file.")
+		return
+	}
+	n, err := syncRoster(source, path)
+	if err != nil {
+		fmt.Println("Error syncing roster:", err)
+		return
+	}
+	fmt.Printf("Saved %d members from the roster source to %s.\n", n, path)
+}
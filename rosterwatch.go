@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// rosterPollInterval is how often a watched roster file is checked for
+	// changes
+	rosterPollInterval = 5 * time.Second
+
+	// maxRosterChangesListed is how many added or removed people a reload's
+	// log line names before summing up the rest
+	maxRosterChangesListed = 5
+)
+
+// rosterWatcher keeps a roster current with its file for the modes that run
+// all day, so people registered at the office, or synced from the
+// roster_source, are recognized without restarting the station. The file is
+// checked every rosterPollInterval and whenever the roster is asked for; a
+// file that can't be read, e.g. one still being saved, or comes back empty
+// keeps the roster loaded until the next change.
+type rosterWatcher struct {
+	path   string
+	report func(change string, err error) // called with what a reload changed, or why it failed
+	done   chan struct{}                  // closed by stop
+
+	mu       sync.Mutex
+	modified time.Time
+	size     int64
+	roster   map[string]rosterEntry
+	names    map[string]string // ID to name, to tell what the next reload changed
+	changed  bool              // reloaded since the roster was last asked for
+}
+
+// watchRoster starts watching the file the roster was loaded from, until
+// the watcher is stopped
+func watchRoster(path string, roster map[string]rosterEntry, report func(change string, err error)) *rosterWatcher {
+	w := &rosterWatcher{path: path, report: report, done: make(chan struct{}), roster: roster, names: rosterNames(roster)}
+	if info, err := os.Stat(path); err == nil {
+		w.modified, w.size = info.ModTime(), info.Size()
+	}
+	go func() {
+		ticker := time.NewTicker(rosterPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.check()
+			case <-w.done:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// stop stops polling the file, so a mode that returns, such as scan mode
+// restarted by -supervise, doesn't leave its watcher behind
+func (w *rosterWatcher) stop() {
+	close(w.done)
+}
+
+// current returns the roster, after checking the file, and whether it was
+// reloaded since the last call
+func (w *rosterWatcher) current() (map[string]rosterEntry, bool) {
+	w.check()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	changed := w.changed
+	w.changed = false
+	return w.roster, changed
+}
+
+// check reloads the roster when its file changed. A failed reload is only
+// reported once per change to the file.
+func (w *rosterWatcher) check() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	info, err := os.Stat(w.path)
+	if err != nil || (info.ModTime().Equal(w.modified) && info.Size() == w.size) {
+		return
+	}
+	w.modified, w.size = info.ModTime(), info.Size()
+	roster, err := loadRoster(w.path)
+	if err == nil && len(roster) == 0 && len(w.names) > 0 {
+		err = fmt.Errorf("%s has no one on it; keeping the %d people loaded", w.path, len(w.names))
+	}
+	if err != nil {
+		w.report("", err)
+		return
+	}
+	w.report(describeRosterChange(w.path, w.names, roster), nil)
+	w.roster, w.names, w.changed = roster, rosterNames(roster), true
+}
+
+// rosterNames returns the names on a roster by ID
+func rosterNames(roster map[string]rosterEntry) map[string]string {
+	names := make(map[string]string, len(roster))
+	for id, entry := range roster {
+		names[id] = entry.Name
+	}
+	return names
+}
+
+// describeRosterChange says who a reload added and removed, e.g. "Reloaded
+// roster.csv (120 people): 2 added (1042 Dana Smith, 1043 Lee Park), 1
+// removed (1001 Sam Ortiz)"
+func describeRosterChange(path string, before map[string]string, after map[string]rosterEntry) string {
+	var added, removed []string
+	for id, entry := range after {
+		if _, ok := before[id]; !ok {
+			added = append(added, strings.TrimSpace(id+" "+entry.Name))
+		}
+	}
+	for id, name := range before {
+		if _, ok := after[id]; !ok {
+			removed = append(removed, strings.TrimSpace(id+" "+name))
+		}
+	}
+	// list names up to maxRosterChangesListed people
+	list := func(people []string) string {
+		sort.Strings(people)
+		if len(people) > maxRosterChangesListed {
+			return strings.Join(people[:maxRosterChangesListed], ", ") + fmt.Sprintf(" and %d more", len(people)-maxRosterChangesListed)
+		}
+		return strings.Join(people, ", ")
+	}
+
+	text := fmt.Sprintf("Reloaded %s (%d people)", path, len(after))
+	var changes []string
+	if len(added) > 0 {
+		changes = append(changes, fmt.Sprintf("%d added (%s)", len(added), list(added)))
+	}
+	if len(removed) > 0 {
+		changes = append(changes, fmt.Sprintf("%d removed (%s)", len(removed), list(removed)))
+	}
+	if len(changes) == 0 {
+		return text + ": details changed, no one added or removed"
+	}
+	return text + ": " + strings.Join(changes, ", ")
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// scannerConfig describes what the barcode scanner adds around each badge
+// number, so it can be removed before the ID is checked
+type scannerConfig struct {
+	StripPrefixes []string `json:"strip_prefixes"` // removed from the start of a scan, e.g. "B:"
+	StripSuffixes []string `json:"strip_suffixes"` // removed from the end of a scan
+	SymbologyIDs  bool     `json:"symbology_ids"`  // remove a leading AIM symbology identifier such as ]C0
+
+	// The IDs badges can carry, so partial reads are refused instead of
+	// passing as shorter numbers. A read must match one of the formats for
+	// its symbology, or when there are none of those one of the formats for
+	// any symbology. Formats naming a symbology need symbology_ids.
+	Formats []idFormat `json:"formats"`
+
+	// Repeat reads of the same badge closer together than this, as scanners
+	// in auto-sense mode often send, are silently ignored, e.g. "750ms"
+	Debounce duration `json:"debounce"`
+}
+
+// idFormat is one ID format badges can carry
+type idFormat struct {
+	Symbology string `json:"symbology"` // e.g. code39 (see symbologyNames); empty for any
+	Length    int    `json:"length"`    // exact length, or
+	MinLength int    `json:"min_length"`
+	MaxLength int    `json:"max_length"`
+	Pattern   string `json:"pattern"` // regular expression the whole ID must match
+	pattern   *regexp.Regexp
+}
+
+// symbologyNames names the barcode types by the code character of their AIM
+// identifier
+var symbologyNames = map[byte]string{
+	'A': "code39",
+	'C': "code128",
+	'E': "ean",
+	'F': "codabar",
+	'G': "code93",
+	'I': "itf",
+	'L': "pdf417",
+	'Q': "qr",
+	'd': "datamatrix",
+	'e': "databar",
+	'z': "aztec",
+}
+
+// symbologyID matches an AIM symbology identifier, which some scanners send
+// before the data to name the barcode type
+var symbologyID = regexp.MustCompile(`^\][A-Za-z][0-9A-Za-z]`)
+
+// normalize turns a raw scanner read into a badge ID and the name of its
+// symbology when the scanner sent one. Whitespace and control characters such
+// as tabs, carriage returns and group separators are dropped wherever they
+// appear, then the identifier and the first matching prefix and suffix are
+// removed.
+func (settings scannerConfig) normalize(raw string) (string, string) {
+	id := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, raw)
+
+	symbology := ""
+	if settings.SymbologyIDs {
+		if identifier := symbologyID.FindString(id); identifier != "" {
+			symbology = symbologyNames[identifier[1]]
+			if symbology == "" {
+				symbology = identifier
+			}
+			id = id[len(identifier):]
+		}
+	}
+	for _, prefix := range settings.StripPrefixes {
+		if prefix != "" && strings.HasPrefix(id, prefix) {
+			id = strings.TrimPrefix(id, prefix)
+			break
+		}
+	}
+	for _, suffix := range settings.StripSuffixes {
+		if suffix != "" && strings.HasSuffix(id, suffix) {
+			id = strings.TrimSuffix(id, suffix)
+			break
+		}
+	}
+	return id, symbology
+}
+
+// compile checks the formats, compiling their patterns
+func (settings scannerConfig) compile() error {
+	for i := range settings.Formats {
+		format := &settings.Formats[i]
+		if format.Symbology != "" && !settings.SymbologyIDs {
+			return fmt.Errorf("scanner format for %s needs symbology_ids", format.Symbology)
+		}
+		if format.Pattern != "" {
+			pattern, err := regexp.Compile("^(?:" + format.Pattern + ")$")
+			if err != nil {
+				return fmt.Errorf("scanner format pattern %q: %w", format.Pattern, err)
+			}
+			format.pattern = pattern
+		}
+	}
+	return nil
+}
+
+// check returns an error when the formats don't allow an ID read from a
+// barcode of the symbology
+func (settings scannerConfig) check(id, symbology string) error {
+	var formats []idFormat
+	for _, format := range settings.Formats {
+		if format.Symbology != "" && strings.EqualFold(format.Symbology, symbology) {
+			formats = append(formats, format)
+		}
+	}
+	if len(formats) == 0 {
+		for _, format := range settings.Formats {
+			if format.Symbology == "" {
+				formats = append(formats, format)
+			}
+		}
+	}
+	if len(formats) == 0 {
+		return nil
+	}
+	for _, format := range formats {
+		if format.matches(id) {
+			return nil
+		}
+	}
+	if symbology == "" {
+		return fmt.Errorf("%q doesn't match the badge ID formats", id)
+	}
+	return fmt.Errorf("%q doesn't match the %s badge ID formats", id, symbology)
+}
+
+// matches reports whether an ID has the format
+func (format idFormat) matches(id string) bool {
+	switch {
+	case format.Length > 0 && len(id) != format.Length:
+		return false
+	case format.MinLength > 0 && len(id) < format.MinLength:
+		return false
+	case format.MaxLength > 0 && len(id) > format.MaxLength:
+		return false
+	case format.pattern != nil && !format.pattern.MatchString(id):
+		return false
+	}
+	return true
+}
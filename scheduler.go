@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jobConfig is a scheduled job from the config file. Export jobs take the
+// same settings as the export mode flags, backup jobs copy the data file
+// into Dir, archive jobs archive the records from before Before, and stats
+// jobs email the -stats report from Start to End to EmailTo.
+type jobConfig struct {
+	Name     string   `json:"name"`
+	Schedule string   `json:"schedule"` // cron expression: minute hour day-of-month month day-of-week
+	Type     string   `json:"type"`     // export, backup, archive, crm or stats
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Format   string   `json:"format"`
+	Compress string   `json:"compress"`
+	Columns  string   `json:"columns"`
+	Time     string   `json:"time_format"`  // rfc3339, local, split or unix
+	Excel    string   `json:"excel"`        // bom, crlf, text or all
+	Delim    string   `json:"delimiter"`    // comma, tab or semicolon
+	Types    string   `json:"record_types"` // comma-separated record types to export
+	Tags     string   `json:"tags"`         // comma-separated tags; records need one of them
+	Filename string   `json:"filename"`
+	Dir      string   `json:"dir"`
+	Split    string   `json:"split"` // "day" for a file per day
+	EmailTo  []string `json:"email_to"`
+	Upload   []string `json:"upload"`
+	Push     bool     `json:"push"` // send the records to the config file's push instance
+	Sign     bool     `json:"sign"`
+	Encrypt  bool     `json:"encrypt"`
+	Before   string   `json:"before"` // archive cutoff, e.g. last-365-days
+}
+
+// cronSchedule is a parsed cron expression. Each field holds the set of
+// matching values.
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	domAny, dowAny                bool
+}
+
+// runDaemonMode runs the jobs from the config file on their schedules until
+// the process is stopped
+func runDaemonMode(cfg config, rosterFile string) {
+	if len(cfg.Jobs) == 0 && cfg.RosterSource.URL == "" && len(cfg.Hooks.OnDayClose) == 0 {
+		fmt.Println("Error: No jobs, roster_source or on_day_close hooks are defined in the config file.")
+		return
+	}
+
+	schedules := make([]cronSchedule, len(cfg.Jobs))
+	for i, job := range cfg.Jobs {
+		schedule, err := parseCron(job.Schedule)
+		if err != nil {
+			fmt.Printf("Error in job %q: %v\n", job.Name, err)
+			return
+		}
+		if job.Type != "export" && job.Type != "backup" && job.Type != "archive" && job.Type != "crm" && job.Type != "stats" {
+			fmt.Printf("Error in job %q: unknown job type %q\n", job.Name, job.Type)
+			return
+		}
+		if job.Type == "stats" && len(job.EmailTo) == 0 {
+			fmt.Printf("Error in job %q: stats jobs need an email_to\n", job.Name)
+			return
+		}
+		schedules[i] = schedule
+	}
+
+	fmt.Printf("Scheduler started with %d jobs.\n", len(cfg.Jobs))
+	warnClock(cfg, time.Now())
+	if cfg.RosterSource.URL != "" {
+		startRosterSync(cfg.RosterSource, rosterFile, func(err error) {
+			fmt.Println("Error syncing roster:", err)
+		})
+	}
+	for {
+		// Wake at the start of each minute and run the jobs due then
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		time.Sleep(next.Sub(now))
+		if next.Minute() == 0 {
+			warnClock(cfg, next)
+		}
+		if next.Hour() == 0 && next.Minute() == 0 {
+			hooks.closeDay(next.AddDate(0, 0, -1).Format("2006-01-02"))
+		}
+
+		for i, job := range cfg.Jobs {
+			if schedules[i].matches(next) {
+				fmt.Printf("%s: running job %q\n", next.Format("2006-01-02T15:04:05-07:00"), job.Name)
+				runJob(job, cfg, rosterFile, next)
+			}
+		}
+	}
+}
+
+// warnClock prints a warning when the clock looks wrong, since scheduled jobs
+// would run at the wrong times and cover the wrong days
+func warnClock(cfg config, now time.Time) {
+	if check := checkClock(now, cfg.NTPServer); !check.OK {
+		fmt.Printf("WARNING: the clock %s. Jobs will run at the wrong times until it is fixed.\n", check.Detail)
+	}
+}
+
+// runJob runs one scheduled job
+func runJob(job jobConfig, cfg config, rosterFile string, now time.Time) {
+	if job.Type == "backup" {
+		runBackupJob(job, cfg, now)
+		return
+	}
+	if job.Type == "archive" {
+		runArchiveJob(job, now)
+		return
+	}
+	if job.Type == "crm" {
+		runSyncCRMMode(cfg.CRM, rosterFile)
+		return
+	}
+	if job.Type == "stats" {
+		runStatsJob(job, cfg, rosterFile, now)
+		return
+	}
+
+	startDate, endDate, err := resolveExportRange(job.Start, job.End, "", "", now)
+	if err != nil {
+		fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		return
+	}
+	if startDate == "" {
+		startDate, _, _ = relativeRange("today", now)
+	}
+	columns, err := parseExportColumns(job.Columns)
+	if err != nil {
+		fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		return
+	}
+	types, err := parseRecordTypes(job.Types)
+	if err != nil {
+		fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		return
+	}
+	tags, err := parseTags(job.Tags)
+	if err != nil {
+		fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		return
+	}
+	excel, err := parseExcelOptions(job.Excel)
+	if err != nil {
+		fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		return
+	}
+	delimiter, err := parseDelimiter(job.Delim)
+	if err != nil {
+		fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		return
+	}
+	format := job.Format
+	if format == "" {
+		format = "csv"
+	}
+
+	options := exportOptions{
+		Formats:    strings.Split(format, ","),
+		Compress:   job.Compress,
+		Encrypt:    job.Encrypt,
+		Columns:    columns,
+		TimeFormat: job.Time,
+		Excel:      excel,
+		Delimiter:  delimiter,
+		Types:      types,
+		Tags:       tags,
+		RosterFile: rosterFile,
+		Filename:   job.Filename,
+		Dir:        job.Dir,
+		Split:      job.Split,
+		EmailTo:    job.EmailTo,
+		Upload:     job.Upload,
+		Push:       job.Push,
+		Sign:       job.Sign,
+		Config:     cfg,
+	}
+	if err := options.validate(); err != nil {
+		fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		return
+	}
+	runExportMode(startDate, endDate, options)
+}
+
+// runStatsJob emails the stats report for the job's range, by default the
+// last 28 days as with -stats, with its CSV attached. An email that can't be
+// sent is queued to retry.
+func runStatsJob(job jobConfig, cfg config, rosterFile string, now time.Time) {
+	first, last, err := resolveExportRange(job.Start, job.End, "", "", now)
+	if err != nil {
+		fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		return
+	}
+	if first == "" {
+		first, last, _ = relativeRange("last-28-days", now)
+	}
+	if last == "" {
+		last = first
+	}
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		return
+	}
+	var report strings.Builder
+	result, err := writeStats(&report, cfg, roster, first, last, job.Dir)
+	if err != nil {
+		fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		return
+	}
+	subject := "Check-in stats " + first + " to " + last
+	attachments := []string{result.SavedTo}
+	if err := sendEmail(cfg.SMTP, job.EmailTo, subject, report.String(), attachments); err != nil {
+		fmt.Println("Error emailing stats, queued to retry (see -queue=status):", err)
+		outbox.add(delivery{Channel: "stats email", Email: &queuedEmail{To: job.EmailTo, Subject: subject, Body: report.String(), Attachments: attachments}})
+		return
+	}
+	fmt.Println("Emailed stats to", strings.Join(job.EmailTo, ", "))
+}
+
+// runArchiveJob archives the records from before the job's cutoff
+func runArchiveJob(job jobConfig, now time.Time) {
+	cutoff, err := archiveCutoff(job.Before, now)
+	if err != nil {
+		fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		return
+	}
+	archived, err := archiveRecords(cutoff)
+	if err != nil {
+		fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		return
+	}
+	fmt.Printf("Archived %d records from before %s.\n", archived, cutoff.Format("2006-01-02"))
+}
+
+// runBackupJob copies the data file into the job's directory under a
+// timestamped name and uploads the copy to the job's destinations
+func runBackupJob(job jobConfig, cfg config, now time.Time) {
+	dir := job.Dir
+	if dir == "" {
+		dir = "backups"
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		return
+	}
+
+	names, err := dataFiles()
+	if err != nil {
+		fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		return
+	}
+	var backups []string
+	for _, name := range names {
+		base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+		backup := filepath.Join(dir, fmt.Sprintf("%s-%s%s", base, now.Format("20060102-150405"), filepath.Ext(name)))
+		if err := copyFile(name, backup); err != nil {
+			fmt.Printf("Error in job %q: %v\n", job.Name, err)
+			return
+		}
+		fmt.Println("Backed up data file to", backup)
+		backups = append(backups, backup)
+	}
+
+	if len(job.Upload) > 0 {
+		if err := uploadExports(cfg, job.Upload, backups, nil); err != nil {
+			fmt.Printf("Error in job %q: %v\n", job.Name, err)
+		}
+	}
+}
+
+// parseCron parses a five-field cron expression. Fields accept *, single
+// values, ranges (1-5), lists (1,3,5) and steps (*/15 or 8-18/2). Day of
+// week runs from 0 (Sunday) to 6, with 7 also meaning Sunday.
+func parseCron(expression string) (cronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("cron expression %q must have 5 fields", expression)
+	}
+
+	var schedule cronSchedule
+	var err error
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := []*map[int]bool{&schedule.minute, &schedule.hour, &schedule.dom, &schedule.month, &schedule.dow}
+	for i, field := range fields {
+		*sets[i], err = parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return cronSchedule{}, fmt.Errorf("cron expression %q: %w", expression, err)
+		}
+	}
+	if schedule.dow[7] {
+		schedule.dow[0] = true
+	}
+	schedule.domAny = fields[2] == "*"
+	schedule.dowAny = fields[4] == "*"
+
+	return schedule, nil
+}
+
+// parseCronField returns the values in [min, max] matched by one cron field
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+
+		low, high := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid range %q", part)
+				}
+			} else if step > 1 {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+
+		for v := low; v <= high; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// matches reports whether the schedule fires at t's minute. As in cron, when
+// both day of month and day of week are restricted either one may match.
+func (s cronSchedule) matches(t time.Time) bool {
+	if !s.minute[t.Minute()] || !s.hour[t.Hour()] || !s.month[int(t.Month())] {
+		return false
+	}
+	domMatch := s.dom[t.Day()]
+	dowMatch := s.dow[int(t.Weekday())]
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
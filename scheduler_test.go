@@ -0,0 +1,144 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     []int // nil for an error
+	}{
+		{"*", 0, 6, []int{0, 1, 2, 3, 4, 5, 6}},
+		{"5", 0, 59, []int{5}},
+		{"0", 0, 59, []int{0}},
+		{"59", 0, 59, []int{59}},
+		{"1-5", 0, 6, []int{1, 2, 3, 4, 5}},
+		{"1,3,5", 0, 6, []int{1, 3, 5}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"8-18/4", 0, 23, []int{8, 12, 16}},
+		{"10/20", 0, 59, []int{10, 30, 50}},
+		{"1-2,20-21", 1, 31, []int{1, 2, 20, 21}},
+		{"60", 0, 59, nil},
+		{"24", 0, 23, nil},
+		{"0", 1, 31, nil},
+		{"32", 1, 31, nil},
+		{"0", 1, 12, nil},
+		{"13", 1, 12, nil},
+		{"8", 0, 7, nil},
+		{"-1", 0, 59, nil},
+		{"5-3", 0, 59, nil},
+		{"1-60", 0, 59, nil},
+		{"*/0", 0, 59, nil},
+		{"*/x", 0, 59, nil},
+		{"a", 0, 59, nil},
+		{"1-b", 0, 59, nil},
+		{"", 0, 59, nil},
+	}
+	for _, test := range tests {
+		values, err := parseCronField(test.field, test.min, test.max)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("%q in %d-%d: no error", test.field, test.min, test.max)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q in %d-%d: %v", test.field, test.min, test.max, err)
+			continue
+		}
+		var got []int
+		for v := range values {
+			got = append(got, v)
+		}
+		sort.Ints(got)
+		if len(got) != len(test.want) {
+			t.Errorf("%q in %d-%d: got %v, want %v", test.field, test.min, test.max, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%q in %d-%d: got %v, want %v", test.field, test.min, test.max, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+	} {
+		if _, err := parseCron(expression); err == nil {
+			t.Errorf("%q: no error", expression)
+		}
+	}
+}
+
+func TestCronMatches(t *testing.T) {
+	// 2026-03-01 is a Sunday
+	at := func(date, clock string) time.Time {
+		t, err := time.ParseInLocation("2006-01-02 15:04", date+" "+clock, time.UTC)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	tests := []struct {
+		expression string
+		time       time.Time
+		want       bool
+	}{
+		{"* * * * *", at("2026-03-04", "13:37"), true},
+		{"30 6 * * *", at("2026-03-04", "06:30"), true},
+		{"30 6 * * *", at("2026-03-04", "06:31"), false},
+		{"30 6 * * *", at("2026-03-04", "07:30"), false},
+		{"0 0 1 1 *", at("2026-01-01", "00:00"), true},
+		{"0 0 1 1 *", at("2026-02-01", "00:00"), false},
+
+		// Day of week only: day of month is any
+		{"0 9 * * 1-5", at("2026-03-02", "09:00"), true},
+		{"0 9 * * 1-5", at("2026-03-01", "09:00"), false},
+		// Sunday as 0 and as 7
+		{"0 9 * * 0", at("2026-03-01", "09:00"), true},
+		{"0 9 * * 7", at("2026-03-01", "09:00"), true},
+		{"0 9 * * 7", at("2026-03-07", "09:00"), false},
+
+		// Day of month only: day of week is any
+		{"0 9 15 * *", at("2026-03-15", "09:00"), true},
+		{"0 9 15 * *", at("2026-03-16", "09:00"), false},
+
+		// Both restricted: either one matches
+		{"0 9 15 * 1", at("2026-03-15", "09:00"), true},
+		{"0 9 15 * 1", at("2026-03-02", "09:00"), true},
+		{"0 9 15 * 1", at("2026-03-03", "09:00"), false},
+
+		// A stepped day of month is a restriction, not any
+		{"0 9 */10 * 1", at("2026-03-02", "09:00"), true},
+		{"0 9 */10 * 1", at("2026-03-11", "09:00"), true},
+		{"0 9 */10 * 1", at("2026-03-12", "09:00"), false},
+
+		// Months still apply when either day matches
+		{"0 9 15 6 1", at("2026-03-15", "09:00"), false},
+	}
+	for _, test := range tests {
+		schedule, err := parseCron(test.expression)
+		if err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+			continue
+		}
+		if got := schedule.matches(test.time); got != test.want {
+			t.Errorf("%q at %s: got %v, want %v", test.expression, test.time.Format("Mon 2006-01-02 15:04"), got, test.want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// screeningAttempts is how many times a question is asked again after an
+// answer that isn't yes or no
+const screeningAttempts = 3
+
+// screeningQuestion is a yes/no question scan mode asks before recording a
+// scan, such as a health check on arrival or whether a guardian is picking a
+// child up. Answers are saved to the screening sidecar file (e.g.
+// scans.screening.csv) as question=answer, exported with -columns=answer.<id>
+// and listed by -screening.
+type screeningQuestion struct {
+	ID        string   `json:"id"`        // names the answer in exports, e.g. fever
+	Prompt    string   `json:"prompt"`    // e.g. "Any fever in the last 24 hours?"
+	Ask       string   `json:"ask"`       // "first_scan_of_day" (default) or "every_scan"
+	Direction string   `json:"direction"` // "in" (default), "out" or "both"
+	Types     []string `json:"types"`     // record types asked; empty for all
+
+	// The answer expected, yes or no. Any other answer is flagged to staff,
+	// or with refuse set the scan is not recorded.
+	Expected string `json:"expected"`
+	Refuse   bool   `json:"refuse"`
+}
+
+// screeningID matches a valid question ID
+var screeningID = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// checkScreening validates the configured questions
+func checkScreening(questions []screeningQuestion) error {
+	seen := make(map[string]bool)
+	for _, q := range questions {
+		switch {
+		case !screeningID.MatchString(q.ID):
+			return fmt.Errorf("screening question ID %q must be lowercase letters, digits and underscores", q.ID)
+		case seen[q.ID]:
+			return fmt.Errorf("screening question ID %q is used twice", q.ID)
+		case q.Prompt == "":
+			return fmt.Errorf("screening question %s has no prompt", q.ID)
+		case q.Ask != "" && q.Ask != "first_scan_of_day" && q.Ask != "every_scan":
+			return fmt.Errorf("screening question %s: ask must be first_scan_of_day or every_scan", q.ID)
+		case q.Direction != "" && q.Direction != "in" && q.Direction != "out" && q.Direction != "both":
+			return fmt.Errorf("screening question %s: direction must be in, out or both", q.ID)
+		case q.Expected != "" && q.Expected != "yes" && q.Expected != "no":
+			return fmt.Errorf("screening question %s: expected must be yes or no", q.ID)
+		}
+		for _, t := range q.Types {
+			if !contains(recordTypes, t) {
+				return fmt.Errorf("screening question %s has unknown record type %q", q.ID, t)
+			}
+		}
+		seen[q.ID] = true
+	}
+	return nil
+}
+
+// applies reports whether the question is asked for a scan in the direction
+// of the record type, firstToday being set for the ID's first scan of the day
+// in that direction
+func (q screeningQuestion) applies(direction, recordType string, firstToday bool) bool {
+	want := q.Direction
+	if want == "" {
+		want = "in"
+	}
+	if want != "both" && want != direction {
+		return false
+	}
+	if len(q.Types) > 0 && !contains(q.Types, recordType) {
+		return false
+	}
+	return q.Ask == "every_scan" || firstToday
+}
+
+// parseAnswer reads a yes or no answer. 1 and 0 are accepted too, for
+// scanners that can only send digits.
+func parseAnswer(line string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes", "1":
+		return "yes", true
+	case "n", "no", "0":
+		return "no", true
+	}
+	return "", false
+}
+
+// screen asks the questions that apply to a scan, reading answers with read,
+// and returns them as question=answer. It returns false when the scan must
+// not be recorded: a refusing question got the other answer, or no answer
+// came.
+func (options scanOptions) screen(read func() (string, error), barcodeID, recordType string, firstToday bool) ([]string, bool) {
+	var answers []string
+	for _, q := range options.Screening {
+		if !q.applies(options.Direction, recordType, firstToday) {
+			continue
+		}
+		answer := ""
+		for attempt := 0; attempt < screeningAttempts && answer == ""; attempt++ {
+			options.announce(announceInfo, q.Prompt+" (y/n)", q.Prompt)
+			line, err := read()
+			if err != nil && strings.TrimSpace(line) == "" {
+				break
+			}
+			var ok bool
+			if answer, ok = parseAnswer(line); !ok {
+				options.announce(announceError, "Please answer y or n.", "Please answer yes or no.")
+			}
+		}
+		if answer == "" {
+			options.announce(announceError, "No answer to a screening question. Not recorded.",
+				"The question was not answered, so this scan was not recorded. Please scan again.")
+			return nil, false
+		}
+		if q.Expected != "" && answer != q.Expected {
+			if q.Refuse {
+				options.announce(announceError, fmt.Sprintf("Answered %s to %q. Not recorded; please see a staff member.", answer, q.Prompt),
+					"This scan was not recorded. Please see a staff member.")
+				playSound(options.SoundCommand, options.Theme.DuplicateSound)
+				return nil, false
+			}
+			options.announce(announceWarning, fmt.Sprintf("SCREENING: %s answered %s to %q.", barcodeID, answer, q.Prompt),
+				"Please let a staff member know.")
+		}
+		answers = append(answers, q.ID+"="+answer)
+	}
+	return answers, true
+}
+
+// loadScreening reads the screening sidecar file into each record's answers
+// by question ID, keyed by noteKey
+func loadScreening() (map[string]map[string]string, error) {
+	values, err := loadSidecar("screening")
+	if err != nil {
+		return nil, err
+	}
+	answers := make(map[string]map[string]string, len(values))
+	for key, list := range values {
+		answers[key] = make(map[string]string)
+		for _, value := range list {
+			if question, answer, ok := strings.Cut(value, "="); ok {
+				answers[key][question] = answer
+			}
+		}
+	}
+	return answers, nil
+}
+
+// runScreeningMode lists the screening answers given from first to last
+// (YYYY-MM-DD, inclusive), with the yes and no counts for each question and
+// the answers that weren't the one expected, and saves them as a CSV with a
+// column per question in dir
+func runScreeningMode(questions []screeningQuestion, roster map[string]rosterEntry, first, last, dir string) {
+	if len(questions) == 0 {
+		fmt.Println("Error: No screening questions are set in the config file.")
+		return
+	}
+	answers, err := loadScreening()
+	if err != nil {
+		fmt.Println("Error reading screening answers:", err)
+		return
+	}
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+
+	header := []string{"timestamp", "id", "name", "direction"}
+	for _, q := range questions {
+		header = append(header, q.ID)
+	}
+	rows := [][]string{header}
+	counts := make(map[string]map[string]int)
+	var flagged []string
+	for _, record := range records {
+		date := record[0][:10]
+		given := answers[noteKey(record)]
+		if date < first || date > last || len(given) == 0 {
+			continue
+		}
+		row := []string{record[0], record[1], rosterName(roster, record[1]), recordDirection(record)}
+		for _, q := range questions {
+			answer := given[q.ID]
+			row = append(row, answer)
+			if answer == "" {
+				continue
+			}
+			if counts[q.ID] == nil {
+				counts[q.ID] = make(map[string]int)
+			}
+			counts[q.ID][answer]++
+			if q.Expected != "" && answer != q.Expected {
+				flagged = append(flagged, fmt.Sprintf("  %s  %-12s %-28s %s: %s", record[0], record[1], rosterName(roster, record[1]), q.ID, answer))
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 1 {
+		fmt.Println("No screening answers found for the specified date range.")
+		return
+	}
+
+	fmt.Printf("Screening answers from %s to %s:\n", first, last)
+	for _, q := range questions {
+		fmt.Printf("  %-20s yes %-5d no %-5d %s\n", q.ID, counts[q.ID]["yes"], counts[q.ID]["no"], q.Prompt)
+	}
+	if len(flagged) > 0 {
+		fmt.Printf("\n%d unexpected answers:\n", len(flagged))
+		for _, line := range flagged {
+			fmt.Println(line)
+		}
+	}
+
+	filename := "screening_" + first + "_" + last + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving screening report:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving screening report:", err)
+		return
+	}
+	fmt.Println("\nSaved to", filename)
+}
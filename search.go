@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// searchResult is -search's -output=json result
+type searchResult struct {
+	Query          string         `json:"query"`
+	Records        []searchMatch  `json:"records"`
+	Roster         []searchMember `json:"roster"`          // matching roster members with no records
+	MalformedLines int            `json:"malformed_lines"` // lines of the data file skipped (see -check)
+}
+
+// searchMatch is a record -search found, at its line of the data files
+type searchMatch struct {
+	Line   int      `json:"line"`
+	Record Record   `json:"record"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// searchMember is a roster member -search found without records
+type searchMember struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// runSearchMode prints every record whose ID, roster name or any other field
+// contains the query, case-insensitively, along with roster members who match
+// but have no records. With asJSON the matches are printed as a searchResult.
+func runSearchMode(query, rosterFile string, asJSON bool) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		printError(asJSON, "Error: Search text must not be empty.")
+		return
+	}
+
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		printError(asJSON, "Error loading roster:", err)
+		return
+	}
+
+	file, err := openDataFiles()
+	if err != nil {
+		printError(asJSON, "Error opening file:", err)
+		return
+	}
+	defer file.Close()
+
+	records, lines, bad := readRecords(file)
+	if !asJSON {
+		defer reportBadRows(bad)
+	}
+	notes, err := loadNotes()
+	if err != nil {
+		printError(asJSON, "Error reading notes:", err)
+		return
+	}
+	tags, err := loadTags()
+	if err != nil {
+		printError(asJSON, "Error reading tags:", err)
+		return
+	}
+	result := searchResult{Query: query, Records: []searchMatch{}, Roster: []searchMember{}, MalformedLines: len(bad)}
+
+	// Roster members matching by name or ID, so scans of "Marco" are found even
+	// though only his badge number is stored in the records
+	matchedIDs := make(map[string]bool)
+	for id, entry := range roster {
+		if strings.Contains(strings.ToLower(entry.Name), query) || strings.Contains(id, query) {
+			matchedIDs[id] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	matches := 0
+	for i, record := range records {
+		if !matchedIDs[record[1]] && !recordContains(record, query) && !recordContains(notes[noteKey(record)], query) &&
+			!recordContains(tags[noteKey(record)], query) {
+			continue
+		}
+
+		matches++
+		seen[record[1]] = true
+		if asJSON {
+			parsed, _ := parseRecord(record)
+			parsed.Name = rosterName(roster, record[1])
+			parsed.Note = strings.Join(notes[noteKey(record)], "; ")
+			result.Records = append(result.Records, searchMatch{Line: lines[i], Record: parsed, Tags: tags[noteKey(record)]})
+			continue
+		}
+		name := rosterName(roster, record[1])
+		if name == "" {
+			name = "(not on roster)"
+		}
+		fmt.Printf("line %d: %s  ID %s  %s", lines[i], record[0], record[1], name)
+		if recordDirection(record) == "out" {
+			fmt.Print("  checked out")
+		} else if len(record) > 2 {
+			fmt.Printf("  #%s that day", record[2])
+		}
+		if len(record) > 5 {
+			fmt.Printf("  %s", strings.Join(record[5:], " "))
+		}
+		if recordTags := tags[noteKey(record)]; len(recordTags) > 0 {
+			fmt.Printf("  tags: %s", strings.Join(recordTags, ", "))
+		}
+		fmt.Println()
+		for _, text := range notes[noteKey(record)] {
+			fmt.Printf("    note: %s\n", text)
+		}
+	}
+
+	// Roster members who matched but never checked in
+	var unseen []string
+	for id := range matchedIDs {
+		if !seen[id] {
+			unseen = append(unseen, id)
+		}
+	}
+	sort.Strings(unseen)
+	for _, id := range unseen {
+		if asJSON {
+			result.Roster = append(result.Roster, searchMember{ID: id, Name: roster[id].Name})
+			continue
+		}
+		fmt.Printf("roster: ID %s  %s  (no records)\n", id, roster[id].Name)
+	}
+	if asJSON {
+		printJSON(result)
+		return
+	}
+
+	if matches == 0 && len(unseen) == 0 {
+		fmt.Println("No records found matching", query)
+		return
+	}
+	fmt.Printf("Found %d matching records.\n", matches)
+}
+
+// recordContains reports whether any field of the record contains the
+// lowercased query
+func recordContains(record []string, query string) bool {
+	for _, field := range record {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
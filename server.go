@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// runServeMode serves the HTTP pages and endpoints on addr. Apart from scans
+// uploaded by mobile devices, which are appended like a scan station's, the
+// server only reads the data file, so it can run alongside one. The welcome
+// display and the /healthz liveness check are open, while the other endpoints
+// need an API token once any are configured. Until then only the viewer
+// endpoints are served.
+func runServeMode(addr, rosterFile, metricsLog string, theme eventTheme, cfg config, mobile mobileAPI) {
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+	rosters := watchRoster(rosterFile, roster, func(change string, err error) {
+		if err != nil {
+			fmt.Println("Error reloading roster:", err)
+			return
+		}
+		fmt.Println(change + ".")
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/display", func(w http.ResponseWriter, r *http.Request) {
+		handleDisplayPage(w, r, theme)
+	})
+	mux.HandleFunc("/display/latest", func(w http.ResponseWriter, r *http.Request) {
+		roster, _ := rosters.current()
+		handleDisplayLatest(w, r, roster, theme)
+	})
+	mux.HandleFunc("/display/sound", func(w http.ResponseWriter, r *http.Request) {
+		if theme.SuccessSound == "" {
+			http.NotFound(w, r)
+			return
+		}
+		serveSound(w, r, theme.SuccessSound)
+	})
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", cfg.requireToken(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		handleReadyz(w, r, cfg)
+	}))
+	mux.HandleFunc("/metrics", cfg.requireToken(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		handleMetrics(w, r, metricsLog)
+	}))
+	mux.HandleFunc("/waitlist", cfg.requireToken(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		handleWaitlist(w, r, rosterFile)
+	}))
+	mux.HandleFunc("/goals", cfg.requireToken(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		handleGoals(w, r, cfg.Goals)
+	}))
+	mux.HandleFunc("/stations", cfg.requireToken(roleViewer, handleStationsPage))
+	mux.HandleFunc("/api/stations", cfg.requireToken(roleViewer, handleStations))
+	mobile.register(mux, cfg)
+	admin := &rosterAdmin{rosterFile: rosterFile, readOnly: mobile.ReadOnly}
+	admin.register(mux, cfg)
+
+	fmt.Printf("Serving on %s (welcome display at /display).\n", addr)
+	if err := http.ListenAndServe(addr, traced(mux)); err != nil {
+		fmt.Println("Error running server:", err)
+	}
+}
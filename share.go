@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// defaultShareAttempts is how many times a file is copied to the share
+	// before the upload fails, when the config doesn't say
+	defaultShareAttempts = 3
+
+	// defaultShareRetryDelay is the wait between attempts when the config
+	// doesn't say
+	defaultShareRetryDelay = 10 * time.Second
+)
+
+// shareConfig is the network folder exports are copied to with
+// -upload=share, such as the school office's shared drive: a UNC path like
+// \\office\attendance on Windows, or where the share is mounted elsewhere.
+// The folder must already exist, so exports are never written to an empty
+// mount point when the share isn't mounted.
+type shareConfig struct {
+	Path       string   `json:"path"`        // e.g. "\\\\office\\attendance" or "/mnt/office/attendance"
+	Attempts   int      `json:"attempts"`    // tries per file before giving up; default 3
+	RetryDelay duration `json:"retry_delay"` // wait between tries, e.g. "30s"; default 10s
+}
+
+// uploadShare copies the files to the network share. Each is written under a
+// temporary name and renamed once complete, so the clerk's spreadsheet never
+// opens half a file, then read back and compared with the original, as
+// network drives can report a write that didn't fully land. A file that
+// fails is tried again after the retry delay.
+func uploadShare(settings shareConfig, files []string) error {
+	if settings.Path == "" {
+		return fmt.Errorf("share path must be set in the config file")
+	}
+	attempts := settings.Attempts
+	if attempts <= 0 {
+		attempts = defaultShareAttempts
+	}
+	delay := time.Duration(settings.RetryDelay)
+	if delay <= 0 {
+		delay = defaultShareRetryDelay
+	}
+	for _, file := range files {
+		var err error
+		for attempt := 1; attempt <= attempts; attempt++ {
+			if err = copyToShare(settings.Path, file); err == nil {
+				break
+			}
+			if attempt < attempts {
+				fmt.Printf("Copying %s to the share failed (%v); trying again in %s.\n", filepath.Base(file), err, delay)
+				time.Sleep(delay)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+	}
+	return nil
+}
+
+// copyToShare copies one file into dir on the share and checks that what the
+// share holds matches it
+func copyToShare(dir, file string) error {
+	if info, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("share not reachable (is it mounted?): %w", err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("share path %s is not a folder", dir)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(dir, filepath.Base(file))
+	part := target + ".part"
+	out, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(data); err != nil {
+		out.Close()
+		os.Remove(part)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(part)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(part)
+		return err
+	}
+	if err := os.Rename(part, target); err != nil {
+		// Windows won't rename over an existing file, such as an export of
+		// the same range from an earlier run
+		os.Remove(target)
+		if err := os.Rename(part, target); err != nil {
+			os.Remove(part)
+			return err
+		}
+	}
+	return verifyShareCopy(target, data)
+}
+
+// verifyShareCopy reads a copied file back from the share and compares its
+// SHA-256 with the original's
+func verifyShareCopy(target string, data []byte) error {
+	copied, err := os.Open(target)
+	if err != nil {
+		return fmt.Errorf("reading back: %w", err)
+	}
+	defer copied.Close()
+	hash := sha256.New()
+	n, err := io.Copy(hash, copied)
+	if err != nil {
+		return fmt.Errorf("reading back: %w", err)
+	}
+	want := sha256.Sum256(data)
+	if n != int64(len(data)) || !bytes.Equal(hash.Sum(nil), want[:]) {
+		return fmt.Errorf("the copy on the share doesn't match the export (%d bytes read back of %d)", n, len(data))
+	}
+	return nil
+}
+
+// checkShare checks that the share's folder can be reached, for /readyz
+func checkShare(settings shareConfig) healthCheck {
+	check := healthCheck{Name: "share", OK: true, Detail: settings.Path}
+	if info, err := os.Stat(settings.Path); err != nil {
+		check.OK, check.Detail = false, err.Error()
+	} else if !info.IsDir() {
+		check.OK, check.Detail = false, settings.Path+" is not a folder"
+	}
+	return check
+}
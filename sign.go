@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// signFiles writes a detached signature next to each file as <file>.sig using
+// the PKCS #8 PEM private key at keyFile, and returns the signature files.
+// Ed25519 keys sign the file contents directly and RSA keys sign its SHA-256
+// digest, so recipients can check a file with the matching public key:
+//
+//	openssl pkeyutl -verify -pubin -inkey public.pem -rawin -in FILE -sigfile FILE.sig   (Ed25519)
+//	openssl dgst -sha256 -verify public.pem -signature FILE.sig FILE                    (RSA)
+func signFiles(keyFile string, files []string) ([]string, error) {
+	if keyFile == "" {
+		return nil, fmt.Errorf("signing_key_file is not set in the config file")
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM private key", keyFile)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", keyFile, err)
+	}
+
+	var signatures []string
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var signature []byte
+		switch key := key.(type) {
+		case ed25519.PrivateKey:
+			signature = ed25519.Sign(key, contents)
+		case *rsa.PrivateKey:
+			digest := sha256.Sum256(contents)
+			signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%s must hold an Ed25519 or RSA key", keyFile)
+		}
+
+		if err := os.WriteFile(file+".sig", signature, 0644); err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, file+".sig")
+	}
+	return signatures, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// recordSources are the intake paths a record can arrive through, noted in
+// the origins file so questionable data can be traced back to one:
+//
+//	prompt    typed or scanned at scan mode's prompt
+//	scanner   read by scan mode straight from the scanner's -hid-device
+//	mobile    uploaded by the companion app
+//	kiosk     checked in at the server's /kiosk page
+//	lookup    checked in from a -lookup search
+//	push      pushed from another instance to /api/records
+//	waitlist  admitted from the waitlist with -admit
+//	import    added by -ingest or -import-outs
+//	merge     added by -merge from another station's data file
+var recordSources = []string{"prompt", "scanner", "mobile", "kiosk", "lookup", "push", "waitlist", "import", "merge"}
+
+// parseRecordSources parses a comma-separated list of record sources
+func parseRecordSources(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var sources []string
+	for _, source := range strings.Split(list, ",") {
+		source = strings.ToLower(strings.TrimSpace(source))
+		if !contains(recordSources, source) {
+			return nil, fmt.Errorf("unknown source %q (expected %s)", source, strings.Join(recordSources, ", "))
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// source returns the source of the records scan mode makes
+func (options scanOptions) source() string {
+	if options.HIDDevice != "" {
+		return "scanner"
+	}
+	return "prompt"
+}
+
+// logOrigins notes the source of records added in bulk in the origins file,
+// in one write
+func logOrigins(records [][]string, source string) error {
+	if err := journalFile(sidecarFile("origins")); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(sidecarFile("origins"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	for _, record := range records {
+		writer.Write([]string{record[0], record[1], "", "", source})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// spotCheckTag tags the records of check-ins selected for a spot check, so
+// -tags=spot_check lists them
+const spotCheckTag = "spot_check"
+
+// spotCheckConfig is the config file's "spot_check" section: a share of
+// check-ins picked at random for secondary screening, such as a bag check
+// or an ID check. Selected check-ins are recorded as usual and tagged
+// spot_check.
+type spotCheckConfig struct {
+	Percent float64  `json:"percent"` // share of check-ins selected, e.g. 5 for one in twenty; 0 disables
+	Check   string   `json:"check"`   // what staff do, shown at the station; default "bag check"
+	Types   []string `json:"types"`   // record types that can be selected; empty for all
+	Sound   string   `json:"sound"`   // played with sound_command on a selection
+}
+
+// checkSpotCheck validates the spot check settings
+func checkSpotCheck(settings spotCheckConfig) error {
+	if settings.Percent < 0 || settings.Percent > 100 {
+		return fmt.Errorf("spot_check percent must be from 0 to 100, not %g", settings.Percent)
+	}
+	for _, t := range settings.Types {
+		if !contains(recordTypes, t) {
+			return fmt.Errorf("spot_check has unknown record type %q", t)
+		}
+	}
+	return nil
+}
+
+// selects picks a check-in of the record type for a spot check at random.
+// The choice uses crypto/rand so the pattern can't be predicted from the
+// line.
+func (settings spotCheckConfig) selects(recordType string) bool {
+	if settings.Percent <= 0 || len(settings.Types) > 0 && !contains(settings.Types, recordType) {
+		return false
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(10000))
+	if err != nil {
+		return false
+	}
+	return float64(n.Int64()) < settings.Percent*100
+}
+
+// announceSpotCheck tells staff a check-in was selected for a spot check,
+// in a banner that can't be missed
+func (options scanOptions) announceSpotCheck(barcodeID string) {
+	check := options.SpotCheck.Check
+	if check == "" {
+		check = "bag check"
+	}
+	name := rosterName(options.Roster, barcodeID)
+	if name == "" {
+		name = "ID " + barcodeID
+	}
+	text := fmt.Sprintf("SPOT CHECK (%s): %s", check, name)
+	switch {
+	case options.jsonLogs():
+		options.writeEvent(logEvent{Event: "spot_check", ID: barcodeID, Message: text})
+	case options.Accessibility == "plain":
+		fmt.Println(text + ".")
+	default:
+		printBanner(announceError, text)
+	}
+	playSound(options.SoundCommand, options.SpotCheck.Sound)
+}
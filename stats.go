@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxStatsStreaks is how many of the longest attendance streaks -stats lists
+const maxStatsStreaks = 10
+
+// attendanceStreak is one person's run of open days checked in on
+type attendanceStreak struct {
+	ID      string
+	Longest int
+	Current int // up to the last open day of the report
+}
+
+// attendanceStreaks returns each person's longest and current run of
+// consecutive open days with a check-in. Days the facility was closed are
+// skipped rather than ending a streak.
+func attendanceStreaks(present map[string]map[string]bool, openDays []string) []attendanceStreak {
+	var streaks []attendanceStreak
+	for id, dates := range present {
+		streak := attendanceStreak{ID: id}
+		for _, date := range openDays {
+			if !dates[date] {
+				streak.Current = 0
+				continue
+			}
+			streak.Current++
+			streak.Longest = max(streak.Longest, streak.Current)
+		}
+		if streak.Longest > 0 {
+			streaks = append(streaks, streak)
+		}
+	}
+	sort.Slice(streaks, func(i, j int) bool {
+		if streaks[i].Longest != streaks[j].Longest {
+			return streaks[i].Longest > streaks[j].Longest
+		}
+		return streaks[i].ID < streaks[j].ID
+	})
+	return streaks
+}
+
+// statsResult is -stats's -output=json result
+type statsResult struct {
+	First                string          `json:"first"`
+	Last                 string          `json:"last"`
+	CheckIns             int             `json:"check_ins"`
+	Credits              float64         `json:"credits"` // attendance credits
+	OpenDays             int             `json:"open_days"`
+	AveragePerOpenDay    float64         `json:"average_per_open_day"`
+	People               int             `json:"people"`
+	BusiestDay           string          `json:"busiest_day,omitempty"`
+	BusiestDayCheckIns   int             `json:"busiest_day_check_ins,omitempty"`
+	Closures             []closureConfig `json:"closures"` // closures in the range, left out of the averages
+	ClosureDays          int             `json:"closure_days"`
+	CheckInsOnClosedDays int             `json:"check_ins_on_closed_days"`
+	Weekdays             []statsWeekday  `json:"weekdays"`
+	Goals                []statsGoal     `json:"goals"`
+	Streaks              []statsStreak   `json:"streaks"` // the longest, up to maxStatsStreaks
+	SavedTo              string          `json:"saved_to"`
+}
+
+// statsWeekday is the average check-ins on one weekday's open days
+type statsWeekday struct {
+	Weekday string  `json:"weekday"`
+	Average float64 `json:"average"`
+	Days    int     `json:"days"`
+}
+
+// statsGoal is a goal's progress over the report: the open days a daily goal
+// was met on, or a weekly or monthly goal's count in each period
+type statsGoal struct {
+	Goal    string         `json:"goal"`
+	Target  int            `json:"target"`
+	DaysMet *int           `json:"days_met,omitempty"`
+	Periods []goalProgress `json:"periods,omitempty"`
+}
+
+// statsStreak is one person's attendance streak
+type statsStreak struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Longest int    `json:"longest"`
+	Current int    `json:"current"`
+}
+
+// runStatsMode reports check-ins from first to last (YYYY-MM-DD, inclusive):
+// the total, the average per open day and per weekday, the busiest day, the
+// people seen, the progress against the attendance goals and the longest
+// attendance streaks. Closures from the config file, and weekdays without
+// operating hours when they are set, are left out of the averages and don't
+// break streaks. The report is also saved as a CSV in dir. With asJSON it's
+// printed as a statsResult instead of text.
+func runStatsMode(cfg config, roster map[string]rosterEntry, first, last, dir string, asJSON bool) {
+	var out io.Writer = os.Stdout
+	if asJSON {
+		out = nil
+	}
+	result, err := writeStats(out, cfg, roster, first, last, dir)
+	if err != nil {
+		printError(asJSON, "Error:", err)
+		return
+	}
+	if asJSON {
+		printJSON(result)
+		return
+	}
+	fmt.Println("\nSaved to", result.SavedTo)
+}
+
+// writeStats writes the stats report from first to last as text to out, or
+// only works it out when out is nil, and saves it as a CSV in dir
+func writeStats(out io.Writer, cfg config, roster map[string]rosterEntry, first, last, dir string) (statsResult, error) {
+	start, err := time.ParseInLocation("2006-01-02", first, time.Local)
+	if err != nil {
+		return statsResult{}, fmt.Errorf("parsing start date: %w", err)
+	}
+	end, err := time.ParseInLocation("2006-01-02", last, time.Local)
+	if err != nil {
+		return statsResult{}, fmt.Errorf("parsing end date: %w", err)
+	}
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		return statsResult{}, fmt.Errorf("opening file: %w", err)
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+
+	credits, err := loadCredits()
+	if err != nil {
+		return statsResult{}, fmt.Errorf("reading credits: %w", err)
+	}
+
+	counts := make(map[string]int)
+	totalCredits := 0.0
+	present := make(map[string]map[string]bool) // dates by current badge, so a reissue doesn't split a person
+	holders := badgeHolders(roster)
+	for _, record := range records {
+		date := record[0][:10]
+		if recordDirection(record) != "in" || date < first || date > last {
+			continue
+		}
+		counts[date]++
+		totalCredits += recordCredits(credits, record)
+		id := holder(holders, record[1])
+		if present[id] == nil {
+			present[id] = make(map[string]bool)
+		}
+		present[id][date] = true
+	}
+
+	var openDays, closed []string
+	result := statsResult{First: first, Last: last, Closures: []closureConfig{}, Weekdays: []statsWeekday{}, Goals: []statsGoal{}, Streaks: []statsStreak{}}
+	total, onClosed, closureDays, busiest := 0, 0, 0, ""
+	listed := make(map[closureConfig]bool)
+	weekdayCheckIns, weekdayDays := make(map[time.Weekday]int), make(map[time.Weekday]int)
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		total += counts[date]
+		if busiest == "" || counts[date] > counts[busiest] {
+			busiest = date
+		}
+		if !cfg.openOn(date) {
+			onClosed += counts[date]
+			if closure, ok := closureOn(cfg.Closures, date); ok {
+				closureDays++
+				if !listed[closure] {
+					listed[closure] = true
+					result.Closures = append(result.Closures, closure)
+					text := closure.Date
+					if closure.Through != "" {
+						text += " to " + closure.Through
+					}
+					if closure.Reason != "" {
+						text += " (" + closure.Reason + ")"
+					}
+					closed = append(closed, text)
+				}
+			}
+			continue
+		}
+		openDays = append(openDays, date)
+		weekdayCheckIns[day.Weekday()] += counts[date]
+		weekdayDays[day.Weekday()]++
+	}
+
+	// The text report is only written with an out
+	printf := func(format string, a ...any) {
+		if out != nil {
+			fmt.Fprintf(out, format, a...)
+		}
+	}
+	printLine := func(a ...any) {
+		if out != nil {
+			fmt.Fprintln(out, a...)
+		}
+	}
+	rows := [][]string{{"metric", "value"}}
+	average := 0.0
+	if len(openDays) > 0 {
+		average = float64(total-onClosed) / float64(len(openDays))
+	}
+	// The printed report is in the configured locale; the CSV keeps its
+	// metric keys and plain numbers for spreadsheets to read
+	loc := cfg.locale()
+	width := loc.width(24, "check-ins", "attendance credits", "open days", "average per open day", "people", "busiest day", "closures left out", "check-ins on closed days")
+	line := func(label, value string) {
+		printf("  %-*s %s\n", width, loc.text(label), value)
+	}
+	printLine(loc.textf("Stats for %s to %s:", loc.date(first), loc.date(last)))
+	line("check-ins", loc.number(total))
+	// Credits are listed once any check-in has counted for other than one,
+	// as funders count them rather than scans
+	if len(credits) > 0 {
+		text := loc.number(int(totalCredits))
+		if _, fraction, ok := strings.Cut(formatCredits(totalCredits), "."); ok {
+			text = loc.decimal(totalCredits, len(fraction))
+		}
+		line("attendance credits", text)
+		rows = append(rows, []string{"credits", formatCredits(totalCredits)})
+	}
+	line("open days", loc.number(len(openDays)))
+	line("average per open day", loc.decimal(average, 1))
+	line("people", loc.number(len(present)))
+	result.CheckIns, result.Credits, result.OpenDays, result.AveragePerOpenDay, result.People = total, totalCredits, len(openDays), average, len(present)
+	result.ClosureDays, result.CheckInsOnClosedDays = closureDays, onClosed
+	rows = append(rows, []string{"check_ins", strconv.Itoa(total)}, []string{"open_days", strconv.Itoa(len(openDays))},
+		[]string{"average_per_open_day", strconv.FormatFloat(average, 'f', 1, 64)}, []string{"people", strconv.Itoa(len(present))})
+	if total > 0 {
+		line("busiest day", loc.textf("%s (%s check-ins)", loc.date(busiest), loc.number(counts[busiest])))
+		result.BusiestDay, result.BusiestDayCheckIns = busiest, counts[busiest]
+		rows = append(rows, []string{"busiest_day", busiest}, []string{"busiest_day_check_ins", strconv.Itoa(counts[busiest])})
+	}
+	if len(closed) > 0 {
+		line("closures left out", strings.Join(closed, ", "))
+		rows = append(rows, []string{"closure_days", strconv.Itoa(closureDays)})
+	}
+	if onClosed > 0 {
+		line("check-ins on closed days", loc.textf("%s (not in the averages)", loc.number(onClosed)))
+		rows = append(rows, []string{"check_ins_on_closed_days", strconv.Itoa(onClosed)})
+	}
+
+	printLine("\n" + loc.text("Average check-ins by weekday:"))
+	for i := 1; i <= 7; i++ {
+		weekday := time.Weekday(i % 7)
+		if weekdayDays[weekday] == 0 {
+			continue
+		}
+		weekdayAverage := float64(weekdayCheckIns[weekday]) / float64(weekdayDays[weekday])
+		days := loc.textf("%s days", loc.number(weekdayDays[weekday]))
+		if weekdayDays[weekday] == 1 {
+			days = loc.text("1 day")
+		}
+		printf("  %-*s %s (%s)\n", width, loc.Days[weekday], loc.decimal(weekdayAverage, 1), days)
+		result.Weekdays = append(result.Weekdays, statsWeekday{weekday.String(), weekdayAverage, weekdayDays[weekday]})
+		rows = append(rows, []string{"average." + strings.ToLower(weekday.String()[:3]), strconv.FormatFloat(weekdayAverage, 'f', 1, 64)})
+	}
+
+	if len(cfg.Goals) > 0 {
+		printLine("\n" + loc.text("Goals:"))
+	}
+	today := time.Now().Format("2006-01-02")
+	for i, goal := range cfg.Goals {
+		counts := goal.counts(records)
+		metric := fmt.Sprintf("goal%d.", i+1)
+		rows = append(rows, []string{metric + "target", strconv.Itoa(goal.Target)})
+		result.Goals = append(result.Goals, statsGoal{Goal: goal.label(), Target: goal.Target})
+		summary := &result.Goals[len(result.Goals)-1]
+		// Daily goals are summed up over the open days, as a line per day
+		// would bury the rest of the report
+		if goal.Period == "day" {
+			met := 0
+			for _, date := range openDays {
+				if counts[date] >= goal.Target {
+					met++
+				}
+			}
+			printLine("  " + loc.textf("%s of %s: met on %s of %s open days", loc.text(goal.label()), loc.number(goal.Target), loc.number(met), loc.number(len(openDays))))
+			rows = append(rows, []string{metric + "days_met", strconv.Itoa(met)})
+			summary.DaysMet = &met
+			continue
+		}
+		var periods []string
+		for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+			if key := goal.periodKey(day.Format("2006-01-02")); len(periods) == 0 || periods[len(periods)-1] != key {
+				periods = append(periods, key)
+			}
+		}
+		for _, key := range periods {
+			progress := newGoalProgress(goal, key, counts[key])
+			current := ""
+			if key == goal.periodKey(today) {
+				current = loc.text(" so far")
+			}
+			text := loc.textf("%s of %s %s (%s%%)", loc.number(progress.Count), loc.number(progress.Target), loc.text(progress.Goal), loc.number(progress.Percent))
+			printf("  %-10s %s%s\n", key, text, current)
+			rows = append(rows, []string{metric + key, strconv.Itoa(progress.Count)})
+			summary.Periods = append(summary.Periods, progress)
+		}
+	}
+
+	streaks := attendanceStreaks(present, openDays)
+	if len(streaks) > 0 {
+		printLine("\n" + loc.text("Longest attendance streaks (open days in a row):"))
+	}
+	for i, streak := range streaks {
+		if i == maxStatsStreaks {
+			break
+		}
+		printf("  %-12s %-28s %s\n", streak.ID, rosterName(roster, streak.ID), loc.textf("%s (current %s)", fmt.Sprintf("%4s", loc.number(streak.Longest)), loc.number(streak.Current)))
+		result.Streaks = append(result.Streaks, statsStreak{streak.ID, rosterName(roster, streak.ID), streak.Longest, streak.Current})
+		rows = append(rows, []string{"streak." + streak.ID, strconv.Itoa(streak.Longest)})
+	}
+
+	filename := "stats_" + first + "_" + last + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return statsResult{}, fmt.Errorf("saving stats: %w", err)
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		return statsResult{}, fmt.Errorf("saving stats: %w", err)
+	}
+	result.SavedTo = filename
+	return result, nil
+}
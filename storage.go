@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultStorageMinFreeMB is the free space scan mode warns below when
+	// the config doesn't say
+	defaultStorageMinFreeMB = 500
+
+	// storageCheckInterval is how often scan mode checks the disk between
+	// scans
+	storageCheckInterval = time.Minute
+)
+
+// storageConfig is the config file's "storage" section: the free space and
+// data file size scan mode warns about, so a filling SD card is noticed
+// before scans stop being saved
+type storageConfig struct {
+	MinFreeMB int       `json:"min_free_mb"` // free space on the data file's disk to warn below; default 500
+	MaxFileMB int       `json:"max_file_mb"` // data file size to warn above; 0 disables
+	Webhook   string    `json:"webhook"`     // Slack-compatible incoming webhook URL
+	SMS       smsConfig `json:"sms"`
+}
+
+// storageMonitor checks the data file's disk and size between scans
+type storageMonitor struct {
+	settings storageConfig
+	checked  time.Time
+	low      bool // free space is below the threshold
+	large    bool // the data file is above the threshold
+	sending  sync.WaitGroup
+}
+
+// newStorageMonitor returns a monitor for the settings
+func newStorageMonitor(settings storageConfig) *storageMonitor {
+	if settings.MinFreeMB <= 0 {
+		settings.MinFreeMB = defaultStorageMinFreeMB
+	}
+	return &storageMonitor{settings: settings}
+}
+
+// check checks the free space and the data file's size once a minute.
+// While either is past its threshold every check shows a warning; crossing
+// a threshold either way notifies staff, except in dry runs.
+func (m *storageMonitor) check(options scanOptions, now time.Time) {
+	if now.Sub(m.checked) < storageCheckInterval {
+		return
+	}
+	m.checked = now
+	name := currentDataFile()
+	warn := func(standard, plain string) {
+		if options.jsonLogs() {
+			options.writeEvent(logEvent{Event: "storage_warning", Message: standard})
+		}
+		options.announce(announceWarning, standard, plain)
+	}
+
+	if free, err := freeDiskBytes(filepath.Dir(name)); err == nil {
+		freeMB := int(free >> 20)
+		low := freeMB < m.settings.MinFreeMB
+		if low {
+			warn(fmt.Sprintf("LOW DISK SPACE: %d MB free for %s. Scans will stop being saved when it fills; please tell a staff member.", freeMB, name),
+				"Warning. This station is running out of storage. Please tell a staff member.")
+		}
+		if low != m.low && !options.DryRun {
+			if low {
+				m.notify(options, fmt.Sprintf("Low disk space: %d MB free for %s, below the %d MB threshold.", freeMB, name, m.settings.MinFreeMB))
+			} else {
+				m.notify(options, fmt.Sprintf("Disk space is back to %d MB free for %s.", freeMB, name))
+			}
+		}
+		m.low = low
+	}
+
+	if info, err := os.Stat(name); err == nil && m.settings.MaxFileMB > 0 {
+		sizeMB := int(info.Size() >> 20)
+		large := sizeMB >= m.settings.MaxFileMB
+		if large {
+			warn(fmt.Sprintf("LARGE DATA FILE: %s is %d MB. Please ask a staff member to archive old records.", name, sizeMB),
+				"Warning. The records file is getting large. Please tell a staff member.")
+		}
+		if large && !m.large && !options.DryRun {
+			m.notify(options, fmt.Sprintf("Data file %s has grown to %d MB, past the %d MB threshold. Archive old records with -archive.", name, sizeMB, m.settings.MaxFileMB))
+		}
+		m.large = large
+	}
+}
+
+// notify sends a storage alert to the webhook and the SMS numbers. The
+// delivery queue is kept on the same disk that may be full, so alerts are
+// sent straight away and only queued when that fails.
+func (m *storageMonitor) notify(options scanOptions, text string) {
+	if options.Station != "" {
+		text = options.Station + ": " + text
+	}
+	var requests []*http.Request
+	if m.settings.Webhook != "" {
+		body, _ := json.Marshal(map[string]string{"text": text})
+		req, err := http.NewRequest("POST", m.settings.Webhook, bytes.NewReader(body))
+		if err != nil {
+			options.logError("Error sending storage alert", err)
+		} else {
+			req.Header.Set("Content-Type", "application/json")
+			requests = append(requests, req)
+		}
+	}
+	for _, to := range m.settings.SMS.To {
+		req, err := m.settings.SMS.request(to, text)
+		if err != nil {
+			options.logError("Error sending storage alert", err)
+		} else if req != nil {
+			requests = append(requests, req)
+		}
+	}
+	for _, req := range requests {
+		m.sending.Add(1)
+		go func(req *http.Request) {
+			defer m.sending.Done()
+			body, _ := req.GetBody()
+			retry := req.Clone(req.Context())
+			retry.Body = body
+			client := http.Client{Timeout: 10 * time.Second}
+			resp, err := client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode < 300 {
+					return
+				}
+			}
+			queueRequest("storage alert", retry)
+		}(req)
+	}
+}
+
+// wait waits for alerts still being sent, for when scan mode exits
+func (m *storageMonitor) wait() {
+	m.sending.Wait()
+}
+
+// warnDiskFull explains a failed data file write when the disk is full,
+// which otherwise only shows as a write error
+func (options scanOptions) warnDiskFull(err error) {
+	if !errors.Is(err, syscall.ENOSPC) {
+		return
+	}
+	options.announce(announceError, "DISK FULL: this scan was not saved. Free up space on "+filepath.Dir(currentDataFile())+", then restart scan mode.",
+		"This station's storage is full and scans are not being saved. Please tell a staff member.")
+}
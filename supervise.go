@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	// maxRestartDelay caps how long the supervisor waits between restarts of
+	// a scan mode that keeps failing
+	maxRestartDelay = time.Minute
+
+	// restartResetAfter is how long scan mode must run before a failure is
+	// treated as new, restarting it after a second again
+	restartResetAfter = 5 * time.Minute
+)
+
+// superviseScanMode runs scan mode and starts it again whenever a panic or a
+// read or write error stops it, so an unattended kiosk doesn't sit dead.
+// Each restart opens the data file and the scanner again and reloads the
+// daily counts from the file. Each incident is logged and appended to the
+// data file's incidents sidecar as started,stopped,error. It returns when
+// the operator exits or the input ends.
+func superviseScanMode(options scanOptions) {
+	options.Supervised = true
+	delay := time.Second
+	for {
+		started := time.Now()
+		err := runRecoveringScanMode(options)
+		if err == nil {
+			return
+		}
+		stopped := time.Now()
+		options.logError("Scan mode stopped", err)
+		row := []string{started.Format("2006-01-02T15:04:05-07:00"), stopped.Format("2006-01-02T15:04:05-07:00"), err.Error()}
+		if err := appendCSV(sidecarFile("incidents"), row); err != nil {
+			options.logError("Error writing incidents file", err)
+		}
+
+		if stopped.Sub(started) > restartResetAfter {
+			delay = time.Second
+		}
+		options.announce(announceWarning, fmt.Sprintf("Restarting scan mode in %s.", delay),
+			"The scanner is restarting. Please wait.")
+		time.Sleep(delay)
+		delay = min(delay*2, maxRestartDelay)
+	}
+}
+
+// runRecoveringScanMode runs scan mode, turning a panic into an error with
+// its stack trace
+func runRecoveringScanMode(options scanOptions) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return runScanMode(options)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// tagPattern matches a valid tag, such as field-trip or makeup_session
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// parseTags splits a comma-separated tag list, lowercasing each tag and
+// dropping repeats
+func parseTags(list string) ([]string, error) {
+	var tags []string
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q: use letters, digits, - and _", tag)
+		}
+		if !contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// loadTags reads the tags file, whose rows are timestamp,id,tag,added_at,
+// into the tags for each record key
+func loadTags() (map[string][]string, error) {
+	return loadSidecar("tags")
+}
+
+// hasAnyTag reports whether the record has at least one of the tags
+func hasAnyTag(tags map[string][]string, record []string, wanted []string) bool {
+	for _, tag := range tags[noteKey(record)] {
+		if contains(wanted, tag) {
+			return true
+		}
+	}
+	return false
+}
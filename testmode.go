@@ -0,0 +1,18 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// testMode is set by -test-mode. Every mode then works on a practice copy of
+// the data file name and labels its output so the real attendance records
+// are never touched during training or hardware tests.
+var testMode bool
+
+// practiceFile returns the practice data file used in test mode for path,
+// e.g. scans.practice.csv for scans.csv
+func practiceFile(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".practice" + ext
+}
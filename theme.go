@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+// eventTheme customizes what attendees see and hear at check-in. Greeting,
+// Detail, FirstVisit, Milestone, Success and Duplicate are text/templates
+// with {{.Name}} and {{.Count}}, and {{.ID}}, {{.Direction}}, {{.Record}},
+// {{.Window}}, {{.Ago}} and {{.Eligible}} where they apply; sounds are file
+// paths, or the built-in success.wav, duplicate.wav and alert.wav, played by
+// the configured sound command and on the welcome display. Registrations is
+// the event's expected-attendee list.
+type eventTheme struct {
+	Greeting       string `json:"greeting"`
+	Detail         string `json:"detail"`
+	FirstVisit     string `json:"first_visit"` // added to the greeting on an ID's first check-in ever
+	Milestone      string `json:"milestone"`   // shown on a milestone visit, with {{.Count}} the visit number
+	Prompt         string `json:"prompt"`      // asks for the next scan
+	Success        string `json:"success"`     // shown above the greeting when a scan is recorded
+	Duplicate      string `json:"duplicate"`   // shown for a repeat scan; {{.Window}} is empty under the daily policy, {{.Ago}} when the earlier scan is unknown
+	Exit           string `json:"exit"`        // typed at the prompt to quit scan mode
+	Background     string `json:"background"`
+	Color          string `json:"color"`
+	SuccessSound   string `json:"success_sound"`
+	DuplicateSound string `json:"duplicate_sound"`
+	Registrations  string `json:"registrations"` // CSV with an id column, like the roster
+	DedupePolicy   string `json:"dedupe_policy"` // replaces the default dedupe policy during the event
+
+	Credits float64 `json:"credits"` // attendance credits each check-in earns, e.g. 2 for a double-length session; default 1
+}
+
+// greetingData is the data available to greeting templates
+type greetingData struct {
+	Name      string
+	Count     string
+	ID        string
+	Direction string // in or out
+	Record    string // the fields recorded, e.g. [2025-03-04T09:15:00-05:00 1234 12]
+	Window    string // the dedupe window in words, e.g. 2 hours
+	Ago       string // how long ago the scan a duplicate repeats was, e.g. 35 minutes
+	Eligible  string // when the ID may scan again, e.g. at 3:42 PM or tomorrow
+}
+
+// defaultTheme is used for any setting an event doesn't override
+var defaultTheme = eventTheme{
+	Greeting:   "Welcome{{if .Name}}, {{.Name}}{{end}}!",
+	Detail:     "You're #{{.Count}} today",
+	FirstVisit: "First visit — welcome!",
+	Milestone:  "Visit #{{.Count}}! Congratulations{{if .Name}}, {{.Name}}{{end}}!",
+	Prompt:     "Barcode ID: ",
+	Success:    "Recorded: {{.Record}}",
+	Duplicate:  "Duplicate entry{{if .Ago}}: already checked {{.Direction}} {{.Ago}} ago; eligible again {{.Eligible}}{{else if .Window}} within {{.Window}} detected{{else}}: already checked {{.Direction}} today{{end}}. Skipping entry.",
+	Exit:       "exit",
+	Background: "#12355b",
+	Color:      "#ffffff",
+}
+
+// eventTheme returns the theme for the named event from the config file,
+// filled in with the config file's theme section and then the defaults. An
+// empty name returns the theme without an event's settings.
+func (cfg config) eventTheme(event string) (eventTheme, error) {
+	theme := overrideTheme(defaultTheme, cfg.Theme)
+	name := "theme"
+	if event != "" {
+		custom, ok := cfg.Events[event]
+		if !ok {
+			return theme, fmt.Errorf("event %q is not defined in the config file", event)
+		}
+		theme, name = overrideTheme(theme, custom), fmt.Sprintf("event %q", event)
+	}
+
+	// Catch template mistakes at startup rather than at the first scan
+	for _, text := range []string{theme.Greeting, theme.Detail, theme.FirstVisit, theme.Milestone, theme.Success, theme.Duplicate} {
+		if _, err := template.New("greeting").Parse(text); err != nil {
+			return theme, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if theme.Credits < 0 {
+		return theme, fmt.Errorf("%s: credits can't be negative", name)
+	}
+	// A numeric exit word would quit on the badge with that number
+	if theme.Exit = strings.TrimSpace(theme.Exit); barcodePattern.MatchString(theme.Exit) {
+		return theme, fmt.Errorf("%s: exit %q can't be a number, since badge IDs are numbers", name, theme.Exit)
+	}
+	return theme, nil
+}
+
+// overrideTheme returns the theme with the custom theme's non-empty settings
+// in place of its own
+func overrideTheme(theme, custom eventTheme) eventTheme {
+	for _, setting := range []struct{ value, target *string }{
+		{&custom.Greeting, &theme.Greeting},
+		{&custom.Detail, &theme.Detail},
+		{&custom.FirstVisit, &theme.FirstVisit},
+		{&custom.Milestone, &theme.Milestone},
+		{&custom.Prompt, &theme.Prompt},
+		{&custom.Success, &theme.Success},
+		{&custom.Duplicate, &theme.Duplicate},
+		{&custom.Exit, &theme.Exit},
+		{&custom.Background, &theme.Background},
+		{&custom.Color, &theme.Color},
+		{&custom.SuccessSound, &theme.SuccessSound},
+		{&custom.DuplicateSound, &theme.DuplicateSound},
+		{&custom.Registrations, &theme.Registrations},
+	} {
+		if *setting.value != "" {
+			*setting.target = *setting.value
+		}
+	}
+	if custom.Credits != 0 {
+		theme.Credits = custom.Credits
+	}
+	return theme
+}
+
+// renderGreeting expands a greeting template, falling back to the raw text if
+// it can't be expanded
+func renderGreeting(text string, data greetingData) string {
+	tmpl, err := template.New("greeting").Parse(text)
+	if err != nil {
+		return text
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return text
+	}
+	return out.String()
+}
+
+// playSound plays a sound file, or a built-in sound such as success.wav, with
+// the configured command, such as "aplay -q", without waiting for it to finish
+func playSound(command, file string) {
+	if command == "" || file == "" {
+		return
+	}
+	args := append(strings.Fields(command), soundPath(file))
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		fmt.Println("Error playing sound:", err)
+		return
+	}
+	go cmd.Wait()
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// timeClockConfig is the config file's "time_clock" section: staff punching
+// in and out at the door scanner with -time-clock, and how -timesheet adds
+// up their hours for payroll
+type timeClockConfig struct {
+	Types        []string `json:"types"`         // record types that punch in and out; default staff
+	PayPeriod    string   `json:"pay_period"`    // weekly (default), biweekly, semimonthly or monthly
+	PeriodStart  string   `json:"period_start"`  // first day of any weekly or biweekly pay period, YYYY-MM-DD; default a Monday
+	RoundMinutes int      `json:"round_minutes"` // each punch is rounded to this many minutes, e.g. 15; 0 keeps them exact
+	Rounding     string   `json:"rounding"`      // nearest (default), up or down
+	MaxShift     duration `json:"max_shift"`     // a punch-in with no punch-out this long after is missing one; default 16h
+	RepeatWindow duration `json:"repeat_window"` // a scan this soon after a punch isn't another punch; default 2m
+}
+
+// payPeriods are the pay_period settings
+var payPeriods = []string{"weekly", "biweekly", "semimonthly", "monthly"}
+
+// checkTimeClock validates the time clock settings
+func checkTimeClock(settings timeClockConfig) error {
+	for _, t := range settings.Types {
+		if !contains(recordTypes, t) {
+			return fmt.Errorf("time_clock has unknown record type %q", t)
+		}
+	}
+	if settings.PayPeriod != "" && !contains(payPeriods, settings.PayPeriod) {
+		return fmt.Errorf("time_clock pay_period must be weekly, biweekly, semimonthly or monthly, not %q", settings.PayPeriod)
+	}
+	if settings.PeriodStart != "" {
+		if _, err := time.Parse("2006-01-02", settings.PeriodStart); err != nil {
+			return fmt.Errorf("time_clock period_start must be a date (YYYY-MM-DD), not %q", settings.PeriodStart)
+		}
+	}
+	if settings.RoundMinutes < 0 || settings.RoundMinutes > 60 {
+		return fmt.Errorf("time_clock round_minutes must be from 0 to 60, not %d", settings.RoundMinutes)
+	}
+	if settings.Rounding != "" && settings.Rounding != "nearest" && settings.Rounding != "up" && settings.Rounding != "down" {
+		return fmt.Errorf("time_clock rounding must be nearest, up or down, not %q", settings.Rounding)
+	}
+	return nil
+}
+
+// punches reports whether scans of the record type are time clock punches
+func (settings timeClockConfig) punches(recordType string) bool {
+	if len(settings.Types) == 0 {
+		return recordType == "staff"
+	}
+	return contains(settings.Types, recordType)
+}
+
+// maxShift returns the longest shift, 16 hours unless the config sets it
+func (settings timeClockConfig) maxShift() time.Duration {
+	if settings.MaxShift > 0 {
+		return time.Duration(settings.MaxShift)
+	}
+	return 16 * time.Hour
+}
+
+// repeatWindow returns how soon after a punch a scan is a repeat rather
+// than the next punch, 2 minutes unless the config sets it
+func (settings timeClockConfig) repeatWindow() time.Duration {
+	if settings.RepeatWindow > 0 {
+		return time.Duration(settings.RepeatWindow)
+	}
+	return 2 * time.Minute
+}
+
+// round rounds a punch to the configured minutes
+func (settings timeClockConfig) round(t time.Time) time.Time {
+	if settings.RoundMinutes == 0 {
+		return t
+	}
+	interval := time.Duration(settings.RoundMinutes) * time.Minute
+	year, month, day := t.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	since := t.Sub(midnight)
+	switch settings.Rounding {
+	case "up":
+		if since%interval != 0 {
+			since = since.Truncate(interval) + interval
+		}
+	case "down":
+		since = since.Truncate(interval)
+	default:
+		since = since.Round(interval)
+	}
+	return midnight.Add(since)
+}
+
+// period returns the first and last day of the pay period a date is in
+func (settings timeClockConfig) period(date time.Time) (time.Time, time.Time) {
+	year, month, day := date.Date()
+	switch settings.PayPeriod {
+	case "semimonthly":
+		if day <= 15 {
+			return time.Date(year, month, 1, 0, 0, 0, 0, time.Local), time.Date(year, month, 15, 0, 0, 0, 0, time.Local)
+		}
+		return time.Date(year, month, 16, 0, 0, 0, 0, time.Local), time.Date(year, month+1, 0, 0, 0, 0, 0, time.Local)
+	case "monthly":
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.Local), time.Date(year, month+1, 0, 0, 0, 0, 0, time.Local)
+	}
+	length := 7
+	if settings.PayPeriod == "biweekly" {
+		length = 14
+	}
+	anchor, err := time.ParseInLocation("2006-01-02", settings.PeriodStart, time.Local)
+	if err != nil {
+		anchor = time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local) // a Monday
+	}
+	// Whole days between the dates, counted in UTC so a clock change
+	// doesn't shift them
+	days := int(time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Sub(time.Date(anchor.Year(), anchor.Month(), anchor.Day(), 0, 0, 0, 0, time.UTC)).Hours() / 24)
+	offset := days % length
+	if offset < 0 {
+		offset += length
+	}
+	start := time.Date(year, month, day-offset, 0, 0, 0, 0, time.Local)
+	return start, time.Date(year, month, day-offset+length-1, 0, 0, 0, 0, time.Local)
+}
+
+// nextPunch returns whether a time clock scan of the ID now punches in or
+// out: out when its last punch was in, less than the longest shift ago, and
+// in otherwise. It also reports whether the scan repeats the last punch
+// within the repeat window, returning that punch's direction.
+func (s *scanState) nextPunch(barcodeID string, settings timeClockConfig, now time.Time) (string, bool) {
+	in, _ := time.Parse("2006-01-02T15:04:05-07:00", s.LastSeen[barcodeID+" in"])
+	out, _ := time.Parse("2006-01-02T15:04:05-07:00", s.LastSeen[barcodeID+" out"])
+	latest, direction := in, "in"
+	if out.After(in) {
+		latest, direction = out, "out"
+	}
+	if !latest.IsZero() && now.Sub(latest) < settings.repeatWindow() {
+		return direction, true
+	}
+	if direction == "in" && !in.IsZero() && now.Sub(in) <= settings.maxShift() {
+		return "out", false
+	}
+	return "in", false
+}
+
+// timeClockShift is one punch-in and the punch-out after it
+type timeClockShift struct {
+	ID      string
+	In, Out time.Time
+}
+
+// missedPunch is a punch-in without a punch-out, or a punch-out without a
+// punch-in, which payroll has to fix by hand
+type missedPunch struct {
+	ID        string
+	Time      time.Time
+	Direction string // the punch that was recorded
+}
+
+// timeClockShifts pairs each person's punches into shifts, in time order.
+// An open punch-in younger than the longest shift is still on the clock and
+// is neither a shift nor missed.
+func timeClockShifts(records [][]string, settings timeClockConfig, now time.Time) ([]timeClockShift, []missedPunch) {
+	var punches []Record
+	for _, fields := range records {
+		if record, err := parseRecord(fields); err == nil && settings.punches(record.Type) {
+			punches = append(punches, record)
+		}
+	}
+	sort.SliceStable(punches, func(i, j int) bool { return punches[i].Timestamp.Before(punches[j].Timestamp) })
+
+	var shifts []timeClockShift
+	var missed []missedPunch
+	open := make(map[string]time.Time)
+	for _, punch := range punches {
+		in, clockedIn := open[punch.BadgeID]
+		if punch.Direction == "in" {
+			if clockedIn {
+				missed = append(missed, missedPunch{punch.BadgeID, in, "in"})
+			}
+			open[punch.BadgeID] = punch.Timestamp
+			continue
+		}
+		delete(open, punch.BadgeID)
+		if clockedIn && punch.Timestamp.Sub(in) <= settings.maxShift() {
+			shifts = append(shifts, timeClockShift{punch.BadgeID, in, punch.Timestamp})
+			continue
+		}
+		if clockedIn {
+			missed = append(missed, missedPunch{punch.BadgeID, in, "in"})
+		}
+		missed = append(missed, missedPunch{punch.BadgeID, punch.Timestamp, "out"})
+	}
+	for id, in := range open {
+		if now.Sub(in) > settings.maxShift() {
+			missed = append(missed, missedPunch{id, in, "in"})
+		}
+	}
+	sort.SliceStable(missed, func(i, j int) bool { return missed[i].Time.Before(missed[j].Time) })
+	return shifts, missed
+}
+
+// hoursWorked returns the hours of a shift between its rounded punches
+func (settings timeClockConfig) hoursWorked(shift timeClockShift) float64 {
+	worked := settings.round(shift.Out).Sub(settings.round(shift.In))
+	if worked < 0 {
+		return 0
+	}
+	return worked.Hours()
+}
+
+// runTimesheetMode reports the hours each person on the time clock worked in
+// each pay period from first to last (YYYY-MM-DD, widened to whole pay
+// periods), with the punches rounded as configured, and lists the missing
+// punches to fix before payroll. The report is also saved as a CSV in dir.
+func runTimesheetMode(settings timeClockConfig, roster map[string]rosterEntry, first, last, dir string) {
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	var records [][]string
+	if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+	now := time.Now()
+	shifts, missed := timeClockShifts(records, settings, now)
+
+	// Without dates, the last pay period that has ended
+	var from, to time.Time
+	if first == "" {
+		current, _ := settings.period(now)
+		from, to = settings.period(current.AddDate(0, 0, -1))
+	} else {
+		start, err := time.ParseInLocation("2006-01-02", first, time.Local)
+		if err != nil {
+			fmt.Println("Error: invalid start date", first)
+			return
+		}
+		end, err := time.ParseInLocation("2006-01-02", last, time.Local)
+		if err != nil {
+			fmt.Println("Error: invalid end date", last)
+			return
+		}
+		from, _ = settings.period(start)
+		_, to = settings.period(end)
+	}
+	first, last = from.Format("2006-01-02"), to.Format("2006-01-02")
+
+	// Hours, shifts and missed punches by pay period and ID
+	type timesheet struct {
+		Shifts int
+		Hours  float64
+		Missed int
+	}
+	sheets := make(map[string]map[string]*timesheet)
+	sheet := func(t time.Time, id string) *timesheet {
+		start, _ := settings.period(t.In(time.Local))
+		period := start.Format("2006-01-02")
+		if sheets[period] == nil {
+			sheets[period] = make(map[string]*timesheet)
+		}
+		if sheets[period][id] == nil {
+			sheets[period][id] = &timesheet{}
+		}
+		return sheets[period][id]
+	}
+	inRange := func(t time.Time) bool {
+		date := t.In(time.Local).Format("2006-01-02")
+		return date >= first && date <= last
+	}
+	for _, shift := range shifts {
+		if inRange(shift.In) {
+			s := sheet(shift.In, shift.ID)
+			s.Shifts++
+			s.Hours += settings.hoursWorked(shift)
+		}
+	}
+	var missing []missedPunch
+	for _, punch := range missed {
+		if inRange(punch.Time) {
+			sheet(punch.Time, punch.ID).Missed++
+			missing = append(missing, punch)
+		}
+	}
+
+	var periods []string
+	for period := range sheets {
+		periods = append(periods, period)
+	}
+	sort.Strings(periods)
+	rows := [][]string{{"period_start", "period_end", "id", "name", "shifts", "hours", "missing_punches"}}
+	if len(periods) == 0 {
+		fmt.Printf("No time clock punches from %s to %s.\n", first, last)
+	}
+	for _, period := range periods {
+		start, _ := time.ParseInLocation("2006-01-02", period, time.Local)
+		_, end := settings.period(start)
+		fmt.Printf("Pay period %s to %s:\n", period, end.Format("2006-01-02"))
+		fmt.Printf("  %-12s %-28s %6s %8s %7s\n", "id", "name", "shifts", "hours", "missing")
+		var ids []string
+		for id := range sheets[period] {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		total := 0.0
+		for _, id := range ids {
+			s := sheets[period][id]
+			total += s.Hours
+			fmt.Printf("  %-12s %-28s %6d %8.2f %7d\n", id, rosterName(roster, id), s.Shifts, s.Hours, s.Missed)
+			rows = append(rows, []string{period, end.Format("2006-01-02"), id, rosterName(roster, id), strconv.Itoa(s.Shifts),
+				strconv.FormatFloat(s.Hours, 'f', 2, 64), strconv.Itoa(s.Missed)})
+		}
+		fmt.Printf("  %-12s %-28s %6s %8.2f\n\n", "total", "", "", total)
+	}
+	if settings.RoundMinutes > 0 {
+		rounding := settings.Rounding
+		if rounding == "" {
+			rounding = "nearest"
+		}
+		fmt.Printf("Punches are rounded %s %d minutes.\n", map[string]string{"nearest": "to the nearest", "up": "up to", "down": "down to"}[rounding], settings.RoundMinutes)
+	}
+	if len(missing) > 0 {
+		fmt.Println("Missing punches to fix before payroll:")
+		for _, punch := range missing {
+			other := "punch-out"
+			if punch.Direction == "out" {
+				other = "punch-in"
+			}
+			fmt.Printf("  %-12s %-28s punched %s %s with no %s\n", punch.ID, rosterName(roster, punch.ID), punch.Direction,
+				punch.Time.In(time.Local).Format("2006-01-02 15:04"), other)
+		}
+	}
+
+	filename := "timesheet_" + first + "_" + last + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving timesheet:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving timesheet:", err)
+		return
+	}
+	fmt.Println("Saved to", filename)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tracingConfig is the OpenTelemetry collector spans are sent to over
+// OTLP/HTTP with JSON encoding
+type tracingConfig struct {
+	Endpoint    string            `json:"endpoint"`     // collector URL, e.g. http://localhost:4318; empty disables tracing
+	ServiceName string            `json:"service_name"` // defaults to checkin
+	Headers     map[string]string `json:"headers"`      // sent with each export, e.g. an API key
+}
+
+// tracingFlushInterval is how often finished spans are sent to the collector
+const tracingFlushInterval = 5 * time.Second
+
+// OTLP span kinds
+const (
+	spanInternal = 1
+	spanServer   = 2
+	spanClient   = 3
+)
+
+// tracer collects finished spans and sends them to the collector in batches
+type tracer struct {
+	settings tracingConfig
+	client   *http.Client
+
+	mu       sync.Mutex
+	finished []*span
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// activeTracer is the tracer spans are recorded to, or nil when tracing is off
+var activeTracer *tracer
+
+// span is one timed operation. Methods on a nil span do nothing, so code can
+// create spans whether or not tracing is enabled.
+type span struct {
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	name       string
+	kind       int
+	start, end time.Time
+	attributes map[string]string
+	err        string
+}
+
+// startTracing starts sending spans to the configured collector, if any
+func startTracing(settings tracingConfig) {
+	if settings.Endpoint == "" {
+		return
+	}
+	if settings.ServiceName == "" {
+		settings.ServiceName = "checkin"
+	}
+	t := &tracer{settings: settings, client: &http.Client{Timeout: 10 * time.Second}, stop: make(chan struct{})}
+	t.done.Add(1)
+	go func() {
+		defer t.done.Done()
+		ticker := time.NewTicker(tracingFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.flush()
+			case <-t.stop:
+				t.flush()
+				return
+			}
+		}
+	}()
+	activeTracer = t
+}
+
+// stopTracing sends any spans not yet sent and stops the tracer
+func stopTracing() {
+	if activeTracer == nil {
+		return
+	}
+	close(activeTracer.stop)
+	activeTracer.done.Wait()
+	activeTracer = nil
+}
+
+// startSpan starts a span as a child of parent, or as the root of a new trace
+// when parent is nil. It returns nil when tracing is off.
+func startSpan(name string, kind int, parent *span) *span {
+	if activeTracer == nil {
+		return nil
+	}
+	s := &span{name: name, kind: kind, start: time.Now(), attributes: make(map[string]string)}
+	if parent != nil {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	return s
+}
+
+// remoteParent returns the caller's span from a W3C traceparent header, or
+// nil if the header is missing or malformed
+func remoteParent(header string) *span {
+	parts := strings.Split(header, "-")
+	if activeTracer == nil || len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return nil
+	}
+	parent := &span{}
+	if _, err := hex.Decode(parent.traceID[:], []byte(parts[1])); err != nil {
+		return nil
+	}
+	if _, err := hex.Decode(parent.spanID[:], []byte(parts[2])); err != nil {
+		return nil
+	}
+	return parent
+}
+
+// set adds an attribute to the span
+func (s *span) set(key, value string) {
+	if s != nil {
+		s.attributes[key] = value
+	}
+}
+
+// finish ends the span, marking it failed when err is not nil, and queues it
+// to be sent
+func (s *span) finish(err error) {
+	if s == nil || activeTracer == nil {
+		return
+	}
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	activeTracer.mu.Lock()
+	activeTracer.finished = append(activeTracer.finished, s)
+	activeTracer.mu.Unlock()
+}
+
+// flush sends the finished spans to the collector
+func (t *tracer) flush() {
+	t.mu.Lock()
+	spans := t.finished
+	t.finished = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(otlpRequest(t.settings.ServiceName, spans))
+	if err != nil {
+		fmt.Println("Error encoding traces:", err)
+		return
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(t.settings.Endpoint, "/")+"/v1/traces", bytes.NewReader(body))
+	if err != nil {
+		fmt.Println("Error sending traces:", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.settings.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		fmt.Println("Error sending traces:", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Println("Error sending traces:", resp.Status)
+	}
+}
+
+// otlpRequest builds the OTLP/HTTP JSON export request body for spans
+func otlpRequest(serviceName string, spans []*span) map[string]any {
+	attribute := func(key, value string) map[string]any {
+		return map[string]any{"key": key, "value": map[string]string{"stringValue": value}}
+	}
+
+	var encoded []map[string]any
+	for _, s := range spans {
+		attributes := []map[string]any{}
+		for key, value := range s.attributes {
+			attributes = append(attributes, attribute(key, value))
+		}
+		status := map[string]any{"code": 1} // ok
+		if s.err != "" {
+			status = map[string]any{"code": 2, "message": s.err}
+		}
+		span := map[string]any{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        attributes,
+			"status":            status,
+		}
+		if s.parentID != [8]byte{} {
+			span["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		encoded = append(encoded, span)
+	}
+
+	return map[string]any{
+		"resourceSpans": []map[string]any{{
+			"resource": map[string]any{"attributes": []map[string]any{attribute("service.name", serviceName)}},
+			"scopeSpans": []map[string]any{{
+				"scope": map[string]string{"name": "checkin"},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+// statusRecorder remembers the status code an HTTP handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before writing it
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// traced wraps an HTTP handler in a server span per request, continuing the
+// caller's trace when it sends a traceparent header
+func traced(handler http.Handler) http.Handler {
+	if activeTracer == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := startSpan(r.Method+" "+r.URL.Path, spanServer, remoteParent(r.Header.Get("traceparent")))
+		s.set("http.request.method", r.Method)
+		s.set("url.path", r.URL.Path)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(recorder, r)
+		s.set("http.response.status_code", strconv.Itoa(recorder.status))
+		var err error
+		if recorder.status >= 500 {
+			err = fmt.Errorf("%s", http.StatusText(recorder.status))
+		}
+		s.finish(err)
+	})
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTrashDays is how many days removed rows stay in the trash when the
+// config doesn't say
+const defaultTrashDays = 30
+
+// trashedRow is one row a maintenance command removed from the data file.
+// The trash file, e.g. scans.trash.csv, holds them as
+// id,trashed_at,action,reason,source,kind followed by the record's fields,
+// or for an unreadable line its text. Rows removed together share a batch,
+// and a row's ID is its batch and its place in it, e.g. 3f9a2c1e.2.
+type trashedRow struct {
+	ID, TrashedAt  string
+	Action, Reason string
+	Source         string   // the data file it came from
+	Line           bool     // an unreadable line, kept as its text
+	Fields         []string // the record, or the line's text
+}
+
+// batch returns the ID of the batch the row was removed in
+func (row trashedRow) batch() string {
+	batch, _, _ := strings.Cut(row.ID, ".")
+	return batch
+}
+
+// trashDays returns how many days removed rows are kept
+func (cfg config) trashDays() int {
+	if cfg.TrashDays > 0 {
+		return cfg.TrashDays
+	}
+	return defaultTrashDays
+}
+
+// loadTrash reads the trash file. A missing file is an empty trash.
+func loadTrash() ([]trashedRow, error) {
+	file, err := os.Open(sidecarFile("trash"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", sidecarFile("trash"), err)
+	}
+	var trash []trashedRow
+	for _, row := range rows {
+		if len(row) < 7 {
+			continue
+		}
+		trash = append(trash, trashedRow{ID: row[0], TrashedAt: row[1], Action: row[2], Reason: row[3], Source: row[4], Line: row[5] == "line", Fields: row[6:]})
+	}
+	return trash, nil
+}
+
+// saveTrash replaces the trash file with rows, journaling it first so
+// -undo-admin puts back the trash along with the data file
+func saveTrash(trash []trashedRow) error {
+	name := sidecarFile("trash")
+	if err := journalFile(name); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	for _, row := range trash {
+		kind := "record"
+		if row.Line {
+			kind = "line"
+		}
+		writer.Write(append([]string{row.ID, row.TrashedAt, row.Action, row.Reason, row.Source, kind}, row.Fields...))
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return writeFileAtomic(name, buf.Bytes(), 0644)
+}
+
+// expireTrash drops the rows trashed more than days ago, returning how many
+// were dropped
+func expireTrash(trash []trashedRow, days int, now time.Time) ([]trashedRow, int) {
+	cutoff := now.AddDate(0, 0, -days)
+	var kept []trashedRow
+	for _, row := range trash {
+		trashedAt, err := time.Parse("2006-01-02T15:04:05-07:00", row.TrashedAt)
+		if err == nil && trashedAt.Before(cutoff) {
+			continue
+		}
+		kept = append(kept, row)
+	}
+	return kept, len(trash) - len(kept)
+}
+
+// moveToTrash adds the rows a command is about to remove to the trash as one
+// batch, dropping expired rows, and returns the batch ID. Commands call it
+// before rewriting the data file, so nothing is removed that isn't in the
+// trash.
+func moveToTrash(cfg config, action string, rows []trashedRow) (string, error) {
+	trash, err := loadTrash()
+	if err != nil {
+		return "", err
+	}
+	trash, _ = expireTrash(trash, cfg.trashDays(), time.Now())
+	id := make([]byte, 4)
+	rand.Read(id)
+	batch := hex.EncodeToString(id)
+	now := time.Now().Format("2006-01-02T15:04:05-07:00")
+	for i, row := range rows {
+		row.ID, row.TrashedAt, row.Action = batch+"."+strconv.Itoa(i+1), now, action
+		trash = append(trash, row)
+	}
+	return batch, saveTrash(trash)
+}
+
+// discardTrashBatch takes a batch back out of the trash when the command that
+// trashed it failed to remove its rows, so restoring can't duplicate them
+func discardTrashBatch(batch string) {
+	trash, err := loadTrash()
+	if err != nil {
+		return
+	}
+	var kept []trashedRow
+	for _, row := range trash {
+		if row.batch() != batch {
+			kept = append(kept, row)
+		}
+	}
+	saveTrash(kept)
+}
+
+// trashNotice says where removed rows went and how to get them back
+func trashNotice(cfg config, batch string, count int) {
+	fmt.Printf("The %d removed rows are in the trash for %d days; put them back with -restore=%s.\n", count, cfg.trashDays(), batch)
+}
+
+// runTrashMode lists the rows in the trash by batch, newest first, after
+// dropping the expired ones
+func runTrashMode(cfg config) {
+	trash, err := loadTrash()
+	if err != nil {
+		fmt.Println("Error reading trash:", err)
+		return
+	}
+	trash, expired := expireTrash(trash, cfg.trashDays(), time.Now())
+	if expired > 0 {
+		if err := saveTrash(trash); err != nil {
+			fmt.Println("Error expiring trash:", err)
+			return
+		}
+		fmt.Printf("Dropped %d rows trashed more than %d days ago.\n", expired, cfg.trashDays())
+	}
+	if len(trash) == 0 {
+		fmt.Println("The trash is empty.")
+		return
+	}
+
+	var batches []string
+	rows := make(map[string][]trashedRow)
+	for _, row := range trash {
+		if rows[row.batch()] == nil {
+			batches = append(batches, row.batch())
+		}
+		rows[row.batch()] = append(rows[row.batch()], row)
+	}
+	sort.SliceStable(batches, func(i, j int) bool { return rows[batches[i]][0].TrashedAt > rows[batches[j]][0].TrashedAt })
+	for _, batch := range batches {
+		first := rows[batch][0]
+		expires := ""
+		if trashedAt, err := time.Parse("2006-01-02T15:04:05-07:00", first.TrashedAt); err == nil {
+			expires = ", kept until " + trashedAt.AddDate(0, 0, cfg.trashDays()).Format("2006-01-02")
+		}
+		fmt.Printf("%s  %s  %s: %d rows%s\n", batch, first.TrashedAt, first.Action, len(rows[batch]), expires)
+		for _, row := range rows[batch] {
+			text := strings.Join(row.Fields, ",")
+			if row.Line {
+				text = "unreadable line " + strconv.Quote(text)
+			}
+			fmt.Printf("  %-12s %s (%s)\n", row.ID, text, row.Reason)
+		}
+	}
+	fmt.Println("\nPut rows back with -restore=<batch or row IDs>.")
+}
+
+// runRestoreMode puts the trashed rows with the comma-separated IDs, each a
+// batch or a single row, back in the data file and renumbers the daily
+// counts. Records go back in timestamp order; unreadable lines are appended
+// to the file they came from as they were, for -check to report again.
+func runRestoreMode(ids string, cfg config) {
+	trash, err := loadTrash()
+	if err != nil {
+		fmt.Println("Error reading trash:", err)
+		return
+	}
+	trash, _ = expireTrash(trash, cfg.trashDays(), time.Now())
+	wanted := make(map[string]bool)
+	for _, id := range strings.Split(ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			wanted[id] = true
+		}
+	}
+	found := make(map[string]bool)
+	var restored, kept []trashedRow
+	for _, row := range trash {
+		switch {
+		case wanted[row.ID]:
+			found[row.ID] = true
+		case wanted[row.batch()]:
+			found[row.batch()] = true
+		default:
+			kept = append(kept, row)
+			continue
+		}
+		restored = append(restored, row)
+	}
+	for id := range wanted {
+		if !found[id] {
+			fmt.Printf("Error: %s is not in the trash (see -trash).\n", id)
+			return
+		}
+	}
+
+	existing, sources, err := readDataFile()
+	if err != nil {
+		fmt.Println("Error reading CSV:", err)
+		fmt.Println("Restoring rewrites the whole file, so fix the malformed lines first (see -check).")
+		return
+	}
+	var records, lines []trashedRow
+	times := make(map[string]time.Time)
+	for _, row := range restored {
+		if row.Line {
+			lines = append(lines, row)
+			continue
+		}
+		t, err := time.Parse("2006-01-02T15:04:05-07:00", row.Fields[0])
+		if err != nil {
+			fmt.Printf("Error: trashed row %s has an invalid timestamp %q.\n", row.ID, row.Fields[0])
+			return
+		}
+		records = append(records, row)
+		times[row.ID] = t
+	}
+	sort.SliceStable(records, func(i, j int) bool { return times[records[i].ID].Before(times[records[j].ID]) })
+	var added [][]string
+	var addedTimes []time.Time
+	for _, row := range records {
+		added = append(added, row.Fields)
+		addedTimes = append(addedTimes, times[row.ID])
+	}
+
+	merged, mergedSources := mergeRecords(existing, sources, added, addedTimes)
+	renumberDailyCounts(merged)
+	if err := rewriteDataFile(merged, mergedSources); err != nil {
+		fmt.Println("Error rewriting data file:", err)
+		return
+	}
+	for _, row := range lines {
+		if err := restoreLine(row); err != nil {
+			fmt.Println("Error restoring unreadable line:", err)
+			return
+		}
+	}
+	if err := saveTrash(kept); err != nil {
+		fmt.Println("Error updating trash:", err)
+		return
+	}
+	fmt.Printf("Restored %d records", len(added))
+	if len(lines) > 0 {
+		fmt.Printf(" and %d unreadable lines", len(lines))
+	}
+	fmt.Printf(" to %s (backup saved as .bak).\n", dataName())
+	for _, record := range merged {
+		if len(record) > 3 && record[3] != "" {
+			fmt.Println("Warning: Record checksums no longer match the rewritten file, so -verify will report it.")
+			break
+		}
+	}
+}
+
+// restoreLine appends a trashed unreadable line to the data file it came
+// from, or the current one when that file is gone
+func restoreLine(row trashedRow) error {
+	name := row.Source
+	if _, err := os.Stat(name); err != nil {
+		name = currentDataFile()
+	}
+	if err := journalFile(name); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(strings.Join(row.Fields, ",") + "\n")
+	return err
+}
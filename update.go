@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version is this build's release, set when building a release with
+// -ldflags "-X main.version=1.4.0"
+var version = "dev"
+
+// updateConfig is the config file's "update" section: where -update fetches
+// releases from. A release server holds the latest version number in
+// <url>/latest, and each release's binaries in <url>/<version>/ named
+// checkin-<os>-<arch> (.exe on Windows), with a sha256sum SHA256SUMS file and
+// its detached signature SHA256SUMS.sig, as -sign writes them. SHA256SUMS
+// also has a "version <version>" line, so the signature covers which release
+// it is.
+type updateConfig struct {
+	URL            string `json:"url"`              // e.g. "https://downloads.example.org/checkin"
+	PublicKeyFile  string `json:"public_key_file"`  // PEM Ed25519 or RSA public key SHA256SUMS.sig is checked with; required to install
+	CheckAtStartup bool   `json:"check_at_startup"` // scan mode, -serve and -daemon say when a newer release is out
+}
+
+// releaseAsset returns the name of this platform's binary in a release
+func releaseAsset() string {
+	name := "checkin-" + runtime.GOOS + "-" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// newerVersion reports whether release a is newer than b, comparing dotted
+// numbers such as 1.10.2. A dev build is older than any release.
+func newerVersion(a, b string) bool {
+	if b == "dev" {
+		return a != "dev"
+	}
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
+
+// fetchRelease downloads one file from the release server
+func fetchRelease(settings updateConfig, path string) ([]byte, error) {
+	client := http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(strings.TrimSuffix(settings.URL, "/") + "/" + path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", path, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// latestRelease returns the release server's latest version
+func latestRelease(settings updateConfig) (string, error) {
+	if settings.URL == "" {
+		return "", fmt.Errorf("the config file has no update url")
+	}
+	data, err := fetchRelease(settings, "latest")
+	if err != nil {
+		return "", err
+	}
+	latest := strings.TrimSpace(string(data))
+	if latest == "" || strings.ContainsAny(latest, "/\\ ") {
+		return "", fmt.Errorf("the release server's latest version %q is not a version", latest)
+	}
+	return latest, nil
+}
+
+// verifySignature checks a detached signature made by signFiles with the
+// PEM public key at keyFile
+func verifySignature(keyFile string, contents, signature []byte) error {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("%s does not contain a PEM public key", keyFile)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", keyFile, err)
+	}
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, contents, signature) {
+			return fmt.Errorf("the signature does not match %s", keyFile)
+		}
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(contents)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("the signature does not match %s", keyFile)
+		}
+	default:
+		return fmt.Errorf("%s must hold an Ed25519 or RSA key", keyFile)
+	}
+	return nil
+}
+
+// releaseChecksum returns the SHA-256 digest SHA256SUMS lists for a file
+func releaseChecksum(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("SHA256SUMS has no checksum for %s", name)
+}
+
+// releaseVersion returns the version SHA256SUMS names in its version line
+func releaseVersion(sums []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "version" {
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("SHA256SUMS has no version line")
+}
+
+// runUpdateMode replaces this binary with the latest release for the
+// platform when it is newer. SHA256SUMS must carry a valid signature from the
+// configured public key and name the version being installed, so an older
+// signed release copied under a newer version number is refused, and the
+// download must match its checksum before the binary is replaced; the
+// previous binary is kept as <binary>.previous to go back to.
+func runUpdateMode(settings updateConfig) {
+	if settings.PublicKeyFile == "" {
+		fmt.Println("Error updating: the config file's update section has no public_key_file to check releases with.")
+		return
+	}
+	latest, err := latestRelease(settings)
+	if err != nil {
+		fmt.Println("Error checking for updates:", err)
+		return
+	}
+	if !newerVersion(latest, version) {
+		fmt.Printf("Already up to date (version %s, latest release %s).\n", version, latest)
+		return
+	}
+	asset := releaseAsset()
+	fmt.Printf("Updating from version %s to %s (%s)...\n", version, latest, asset)
+
+	sums, err := fetchRelease(settings, latest+"/SHA256SUMS")
+	if err != nil {
+		fmt.Println("Error updating:", err)
+		return
+	}
+	signature, err := fetchRelease(settings, latest+"/SHA256SUMS.sig")
+	if err != nil {
+		fmt.Println("Error updating:", err)
+		return
+	}
+	if err := verifySignature(settings.PublicKeyFile, sums, signature); err != nil {
+		fmt.Println("Error updating, SHA256SUMS is not signed by the release key:", err)
+		return
+	}
+	if signed, err := releaseVersion(sums); err != nil {
+		fmt.Println("Error updating:", err)
+		return
+	} else if signed != latest {
+		fmt.Printf("Error updating: the release server's latest version is %s, but its signed SHA256SUMS is for %s.\n", latest, signed)
+		return
+	}
+	want, err := releaseChecksum(sums, asset)
+	if err != nil {
+		fmt.Println("Error updating:", err)
+		return
+	}
+	binary, err := fetchRelease(settings, latest+"/"+asset)
+	if err != nil {
+		fmt.Println("Error updating:", err)
+		return
+	}
+	sum := sha256.Sum256(binary)
+	if hex.EncodeToString(sum[:]) != want {
+		fmt.Println("Error updating: the downloaded", asset, "does not match its checksum in SHA256SUMS.")
+		return
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		fmt.Println("Error finding this binary:", err)
+		return
+	}
+	// Written next to the binary so the rename replacing it stays on one
+	// disk, and the running binary is moved aside first, which Windows
+	// allows where replacing it isn't
+	next := exe + ".next"
+	if err := os.WriteFile(next, binary, 0755); err != nil {
+		fmt.Println("Error updating:", err)
+		return
+	}
+	os.Remove(exe + ".previous")
+	if err := os.Rename(exe, exe+".previous"); err != nil {
+		os.Remove(next)
+		fmt.Println("Error updating:", err)
+		return
+	}
+	if err := os.Rename(next, exe); err != nil {
+		os.Rename(exe+".previous", exe)
+		os.Remove(next)
+		fmt.Println("Error updating:", err)
+		return
+	}
+	fmt.Printf("Updated %s to version %s; the previous version is kept as %s. Restart running stations to use it.\n", exe, latest, exe+".previous")
+}
+
+// checkForUpdate says when the release server has a newer version, for the
+// startup check. Failures are left quiet, as stations are often offline.
+func checkForUpdate(settings updateConfig) {
+	latest, err := latestRelease(settings)
+	if err != nil || !newerVersion(latest, version) {
+		return
+	}
+	fmt.Printf("A newer version, %s, is available (this is %s). Run -update to install it.\n", latest, version)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// uploadExports copies the export files to each named destination configured
+// in the config file, tracing each upload under parent
+func uploadExports(cfg config, destinations []string, files []string, parent *span) error {
+	for _, destination := range destinations {
+		upload := startSpan("upload "+destination, spanClient, parent)
+		var err error
+		switch destination {
+		case "sftp":
+			err = uploadSFTP(cfg.SFTP, files)
+		case "drive":
+			err = uploadDrive(cfg.Drive, files)
+		case "share":
+			err = uploadShare(cfg.Share, files)
+		default:
+			err = fmt.Errorf("unknown upload destination %q", destination)
+		}
+		upload.finish(err)
+		if err != nil {
+			return fmt.Errorf("%s: %w", destination, err)
+		}
+		fmt.Printf("Uploaded %s to %s\n", strings.Join(files, ", "), destination)
+	}
+	return nil
+}
+
+// uploadSFTP uploads the files with the system sftp client in batch mode, so
+// authentication must not need a password prompt
+func uploadSFTP(settings sftpConfig, files []string) error {
+	if settings.Host == "" || settings.User == "" {
+		return fmt.Errorf("sftp host and user must be set in the config file")
+	}
+
+	args := []string{"-b", "-", "-o", "BatchMode=yes"}
+	if settings.Port != 0 {
+		args = append(args, "-P", strconv.Itoa(settings.Port))
+	}
+	if settings.KeyFile != "" {
+		args = append(args, "-i", settings.KeyFile)
+	}
+	if settings.KnownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+settings.KnownHostsFile)
+	}
+	args = append(args, settings.User+"@"+settings.Host)
+
+	// Upload under a temporary name and rename once complete so the
+	// server's import jobs never pick up a partial file
+	var batch strings.Builder
+	for _, file := range files {
+		name := filepath.Base(file)
+		remote := path.Join(settings.RemoteDir, name)
+		fmt.Fprintf(&batch, "put %s %s\n", sftpQuote(file), sftpQuote(remote+".part"))
+		fmt.Fprintf(&batch, "-rm %s\n", sftpQuote(remote))
+		fmt.Fprintf(&batch, "rename %s %s\n", sftpQuote(remote+".part"), sftpQuote(remote))
+	}
+
+	cmd := exec.Command("sftp", args...)
+	cmd.Stdin = strings.NewReader(batch.String())
+	var stderr bytes.Buffer
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// sftpQuote quotes a path for an sftp batch file
+func sftpQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// firstVisitTag tags the record of an ID's first check-in ever, so
+// -tags=first_visit exports the new visitors
+const firstVisitTag = "first_visit"
+
+// defaultMilestones are the visit counts celebrated when the config doesn't
+// list any
+var defaultMilestones = []int{10, 50, 100}
+
+// milestoneTag returns the tag on the check-in reaching a milestone, e.g.
+// milestone_50
+func milestoneTag(visits int) string {
+	return "milestone_" + strconv.Itoa(visits)
+}
+
+// visitHistory holds the dates (YYYY-MM-DD) each ID checked in on. A visit
+// is a day with a check-in, however many times the ID came and went.
+type visitHistory map[string]map[string]bool
+
+// loadVisitHistory reads every check-in, archived records included
+func loadVisitHistory() (visitHistory, error) {
+	history := make(visitHistory)
+	file, err := openRecords(true)
+	if os.IsNotExist(err) {
+		return history, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	records, _, _ := readRecords(file)
+	for _, record := range records {
+		if recordDirection(record) == "in" {
+			history.add(record[1], record[0][:10])
+		}
+	}
+	return history, nil
+}
+
+// followBadges adds the visits made with reissued badges to their holders'
+// current badges, so a new badge keeps the person's visit count
+func (h visitHistory) followBadges(holders map[string]string) {
+	if h == nil {
+		return
+	}
+	for id, current := range holders {
+		for date := range h[id] {
+			h.add(current, date)
+		}
+	}
+}
+
+// add records a check-in of the ID on the date and returns whether it was
+// the ID's first that day
+func (h visitHistory) add(id, date string) bool {
+	if h[id] == nil {
+		h[id] = make(map[string]bool)
+	}
+	if h[id][date] {
+		return false
+	}
+	h[id][date] = true
+	return true
+}
+
+// first returns the date of the ID's first visit, or "" for none
+func (h visitHistory) first(id string) string {
+	first := ""
+	for date := range h[id] {
+		if first == "" || date < first {
+			first = date
+		}
+	}
+	return first
+}
+
+// visitsThrough returns how many visits the ID made up to and including date
+func (h visitHistory) visitsThrough(id, date string) int {
+	n := 0
+	for day := range h[id] {
+		if day <= date {
+			n++
+		}
+	}
+	return n
+}
+
+// visitorCounts counts the IDs checking in on a date that had never checked
+// in before it and those returning
+func (h visitHistory) visitorCounts(records [][]string, date string) (newcomers, returning int) {
+	counted := make(map[string]bool)
+	for _, record := range records {
+		if record[0][:10] != date || recordDirection(record) != "in" || counted[record[1]] {
+			continue
+		}
+		counted[record[1]] = true
+		if h.first(record[1]) == date {
+			newcomers++
+		} else {
+			returning++
+		}
+	}
+	return newcomers, returning
+}
+
+// milestonesOn returns the IDs whose visit on a date reached one of the
+// milestones, with the visit count, sorted by ID
+func (h visitHistory) milestonesOn(records [][]string, date string, milestones []int) ([]string, map[string]int) {
+	counts := make(map[string]int)
+	var ids []string
+	for _, record := range records {
+		id := record[1]
+		if _, done := counts[id]; done || record[0][:10] != date || recordDirection(record) != "in" {
+			continue
+		}
+		counts[id] = h.visitsThrough(id, date)
+		if containsInt(milestones, counts[id]) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, counts
+}
+
+// isFirstVisit reports whether a check-in of the ID now is its first ever,
+// from the history loaded when scan mode started and the records other
+// stations appended since. A nil history, after it failed to load, never
+// reports one.
+func isFirstVisit(history visitHistory, state *scanState, id string) bool {
+	if history == nil || len(history[id]) > 0 {
+		return false
+	}
+	_, ok := state.LastSeen[id+" in"]
+	return !ok
+}
+
+// milestone records a check-in of the ID on the date in the history and
+// returns the visit count when it reaches one of the milestones, or 0. A
+// check-in another station already recorded today counts that visit, so it
+// isn't celebrated twice.
+func milestone(history visitHistory, state *scanState, milestones []int, id, date string) int {
+	if history == nil {
+		return 0
+	}
+	if latest := state.LastSeen[id+" in"]; len(latest) >= 10 && latest[:10] == date {
+		history.add(id, date)
+	}
+	if !history.add(id, date) {
+		return 0
+	}
+	if n := len(history[id]); containsInt(milestones, n) {
+		return n
+	}
+	return 0
+}
+
+// milestones returns the visit counts celebrated at check-in
+func (cfg config) milestones() []int {
+	if len(cfg.Milestones) == 0 {
+		return defaultMilestones
+	}
+	return cfg.Milestones
+}
+
+// containsInt reports whether list contains n
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMilestones validates the configured milestone visit counts
+func checkMilestones(milestones []int) error {
+	for _, n := range milestones {
+		if n < 1 {
+			return fmt.Errorf("milestones must be visit counts of 1 or more, not %d", n)
+		}
+	}
+	return nil
+}
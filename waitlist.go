@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// waitlistEntry is someone waiting for a place, in the order they scanned
+type waitlistEntry struct {
+	ID    string    `json:"id"`
+	Name  string    `json:"name,omitempty"`
+	Since time.Time `json:"since"`
+}
+
+// waitlistState is today's waitlist: who is waiting in order, and who was
+// last admitted from it
+type waitlistState struct {
+	Waiting      []waitlistEntry `json:"waiting"`
+	LastAdmitted *waitlistEntry  `json:"last_admitted,omitempty"` // Since is when they were admitted
+}
+
+// waitlistFile returns the waitlist log next to the data file, whose rows
+// are timestamp,id,event with event waiting or admitted
+func waitlistFile() string {
+	return sidecarFile("waitlist")
+}
+
+// loadWaitlist reads today's waitlist from the log. Entries from earlier
+// days are dropped, as everyone has gone home.
+func loadWaitlist(roster map[string]rosterEntry, now time.Time) (waitlistState, error) {
+	var state waitlistState
+	file, err := os.Open(waitlistFile())
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return state, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return state, err
+	}
+	today := now.Format("2006-01-02")
+	// Everyone who joined, in order, with who is still waiting since when
+	var order []waitlistEntry
+	waiting := make(map[string]time.Time)
+	for _, row := range rows {
+		if len(row) < 3 {
+			continue
+		}
+		t, err := time.Parse("2006-01-02T15:04:05-07:00", row[0])
+		if err != nil || t.In(now.Location()).Format("2006-01-02") != today {
+			continue
+		}
+		switch row[2] {
+		case "waiting":
+			if _, ok := waiting[row[1]]; !ok {
+				waiting[row[1]] = t
+				order = append(order, waitlistEntry{ID: row[1], Since: t})
+			}
+		case "admitted":
+			delete(waiting, row[1])
+			state.LastAdmitted = &waitlistEntry{ID: row[1], Name: rosterName(roster, row[1]), Since: t}
+		}
+	}
+	for _, entry := range order {
+		if since, ok := waiting[entry.ID]; ok && since.Equal(entry.Since) {
+			entry.Name = rosterName(roster, entry.ID)
+			state.Waiting = append(state.Waiting, entry)
+		}
+	}
+	return state, nil
+}
+
+// position returns someone's place on the waitlist starting at 1, or 0 if
+// they aren't waiting
+func (state waitlistState) position(id string) int {
+	for i, entry := range state.Waiting {
+		if entry.ID == id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// logWaitlist appends an event for an ID to the waitlist log
+func logWaitlist(id, event string, now time.Time) error {
+	return appendCSV(waitlistFile(), []string{now.Format("2006-01-02T15:04:05-07:00"), id, event})
+}
+
+// joinWaitlist puts an ID on the waitlist instead of checking it in when
+// every place is taken, or when others are waiting ahead of it for the places
+// that are free, and reports whether it did. file is the data file scan mode
+// records to and extra the unrecorded dry run scans.
+func (options scanOptions) joinWaitlist(file *os.File, extra [][]string, id string, now time.Time) bool {
+	if options.Direction != "in" || !options.Capacity.Waitlist || options.Capacity.Max <= 0 {
+		return false
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		options.logError("Error seeking to beginning of file", err)
+		return false
+	}
+	records, _, _ := readRecords(file)
+	present := presentIDs(append(records, extra...), now)
+	if _, inside := present[id]; inside {
+		return false
+	}
+	state, err := loadWaitlist(options.Roster, now)
+	if err != nil {
+		options.logError("Error reading waitlist", err)
+		return false
+	}
+	free := options.Capacity.Max - len(present)
+	position := state.position(id)
+	if position == 0 && free > len(state.Waiting) || position > 0 && position <= free {
+		return false
+	}
+
+	if position == 0 {
+		position = len(state.Waiting) + 1
+		if !options.DryRun {
+			if err := logWaitlist(id, "waiting", now); err != nil {
+				options.logError("Error writing waitlist", err)
+				return false
+			}
+		}
+	}
+	options.announce(announceWarning, fmt.Sprintf("Full: all %d places are taken. Not checked in; number %d on the waitlist.", options.Capacity.Max, position),
+		fmt.Sprintf("This session is full. You are number %d on the waitlist. Please wait to be called.", position))
+	playSound(options.SoundCommand, options.Theme.DuplicateSound)
+	return true
+}
+
+// leaveWaitlist marks an ID admitted once it is checked in, if it was waiting
+func (options scanOptions) leaveWaitlist(id string, now time.Time) {
+	if !options.Capacity.Waitlist || options.DryRun {
+		return
+	}
+	state, err := loadWaitlist(options.Roster, now)
+	if err != nil {
+		options.logError("Error reading waitlist", err)
+		return
+	}
+	if state.position(id) > 0 {
+		if err := logWaitlist(id, "admitted", now); err != nil {
+			options.logError("Error writing waitlist", err)
+		}
+	}
+}
+
+// runWaitlistMode prints who is waiting for a place, in order
+func runWaitlistMode(rosterFile string) {
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+	now := time.Now()
+	state, err := loadWaitlist(roster, now)
+	if err != nil {
+		fmt.Println("Error reading waitlist:", err)
+		return
+	}
+
+	fmt.Printf("Waiting: %d\n", len(state.Waiting))
+	for i, entry := range state.Waiting {
+		name := entry.Name
+		if name == "" {
+			name = "(not on roster)"
+		}
+		waited := "under a minute"
+		if now.Sub(entry.Since) >= time.Minute {
+			waited = humanDuration(now.Sub(entry.Since).Truncate(time.Minute))
+		}
+		fmt.Printf("  %2d. %s  %-12s %s (waiting %s)\n", i+1, entry.Since.Format("15:04"), entry.ID, name, waited)
+	}
+	if last := state.LastAdmitted; last != nil {
+		fmt.Printf("Last admitted: %s %s at %s\n", last.ID, last.Name, last.Since.Format("15:04"))
+	}
+}
+
+// runAdmitNextMode checks in the first person on the waitlist, marks them
+// admitted and posts to the capacity webhook so the desk and dashboards know
+// who to call forward
+func runAdmitNextMode(rosterFile string, cfg config, integrityKey []byte) {
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+	now := time.Now()
+	state, err := loadWaitlist(roster, now)
+	if err != nil {
+		fmt.Println("Error reading waitlist:", err)
+		return
+	}
+	if len(state.Waiting) == 0 {
+		fmt.Println("No one is waiting.")
+		return
+	}
+	next := state.Waiting[0]
+
+	record, err := appendCheckIn(next.ID, now, roster, cfg.TypePrefixes, integrityKey)
+	if err != nil {
+		fmt.Println("Error writing to CSV:", err)
+		return
+	}
+	if err := logOrigin(record, "", "", "waitlist"); err != nil {
+		fmt.Println("Error writing origins file:", err)
+	}
+	if err := logWaitlist(next.ID, "admitted", now); err != nil {
+		fmt.Println("Error writing waitlist:", err)
+		return
+	}
+	name := next.Name
+	if name == "" {
+		name = "ID " + next.ID
+	}
+	fmt.Printf("Admitted %s from the waitlist: %v\n", name, record)
+	fmt.Printf("Still waiting: %d\n", len(state.Waiting)-1)
+
+	capacity := newCapacityMonitor(cfg.Capacity)
+	capacity.notify(fmt.Sprintf("Now admitting %s from the waitlist (%d still waiting).", name, len(state.Waiting)-1))
+	outbox.wait()
+}
+
+// appendCheckIn records a check-in for an ID at t to the current data file,
+// numbered after the highest count of its type that day, and returns the
+// record
+func appendCheckIn(id string, t time.Time, roster map[string]rosterEntry, typePrefixes map[string]string, integrityKey []byte) ([]string, error) {
+	var records [][]string
+	file, err := openDataFiles()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	} else if err == nil {
+		records, _, _ = readRecords(file)
+		file.Close()
+	}
+
+	admitted := Record{Timestamp: t, BadgeID: id, Direction: "in", Type: deriveType(id, roster, typePrefixes), ScanID: newScanID()}
+	admitted.Seq = nextDailyCount(records, t.Format("2006-01-02"), admitted.Type)
+	record := admitted.Fields()
+	if integrityKey != nil {
+		previous, err := lastChecksum()
+		if err != nil {
+			return nil, err
+		}
+		if len(record) == 3 {
+			record = append(record, "")
+		}
+		record[3] = recordChecksum(integrityKey, previous, record)
+	}
+	return record, appendRecord(currentDataFile(), record)
+}
+
+// handleWaitlist returns today's waitlist as JSON for dashboards
+func handleWaitlist(w http.ResponseWriter, r *http.Request, rosterFile string) {
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		http.Error(w, "error reading roster", http.StatusInternalServerError)
+		return
+	}
+	state, err := loadWaitlist(roster, time.Now())
+	if err != nil {
+		http.Error(w, "error reading waitlist", http.StatusInternalServerError)
+		return
+	}
+	if state.Waiting == nil {
+		state.Waiting = []waitlistEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(state)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// waiverConfig is the config file's "waivers" section. A member has signed
+// when the roster's waiver column holds the date they signed (or yes), or
+// when -sign-waiver recorded it in the waivers file.
+type waiverConfig struct {
+	Enforce  string   `json:"enforce"`   // "warn" flags check-ins without a waiver, "block" refuses them; empty for neither
+	Types    []string `json:"types"`     // record types that need a waiver; empty for all
+	Column   string   `json:"column"`    // roster column; default waiver
+	File     string   `json:"file"`      // defaults to waivers.csv
+	ValidFor duration `json:"valid_for"` // how long a dated waiver lasts, e.g. "8760h"; default forever
+	TextFile string   `json:"text_file"` // the waiver the /kiosk page asks people to sign
+}
+
+// path returns the waivers file
+func (settings waiverConfig) path() string {
+	if settings.File == "" {
+		return "waivers.csv"
+	}
+	return settings.File
+}
+
+// required reports whether records of the type need a waiver
+func (settings waiverConfig) required(recordType string) bool {
+	return len(settings.Types) == 0 || contains(settings.Types, recordType)
+}
+
+// loadWaivers reads the waivers file, whose rows are
+// id,signed_date,recorded_at followed by the signature's details for waivers
+// signed at the kiosk, returning the latest date each ID signed. A
+// missing file means no waivers.
+func loadWaivers(path string) (map[string]string, error) {
+	waivers := make(map[string]string)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return waivers, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if len(row) >= 2 && row[1] > waivers[row[0]] {
+			waivers[row[0]] = row[1]
+		}
+	}
+	return waivers, nil
+}
+
+// waiverProblem returns why an ID, with its roster entry if it has one, has
+// no valid waiver at a time, such as "no signed waiver" or "waiver expired
+// 2026-03-01", or an empty string when it has one
+func (settings waiverConfig) waiverProblem(id string, entry rosterEntry, waivers map[string]string, now time.Time) string {
+	column := settings.Column
+	if column == "" {
+		column = "waiver"
+	}
+	signed := strings.TrimSpace(entry.Fields[strings.ToLower(column)])
+	switch strings.ToLower(signed) {
+	case "yes", "true", "signed":
+		return ""
+	case "", "no", "false":
+		signed = ""
+	}
+	if stored := waivers[id]; stored > signed {
+		signed = stored
+	}
+	if signed == "" {
+		return "no signed waiver"
+	}
+	date, err := time.ParseInLocation("2006-01-02", signed, time.Local)
+	if err != nil {
+		return fmt.Sprintf("unreadable waiver date %q", signed)
+	}
+	if settings.ValidFor > 0 {
+		if expires := date.Add(time.Duration(settings.ValidFor)); !now.Before(expires) {
+			return "waiver expired " + expires.Format("2006-01-02")
+		}
+	}
+	return ""
+}
+
+// runSignWaiverMode records that the IDs signed a waiver on date
+// (YYYY-MM-DD)
+func runSignWaiverMode(settings waiverConfig, ids []string, date string) {
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		fmt.Println("Error parsing waiver date:", err)
+		return
+	}
+	now := time.Now().Format("2006-01-02T15:04:05-07:00")
+	for _, id := range ids {
+		if err := appendCSV(settings.path(), []string{id, date, now}); err != nil {
+			fmt.Println("Error writing waivers file:", err)
+			return
+		}
+		fmt.Printf("Recorded the waiver %s signed on %s.\n", id, date)
+	}
+}
+
+// runMissingWaiversMode lists the roster members needing a waiver who have
+// no valid one today, and saves the list as CSV in dir
+func runMissingWaiversMode(settings waiverConfig, rosterFile string, typePrefixes map[string]string, dir string) {
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+	waivers, err := loadWaivers(settings.path())
+	if err != nil {
+		fmt.Println("Error reading waivers file:", err)
+		return
+	}
+
+	var ids []string
+	for id := range roster {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	now := time.Now()
+	rows := [][]string{{"id", "name", "type", "problem"}}
+	for _, id := range ids {
+		entry := roster[id]
+		t := deriveType(id, roster, typePrefixes)
+		if !rosterActive(entry) || !settings.required(t) {
+			continue
+		}
+		if problem := settings.waiverProblem(id, entry, waivers, now); problem != "" {
+			rows = append(rows, []string{id, entry.Name, t, problem})
+			fmt.Printf("  %-12s %-28s %-10s %s\n", id, entry.Name, t, problem)
+		}
+	}
+	if len(rows) == 1 {
+		fmt.Println("Every member who needs a waiver has signed one.")
+		return
+	}
+	fmt.Printf("\n%d members have no valid waiver.\n", len(rows)-1)
+
+	filename := "missing_waivers_" + now.Format("2006-01-02") + ".csv"
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Println("Error saving waiver report:", err)
+			return
+		}
+		filename = filepath.Join(dir, filename)
+	}
+	if err := writeCSVExport(filename, rows, false); err != nil {
+		fmt.Println("Error saving waiver report:", err)
+		return
+	}
+	fmt.Println("\nSaved to", filename)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	watchInterval = 2 * time.Second
+	watchRecent   = 10
+
+	watchGoalsInterval = 30 * time.Second
+)
+
+// runWatchMode tails the data file and redraws today's count, the recent
+// arrival rate and the latest entries whenever the file changes. It is meant
+// for watching a station from another terminal, e.g. over SSH. A positive
+// maxOccupancy flags when more people than that are inside. With waitlist set
+// it also shows how many are waiting and who was last admitted, and with
+// attendance goals the progress towards each in the current period. The
+// arrival rate is averaged over the arrival_rate window and flagged when it is
+// over the alert threshold.
+func runWatchMode(rosterFile string, maxOccupancy int, waitlist bool, goals []goalConfig, arrival arrivalRateConfig) {
+	roster, err := loadRoster(rosterFile)
+	if err != nil {
+		fmt.Println("Error loading roster:", err)
+		return
+	}
+
+	var offset int64
+	var watched string
+	var recent [][]string
+	arrivals := arrivalCounter{window: arrival.window()}
+	present := make(map[string]bool)
+	todayCount := 0
+	today := time.Now().Format("2006-01-02")
+
+	// Goals span weeks or months of records, so they are counted from the
+	// whole data file every watchGoalsInterval rather than on each redraw
+	var progress []goalProgress
+	var goalsCounted time.Time
+
+	for {
+		current := currentDataFile()
+		info, err := os.Stat(current)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Println("Error reading data file:", err)
+			return
+		}
+
+		// Start over when the file was rewritten or replaced by a
+		// maintenance command, or a new month's partition was started
+		if info == nil || info.Size() < offset || current != watched {
+			offset, recent, arrivals.times, todayCount = 0, nil, nil, 0
+			present = make(map[string]bool)
+			watched = current
+		}
+
+		if info != nil && info.Size() > offset {
+			records, read, err := readNewRecords(current, offset)
+			if err != nil {
+				fmt.Println("Error reading data file:", err)
+				return
+			}
+			offset += read
+
+			for _, record := range records {
+				if len(record) < 2 {
+					continue
+				}
+				recordTime, err := time.Parse("2006-01-02T15:04:05-07:00", record[0])
+				if err != nil {
+					continue
+				}
+				if recordTime.Format("2006-01-02") == today {
+					if recordDirection(record) == "out" {
+						delete(present, record[1])
+					} else {
+						todayCount++
+						present[record[1]] = true
+					}
+				}
+				if recordDirection(record) != "out" {
+					arrivals.add(recordTime)
+				}
+				recent = append(recent, record)
+				if len(recent) > watchRecent {
+					recent = recent[1:]
+				}
+			}
+		}
+
+		// Reset the count at midnight
+		now := time.Now()
+		if now.Format("2006-01-02") != today {
+			today = now.Format("2006-01-02")
+			todayCount = 0
+			present = make(map[string]bool)
+		}
+
+		rate := arrivals.rate(now)
+
+		fmt.Print("\033[H\033[2J")
+		label := ""
+		if testMode {
+			label = "  [TEST MODE]"
+		}
+		fmt.Printf("Watching %s  (%s)%s\n\n", currentDataFile(), now.Format("15:04:05"), label)
+		fmt.Printf("  Today:  %d check-ins\n", todayCount)
+		fmt.Printf("  Inside: %d people", len(present))
+		if maxOccupancy > 0 && len(present) > maxOccupancy {
+			fmt.Printf("  \033[1;97;41m OVER CAPACITY (limit %d) \033[0m", maxOccupancy)
+		}
+		fmt.Println()
+		if waitlist {
+			if state, err := loadWaitlist(roster, now); err == nil {
+				fmt.Printf("  Waiting: %d on the waitlist", len(state.Waiting))
+				if state.LastAdmitted != nil {
+					fmt.Printf("  (last admitted %s %s at %s)", state.LastAdmitted.ID, state.LastAdmitted.Name, state.LastAdmitted.Since.Format("15:04"))
+				}
+				fmt.Println()
+			}
+		}
+		if len(goals) > 0 && now.Sub(goalsCounted) >= watchGoalsInterval {
+			if counted, err := currentGoals(goals, now); err == nil {
+				progress, goalsCounted = counted, now
+			}
+		}
+		for i, goal := range progress {
+			label := "Goals:"
+			if i > 0 {
+				label = ""
+			}
+			fmt.Printf("  %-7s %s\n", label, goal)
+		}
+		fmt.Printf("  Rate:   %.1f check-ins/min over the last %d minutes", rate, int(arrivals.window.Minutes()))
+		if arrival.high(rate) {
+			fmt.Printf("  \033[1;30;43m BACKING UP (alert at %.1f/min) \033[0m", arrival.PerMinute)
+		}
+		fmt.Print("\n\n")
+		fmt.Println("  Recent entries:")
+		for i := len(recent) - 1; i >= 0; i-- {
+			record := recent[i]
+			fmt.Printf("    %s  %-3s %-12s %s\n", record[0], recordDirection(record), record[1], rosterName(roster, record[1]))
+		}
+		fmt.Println("\nPress Ctrl+C to stop.")
+
+		time.Sleep(watchInterval)
+	}
+}
+
+// readNewRecords reads the complete lines appended to the named data file
+// after offset and returns their records along with the number of bytes
+// consumed. A partially written last line is left for the next read.
+func readNewRecords(name string, offset int64) ([][]string, int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return nil, 0, nil
+	}
+	data = data[:end+1]
+
+	reader := newDataReader(bytes.NewReader(data))
+	var records [][]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, int64(len(data)), nil
+}
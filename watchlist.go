@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// watchListConfig is the config file's "watch_list" section: IDs whose
+// check-in staff want to hear about right away, such as a visiting board
+// member or a child with a custody alert
+type watchListConfig struct {
+	IDs     map[string]string `json:"ids"`     // reason by ID; a roster "watch" column flags IDs too
+	Sound   string            `json:"sound"`   // played with sound_command on a watch-list arrival
+	Webhook string            `json:"webhook"` // Slack-compatible incoming webhook URL
+	SMS     smsConfig         `json:"sms"`
+}
+
+// smsConfig is an SMS gateway taking form posts of To, From and Body with
+// basic authentication, as Twilio's Messages API does
+type smsConfig struct {
+	URL      string   `json:"url"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// watchNotifier sends watch-list arrival notifications in the background
+type watchNotifier struct {
+	settings watchListConfig
+}
+
+// newWatchNotifier returns a notifier for the settings
+func newWatchNotifier(settings watchListConfig) *watchNotifier {
+	return &watchNotifier{settings: settings}
+}
+
+// reason returns why an ID is on the watch list, from the config file or the
+// roster's "watch" column, and whether it is
+func (n *watchNotifier) reason(roster map[string]rosterEntry, id string) (string, bool) {
+	if reason, ok := n.settings.IDs[id]; ok {
+		return reason, true
+	}
+	if reason := strings.TrimSpace(roster[id].Fields["watch"]); reason != "" {
+		return reason, true
+	}
+	return "", false
+}
+
+// arrived checks a recorded check-in against the watch list. A flagged ID is
+// highlighted on screen and plays the watch-list sound, and unless it is a dry
+// run, staff are notified by webhook and SMS. The reason is only sent to
+// staff, never shown at the station.
+func (n *watchNotifier) arrived(options scanOptions, id string, now time.Time) {
+	reason, ok := n.reason(options.Roster, id)
+	if !ok {
+		return
+	}
+	name := rosterName(options.Roster, id)
+	if name == "" {
+		name = "ID " + id
+	}
+	text := "Watch list arrival: " + name + ". Please notify staff."
+	switch {
+	case options.jsonLogs():
+	case options.Accessibility == "plain":
+		fmt.Println(text)
+	default:
+		printBanner(announceWarning, text)
+	}
+	playSound(options.SoundCommand, n.settings.Sound)
+	if options.DryRun {
+		return
+	}
+
+	message := fmt.Sprintf("%s (%s) checked in at %s", name, id, now.Format("15:04"))
+	if options.Station != "" {
+		message += " at " + options.Station
+	}
+	if reason != "" {
+		message += ": " + reason
+	}
+	n.send("watch list webhook", func() (*http.Request, error) {
+		if n.settings.Webhook == "" {
+			return nil, nil
+		}
+		body, _ := json.Marshal(map[string]string{"text": message + "."})
+		req, err := http.NewRequest("POST", n.settings.Webhook, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		return req, err
+	})
+	for _, to := range n.settings.SMS.To {
+		n.send("watch list sms", func() (*http.Request, error) {
+			return n.settings.SMS.request(to, message+".")
+		})
+	}
+}
+
+// send builds one notification and sends it through the delivery queue so a
+// slow gateway never holds up the scan line and an outage never loses it. A
+// nil request means the channel isn't configured.
+func (n *watchNotifier) send(name string, build func() (*http.Request, error)) {
+	req, err := build()
+	if err != nil {
+		fmt.Println("Error sending watch list alert:", err)
+		return
+	}
+	if req == nil {
+		return
+	}
+	queueRequest(name, req)
+}